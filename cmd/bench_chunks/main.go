@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Measures download throughput for different --chunk-size values against a
+// localhost server, copying each body through a SHA256 hash with a fixed-size
+// buffer the same way the downloader does.
+func main() {
+	sizeMB := flag.Int("size", 512, "Payload size in MB")
+	rounds := flag.Int("rounds", 3, "Downloads per chunk size, the best one is reported")
+	flag.Parse()
+
+	payload := make([]byte, 4*1024*1024)
+	if _, err := rand.Read(payload); err != nil {
+		log.Fatal(err)
+	}
+	total := int64(*sizeMB) * 1024 * 1024
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(total))
+		for sent := int64(0); sent < total; {
+			n := int64(len(payload))
+			if total-sent < n {
+				n = total - sent
+			}
+			if _, err := w.Write(payload[:n]); err != nil {
+				return
+			}
+			sent += n
+		}
+	}))
+	url := "http://" + listener.Addr().String()
+
+	fmt.Printf("Downloading %d MB from %s, best of %d\n\n", *sizeMB, url, *rounds)
+	fmt.Printf("%-10s %12s\n", "chunk", "MB/s")
+	for _, chunk := range []int{4 << 10, 32 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20} {
+		best := time.Duration(0)
+		for i := 0; i < *rounds; i++ {
+			elapsed, err := download(url, chunk)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if best == 0 || elapsed < best {
+				best = elapsed
+			}
+		}
+		fmt.Printf("%-10s %12.1f\n", formatSize(int64(chunk)), float64(*sizeMB)/best.Seconds())
+	}
+}
+
+func download(url string, chunk int) (time.Duration, error) {
+	start := time.Now()
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	hash := sha256.New()
+	// Wrapping the body keeps io.CopyBuffer from bypassing the buffer
+	if _, err := io.CopyBuffer(io.MultiWriter(io.Discard, hash), struct{ io.Reader }{resp.Body}, make([]byte, chunk)); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.0f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Measures the bytes on the wire for a JSON-lines dataset shard with zstd, gzip
+// and no transfer encoding, against a localhost server that compresses like a
+// CDN would, and checks the SHA256 of the decoded body matches the original.
+func main() {
+	rows := flag.Int("rows", 200000, "JSON lines in the fixture")
+	flag.Parse()
+
+	fixture := makeFixture(*rows)
+	sum := sha256.Sum256(fixture)
+	expected := hex.EncodeToString(sum[:])
+
+	var gzipped, zstded bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&gzipped, gzip.DefaultCompression)
+	gz.Write(fixture)
+	gz.Close()
+	zw, _ := zstd.NewWriter(&zstded)
+	zw.Write(fixture)
+	zw.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var wire atomic.Int64
+	go http.Serve(&countingListener{Listener: listener, n: &wire}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch accept := r.Header.Get("Accept-Encoding"); {
+		case strings.Contains(accept, "zstd"):
+			w.Header().Set("Content-Encoding", "zstd")
+			w.Write(zstded.Bytes())
+		case strings.Contains(accept, "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipped.Bytes())
+		default:
+			w.Write(fixture)
+		}
+	}))
+	url := "http://" + listener.Addr().String()
+
+	fmt.Printf("Fixture: %d JSON lines, %s\n\n", *rows, formatSize(int64(len(fixture))))
+	fmt.Printf("%-14s %12s %10s %8s\n", "mode", "wire", "time", "sha256")
+	for _, mode := range []string{"no-compression", "gzip", "zstd"} {
+		wire.Store(0)
+		client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if mode != "no-compression" {
+			req.Header.Set("Accept-Encoding", mode)
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var body io.Reader = resp.Body
+		switch resp.Header.Get("Content-Encoding") {
+		case "gzip":
+			if body, err = gzip.NewReader(resp.Body); err != nil {
+				log.Fatal(err)
+			}
+		case "zstd":
+			dec, err := zstd.NewReader(resp.Body)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer dec.Close()
+			body = dec
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(hash, body); err != nil {
+			log.Fatal(err)
+		}
+		resp.Body.Close()
+		elapsed := time.Since(start)
+		client.CloseIdleConnections()
+
+		ok := hex.EncodeToString(hash.Sum(nil)) == expected
+		fmt.Printf("%-14s %12s %10s %8t\n", mode, formatSize(wire.Load()), elapsed.Round(time.Millisecond), ok)
+	}
+}
+
+// makeFixture builds a deterministic JSON-lines file shaped like a text dataset.
+func makeFixture(rows int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	words := strings.Fields("the model was trained on a large corpus of text and evaluated on several benchmarks with strong results across tasks")
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := 0; i < rows; i++ {
+		text := make([]string, 20+rng.Intn(40))
+		for j := range text {
+			text[j] = words[rng.Intn(len(words))]
+		}
+		encoder.Encode(map[string]interface{}{"id": i, "label": rng.Intn(5), "score": rng.Float64(), "text": strings.Join(text, " ")})
+	}
+	return buf.Bytes()
+}
+
+// countingListener counts the bytes the server writes.
+type countingListener struct {
+	net.Listener
+	n *atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, n: l.n}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
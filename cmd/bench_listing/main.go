@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Measures how long listing a many-folder repo tree takes for different
+// --prefetch-metadata values, against a localhost server that answers tree
+// requests after a fixed delay, walking the tree the same way the downloader
+// does: subfolders concurrently, with a bound on requests in flight.
+func main() {
+	folders := flag.Int("folders", 40, "Folders under each of the top-level folders")
+	top := flag.Int("top", 5, "Top-level folders")
+	files := flag.Int("files", 50, "Files per leaf folder")
+	latency := flag.Duration("latency", 50*time.Millisecond, "Delay before each tree response")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(*latency)
+		folder := strings.Trim(r.URL.Path, "/")
+		json.NewEncoder(w).Encode(treeEntries(folder, *top, *folders, *files))
+	}))
+	url := "http://" + listener.Addr().String()
+
+	total := *top * *folders * *files
+	fmt.Printf("Listing %d folders holding %d files, %s per request\n\n", 1+*top+*top**folders, total, *latency)
+	fmt.Printf("%-10s %10s %8s\n", "workers", "time", "files")
+	for _, workers := range []int{1, 2, 4, 8, 16, 32} {
+		start := time.Now()
+		listed, err := walk(url, "", make(chan struct{}, workers))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(listed) != total {
+			log.Fatalf("listed %d files, expected %d", len(listed), total)
+		}
+		fmt.Printf("%-10d %10s %8d\n", workers, time.Since(start).Round(time.Millisecond), len(listed))
+	}
+}
+
+type entry struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Size int    `json:"size"`
+}
+
+// treeEntries is the fixture: top-level folders of folders of files.
+func treeEntries(folder string, top, folders, files int) []entry {
+	var entries []entry
+	switch depth := strings.Count(folder, "/") + 1; {
+	case folder == "":
+		for i := 0; i < top; i++ {
+			entries = append(entries, entry{Type: "directory", Path: fmt.Sprintf("part-%d", i)})
+		}
+	case depth == 1:
+		for i := 0; i < folders; i++ {
+			entries = append(entries, entry{Type: "directory", Path: fmt.Sprintf("%s/shard-%d", folder, i)})
+		}
+	default:
+		for i := 0; i < files; i++ {
+			entries = append(entries, entry{Type: "file", Path: fmt.Sprintf("%s/%05d.parquet", folder, i), Size: 1024})
+		}
+	}
+	return entries
+}
+
+func walk(url, folder string, sem chan struct{}) ([]string, error) {
+	sem <- struct{}{}
+	resp, err := http.Get(url + "/" + folder)
+	if err != nil {
+		<-sem
+		return nil, err
+	}
+	var entries []entry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	<-sem
+	if err != nil {
+		return nil, err
+	}
+
+	var files, subfolders []string
+	for _, e := range entries {
+		if e.Type == "directory" {
+			subfolders = append(subfolders, e.Path)
+		} else {
+			files = append(files, e.Path)
+		}
+	}
+	listed := make([][]string, len(subfolders))
+	errs := make([]error, len(subfolders))
+	var wg sync.WaitGroup
+	for i, subfolder := range subfolders {
+		wg.Add(1)
+		go func(i int, subfolder string) {
+			defer wg.Done()
+			listed[i], errs[i] = walk(url, subfolder, sem)
+		}(i, subfolder)
+	}
+	wg.Wait()
+
+	var all []string
+	for i := range listed {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		all = append(all, listed[i]...)
+	}
+	return append(all, files...), nil
+}
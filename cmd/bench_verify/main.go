@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Compares hashing each file while it downloads, as the downloader does, with
+// writing it first and hashing it afterwards in a separate pool of verify
+// goroutines, against a localhost server. Both write every file to disk.
+func main() {
+	files := flag.Int("files", 16, "Number of files downloaded")
+	sizeMB := flag.Int("size", 256, "Size of each file in MB")
+	workers := flag.Int("workers", 4, "Concurrent downloads")
+	verifiers := flag.Int("verify-workers", 4, "Goroutines hashing finished files in the decoupled mode")
+	rounds := flag.Int("rounds", 3, "Runs per mode, the best one is reported")
+	dir := flag.String("dir", "", "Folder to write the files to, a temp folder when empty")
+	flag.Parse()
+
+	payload := make([]byte, 4*1024*1024)
+	if _, err := rand.Read(payload); err != nil {
+		log.Fatal(err)
+	}
+	total := int64(*sizeMB) * 1024 * 1024
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(total))
+		for sent := int64(0); sent < total; {
+			n := int64(len(payload))
+			if total-sent < n {
+				n = total - sent
+			}
+			if _, err := w.Write(payload[:n]); err != nil {
+				return
+			}
+			sent += n
+		}
+	}))
+	url := "http://" + listener.Addr().String()
+
+	if *dir == "" {
+		if *dir, err = os.MkdirTemp("", "bench-verify-*"); err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(*dir)
+	}
+
+	fmt.Printf("Downloading %d x %d MB with %d workers, best of %d\n\n", *files, *sizeMB, *workers, *rounds)
+	fmt.Printf("%-28s %12s\n", "mode", "MB/s")
+	for _, mode := range []struct {
+		name string
+		run  func() error
+	}{
+		{"inline", func() error { return inline(url, *dir, *files, *workers) }},
+		{fmt.Sprintf("decoupled (%d verifiers)", *verifiers), func() error { return decoupled(url, *dir, *files, *workers, *verifiers) }},
+	} {
+		best := time.Duration(0)
+		for i := 0; i < *rounds; i++ {
+			start := time.Now()
+			if err := mode.run(); err != nil {
+				log.Fatal(err)
+			}
+			if elapsed := time.Since(start); best == 0 || elapsed < best {
+				best = elapsed
+			}
+		}
+		fmt.Printf("%-28s %12.1f\n", mode.name, float64(*files**sizeMB)/best.Seconds())
+	}
+}
+
+// inline hashes each body as it is written, on the download goroutine.
+func inline(url, dir string, files, workers int) error {
+	return forEach(files, workers, func(i int) error {
+		_, err := fetch(url, filepath.Join(dir, fmt.Sprint(i)), true)
+		return err
+	})
+}
+
+// decoupled writes each body, then hands the file to the verify pool, which
+// reads it back to hash it while the download goroutine moves on.
+func decoupled(url, dir string, files, workers, verifiers int) error {
+	paths := make(chan string, files)
+	var verifyErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < verifiers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if err := hashFile(path); err != nil {
+					mu.Lock()
+					verifyErr = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	err := forEach(files, workers, func(i int) error {
+		path := filepath.Join(dir, fmt.Sprint(i))
+		if _, err := fetch(url, path, false); err != nil {
+			return err
+		}
+		paths <- path
+		return nil
+	})
+	close(paths)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+func forEach(n, workers int, do func(i int) error) error {
+	jobs := make(chan int, n)
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := do(i); err != nil {
+					mu.Lock()
+					firstErr = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func fetch(url, path string, hashInline bool) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	var w io.Writer = out
+	hash := sha256.New()
+	if hashInline {
+		w = io.MultiWriter(out, hash)
+	}
+	if _, err := io.CopyBuffer(w, struct{ io.Reader }{resp.Body}, make([]byte, 32*1024)); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), out.Close()
+}
+
+func hashFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(sha256.New(), f)
+	return err
+}
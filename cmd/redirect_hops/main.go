@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Prints the redirect chain of a HuggingFace resolve URL with and without
+// ?download=true, to compare how many hops each takes before the data arrives.
+//
+//	go run ./cmd/redirect_hops https://huggingface.co/gpt2/resolve/main/model.safetensors
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: redirect_hops <resolve-url>")
+	}
+	base := strings.SplitN(os.Args[1], "?", 2)[0]
+	token := os.Getenv("HF_TOKEN")
+
+	for _, link := range []string{base, base + "?download=true"} {
+		hops, elapsed, disposition, err := follow(link, token)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s\n", link)
+		for i, hop := range hops {
+			fmt.Printf("  %d. %s\n", i+1, hop)
+		}
+		fmt.Printf("  %d redirect(s) in %s, Content-Disposition: %q\n\n", len(hops)-1, elapsed.Round(time.Millisecond), disposition)
+	}
+}
+
+func follow(link string, token string) ([]string, time.Duration, string, error) {
+	hops := []string{link}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			hops = append(hops, req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	req.Header.Set("Range", "bytes=0-0") // only the chain matters, not the data
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	resp.Body.Close()
+	return hops, time.Since(start), resp.Header.Get("Content-Disposition"), nil
+}
@@ -1,6 +1,6 @@
 module github.com/bodaay/HuggingFaceModelDownloader
 
-go 1.20
+go 1.22
 
 require (
 	github.com/aws/aws-sdk-go-v2 v1.25.3
@@ -9,11 +9,16 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.51.4
 	github.com/fatih/color v1.16.0
 	github.com/joho/godotenv v1.5.1
+	github.com/klauspost/compress v1.18.0
 	github.com/schollz/progressbar/v3 v3.14.1
 	github.com/spf13/cobra v1.7.0
+	golang.org/x/oauth2 v0.20.0
+	golang.org/x/sys v0.16.0
+	golang.org/x/term v0.14.0
 )
 
 require (
+	cloud.google.com/go/compute/metadata v0.3.0 // indirect
 	github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream v1.6.1 // indirect
 	github.com/aws/aws-sdk-go-v2/feature/ec2/imds v1.15.3 // indirect
 	github.com/aws/aws-sdk-go-v2/internal/configsources v1.3.3 // indirect
@@ -34,6 +39,4 @@ require (
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/sys v0.16.0 // indirect
-	golang.org/x/term v0.14.0 // indirect
 )
@@ -0,0 +1,121 @@
+package hfdownloader
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	adaptiveStart    = 4               // workers an adaptive download starts with
+	adaptiveInterval = 5 * time.Second // how often throughput is measured
+	throttleBurst    = 3               // 429/503 responses within an interval that halve the workers
+)
+
+// adaptiveLimiter sizes the worker pool AIMD style: one more active worker each
+// interval throughput improved, half as many after a burst of throttled
+// responses. Workers above the limit park before taking their next file.
+type adaptiveLimiter struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	limit     int
+	max       int
+	throttles int
+	closed    bool
+	bytes     atomic.Int64
+	d         *Downloader
+}
+
+func (d *Downloader) newAdaptiveLimiter(max int) *adaptiveLimiter {
+	l := &adaptiveLimiter{limit: adaptiveStart, max: max, d: d}
+	if l.limit > max {
+		l.limit = max
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// wait blocks worker workerID while it is above the limit. It returns false if
+// the limiter was closed while the worker was parked, which should then exit and
+// leave the remaining files to the active workers.
+func (l *adaptiveLimiter) wait(workerID int) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for workerID >= l.limit {
+		if l.closed {
+			return false
+		}
+		l.cond.Wait()
+	}
+	return true
+}
+
+// throttled records a 429 or 503 response, halving the limit on a burst.
+func (l *adaptiveLimiter) throttled() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.throttles++
+	if l.throttles < throttleBurst || l.limit == 1 {
+		return
+	}
+	l.limit /= 2
+	l.throttles = 0
+	l.d.logf("🐢 Server is throttling, reducing concurrency to %d workers\n", l.limit)
+}
+
+// counter is where downloads add the bytes they read, nil when not adaptive.
+func (l *adaptiveLimiter) counter() *atomic.Int64 {
+	if l == nil {
+		return nil
+	}
+	return &l.bytes
+}
+
+// current returns the number of active workers.
+func (l *adaptiveLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// run raises the limit while throughput keeps improving, until stop is closed.
+func (l *adaptiveLimiter) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(adaptiveInterval)
+	defer ticker.Stop()
+
+	var last int64
+	for {
+		select {
+		case <-ticker.C:
+			throughput := l.bytes.Swap(0)
+			l.mu.Lock()
+			if l.throttles == 0 && throughput > last && l.limit < l.max {
+				l.limit++
+				l.cond.Broadcast()
+				l.d.logf("📈 Throughput improving, raising concurrency to %d workers\n", l.limit)
+			}
+			l.throttles = 0
+			l.mu.Unlock()
+			last = throughput
+		case <-stop:
+			return
+		}
+	}
+}
+
+// close releases every parked worker once no more files will be queued.
+func (l *adaptiveLimiter) close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.closed = true
+	l.cond.Broadcast()
+	l.mu.Unlock()
+}
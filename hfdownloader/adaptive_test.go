@@ -0,0 +1,79 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiterHalvesOnThrottling(t *testing.T) {
+	l := NewDownloader(WithOutput(io.Discard)).newAdaptiveLimiter(16)
+	if got := l.current(); got != adaptiveStart {
+		t.Fatalf("starts with %d workers, want %d", got, adaptiveStart)
+	}
+	for i := 0; i < throttleBurst-1; i++ {
+		l.throttled()
+	}
+	if got := l.current(); got != adaptiveStart {
+		t.Fatalf("%d workers before a full burst, want %d", got, adaptiveStart)
+	}
+	l.throttled()
+	if got := l.current(); got != adaptiveStart/2 {
+		t.Fatalf("%d workers after a burst, want %d", got, adaptiveStart/2)
+	}
+	for i := 0; i < 4*throttleBurst; i++ {
+		l.throttled()
+	}
+	if got := l.current(); got != 1 {
+		t.Fatalf("%d workers, want at least 1 left", got)
+	}
+
+	if got := NewDownloader().newAdaptiveLimiter(2).current(); got != 2 {
+		t.Fatalf("starts with %d workers, want the ceiling of 2", got)
+	}
+}
+
+func TestAdaptiveLimiterCloseReleasesParkedWorkers(t *testing.T) {
+	l := NewDownloader(WithOutput(io.Discard)).newAdaptiveLimiter(16)
+	if !l.wait(0) {
+		t.Fatal("worker below the limit parked")
+	}
+	done := make(chan bool)
+	go func() { done <- l.wait(adaptiveStart) }()
+	select {
+	case <-done:
+		t.Fatal("worker above the limit wasn't parked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.close()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("released worker told to keep going")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("close didn't release the parked worker")
+	}
+}
+
+func TestAdaptiveDownloadFetchesEveryFile(t *testing.T) {
+	files := map[string]hubFile{}
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("shard-%d.bin", i)] = hubFile{Content: fmt.Sprintf("shard %d", i), LFS: true}
+	}
+	hub := newFakeHub(t, files)
+	opts := hubOptions(t)
+	opts.MaxWorkers = 8
+	opts.AdaptiveConcurrency = true
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		if hub.hits("/resolve/main/"+name) == 0 {
+			t.Errorf("%s never requested", name)
+		}
+	}
+}
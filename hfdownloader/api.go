@@ -0,0 +1,283 @@
+package hfdownloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	JsonModelInfoURL        = "https://huggingface.co/api/models/%s"
+	JsonDatasetInfoURL      = "https://huggingface.co/api/datasets/%s"
+	JsonSpaceInfoURL        = "https://huggingface.co/api/spaces/%s"
+	JsonModelRefsURL        = "https://huggingface.co/api/models/%s/refs"
+	JsonDatasetRefsURL      = "https://huggingface.co/api/datasets/%s/refs"
+	JsonModelPathsInfoURL   = "https://huggingface.co/api/models/%s/paths-info/%s"
+	JsonDatasetPathsInfoURL = "https://huggingface.co/api/datasets/%s/paths-info/%s"
+	JsonModelRevisionURL    = "https://huggingface.co/api/models/%s/revision/%s"
+	JsonDatasetRevisionURL  = "https://huggingface.co/api/datasets/%s/revision/%s"
+	JsonSpaceRefsURL        = "https://huggingface.co/api/spaces/%s/refs"
+	JsonSpacePathsInfoURL   = "https://huggingface.co/api/spaces/%s/paths-info/%s"
+	JsonSpaceRevisionURL    = "https://huggingface.co/api/spaces/%s/revision/%s"
+)
+
+// Auth header sent with Hub requests, "Authorization: Bearer <token>" unless
+// SetAuthHeader picks another for a gateway.
+var (
+	authHeaderName   = "Authorization"
+	authHeaderFormat = template.Must(template.New("auth-header").Parse("Bearer {{.Token}}"))
+)
+
+// SetAuthHeader changes how the token is sent, for HF-compatible gateways that
+// expect e.g. "X-API-Key: {{.Token}}". format is a text/template given the
+// token as {{.Token}}. Empty arguments keep the default.
+func SetAuthHeader(name, format string) error {
+	if name != "" {
+		if strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid auth header name %q", name)
+		}
+		authHeaderName = http.CanonicalHeaderKey(name)
+	}
+	if format != "" {
+		tmpl, err := template.New("auth-header").Option("missingkey=error").Parse(format)
+		if err != nil {
+			return fmt.Errorf("invalid auth header format: %v", err)
+		}
+		var sample strings.Builder
+		if err := tmpl.Execute(&sample, struct{ Token string }{"token"}); err != nil {
+			return fmt.Errorf("invalid auth header format: %v", err)
+		}
+		if strings.ContainsAny(sample.String(), "\r\n") {
+			return errors.New("invalid auth header format: value must be a single line")
+		}
+		authHeaderFormat = tmpl
+	}
+	return nil
+}
+
+// setAuth adds the token to a request in the configured header. Callers without
+// a token of their own fall back to the legacy RequiresAuth/AuthToken globals.
+func setAuth(req *http.Request, token string) {
+	if token == "" && RequiresAuth {
+		token = AuthToken
+	}
+	if token == "" {
+		return
+	}
+	var value strings.Builder
+	// The template was checked by SetAuthHeader, so this can't fail
+	_ = authHeaderFormat.Execute(&value, struct{ Token string }{token})
+	req.Header.Set(authHeaderName, value.String())
+}
+
+// hubStatusError is a non-200 reply from the Hub API.
+type hubStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *hubStatusError) Error() string {
+	return fmt.Sprintf("bad status: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// isHubNotFound reports whether err is a 404 from the Hub API.
+func isHubNotFound(err error) bool {
+	var statusErr *hubStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+type hfref struct {
+	Name         string `json:"name"`
+	Ref          string `json:"ref"`
+	TargetCommit string `json:"targetCommit"`
+}
+
+type hfrefs struct {
+	Branches []hfref `json:"branches"`
+	Tags     []hfref `json:"tags"`
+}
+
+// getHubJSON fetches a Hub API endpoint and decodes its JSON body into v.
+func getHubJSON(ctx context.Context, client *http.Client, endpoint string, token string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	return doHubJSON(client, req, token, v)
+}
+
+// postHubForm posts form values to a Hub API endpoint and decodes the JSON reply into v.
+func postHubForm(ctx context.Context, client *http.Client, endpoint string, token string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doHubJSON(client, req, token, v)
+}
+
+func doHubJSON(client *http.Client, req *http.Request, token string, v interface{}) error {
+	setAuth(req, token)
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return networkError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &hubStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// ListBranches returns the branch names of a model or dataset repo.
+func ListBranches(repo string, isDataset bool, token string) ([]string, error) {
+	if isDataset {
+		return ListRepoBranches(repo, RepoDataset, token)
+	}
+	return ListRepoBranches(repo, RepoModel, token)
+}
+
+// ListRepoBranches returns the branch names of a repo of any type.
+func ListRepoBranches(repo string, repoType RepoType, token string) ([]string, error) {
+	return listRepoBranches(httpClient, repo, repoType, token)
+}
+
+func listRepoBranches(client *http.Client, repo string, repoType RepoType, token string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	refsURL := repoType.pickURL(JsonModelRefsURL, JsonDatasetRefsURL, JsonSpaceRefsURL)
+
+	var refs hfrefs
+	if err := getHubJSON(ctx, client, fmt.Sprintf(refsURL, strings.Split(repo, ":")[0]), token, &refs); err != nil {
+		return nil, err
+	}
+
+	branches := make([]string, 0, len(refs.Branches))
+	for _, ref := range refs.Branches {
+		branches = append(branches, ref.Name)
+	}
+	return branches, nil
+}
+
+// fetchPathsInfo looks up the metadata of explicit repo paths in a single call,
+// instead of walking the whole tree to find them.
+func (d *Downloader) fetchPathsInfo(opts DownloadOptions, paths []string) ([]hfmodel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	infoURL := opts.repoType().pickURL(JsonModelPathsInfoURL, JsonDatasetPathsInfoURL, JsonSpacePathsInfoURL)
+	form := url.Values{"paths": paths}
+	if !opts.Since.IsZero() || opts.TouchTimestamps {
+		form.Set("expand", "true")
+	}
+
+	var entries []hfmodel
+	if err := postHubForm(ctx, d.client(), fmt.Sprintf(infoURL, opts.Repo, opts.Branch), opts.Token, form, &entries); err != nil {
+		return nil, err
+	}
+
+	files := make([]hfmodel, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type == "directory" {
+			continue
+		}
+		entry.DownloadLink = downloadLink(opts, entry.Path)
+		files = append(files, entry)
+	}
+	return files, nil
+}
+
+// checkRepo confirms the repo exists before anything else is fetched, so a
+// typo fails at once with a clear message instead of deep in the retries. The
+// Hub answers 401 rather than 404 for a missing repo when no token is sent,
+// as it won't tell missing and private repos apart. Failures that say nothing
+// about the repo, e.g. network errors, are left for the download to report.
+func (d *Downloader) checkRepo(opts DownloadOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	infoURL := opts.repoType().pickURL(JsonModelInfoURL, JsonDatasetInfoURL, JsonSpaceInfoURL)
+	var info struct {
+		ID string `json:"id"`
+	}
+	err := getHubJSON(ctx, d.client(), fmt.Sprintf(infoURL, opts.Repo), opts.Token, &info)
+	var statusErr *hubStatusError
+	if err == nil || !errors.As(err, &statusErr) {
+		if err != nil {
+			d.logf("Warning: could not check that %s exists: %v\n", opts.Repo, err)
+		}
+		return nil
+	}
+	switch {
+	case statusErr.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s (revision %s)", ErrRepoNotFound, opts.Repo, opts.Branch)
+	case statusErr.StatusCode == http.StatusUnauthorized && opts.Token == "":
+		return fmt.Errorf("%w: %s (revision %s); if it is private or gated, pass a token", ErrRepoNotFound, opts.Repo, opts.Branch)
+	case statusErr.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("%w: the token was rejected for %s: %v", ErrAuth, opts.Repo, err)
+	case statusErr.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: access to %s denied, for a gated repo accept its terms on the Hub: %v", ErrAuth, opts.Repo, err)
+	}
+	d.logf("Warning: could not check that %s exists: %v\n", opts.Repo, err)
+	return nil
+}
+
+// revisionExists checks a branch, tag or commit against the Hub. Only a 404
+// counts as missing; any other failure is returned as an error.
+func revisionExists(client *http.Client, opts DownloadOptions, revision string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	revisionURL := opts.repoType().pickURL(JsonModelRevisionURL, JsonDatasetRevisionURL, JsonSpaceRevisionURL)
+	var info struct {
+		SHA string `json:"sha"`
+	}
+	err := getHubJSON(ctx, client, fmt.Sprintf(revisionURL, opts.Repo, url.PathEscape(revision)), opts.Token, &info)
+	if isHubNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// resolveBranch picks the revision to download: opts.Branch if it exists, else
+// the first of opts.BranchFallback that does, else the repo's only branch. A
+// failed lookup keeps opts.Branch so the download reports the real error.
+func (d *Downloader) resolveBranch(opts DownloadOptions) (string, error) {
+	candidates := append([]string{opts.Branch}, opts.BranchFallback...)
+	for _, candidate := range candidates {
+		exists, err := revisionExists(d.client(), opts, candidate)
+		if err != nil {
+			d.logf("Warning: could not check branch %s: %v\n", candidate, err)
+			return opts.Branch, nil
+		}
+		if exists {
+			return candidate, nil
+		}
+		d.logf("Branch %s not found\n", candidate)
+	}
+
+	// Fall back to the default branch when the repo only has one
+	branches, err := listRepoBranches(d.client(), opts.Repo, opts.repoType(), opts.Token)
+	if err != nil {
+		return "", fmt.Errorf("%w: none of the branches %s exist and listing branches failed: %v", ErrRevisionNotFound, strings.Join(candidates, ", "), err)
+	}
+	if len(branches) == 1 {
+		return branches[0], nil
+	}
+	return "", fmt.Errorf("%w: none of the branches %s exist, available branches: %s", ErrRevisionNotFound, strings.Join(candidates, ", "), strings.Join(branches, ", "))
+}
@@ -0,0 +1,49 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMissingRepoFailsWithoutRetries(t *testing.T) {
+	for _, tc := range []struct {
+		status  int
+		token   string
+		want    error
+		message string
+	}{
+		{http.StatusNotFound, "", ErrRepoNotFound, "repo not found: o/typo (revision main)"},
+		{http.StatusUnauthorized, "", ErrRepoNotFound, "if it is private or gated, pass a token"},
+		{http.StatusUnauthorized, "hf_token", ErrAuth, "the token was rejected for o/typo"},
+		{http.StatusForbidden, "hf_token", ErrAuth, "accept its terms on the Hub"},
+	} {
+		hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: "{}"}})
+		hub.fail = func(r *http.Request) int {
+			if strings.HasPrefix(r.URL.Path, "/api/models/o/typo") {
+				return tc.status
+			}
+			return 0
+		}
+		opts := hubOptions(t)
+		opts.Repo, opts.Token = "o/typo", tc.token
+		d, _ := hub.downloader()
+		start := time.Now()
+		_, err := d.Download(context.Background(), opts)
+		if !errors.Is(err, tc.want) || !strings.Contains(err.Error(), tc.message) {
+			t.Fatalf("%d: err = %v, want %v mentioning %q", tc.status, err, tc.want, tc.message)
+		}
+		if tc.want == ErrRepoNotFound && errors.Is(err, ErrAuth) || tc.want == ErrAuth && errors.Is(err, ErrNotFound) {
+			t.Fatalf("%d: err = %v is both not-found and auth", tc.status, err)
+		}
+		if n := hub.hits("/api/models/o/typo"); n != 1 {
+			t.Fatalf("%d: %d requests to the repo, want the single preflight", tc.status, n)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Fatalf("%d: took %s, a retry backoff ran", tc.status, elapsed)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build darwin
+
+package hfdownloader
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// accessTime is when the file was last read, or its modification time when
+// the file system doesn't say.
+func accessTime(info fs.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(int64(st.Atimespec.Sec), int64(st.Atimespec.Nsec))
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !windows
+
+package hfdownloader
+
+import (
+	"io/fs"
+	"time"
+)
+
+// accessTime is the file's modification time, as access times aren't read on
+// this platform.
+func accessTime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
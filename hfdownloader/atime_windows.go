@@ -0,0 +1,18 @@
+//go:build windows
+
+package hfdownloader
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// accessTime is when the file was last read, or its modification time when
+// the file system doesn't say.
+func accessTime(info fs.FileInfo) time.Time {
+	if data, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return time.Unix(0, data.LastAccessTime.Nanoseconds())
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,102 @@
+package hfdownloader
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// AttestationFile is one downloaded file as the Hub described it.
+type AttestationFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`  // LFS files
+	GitOID string `json:"git_oid,omitempty"` // git blob id, for regular files
+}
+
+// Attestation records exactly which files of which commit a download fetched,
+// for provenance checks. Unlike the manifest it is written once per run and
+// never consulted by the downloader.
+type Attestation struct {
+	Repo        string            `json:"repo"`
+	RepoType    RepoType          `json:"repo_type"`
+	Revision    string            `json:"revision"`
+	Commit      string            `json:"commit"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	Tool        string            `json:"tool"`
+	Files       []AttestationFile `json:"files"`
+
+	// Signature is an HMAC-SHA256 over the rest, with the manifest key, when
+	// the manifest is signed too.
+	Signature string `json:"signature,omitempty"`
+}
+
+// resolveCommit returns the commit SHA a branch or tag currently points to.
+func resolveCommit(client *http.Client, opts DownloadOptions) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	revisionURL := opts.repoType().pickURL(JsonModelRevisionURL, JsonDatasetRevisionURL, JsonSpaceRevisionURL)
+	var info struct {
+		SHA string `json:"sha"`
+	}
+	if err := getHubJSON(ctx, client, fmt.Sprintf(revisionURL, opts.Repo, url.PathEscape(opts.Branch)), opts.Token, &info); err != nil {
+		return "", err
+	}
+	return info.SHA, nil
+}
+
+// writeAttestation writes the attestation for the selected files to w, from
+// the metadata already fetched during enumeration. revision is what was asked
+// for and commit what it resolved to.
+func writeAttestation(w io.Writer, files []hfmodel, opts DownloadOptions, revision, commit string) error {
+	attestation := Attestation{
+		Repo:        opts.Repo,
+		RepoType:    opts.repoType(),
+		Revision:    revision,
+		Commit:      commit,
+		GeneratedAt: time.Now().UTC(),
+		Tool:        UserAgent,
+		Files:       []AttestationFile{},
+	}
+	for _, file := range files {
+		if file.IsDirectory || file.FilterSkip || file.Size <= 0 {
+			continue
+		}
+		entry := AttestationFile{Path: file.Path, Size: int64(file.Size)}
+		if file.Lfs != nil {
+			entry.SHA256 = file.Lfs.Oid_SHA265
+		} else {
+			entry.GitOID = file.Oid
+		}
+		attestation.Files = append(attestation.Files, entry)
+	}
+	sort.Slice(attestation.Files, func(i, j int) bool { return attestation.Files[i].Path < attestation.Files[j].Path })
+
+	if opts.SignManifest {
+		unsigned, err := json.Marshal(attestation)
+		if err != nil {
+			return fmt.Errorf("failed to encode attestation: %v", err)
+		}
+		mac := hmac.New(sha256.New, opts.ManifestKey)
+		mac.Write(unsigned)
+		attestation.Signature = hex.EncodeToString(mac.Sum(nil))
+	}
+
+	data, err := json.MarshalIndent(attestation, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode attestation: %v", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write attestation: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package hfdownloader
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttestation(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":       {Content: `{"a":1}`},
+		"model.safetensors": {Content: "weights", LFS: true},
+		"README.md":         {Content: "readme"},
+	})
+	key := []byte("key")
+	opts := hubOptions(t)
+	opts.Exclude = []string{"*.md"}
+	opts.Attestation = filepath.Join(t.TempDir(), "attestation.json")
+	opts.SignManifest, opts.ManifestKey = true, key
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	// The branch is pinned to the commit it resolved to
+	if hub.hits("/resolve/"+testCommit+"/config.json") != 1 || hub.hits("/resolve/main/") != 0 {
+		t.Fatal("files weren't fetched from the attested commit")
+	}
+
+	data, err := os.ReadFile(opts.Attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attestation Attestation
+	if err := json.Unmarshal(data, &attestation); err != nil {
+		t.Fatal(err)
+	}
+	if attestation.Repo != "o/m" || attestation.Revision != "main" || attestation.Commit != testCommit {
+		t.Fatalf("attested %s@%s (%s)", attestation.Repo, attestation.Revision, attestation.Commit)
+	}
+	if len(attestation.Files) != 2 {
+		t.Fatalf("files %+v, want config.json and model.safetensors", attestation.Files)
+	}
+	if f := attestation.Files[0]; f.Path != "config.json" || f.Size != 7 || f.GitOID == "" || f.SHA256 != "" {
+		t.Errorf("regular file attested as %+v", f)
+	}
+	if f := attestation.Files[1]; f.Path != "model.safetensors" || f.SHA256 != sha256Hex("weights") {
+		t.Errorf("LFS file attested as %+v", f)
+	}
+
+	signature := attestation.Signature
+	attestation.Signature = ""
+	unsigned, _ := json.Marshal(attestation)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(unsigned)
+	if signature != hex.EncodeToString(mac.Sum(nil)) {
+		t.Error("signature doesn't match the attestation")
+	}
+}
@@ -0,0 +1,353 @@
+package hfdownloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	azureAPIVersion = "2021-08-06"
+	azureBlockSize  = 100 * 1024 * 1024 // block size for uploads too large for a single Put Blob
+	azureMaxPutBlob = 256 * 1024 * 1024 // larger uploads are split into blocks
+)
+
+// AzureConfig describes an Azure Blob Storage upload target, authenticated with
+// the storage account's shared key.
+type AzureConfig struct {
+	Account   string
+	Key       string // base64 account key
+	Container string
+	Prefix    string // blob name prefix (e.g. "hf_dataset")
+	Endpoint  string // blob service URL, https://<account>.blob.core.windows.net when empty
+}
+
+// ParseAzureConnectionString reads the account, key and endpoint from an Azure
+// storage connection string, as in AZURE_STORAGE_CONNECTION_STRING.
+func ParseAzureConnectionString(connStr string) (AzureConfig, error) {
+	values := make(map[string]string)
+	for _, part := range strings.Split(connStr, ";") {
+		if name, value, ok := strings.Cut(part, "="); ok {
+			values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	cfg := AzureConfig{Account: values["AccountName"], Key: values["AccountKey"], Endpoint: values["BlobEndpoint"]}
+	if cfg.Account == "" || cfg.Key == "" {
+		return AzureConfig{}, fmt.Errorf("invalid Azure connection string: AccountName and AccountKey are required")
+	}
+	if cfg.Endpoint == "" {
+		protocol, suffix := values["DefaultEndpointsProtocol"], values["EndpointSuffix"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+		cfg.Endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, cfg.Account, suffix)
+	}
+	return cfg, nil
+}
+
+// azureClient talks to the Blob service REST API, signing each request with
+// the shared key.
+type azureClient struct {
+	cfg  AzureConfig
+	key  []byte
+	base *url.URL
+	http *http.Client
+}
+
+func newAzureClient(cfg AzureConfig) (*azureClient, error) {
+	key, err := base64.StdEncoding.DecodeString(cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Azure storage key: %v", err)
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.Account)
+	}
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Azure endpoint %q: %v", endpoint, err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		DialContext:     restrictDial((&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext),
+		TLSClientConfig: tlsConfig.Clone(),
+	}}
+	return &azureClient{cfg: cfg, key: key, base: base, http: client}, nil
+}
+
+// azureKeyFor maps a repo path to its blob name under the configured prefix.
+func azureKeyFor(cfg *AzureConfig, filePath string, hfPrefix string) string {
+	if cfg == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", cfg.Prefix, strings.TrimPrefix(filePath, fmt.Sprintf("%s/", prefixRoot(hfPrefix))))
+}
+
+// blobURL returns the URL of a blob, or of the container when name is empty.
+func (c *azureClient) blobURL(name string, query url.Values) string {
+	u := *c.base
+	u.Path += "/" + c.cfg.Container
+	if name != "" {
+		u.Path += "/" + name
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// sign adds the Shared Key authorization header to req.
+func (c *azureClient) sign(req *http.Request) {
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	var msHeaders []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+
+	var toSign strings.Builder
+	toSign.WriteString(req.Method + "\n")
+	for _, header := range []string{"Content-Encoding", "Content-Language"} {
+		toSign.WriteString(req.Header.Get(header) + "\n")
+	}
+	toSign.WriteString(contentLength + "\n")
+	for _, header := range []string{"Content-MD5", "Content-Type", "Date", "If-Modified-Since", "If-Match", "If-None-Match", "If-Unmodified-Since", "Range"} {
+		toSign.WriteString(req.Header.Get(header) + "\n")
+	}
+	for _, name := range msHeaders {
+		toSign.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	toSign.WriteString("/" + c.cfg.Account + req.URL.EscapedPath())
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := query[name]
+		sort.Strings(values)
+		toSign.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(toSign.String()))
+	req.Header.Set("Authorization", "SharedKey "+c.cfg.Account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+func (c *azureClient) do(req *http.Request, v interface{}) error {
+	c.sign(req)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("bad status: %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+	if v == nil {
+		return nil
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// list returns the size of every blob under prefix.
+func (c *azureClient) list(ctx context.Context, prefix string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", c.blobURL("", query), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+
+		var page struct {
+			Blobs []struct {
+				Name          string `xml:"Name"`
+				ContentLength int64  `xml:"Properties>Content-Length"`
+			} `xml:"Blobs>Blob"`
+			NextMarker string `xml:"NextMarker"`
+		}
+		if err := c.do(req, &page); err != nil {
+			return nil, err
+		}
+		for _, blob := range page.Blobs {
+			sizes[blob.Name] = blob.ContentLength
+		}
+		if page.NextMarker == "" {
+			return sizes, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+// upload writes a blob, in one Put Blob request when it is small enough and as
+// a list of blocks otherwise. body is read once, front to back.
+func (c *azureClient) upload(ctx context.Context, key string, body io.Reader, size int64) error {
+	if size <= azureMaxPutBlob {
+		req, err := http.NewRequestWithContext(ctx, "PUT", c.blobURL(key, nil), body)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %v", err)
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("x-ms-blob-type", "BlockBlob")
+		if err := c.do(req, nil); err != nil {
+			return fmt.Errorf("upload failed: %v", err)
+		}
+		return nil
+	}
+
+	var blockList bytes.Buffer
+	blockList.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for i, offset := 0, int64(0); offset < size; i, offset = i+1, offset+azureBlockSize {
+		length := size - offset
+		if length > azureBlockSize {
+			length = azureBlockSize
+		}
+		// Block IDs must all have the same length
+		id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", i)))
+		query := url.Values{"comp": {"block"}, "blockid": {id}}
+		req, err := http.NewRequestWithContext(ctx, "PUT", c.blobURL(key, query), io.LimitReader(body, length))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %v", err)
+		}
+		req.ContentLength = length
+		if err := c.do(req, nil); err != nil {
+			return fmt.Errorf("upload of block %d failed: %v", i, err)
+		}
+		blockList.WriteString("<Latest>" + id + "</Latest>")
+	}
+	blockList.WriteString("</BlockList>")
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", c.blobURL(key, url.Values{"comp": {"blocklist"}}), bytes.NewReader(blockList.Bytes()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	if err := c.do(req, nil); err != nil {
+		return fmt.Errorf("committing blocks failed: %v", err)
+	}
+	return nil
+}
+
+func (c *azureClient) delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", c.blobURL(key, nil), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	return c.do(req, nil)
+}
+
+// buildAzureCache lists the blobs already in the container so finished files
+// can be skipped, the same way buildR2Cache does for R2.
+func (d *Downloader) buildAzureCache(ctx context.Context, client *azureClient) (*R2FileCache, error) {
+	d.logf("Building cache of existing files in Azure...\n")
+	start := time.Now()
+
+	files, err := client.list(ctx, client.cfg.Prefix+"/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %v", err)
+	}
+
+	d.logf("Cached %d files in %s\n", len(files), time.Since(start))
+	return &R2FileCache{files: files}, nil
+}
+
+// transferFileToAzure is transferFile for an Azure destination.
+func (d *Downloader) transferFileToAzure(ctx context.Context, body io.Reader, file hfmodel, localPath string, client *azureClient, key string, skipLocal bool, skipSHA bool, uploaded *atomic.Int64) error {
+	if skipLocal {
+		return d.streamToAzure(ctx, body, file, client, key, skipSHA, uploaded)
+	}
+
+	if err := d.downloadToLocal(body, file, localPath, skipSHA); err != nil {
+		return err
+	}
+	return d.uploadLocalToAzure(ctx, localPath, client, key, int64(file.Size), uploaded)
+}
+
+// streamToAzure uploads the download body directly, hashing it on the way so
+// the LFS checksum can be checked without a second read.
+func (d *Downloader) streamToAzure(ctx context.Context, body io.Reader, file hfmodel, client *azureClient, key string, skipSHA bool, uploaded *atomic.Int64) error {
+	size := int64(file.Size)
+	hash := newContentHash(file)
+	progress := d.createProgressBar(size, filepath.Base(file.Path))
+
+	pr, pw := io.Pipe()
+	copyDone := make(chan struct{})
+	go func() {
+		defer close(copyDone)
+		_, err := d.copy(io.MultiWriter(hash, pw), newProgressReader(body, progress))
+		pw.CloseWithError(err)
+	}()
+
+	err := client.upload(ctx, key, newCountingReader(pr, uploaded), size)
+	// Unblock the copier if the upload bailed out early, then wait for the hash to settle
+	pr.Close()
+	<-copyDone
+	if err != nil {
+		return err
+	}
+
+	if !skipSHA {
+		if err := checkContentHash(file, hash); err != nil {
+			if delErr := client.delete(ctx, key); delErr != nil {
+				d.logf("Warning: Failed to delete mismatched upload %s: %v\n", key, delErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadLocalToAzure uploads a staged local file, checking parquet framing
+// before anything is sent.
+func (d *Downloader) uploadLocalToAzure(ctx context.Context, localPath string, client *azureClient, key string, size int64, uploaded *atomic.Int64) error {
+	if strings.HasSuffix(localPath, ".parquet") {
+		if err := verifyLocalParquet(localPath); err != nil {
+			return fmt.Errorf("invalid parquet file: %v", err)
+		}
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", localPath, err)
+	}
+	defer f.Close()
+
+	progress := d.createProgressBar(size, filepath.Base(key))
+	return client.upload(ctx, key, newCountingReader(newProgressReader(f, progress), uploaded), size)
+}
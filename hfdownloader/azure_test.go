@@ -0,0 +1,268 @@
+package hfdownloader
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// azuriteKey is the well-known key of Azurite's devstoreaccount1.
+const azuriteKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+// fakeAzurite is a Blob service in the style of the Azurite emulator, serving
+// one container path-style under /devstoreaccount1. It checks each request's
+// Shared Key signature and pages listings two blobs at a time.
+type fakeAzurite struct {
+	*httptest.Server
+	container string
+
+	mu    sync.Mutex
+	blobs map[string]string
+	puts  []string
+}
+
+func newFakeAzurite(t *testing.T) *fakeAzurite {
+	t.Helper()
+	a := &fakeAzurite{container: "models", blobs: map[string]string{}}
+	a.Server = httptest.NewServer(http.HandlerFunc(a.serve))
+	t.Cleanup(a.Close)
+	return a
+}
+
+func (a *fakeAzurite) config() *AzureConfig {
+	return &AzureConfig{Account: "devstoreaccount1", Key: azuriteKey, Container: a.container, Prefix: "hf_dataset", Endpoint: a.URL + "/devstoreaccount1"}
+}
+
+func (a *fakeAzurite) blob(name string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	content, ok := a.blobs[name]
+	return content, ok
+}
+
+// signature computes the Shared Key signature of r as documented for the Blob
+// service, independently of azureClient.sign.
+func signature(r *http.Request) string {
+	var s strings.Builder
+	s.WriteString(r.Method + "\n")
+	s.WriteString(r.Header.Get("Content-Encoding") + "\n" + r.Header.Get("Content-Language") + "\n")
+	if r.ContentLength > 0 {
+		s.WriteString(strconv.FormatInt(r.ContentLength, 10))
+	}
+	s.WriteString("\n")
+	for _, h := range []string{"Content-MD5", "Content-Type", "Date", "If-Modified-Since", "If-Match", "If-None-Match", "If-Unmodified-Since", "Range"} {
+		s.WriteString(r.Header.Get(h) + "\n")
+	}
+	var ms []string
+	for name := range r.Header {
+		if name = strings.ToLower(name); strings.HasPrefix(name, "x-ms-") {
+			ms = append(ms, name)
+		}
+	}
+	sort.Strings(ms)
+	for _, name := range ms {
+		s.WriteString(name + ":" + r.Header.Get(name) + "\n")
+	}
+	s.WriteString("/devstoreaccount1" + r.URL.EscapedPath())
+	query := r.URL.Query()
+	var names []string
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(query[name], ","))
+	}
+	key, _ := base64.StdEncoding.DecodeString(azuriteKey)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s.String()))
+	return "SharedKey devstoreaccount1:" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *fakeAzurite) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != signature(r) || r.Header.Get("x-ms-version") == "" {
+		http.Error(w, "AuthenticationFailed", http.StatusForbidden)
+		return
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/devstoreaccount1/"+a.container)
+	if !ok {
+		http.Error(w, "ContainerNotFound", http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(rest, "/")
+	query := r.URL.Query()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && query.Get("comp") == "list":
+		a.list(w, query.Get("prefix"), query.Get("marker"))
+	case r.Method == http.MethodPut:
+		if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+			http.Error(w, "MissingRequiredHeader", http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		a.blobs[name] = string(data)
+		a.puts = append(a.puts, name)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete:
+		delete(a.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "UnsupportedHttpVerb", http.StatusMethodNotAllowed)
+	}
+}
+
+type azureBlob struct {
+	Name          string `xml:"Name"`
+	ContentLength int64  `xml:"Properties>Content-Length"`
+}
+
+func (a *fakeAzurite) list(w http.ResponseWriter, prefix, marker string) {
+	var names []string
+	for name := range a.blobs {
+		if strings.HasPrefix(name, prefix) && name >= marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var page struct {
+		XMLName    xml.Name    `xml:"EnumerationResults"`
+		Blobs      []azureBlob `xml:"Blobs>Blob"`
+		NextMarker string      `xml:"NextMarker"`
+	}
+	if len(names) > 2 {
+		page.NextMarker = names[2]
+		names = names[:2]
+	}
+	for _, name := range names {
+		page.Blobs = append(page.Blobs, azureBlob{Name: name, ContentLength: int64(len(a.blobs[name]))})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(page)
+}
+
+var azureRepo = map[string]hubFile{
+	"config.json":         {Content: `{"a":1}`},
+	"model.safetensors":   {Content: "weights", LFS: true},
+	"tokenizer.json":      {Content: "{}"},
+	"onnx/model.onnx":     {Content: "onnx", LFS: true},
+	"onnx/model_fp16.bin": {Content: "fp16", LFS: true},
+}
+
+func TestAzureUpload(t *testing.T) {
+	for _, skipLocal := range []bool{false, true} {
+		t.Run("skip-local="+strconv.FormatBool(skipLocal), func(t *testing.T) {
+			hub, azurite := newFakeHub(t, azureRepo), newFakeAzurite(t)
+			opts := hubOptions(t)
+			opts.Azure = azurite.config()
+			opts.SkipLocal = skipLocal
+			d, _ := hub.downloader()
+			if _, err := d.Download(context.Background(), opts); err != nil {
+				t.Fatal(err)
+			}
+			for name, file := range azureRepo {
+				if got, ok := azurite.blob("hf_dataset/" + name); !ok || got != file.Content {
+					t.Errorf("blob %s = %q, %v; want %q", name, got, ok, file.Content)
+				}
+				_, err := os.Stat(filepath.Join(opts.Storage, "o", "m", filepath.FromSlash(name)))
+				if skipLocal && err == nil {
+					t.Errorf("%s kept locally with SkipLocal", name)
+				} else if !skipLocal && err != nil {
+					t.Errorf("%s not kept locally: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAzureSkipsExistingBlobs(t *testing.T) {
+	hub, azurite := newFakeHub(t, azureRepo), newFakeAzurite(t)
+	// Already uploaded, listed over two pages
+	azurite.blobs["hf_dataset/config.json"] = `{"a":1}`
+	azurite.blobs["hf_dataset/model.safetensors"] = "weights"
+	azurite.blobs["hf_dataset/onnx/model.onnx"] = "onnx"
+	opts := hubOptions(t)
+	opts.Azure = azurite.config()
+	opts.SkipLocal = true
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(azurite.puts)
+	if want := []string{"hf_dataset/.hfdownloader-manifest.json", "hf_dataset/onnx/model_fp16.bin", "hf_dataset/tokenizer.json"}; strings.Join(azurite.puts, ",") != strings.Join(want, ",") {
+		t.Fatalf("uploaded %v, want only the missing %v", azurite.puts, want)
+	}
+	if hub.hits("/resolve/main/model.safetensors") != 0 {
+		t.Fatal("fetched a file already in the container")
+	}
+}
+
+func TestAzureClientUploadAndDelete(t *testing.T) {
+	azurite := newFakeAzurite(t)
+	client, err := newAzureClient(*azurite.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Repeat("b", 3*1024)
+	if err := client.upload(context.Background(), "hf_dataset/blob", strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := azurite.blob("hf_dataset/blob"); got != content {
+		t.Fatalf("blob has %d bytes, want %d", len(got), len(content))
+	}
+	if err := client.delete(context.Background(), "hf_dataset/blob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := azurite.blob("hf_dataset/blob"); ok {
+		t.Fatal("blob not deleted")
+	}
+}
+
+func TestAzureRejectsOtherBackends(t *testing.T) {
+	hub, azurite := newFakeHub(t, azureRepo), newFakeAzurite(t)
+	for _, opts := range []DownloadOptions{
+		{R2: &R2Config{BucketName: "bucket"}},
+		{GCS: &GCSConfig{Bucket: "bucket"}},
+	} {
+		opts.Repo, opts.Branch, opts.Storage = "o/m", "main", t.TempDir()
+		opts.Azure = azurite.config()
+		d, _ := hub.downloader()
+		if _, err := d.Download(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "only one upload backend") {
+			t.Fatalf("err = %v, want the combination rejected", err)
+		}
+	}
+	if len(hub.requestsTo("/")) != 0 {
+		t.Fatal("contacted the Hub before rejecting the options")
+	}
+}
+
+func TestParseAzureConnectionString(t *testing.T) {
+	cfg, err := ParseAzureConnectionString("DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=" + azuriteKey + ";BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Account != "devstoreaccount1" || cfg.Key != azuriteKey || cfg.Endpoint != "http://127.0.0.1:10000/devstoreaccount1" {
+		t.Fatalf("got %+v", cfg)
+	}
+	cfg, err = ParseAzureConnectionString("AccountName=acct;AccountKey=a2V5;EndpointSuffix=core.chinacloudapi.cn")
+	if err != nil || cfg.Endpoint != "https://acct.blob.core.chinacloudapi.cn" {
+		t.Fatalf("got %+v, %v", cfg, err)
+	}
+	if _, err := ParseAzureConnectionString("AccountName=acct"); err == nil {
+		t.Fatal("connection string without a key accepted")
+	}
+}
@@ -0,0 +1,169 @@
+package hfdownloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBucket is an S3 bucket served over path-style requests, enough for
+// listing, ranged reads, heads, puts and deletes. It is served over TLS like
+// R2, where the SDK streams uploads without hashing them first.
+type fakeBucket struct {
+	*httptest.Server
+	name     string
+	pageSize int  // keys per list page, 1000 when 0
+	denied   bool // answer every request with 403 AccessDenied
+
+	mu       sync.Mutex
+	objects  map[string]string
+	metadata map[string]map[string]string
+	deleted  []string
+	lists    int
+}
+
+func newFakeBucket(t *testing.T, objects map[string]string) *fakeBucket {
+	t.Helper()
+	// The SDK can't add a CA bundle to createR2Client's own HTTP client
+	t.Setenv("AWS_CA_BUNDLE", "")
+	b := &fakeBucket{name: "bucket", objects: objects, metadata: map[string]map[string]string{}}
+	if b.objects == nil {
+		b.objects = map[string]string{}
+	}
+	b.Server = httptest.NewTLSServer(http.HandlerFunc(b.serve))
+	t.Cleanup(b.Close)
+
+	// Trust the bucket's certificate in the clients createR2Client makes
+	pool := x509.NewCertPool()
+	pool.AddCert(b.Certificate())
+	saved := tlsConfig
+	tlsConfig = &tls.Config{RootCAs: pool}
+	t.Cleanup(func() { tlsConfig = saved })
+	return b
+}
+
+// config is an R2Config pointing at the bucket, storing under hf_dataset/.
+func (b *fakeBucket) config() *R2Config {
+	return &R2Config{AccountID: "account", AccessKeyID: "key", AccessKeySecret: "secret", BucketName: b.name, Region: "auto", Subfolder: "hf_dataset", Endpoint: b.URL}
+}
+
+func (b *fakeBucket) object(key string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	content, ok := b.objects[key]
+	return content, ok
+}
+
+type listResult struct {
+	XMLName               xml.Name     `xml:"ListBucketResult"`
+	Name                  string       `xml:"Name"`
+	Prefix                string       `xml:"Prefix"`
+	KeyCount              int          `xml:"KeyCount"`
+	IsTruncated           bool         `xml:"IsTruncated"`
+	NextContinuationToken string       `xml:"NextContinuationToken,omitempty"`
+	Contents              []listObject `xml:"Contents"`
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	Size         int64  `xml:"Size"`
+	LastModified string `xml:"LastModified"`
+}
+
+func (b *fakeBucket) serve(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != b.name {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.denied {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<Error><Code>AccessDenied</Code></Error>`)
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		b.lists++
+		b.list(w, r)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		b.objects[key] = string(data)
+		meta := map[string]string{}
+		for name, values := range r.Header {
+			if name = strings.ToLower(name); strings.HasPrefix(name, "x-amz-meta-") {
+				meta[strings.TrimPrefix(name, "x-amz-meta-")] = values[0]
+			}
+		}
+		b.metadata[key] = meta
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodDelete:
+		delete(b.objects, key)
+		b.deleted = append(b.deleted, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		content, ok := b.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			}
+			return
+		}
+		for name, value := range b.metadata[key] {
+			w.Header().Set("x-amz-meta-"+name, value)
+		}
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	default:
+		http.Error(w, "unsupported", http.StatusNotImplemented)
+	}
+}
+
+// list answers ListObjectsV2, a page of pageSize keys at a time.
+func (b *fakeBucket) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, after := q.Get("prefix"), q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		after = token
+	}
+	var keys []string
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	pageSize := b.pageSize
+	if max, err := strconv.Atoi(q.Get("max-keys")); err == nil && max > 0 && (pageSize == 0 || max < pageSize) {
+		pageSize = max
+	}
+	if pageSize == 0 {
+		pageSize = 1000
+	}
+	result := listResult{Name: b.name, Prefix: prefix}
+	if len(keys) > pageSize {
+		keys = keys[:pageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, listObject{Key: key, Size: int64(len(b.objects[key])), LastModified: "2024-01-01T00:00:00.000Z"})
+	}
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
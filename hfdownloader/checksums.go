@@ -0,0 +1,152 @@
+package hfdownloader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formats of the checksum file written with DownloadOptions.ChecksumFile.
+const (
+	ChecksumSHA256Sum = "sha256sum"
+	ChecksumJSON      = "json"
+	ChecksumCSV       = "csv"
+)
+
+// ValidateChecksumFormat checks a --checksum-format value, empty meaning sha256sum.
+func ValidateChecksumFormat(format string) error {
+	switch format {
+	case "", ChecksumSHA256Sum, ChecksumJSON, ChecksumCSV:
+		return nil
+	}
+	return fmt.Errorf("invalid checksum format %q, expected %s, %s or %s", format, ChecksumSHA256Sum, ChecksumJSON, ChecksumCSV)
+}
+
+// ChecksumEntry is one line of a checksum file.
+type ChecksumEntry struct {
+	Path   string `json:"path"` // relative to the checksum file's directory
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// checksumEntries lists the SHA256 of each downloaded file. LFS files stored
+// under their repo content use the hash already verified against the Hub;
+// regular files, whose Hub hash is a git blob id, and decompressed files are
+// hashed from disk.
+func checksumEntries(files []hfmodel, opts DownloadOptions, modelPath string) ([]ChecksumEntry, error) {
+	base, err := filepath.Abs(filepath.Dir(opts.ChecksumFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ChecksumEntry
+	for _, file := range files {
+		if file.IsDirectory || file.FilterSkip || file.Size <= 0 {
+			continue
+		}
+		localName, decompress := localPathFor(opts, file.Path)
+		localPath, err := filepath.Abs(filepath.Join(modelPath, filepath.FromSlash(localName)))
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(base, localPath)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := ChecksumEntry{Path: filepath.ToSlash(rel), Size: int64(file.Size)}
+		if file.Lfs != nil && !decompress {
+			entry.SHA256 = file.Lfs.Oid_SHA265
+		} else if entry.SHA256, entry.Size, err = sha256OfFile(localPath); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+func sha256OfFile(localPath string) (string, int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open %s: %v", localPath, err)
+	}
+	defer f.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to hash %s: %v", localPath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// encodeChecksums serializes entries in format:
+//
+//	sha256sum  "<hash>  <path>" lines, as read by sha256sum -c
+//	json       an array of {"path", "sha256", "size"} objects
+//	csv        a "path,sha256,size" header and one row per file
+func encodeChecksums(entries []ChecksumEntry, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "", ChecksumSHA256Sum:
+		for _, entry := range entries {
+			// Like sha256sum, escape backslashes and newlines and flag the line
+			name := entry.Path
+			if strings.ContainsAny(name, "\\\n") {
+				name = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(name)
+				buf.WriteString("\\")
+			}
+			fmt.Fprintf(&buf, "%s  %s\n", entry.SHA256, name)
+		}
+	case ChecksumJSON:
+		if entries == nil {
+			entries = []ChecksumEntry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(append(data, '\n'))
+	case ChecksumCSV:
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"path", "sha256", "size"})
+		for _, entry := range entries {
+			w.Write([]string{entry.Path, entry.SHA256, strconv.FormatInt(entry.Size, 10)})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ValidateChecksumFormat(format)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeChecksums writes the checksum file for the downloaded files.
+func writeChecksums(files []hfmodel, opts DownloadOptions, modelPath string) error {
+	entries, err := checksumEntries(files, opts, modelPath)
+	if err != nil {
+		return fmt.Errorf("failed to collect checksums: %v", err)
+	}
+	data, err := encodeChecksums(entries, opts.ChecksumFormat)
+	if err != nil {
+		return fmt.Errorf("failed to encode checksums: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.ChecksumFile), 0755); err != nil {
+		return fmt.Errorf("failed to create checksum file directory: %v", err)
+	}
+	if err := os.WriteFile(opts.ChecksumFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checksum file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeChecksums(t *testing.T) {
+	entries := []ChecksumEntry{
+		{Path: "a.bin", SHA256: "aa", Size: 1},
+		{Path: "dir/b,c.txt", SHA256: "bb", Size: 22},
+		{Path: "odd\\name", SHA256: "cc", Size: 3},
+	}
+	for format, want := range map[string]string{
+		"":                "aa  a.bin\nbb  dir/b,c.txt\n\\cc  odd\\\\name\n",
+		ChecksumSHA256Sum: "aa  a.bin\nbb  dir/b,c.txt\n\\cc  odd\\\\name\n",
+		ChecksumJSON: `[
+  {
+    "path": "a.bin",
+    "sha256": "aa",
+    "size": 1
+  },
+  {
+    "path": "dir/b,c.txt",
+    "sha256": "bb",
+    "size": 22
+  },
+  {
+    "path": "odd\\name",
+    "sha256": "cc",
+    "size": 3
+  }
+]
+`,
+		ChecksumCSV: "path,sha256,size\na.bin,aa,1\n\"dir/b,c.txt\",bb,22\nodd\\name,cc,3\n",
+	} {
+		got, err := encodeChecksums(entries, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s:\n%q\nwant\n%q", format, got, want)
+		}
+	}
+
+	if got, _ := encodeChecksums(nil, ChecksumJSON); string(got) != "[]\n" {
+		t.Errorf("empty json = %q, want []", got)
+	}
+	if _, err := encodeChecksums(entries, "md5"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestDownloadWritesChecksums(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"model.safetensors": {Content: "weights", LFS: true},
+		"sub/config.json":   {Content: `{"a":1}`},
+	})
+	opts := hubOptions(t)
+	opts.ChecksumFile = filepath.Join(opts.Storage, "SHA256SUMS")
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	got, err := os.ReadFile(opts.ChecksumFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256Hex("weights") + "  o/m/model.safetensors\n" + sha256Hex(`{"a":1}`) + "  o/m/sub/config.json\n"
+	if string(got) != want {
+		t.Fatalf("SHA256SUMS:\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,408 @@
+package hfdownloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// RemoteObject is a stored object handed to a CorruptionCheck.
+type RemoteObject struct {
+	Key      string
+	Size     int64
+	Metadata map[string]string
+	// ReadRange returns length bytes of the object starting at offset.
+	ReadRange func(ctx context.Context, offset, length int64) ([]byte, error)
+}
+
+// CorruptionCheck inspects obj and returns why it is corrupt, or "" when it
+// looks fine. An error means the object could not be inspected; cleanup never
+// deletes an object because of one.
+type CorruptionCheck func(ctx context.Context, obj RemoteObject) (reason string, err error)
+
+// DefaultCorruptionChecks are the checks cleanup runs, by file extension.
+var DefaultCorruptionChecks = map[string]CorruptionCheck{
+	".parquet":     CheckParquet,
+	".safetensors": CheckSafetensors,
+}
+
+// maxSafetensorsHeader bounds the JSON header CheckSafetensors reads; real
+// headers are far smaller, so a larger length means a damaged prefix.
+const maxSafetensorsHeader = 100 * 1024 * 1024
+
+// CheckParquet flags objects without the "PAR1" magic at both ends.
+func CheckParquet(ctx context.Context, obj RemoteObject) (string, error) {
+	if obj.Size < 12 {
+		return fmt.Sprintf("too small for a parquet file (%d bytes)", obj.Size), nil
+	}
+	magic := []byte("PAR1")
+	header, err := obj.ReadRange(ctx, 0, 4)
+	if err != nil {
+		return "", fmt.Errorf("failed to read header: %v", err)
+	}
+	if !bytes.Equal(header, magic) {
+		return "invalid parquet header magic number", nil
+	}
+	footer, err := obj.ReadRange(ctx, obj.Size-4, 4)
+	if err != nil {
+		return "", fmt.Errorf("failed to read footer: %v", err)
+	}
+	if !bytes.Equal(footer, magic) {
+		return "invalid parquet footer magic number (truncated upload?)", nil
+	}
+	return "", nil
+}
+
+// CheckSafetensors flags objects whose header length prefix doesn't fit the
+// object or whose JSON header doesn't parse, the usual signs of truncation.
+func CheckSafetensors(ctx context.Context, obj RemoteObject) (string, error) {
+	if obj.Size < 8 {
+		return fmt.Sprintf("too small for a safetensors file (%d bytes)", obj.Size), nil
+	}
+	prefix, err := obj.ReadRange(ctx, 0, 8)
+	if err != nil {
+		return "", fmt.Errorf("failed to read header length: %v", err)
+	}
+	headerLen := binary.LittleEndian.Uint64(prefix)
+	if headerLen == 0 || headerLen > maxSafetensorsHeader || int64(headerLen) > obj.Size-8 {
+		return fmt.Sprintf("safetensors header length %d does not fit a %d byte file", headerLen, obj.Size), nil
+	}
+	header, err := obj.ReadRange(ctx, 8, int64(headerLen))
+	if err != nil {
+		return "", fmt.Errorf("failed to read header: %v", err)
+	}
+	if !json.Valid(bytes.TrimRight(header, " ")) {
+		return "safetensors header is not valid JSON", nil
+	}
+	return "", nil
+}
+
+// CleanupOptions controls CleanupCorrupted.
+type CleanupOptions struct {
+	Prefix      string
+	Concurrency int
+	// DryRun lists what would be deleted without deleting anything.
+	DryRun bool
+	// Checks maps file extensions to their check; nil uses
+	// DefaultCorruptionChecks. Objects with other extensions are skipped.
+	Checks map[string]CorruptionCheck
+	// RateLimit caps how many objects are checked per second across all
+	// workers, to stay under R2's request throttling; 0 means no cap.
+	RateLimit float64
+	// StartAfter skips every key up to and including it, to resume a cleanup
+	// from a CleanupReport.ResumeAfter.
+	StartAfter string
+}
+
+// CorruptObject is an object cleanup found corrupt.
+type CorruptObject struct {
+	Key     string `json:"key"`
+	Size    int64  `json:"size"`
+	Reason  string `json:"reason"`
+	Deleted bool   `json:"deleted"`
+}
+
+// CleanupReport is the outcome of CleanupCorrupted.
+type CleanupReport struct {
+	Checked    int               `json:"checked"`
+	Corrupt    []CorruptObject   `json:"corrupt"`
+	Unverified map[string]string `json:"unverified,omitempty"` // key to the error that stopped its check
+	Listed     int               `json:"listed"`               // objects listed under the prefix, checkable or not
+	// ResumeAfter is set when cleanup stopped early: every key up to and
+	// including it was settled, so it can be passed back as StartAfter.
+	// Objects that could not be checked or deleted don't count as settled.
+	ResumeAfter string `json:"resume_after,omitempty"`
+}
+
+// cleanupProgressInterval is how often a running cleanup logs its progress.
+const cleanupProgressInterval = 10 * time.Second
+
+// cleanupMark tracks the last key up to which every listed object was
+// settled. Workers finish objects out of order, so it waits for gaps to close.
+type cleanupMark struct {
+	next int            // sequence number of the oldest unfinished object
+	keys map[int]string // unfinished objects by sequence number
+	done map[int]bool   // finished objects past next
+	last string         // key of the object before next
+}
+
+func (m *cleanupMark) add(seq int, key string) {
+	m.keys[seq] = key
+}
+
+func (m *cleanupMark) finish(seq int) {
+	m.done[seq] = true
+	for m.done[m.next] {
+		m.last = m.keys[m.next]
+		delete(m.keys, m.next)
+		delete(m.done, m.next)
+		m.next++
+	}
+}
+
+// CleanupCorruptedFiles verifies the parquet and safetensors files under prefix
+// and deletes the corrupt ones.
+func (d *Downloader) CleanupCorruptedFiles(ctx context.Context, r2cfg *R2Config, prefix string, concurrency int) error {
+	_, err := d.CleanupCorrupted(ctx, r2cfg, CleanupOptions{Prefix: prefix, Concurrency: concurrency})
+	return err
+}
+
+// CleanupCorrupted runs the corruption checks over the R2 objects under
+// opts.Prefix and deletes the objects they flag, unless opts.DryRun is set.
+// Deleting an object that is already gone succeeds, so an interrupted cleanup
+// can simply be run again, or resumed from its report's ResumeAfter. Objects
+// are listed a page at a time and fed to the workers as they arrive, so large
+// buckets are never held in memory.
+func (d *Downloader) CleanupCorrupted(ctx context.Context, r2cfg *R2Config, opts CleanupOptions) (*CleanupReport, error) {
+	client := createR2Client(ctx, *r2cfg)
+	checks := opts.Checks
+	if checks == nil {
+		checks = DefaultCorruptionChecks
+	}
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type cleanupJob struct {
+		seq int
+		obj types.Object
+	}
+
+	report := &CleanupReport{Unverified: make(map[string]string)}
+	mark := &cleanupMark{keys: make(map[int]string), done: make(map[int]bool), last: opts.StartAfter}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan cleanupJob, concurrency*2)
+	handled := 0
+	listing := true
+
+	var limiter <-chan time.Time
+	if opts.RateLimit > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.RateLimit))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	stopProgress := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cleanupProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopProgress:
+				return
+			case <-ticker.C:
+				mu.Lock()
+				if listing {
+					d.logf("Progress: %d of %d objects checked (still listing)\n", handled, report.Listed)
+				} else {
+					d.logf("Progress: %d of %d objects checked\n", handled, report.Listed)
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+	defer close(stopProgress)
+
+	worker := func(workerID int) {
+		defer wg.Done()
+		for job := range jobs {
+			if ctx.Err() != nil {
+				continue // drain; the mark stays before this object
+			}
+			// finish counts the object as handled; only settled objects move
+			// the mark, so a resumed run looks at failed ones again
+			finish := func(settled bool) {
+				mu.Lock()
+				handled++
+				if settled {
+					mark.finish(job.seq)
+				}
+				mu.Unlock()
+			}
+			key, size := aws.ToString(job.obj.Key), aws.ToInt64(job.obj.Size)
+			check, ok := checks[path.Ext(key)]
+			if !ok {
+				finish(true)
+				continue
+			}
+			if limiter != nil {
+				select {
+				case <-limiter:
+				case <-ctx.Done():
+					continue
+				}
+			}
+
+			d.debugf("[Worker %d] Checking file: %s (size: %s)\n", workerID, key, formatSize(size))
+			reason, err := d.checkR2Object(ctx, client, r2cfg, key, size, check)
+			if ctx.Err() != nil {
+				continue // interrupted, not checked
+			}
+
+			mu.Lock()
+			report.Checked++
+			mu.Unlock()
+			switch {
+			case err != nil:
+				d.logf("[Worker %d] Warning: could not check %s: %v\n", workerID, key, err)
+				mu.Lock()
+				report.Unverified[key] = err.Error()
+				mu.Unlock()
+				finish(false)
+				continue
+			case reason == "":
+				d.debugf("[Worker %d] ✅ Valid file: %s\n", workerID, key)
+				finish(true)
+				continue
+			}
+
+			corrupt := CorruptObject{Key: key, Size: size, Reason: reason}
+			if opts.DryRun {
+				d.logf("[Worker %d] ❌ Would delete %s: %s\n", workerID, key, reason)
+			} else if _, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(r2cfg.BucketName),
+				Key:    aws.String(key),
+			}); err != nil {
+				d.logf("[Worker %d] Warning: Failed to delete file %s: %v\n", workerID, key, err)
+			} else {
+				corrupt.Deleted = true
+				d.logf("[Worker %d] ❌ Deleted %s: %s\n", workerID, key, reason)
+			}
+			mu.Lock()
+			report.Corrupt = append(report.Corrupt, corrupt)
+			mu.Unlock()
+			finish(corrupt.Deleted || opts.DryRun)
+		}
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go worker(i)
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(r2cfg.BucketName),
+		Prefix: aws.String(opts.Prefix),
+	}
+	if opts.StartAfter != "" {
+		input.StartAfter = aws.String(opts.StartAfter)
+		d.logf("Resuming after %s\n", opts.StartAfter)
+	}
+	paginator := s3.NewListObjectsV2Paginator(client, input)
+	var listErr error
+	seq := 0
+list:
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			listErr = fmt.Errorf("failed to list objects: %w", storageError(err))
+			break
+		}
+		mu.Lock()
+		report.Listed += len(page.Contents)
+		mu.Unlock()
+		d.logf("Retrieved %d objects with prefix %s\n", len(page.Contents), opts.Prefix)
+		for _, obj := range page.Contents {
+			mu.Lock()
+			mark.add(seq, aws.ToString(obj.Key))
+			mu.Unlock()
+			select {
+			case jobs <- cleanupJob{seq: seq, obj: obj}:
+			case <-ctx.Done():
+				break list
+			}
+			seq++
+		}
+	}
+	mu.Lock()
+	listing = false
+	mu.Unlock()
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		// Listing errors after a cancel are only the cancel
+		listErr = fmt.Errorf("%w: %w", ErrInterrupted, ctx.Err())
+	}
+
+	sort.Slice(report.Corrupt, func(i, j int) bool { return report.Corrupt[i].Key < report.Corrupt[j].Key })
+	if listErr != nil {
+		// Everything up to the mark was handled; a rerun from there is enough
+		report.ResumeAfter = mark.last
+		d.logf("Stopped after %d of %d listed objects, resume after %q\n", handled, report.Listed, mark.last)
+		return report, listErr
+	}
+
+	d.logf("\n=== Summary ===\n")
+	d.logf("Objects listed: %d\n", report.Listed)
+	d.logf("Total files checked: %d\n", report.Checked)
+	d.logf("Corrupted files found: %d\n", len(report.Corrupt))
+	if len(report.Unverified) > 0 {
+		d.logf("Files that could not be checked: %d\n", len(report.Unverified))
+	}
+	if report.Checked == 0 {
+		d.logf("Warning: No checkable files found! Verify bucket and prefix.\n")
+	}
+	if opts.DryRun && len(report.Corrupt) > 0 {
+		d.logf("Dry run, nothing deleted.\n")
+	}
+	d.logf("Verification complete!\n")
+	return report, nil
+}
+
+// checkR2Object runs check on an R2 object, then compares its content against
+// the sha256 in its metadata when there is one. A checksum mismatch comes back
+// as an error, so the object is reported but kept.
+func (d *Downloader) checkR2Object(ctx context.Context, client *s3.Client, r2cfg *R2Config, key string, size int64, check CorruptionCheck) (string, error) {
+	if size == 0 {
+		return "empty object", nil
+	}
+	obj := RemoteObject{
+		Key:  key,
+		Size: size,
+		ReadRange: func(ctx context.Context, offset, length int64) ([]byte, error) {
+			out, err := client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(r2cfg.BucketName),
+				Key:    aws.String(key),
+				Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+			})
+			if err != nil {
+				return nil, err
+			}
+			defer out.Body.Close()
+			buf := make([]byte, length)
+			if _, err := io.ReadFull(out.Body, buf); err != nil {
+				return nil, err
+			}
+			return buf, nil
+		},
+	}
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r2cfg.BucketName),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		obj.Metadata = head.Metadata
+	}
+
+	reason, err := check(ctx, obj)
+	if reason != "" || err != nil {
+		return reason, err
+	}
+	if expected := obj.Metadata["sha256"]; expected != "" {
+		return "", verifyRemoteFileChecksum(ctx, r2cfg, key, expected)
+	}
+	return "", nil
+}
@@ -0,0 +1,200 @@
+package hfdownloader
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func safetensors(header string, data string) string {
+	prefix := make([]byte, 8)
+	binary.LittleEndian.PutUint64(prefix, uint64(len(header)))
+	return string(prefix) + header + data
+}
+
+func corruptBucket(t *testing.T) *fakeBucket {
+	return newFakeBucket(t, map[string]string{
+		"ds/good.parquet":        "PAR1 columns PAR1",
+		"ds/truncated.parquet":   "PAR1 columns cut",
+		"ds/empty.parquet":       "",
+		"ds/good.safetensors":    safetensors(`{"w":{}}`, "data"),
+		"ds/bad.safetensors":     safetensors(`{"w":{}}`, "")[:12],
+		"ds/notes.txt":           "",
+		"other/broken.parquet":   "",
+		"ds/sub/nested.parquet":  "PAR1PAR1PAR1",
+		"ds/sub/garbage.parquet": "not parquet at all",
+	})
+}
+
+var wantCorrupt = map[string]string{
+	"ds/bad.safetensors":     "safetensors header length 8 does not fit a 12 byte file",
+	"ds/empty.parquet":       "empty object",
+	"ds/sub/garbage.parquet": "invalid parquet header magic number",
+	"ds/truncated.parquet":   "invalid parquet footer magic number (truncated upload?)",
+}
+
+func TestCleanupDryRunListsWithoutDeleting(t *testing.T) {
+	bucket := corruptBucket(t)
+	var out syncBuffer
+	d := NewDownloader(WithOutput(&out))
+	report, err := d.CleanupCorrupted(context.Background(), bucket.config(), CleanupOptions{Prefix: "ds/", Concurrency: 3, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Corrupt) != len(wantCorrupt) {
+		t.Fatalf("corrupt %+v, want %v", report.Corrupt, wantCorrupt)
+	}
+	for _, obj := range report.Corrupt {
+		if want, ok := wantCorrupt[obj.Key]; !ok || obj.Reason != want || obj.Deleted {
+			t.Errorf("%+v, want reason %q and not deleted", obj, want)
+		}
+		if !strings.Contains(out.String(), "Would delete "+obj.Key+": "+obj.Reason) {
+			t.Errorf("%s not listed in the output", obj.Key)
+		}
+	}
+	if report.Listed != 8 || report.Checked != 7 {
+		t.Errorf("listed %d and checked %d, want 8 and 7", report.Listed, report.Checked)
+	}
+	if len(bucket.deleted) != 0 {
+		t.Fatalf("dry run deleted %v", bucket.deleted)
+	}
+	if !strings.Contains(out.String(), "Dry run, nothing deleted.") {
+		t.Error("dry run not reported")
+	}
+}
+
+func TestCleanupDeletesCorruptObjects(t *testing.T) {
+	bucket := corruptBucket(t)
+	d := NewDownloader(WithOutput(io.Discard))
+	report, err := d.CleanupCorrupted(context.Background(), bucket.config(), CleanupOptions{Prefix: "ds/", Concurrency: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range report.Corrupt {
+		if !obj.Deleted {
+			t.Errorf("%s not deleted", obj.Key)
+		}
+	}
+	for key := range wantCorrupt {
+		if _, ok := bucket.object(key); ok {
+			t.Errorf("%s still in the bucket", key)
+		}
+	}
+	for _, key := range []string{"ds/good.parquet", "ds/good.safetensors", "ds/sub/nested.parquet", "ds/notes.txt", "other/broken.parquet"} {
+		if _, ok := bucket.object(key); !ok {
+			t.Errorf("%s deleted", key)
+		}
+	}
+
+	// Running it again finds nothing left to delete
+	report, err = d.CleanupCorrupted(context.Background(), bucket.config(), CleanupOptions{Prefix: "ds/"})
+	if err != nil || len(report.Corrupt) != 0 {
+		t.Fatalf("second run: %+v, %v", report, err)
+	}
+}
+
+func TestCleanupCustomChecks(t *testing.T) {
+	bucket := corruptBucket(t)
+	d := NewDownloader(WithOutput(io.Discard))
+	checks := map[string]CorruptionCheck{
+		".txt": func(ctx context.Context, obj RemoteObject) (string, error) { return "", nil },
+	}
+	report, err := d.CleanupCorrupted(context.Background(), bucket.config(), CleanupOptions{Prefix: "ds/", DryRun: true, Checks: checks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only notes.txt is checked, and it is empty
+	if report.Checked != 1 || len(report.Corrupt) != 1 || report.Corrupt[0].Key != "ds/notes.txt" {
+		t.Fatalf("%+v, want only ds/notes.txt checked and flagged", report)
+	}
+}
+
+func TestCleanupPagesThroughListing(t *testing.T) {
+	bucket := corruptBucket(t)
+	bucket.pageSize = 3
+	d := NewDownloader(WithOutput(io.Discard))
+	start := time.Now()
+	report, err := d.CleanupCorrupted(context.Background(), bucket.config(), CleanupOptions{Prefix: "ds/", Concurrency: 2, DryRun: true, RateLimit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket.lists != 3 {
+		t.Errorf("%d list requests for 8 objects 3 at a time, want 3", bucket.lists)
+	}
+	if report.Listed != 8 || report.Checked != 7 || len(report.Corrupt) != len(wantCorrupt) {
+		t.Fatalf("listed %d, checked %d, corrupt %+v", report.Listed, report.Checked, report.Corrupt)
+	}
+	// 7 checks at 50 a second can't finish in less than 6 intervals
+	if elapsed := time.Since(start); elapsed < 6*20*time.Millisecond {
+		t.Errorf("7 checks took %s, faster than the rate limit allows", elapsed)
+	}
+}
+
+func TestCleanupDeniedIsAuthError(t *testing.T) {
+	bucket := corruptBucket(t)
+	bucket.denied = true
+	d := NewDownloader(WithOutput(io.Discard))
+	_, err := d.CleanupCorrupted(context.Background(), bucket.config(), CleanupOptions{Prefix: "ds/"})
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("got %v, want ErrAuth", err)
+	}
+}
+
+func TestCleanupResumesAfterInterruption(t *testing.T) {
+	bucket := corruptBucket(t)
+	bucket.pageSize = 3
+	d := NewDownloader(WithOutput(io.Discard))
+
+	// The first run is interrupted while checking the first object of the second page
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checks := make(map[string]CorruptionCheck)
+	for ext, check := range DefaultCorruptionChecks {
+		check := check
+		checks[ext] = func(ctx context.Context, obj RemoteObject) (string, error) {
+			if obj.Key == "ds/good.safetensors" {
+				cancel()
+				return "", ctx.Err()
+			}
+			return check(ctx, obj)
+		}
+	}
+	report, err := d.CleanupCorrupted(ctx, bucket.config(), CleanupOptions{Prefix: "ds/", Concurrency: 1, Checks: checks})
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("error %v, want ErrInterrupted", err)
+	}
+	if report.ResumeAfter != "ds/good.parquet" {
+		t.Fatalf("resume after %q, want ds/good.parquet, the last object settled", report.ResumeAfter)
+	}
+	deleted := map[string]bool{}
+	for _, obj := range report.Corrupt {
+		deleted[obj.Key] = obj.Deleted
+	}
+
+	lists := bucket.lists
+	report, err = d.CleanupCorrupted(context.Background(), bucket.config(), CleanupOptions{Prefix: "ds/", StartAfter: report.ResumeAfter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Listed != 5 || bucket.lists-lists != 2 {
+		t.Errorf("resumed run listed %d objects in %d pages, want 5 in 2", report.Listed, bucket.lists-lists)
+	}
+	for _, obj := range report.Corrupt {
+		if _, ok := deleted[obj.Key]; ok {
+			t.Errorf("%s handled by both runs", obj.Key)
+		}
+		deleted[obj.Key] = obj.Deleted
+	}
+	for key := range wantCorrupt {
+		if !deleted[key] {
+			t.Errorf("%s not deleted by either run", key)
+		}
+		if _, ok := bucket.object(key); ok {
+			t.Errorf("%s still in the bucket", key)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpectCommit(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":       {Content: `{"a":1}`},
+		"model.safetensors": {Content: "weights", LFS: true},
+	})
+	opts := hubOptions(t)
+	opts.ExpectCommit = "fedcba9876543210fedcba9876543210fedcba98"
+	d, _ := hub.downloader()
+	_, err := d.Download(context.Background(), opts)
+	if !errors.Is(err, ErrCommitMismatch) || !strings.Contains(err.Error(), testCommit) {
+		t.Fatalf("error %v, want a mismatch naming %s", err, testCommit)
+	}
+	if n := hub.hits("/tree/") + hub.hits("/resolve/"); n != 0 {
+		t.Fatalf("%d listing or download requests after a commit mismatch", n)
+	}
+
+	for _, expect := range []string{testCommit, strings.ToUpper(testCommit[:7])} {
+		opts := hubOptions(t)
+		opts.ExpectCommit = expect
+		d, out := hub.downloader()
+		before := hub.hits("/resolve/")
+		result, err := d.Download(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("expecting %s: %v\n%s", expect, err, out)
+		}
+		if result.Commit != testCommit || result.Files != 2 {
+			t.Errorf("expecting %s: commit %s, %d files", expect, result.Commit, result.Files)
+		}
+		// Files come from the pinned commit, not from whatever main is by then
+		if n := hub.hits("/resolve/" + testCommit + "/"); n-before != 2 {
+			t.Errorf("expecting %s: %d downloads pinned to the commit, want 2", expect, n-before)
+		}
+		manifest, err := LoadManifest(filepath.Join(opts.Storage, "o", "m"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manifest.Commit != testCommit {
+			t.Errorf("expecting %s: manifest records commit %q", expect, manifest.Commit)
+		}
+	}
+
+	opts = hubOptions(t)
+	opts.ExpectCommit = "main"
+	if _, err := d.Download(context.Background(), opts); err == nil || errors.Is(err, ErrCommitMismatch) {
+		t.Fatalf("error %v, want the malformed SHA rejected", err)
+	}
+}
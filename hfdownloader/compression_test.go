@@ -0,0 +1,73 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// jsonRows is a JSON lines file of n rows, the kind of text gzip shrinks well.
+func jsonRows(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `{"id":%d,"text":"the quick brown fox jumps over the lazy dog","label":"positive"}`+"\n", i)
+	}
+	return b.String()
+}
+
+func TestTransferCompression(t *testing.T) {
+	content := jsonRows(2000)
+	for _, tc := range []struct {
+		served  string // what the hub encodes with when asked
+		disable bool
+	}{{"zstd", false}, {"gzip", false}, {"zstd", true}} {
+		hub := newFakeHub(t, map[string]hubFile{"train.jsonl": {Content: content, LFS: true}})
+		hub.encoding = tc.served
+		hub.transport = withCompression(newTransport(TransportOptions{}), tc.disable)
+		opts := hubOptions(t)
+		d, _ := hub.downloader()
+		if _, err := d.Download(context.Background(), opts); err != nil {
+			t.Fatalf("%s, disabled %v: %v", tc.served, tc.disable, err)
+		}
+		// The checksum is of the decoded bytes, so the download passing verification
+		// shows the content was decoded before hashing
+		if got, _ := os.ReadFile(filepath.Join(opts.Storage, "o", "m", "train.jsonl")); string(got) != content {
+			t.Fatalf("%s, disabled %v: stored %d bytes, want %d", tc.served, tc.disable, len(got), len(content))
+		}
+		accept := hub.requestsTo("/resolve/")[0].Header.Get("Accept-Encoding")
+		if want := map[bool]string{false: "zstd, gzip", true: ""}[tc.disable]; accept != want {
+			t.Fatalf("%s, disabled %v: sent Accept-Encoding %q, want %q", tc.served, tc.disable, accept, want)
+		}
+		if compressed := hub.wire.Load() < int64(len(content))/4; compressed == tc.disable {
+			t.Fatalf("%s, disabled %v: %d bytes on the wire for %d of content", tc.served, tc.disable, hub.wire.Load(), len(content))
+		}
+	}
+}
+
+// BenchmarkTransferCompression reports the bytes sent for a JSON-heavy file
+// with each transfer encoding.
+func BenchmarkTransferCompression(b *testing.B) {
+	content := jsonRows(20000)
+	for _, tc := range []struct {
+		name    string
+		disable bool
+	}{{"zstd", false}, {"gzip", false}, {"identity", true}} {
+		b.Run(tc.name, func(b *testing.B) {
+			hub := newFakeHub(b, map[string]hubFile{"train.jsonl": {Content: content, LFS: true}})
+			hub.encoding = tc.name
+			hub.transport = withCompression(newTransport(TransportOptions{}), tc.disable)
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				opts := DownloadOptions{Repo: "o/m", Branch: "main", Storage: b.TempDir(), MaxWorkers: 1}
+				d, _ := hub.downloader()
+				if _, err := d.Download(context.Background(), opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(hub.wire.Load())/float64(b.N), "wire-B/op")
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package hfdownloader
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// downloadGunzipped is downloadToLocal for .gz files fetched with Decompress: the
+// body is expanded on the fly into localPath, while the SHA256 is computed over
+// the compressed bytes, since that is what the Hub records.
+func (d *Downloader) downloadGunzipped(body io.Reader, file hfmodel, localPath string, skipSHA bool) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", localPath, err)
+	}
+
+	partPath := localPath + ".part"
+	out, release, err := d.createFile(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", partPath, err)
+	}
+
+	hash := newContentHash(file)
+	progress := d.createProgressBar(int64(file.Size), filepath.Base(file.Path))
+	compressed := io.TeeReader(newProgressReader(body, progress), hash)
+
+	gz, err := gzip.NewReader(compressed)
+	if err == nil {
+		_, err = d.copy(out, gz)
+		if err == nil {
+			// Anything the gzip reader left unread still counts towards the hash
+			_, err = io.Copy(io.Discard, compressed)
+		}
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	release()
+	if err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("failed to decompress %s: %w", file.Path, diskError(err))
+	}
+
+	if !skipSHA {
+		if err := checkContentHash(file, hash); err != nil {
+			os.Remove(partPath)
+			return err
+		}
+	}
+
+	if err := os.Rename(partPath, localPath); err != nil {
+		return fmt.Errorf("failed to finalize %s: %v", localPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package hfdownloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, content string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDecompress(t *testing.T) {
+	rows := strings.Repeat(`{"text":"hello"}`+"\n", 100)
+	// The listed SHA256 is of the compressed bytes, as on the Hub
+	hub := newFakeHub(t, map[string]hubFile{
+		"data/train.jsonl.gz": {Content: gzipped(t, rows), LFS: true},
+		"README.md":           {Content: "# data"},
+	})
+	opts := hubOptions(t)
+	opts.Decompress = true
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(opts.Storage, "o", "m")
+	if got, err := os.ReadFile(filepath.Join(dir, "data", "train.jsonl")); err != nil || string(got) != rows {
+		t.Fatalf("train.jsonl = %d bytes, %v; want the %d expanded bytes", len(got), err, len(rows))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data", "train.jsonl.gz")); !os.IsNotExist(err) {
+		t.Fatalf("compressed file kept: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "README.md")); string(got) != "# data" {
+		t.Fatalf("README.md = %q, want it untouched", got)
+	}
+}
@@ -0,0 +1,117 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// duplicateFile is a file whose LFS blob is also stored at primary's path, so
+// it is linked to primary's local copy instead of being fetched again.
+type duplicateFile struct {
+	file    hfmodel
+	primary hfmodel
+}
+
+// splitDuplicates keeps the first file of every LFS blob in files and returns
+// the later ones, which share its OID, separately.
+func splitDuplicates(files []hfmodel) ([]hfmodel, []duplicateFile) {
+	var unique []hfmodel
+	var duplicates []duplicateFile
+	seen := make(map[string]hfmodel)
+	for _, file := range files {
+		if file.Lfs == nil || file.Lfs.Oid_SHA265 == "" {
+			unique = append(unique, file)
+			continue
+		}
+		if primary, ok := seen[file.Lfs.Oid_SHA265]; ok {
+			duplicates = append(duplicates, duplicateFile{file: file, primary: primary})
+			continue
+		}
+		seen[file.Lfs.Oid_SHA265] = file
+		unique = append(unique, file)
+	}
+	return unique, duplicates
+}
+
+// linkDuplicates gives every duplicate the content of its primary's local copy,
+// hard linking where the filesystem allows and copying otherwise. It runs once
+// all downloads have finished; duplicates of a failed primary fail too, and
+// those of a primary that was never reached are left for the next run.
+func (d *Downloader) linkDuplicates(duplicates []duplicateFile, modelPath string, opts DownloadOptions, manifest *Manifest, failed map[string]bool, fail func(string, error)) {
+	for _, dup := range duplicates {
+		if failed[dup.primary.Path] {
+			fail(dup.file.Path, fmt.Errorf("same blob as %s, which failed to download", dup.primary.Path))
+			continue
+		}
+		primaryName, _ := localPathFor(opts, dup.primary.Path)
+		localName, _ := localPathFor(opts, dup.file.Path)
+		src := filepath.Join(modelPath, primaryName)
+		dst := filepath.Join(modelPath, localName)
+		srcInfo, err := os.Stat(src)
+		if err != nil {
+			continue
+		}
+		if dstInfo, err := os.Stat(dst); err == nil && os.SameFile(srcInfo, dstInfo) {
+			continue
+		}
+
+		linked, err := linkOrCopy(src, dst)
+		if err != nil {
+			d.logf("Error linking %s to %s: %v\n", dup.file.Path, dup.primary.Path, err)
+			fail(dup.file.Path, err)
+			continue
+		}
+		if entry, ok := manifest.Get(dup.primary.Path); ok {
+			entry.Updated = time.Now()
+			entry.LocalPath = opts.Rename[dup.file.Path]
+			manifest.Set(dup.file.Path, entry)
+		}
+		if !opts.SilentMode {
+			how := "Copied"
+			if linked {
+				how = "Hard linked"
+			}
+			d.logf("%s %s from %s (same blob)\n", how, dup.file.Path, dup.primary.Path)
+		}
+	}
+}
+
+// linkOrCopy makes dst a hard link to src, falling back to a copy through a
+// .part file on filesystems without hard links. It reports whether it linked.
+func linkOrCopy(src, dst string) (bool, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, fmt.Errorf("failed to create directory for %s: %v", dst, err)
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to replace %s: %v", dst, err)
+	}
+	if err := os.Link(src, dst); err == nil {
+		return true, nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %v", src, err)
+	}
+	defer in.Close()
+	partPath := dst + ".part"
+	out, err := os.Create(partPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to create %s: %v", partPath, err)
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return false, fmt.Errorf("failed to copy to %s: %w", partPath, diskError(err))
+	}
+	if err := os.Rename(partPath, dst); err != nil {
+		return false, fmt.Errorf("failed to finalize %s: %v", dst, err)
+	}
+	return false, nil
+}
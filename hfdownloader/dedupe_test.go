@@ -0,0 +1,45 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupeByHash(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"base/model.safetensors":    {Content: "shared weights", LFS: true},
+		"variant/model.safetensors": {Content: "shared weights", LFS: true},
+		"variant/adapter.bin":       {Content: "adapter", LFS: true},
+	})
+	opts := hubOptions(t)
+	opts.DedupeByHash = true
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if n := hub.hits("/model.safetensors"); n != 1 {
+		t.Fatalf("shared blob fetched %d times, want once", n)
+	}
+	if hub.hits("/resolve/main/variant/adapter.bin") != 1 {
+		t.Fatal("unique file not fetched")
+	}
+
+	dir := filepath.Join(opts.Storage, "o", "m")
+	var infos []os.FileInfo
+	for _, name := range []string{"base/model.safetensors", "variant/model.safetensors"} {
+		local := filepath.Join(dir, filepath.FromSlash(name))
+		if got, _ := os.ReadFile(local); string(got) != "shared weights" {
+			t.Fatalf("%s = %q", name, got)
+		}
+		info, err := os.Stat(local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos = append(infos, info)
+	}
+	if !os.SameFile(infos[0], infos[1]) {
+		t.Logf("copies are not hard linked on this filesystem")
+	}
+}
@@ -0,0 +1,42 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkRequiredFree fails with ErrBelowFreeFloor when the filesystem holding
+// opts.RequireFreePath, or the download folder, has less than opts.RequireFree
+// bytes free. It is a fixed floor, whatever the download's size.
+func checkRequiredFree(opts DownloadOptions) error {
+	if opts.RequireFree <= 0 {
+		return nil
+	}
+	path := opts.RequireFreePath
+	if path == "" {
+		path = opts.Storage
+		if opts.HubCache != "" {
+			path = opts.HubCache
+		}
+	}
+	// The folder may not exist yet; its filesystem is that of its nearest parent
+	dir := path
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check free space on %s: %v", path, err)
+	}
+	if int64(free) < opts.RequireFree {
+		return fmt.Errorf("%w: %s has %s free, %s required", ErrBelowFreeFloor, path, formatSize(int64(free)), formatSize(opts.RequireFree))
+	}
+	return nil
+}
+
+// freeSpace is FreeSpace, swappable to check the floor against other disks.
+var freeSpace = FreeSpace
@@ -0,0 +1,57 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequireFree(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: "weights", LFS: true}})
+	var checked []string
+	freeSpace = func(path string) (uint64, error) {
+		checked = append(checked, path)
+		return 10 << 20, nil
+	}
+	t.Cleanup(func() { freeSpace = FreeSpace })
+
+	opts := hubOptions(t)
+	opts.Storage = filepath.Join(opts.Storage, "not", "created", "yet")
+	opts.RequireFree = 11 << 20
+	d, _ := hub.downloader()
+	_, err := d.Download(context.Background(), opts)
+	if !errors.Is(err, ErrBelowFreeFloor) || !errors.Is(err, ErrDiskFull) {
+		t.Fatalf("error %v, want ErrBelowFreeFloor", err)
+	}
+	if len(hub.requestsTo("/")) != 0 {
+		t.Fatal("requests made below the free space floor")
+	}
+	// A folder that doesn't exist yet is checked on its nearest parent
+	if want := filepath.Dir(filepath.Dir(filepath.Dir(opts.Storage))); len(checked) != 1 || checked[0] != want {
+		t.Fatalf("checked %q, want %s", checked, want)
+	}
+
+	// The floor applies whatever the download's size
+	opts.RequireFree = 10 << 20
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	checked = nil
+	opts = hubOptions(t)
+	opts.RequireFree = 1
+	opts.RequireFreePath = t.TempDir()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(checked) != 1 || checked[0] != opts.RequireFreePath {
+		t.Fatalf("checked %q, want --require-free-path %s", checked, opts.RequireFreePath)
+	}
+
+	freeSpace = func(path string) (uint64, error) { return 0, errors.New("statfs failed") }
+	if _, err := d.Download(context.Background(), opts); err == nil || errors.Is(err, ErrBelowFreeFloor) {
+		t.Fatalf("error %v, want the failed check reported", err)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package hfdownloader
+
+import "golang.org/x/sys/windows"
+
+// FreeSpace returns the bytes available to the current user on the volume
+// holding path.
+func FreeSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(dir, &available, nil, nil); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
@@ -0,0 +1,136 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	HubURL        = "https://huggingface.co"
+	JsonWhoAmIURL = "https://huggingface.co/api/whoami-v2"
+)
+
+// Check is one line of the doctor checklist.
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// DoctorOptions selects what Doctor checks.
+type DoctorOptions struct {
+	Token   string
+	Storage string
+	R2      *R2Config // checked when set
+}
+
+// Doctor checks the things a download depends on: reaching the Hub, the token,
+// the storage folder and, when configured, R2 credentials. Every check runs even
+// if an earlier one failed.
+func (d *Downloader) Doctor(ctx context.Context, opts DoctorOptions) []Check {
+	checks := []Check{checkHub(ctx, d.client())}
+	checks = append(checks, checkToken(ctx, d.client(), opts.Token))
+	checks = append(checks, checkStorage(opts.Storage))
+	if opts.R2 != nil {
+		checks = append(checks, checkR2(ctx, opts.R2))
+	}
+	return checks
+}
+
+func checkHub(ctx context.Context, client *http.Client) Check {
+	check := Check{Name: "Network"}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", HubURL, nil)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		check.Detail = fmt.Sprintf("cannot reach %s: %v", HubURL, err)
+		return check
+	}
+	resp.Body.Close()
+	check.OK = true
+	check.Detail = fmt.Sprintf("%s answered %d in %s", HubURL, resp.StatusCode, time.Since(start).Round(time.Millisecond))
+	return check
+}
+
+func checkToken(ctx context.Context, client *http.Client, token string) Check {
+	check := Check{Name: "Token"}
+	if token == "" {
+		// Public repos work without one, so this isn't a failure
+		check.OK = true
+		check.Detail = "no token set, only public repos can be downloaded"
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var whoami struct {
+		Name string `json:"name"`
+	}
+	if err := getHubJSON(ctx, client, JsonWhoAmIURL, token, &whoami); err != nil {
+		check.Detail = fmt.Sprintf("token rejected: %v", err)
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("authenticated as %s", whoami.Name)
+	return check
+}
+
+func checkStorage(storage string) Check {
+	check := Check{Name: "Storage"}
+	if err := os.MkdirAll(storage, 0755); err != nil {
+		check.Detail = fmt.Sprintf("cannot create %s: %v", storage, err)
+		return check
+	}
+	probe, err := os.CreateTemp(storage, ".hfdownloader-doctor-*")
+	if err != nil {
+		check.Detail = fmt.Sprintf("%s is not writable: %v", storage, err)
+		return check
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	abs, _ := filepath.Abs(storage)
+	free, err := FreeSpace(storage)
+	if err != nil {
+		check.OK = true
+		check.Detail = fmt.Sprintf("%s is writable, free space unknown: %v", abs, err)
+		return check
+	}
+	check.OK = free > 0
+	check.Detail = fmt.Sprintf("%s is writable, %s free", abs, formatSize(int64(free)))
+	return check
+}
+
+func checkR2(ctx context.Context, r2cfg *R2Config) Check {
+	check := Check{Name: "R2"}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	client := createR2Client(ctx, *r2cfg)
+	_, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(r2cfg.BucketName),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		check.Detail = fmt.Sprintf("cannot list bucket %s: %v", r2cfg.BucketName, err)
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("credentials can list bucket %s", r2cfg.BucketName)
+	return check
+}
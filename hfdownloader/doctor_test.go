@@ -0,0 +1,37 @@
+package hfdownloader
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{})
+	bucket := newFakeBucket(t, nil)
+	d, _ := hub.downloader()
+	opts := DoctorOptions{Storage: t.TempDir(), R2: bucket.config()}
+	for _, check := range d.Doctor(context.Background(), opts) {
+		if !check.OK {
+			t.Errorf("%s failed: %s", check.Name, check.Detail)
+		}
+	}
+
+	// A rejected token and a bucket refusing the keys fail, without stopping the other checks
+	hub.fail = func(r *http.Request) int {
+		if r.URL.Path == "/api/whoami-v2" {
+			return http.StatusUnauthorized
+		}
+		return 0
+	}
+	bucket.denied = true
+	opts.Token = "hf_bad"
+	failed := map[string]bool{}
+	checks := d.Doctor(context.Background(), opts)
+	for _, check := range checks {
+		failed[check.Name] = !check.OK
+	}
+	if len(checks) != 4 || failed["Network"] || !failed["Token"] || failed["Storage"] || !failed["R2"] {
+		t.Fatalf("checks %+v, want only Token and R2 failing", checks)
+	}
+}
@@ -0,0 +1,404 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Downloader carries the settings shared by all downloads, such as where progress
+// bars and diagnostic output are written. The zero value is not usable; create
+// one with NewDownloader.
+type Downloader struct {
+	out         io.Writer
+	chunkSize   int
+	lowMemory   bool
+	shouldRetry func(err error, attempt int) bool
+	httpClient  *http.Client // Hub and CDN requests, the package's shared client when nil
+	logger      *slog.Logger // diagnostic output, plain lines on out unless WithLogger is used
+
+	maxOpenFiles     int
+	openFiles        chan struct{} // destination file slots, nil when unbounded
+	openFilesClamped bool
+}
+
+// Bounds and default for the download copy buffer.
+const (
+	MinChunkSize     = 4 * 1024
+	MaxChunkSize     = 64 * 1024 * 1024
+	DefaultChunkSize = 32 * 1024
+)
+
+// Limits set by WithLowMemory.
+const (
+	LowMemoryWorkers       = 2               // concurrent files
+	LowMemoryChunkSize     = 16 * 1024       // copy buffer, unless WithChunkSize says otherwise
+	LowMemoryPartSize      = 8 * 1024 * 1024 // R2 multipart part size, grown only to stay under 10,000 parts
+	LowMemoryPartsInFlight = 1               // R2 part buffers held per streamed file
+)
+
+// Option configures a Downloader.
+type Option func(*Downloader)
+
+// WithOutput routes all progress and diagnostic output to w instead of stdout.
+// Pass io.Discard to silence the downloader entirely.
+func WithOutput(w io.Writer) Option {
+	return func(d *Downloader) {
+		d.out = w
+	}
+}
+
+// WithChunkSize sets the buffer used to copy download bodies, which is also the
+// granularity of progress updates. Larger buffers help on high-latency links,
+// smaller ones save memory. See ValidateChunkSize for the accepted range.
+func WithChunkSize(size int) Option {
+	return func(d *Downloader) {
+		d.chunkSize = size
+	}
+}
+
+// WithLowMemory trades speed for a small, predictable footprint on devices
+// with little RAM: at most LowMemoryWorkers files at once, a LowMemoryChunkSize
+// copy buffer and a single LowMemoryPartSize buffer per streamed R2 upload.
+func WithLowMemory() Option {
+	return func(d *Downloader) {
+		d.lowMemory = true
+	}
+}
+
+// WithShouldRetry replaces the policy deciding whether a failed request is
+// retried, e.g. to retry 404s from an eventually consistent mirror. attempt
+// counts from 1 for the request that just failed. Returning true retries it
+// after the usual exponential backoff, and never beyond the attempt limit;
+// returning false fails it at once. See DefaultShouldRetry for the default.
+func WithShouldRetry(shouldRetry func(err error, attempt int) bool) Option {
+	return func(d *Downloader) {
+		d.shouldRetry = shouldRetry
+	}
+}
+
+// WithHTTPClient sends every Hub and CDN request through client instead of
+// the package's shared one, e.g. to add a tracing transport or to point the
+// downloader at an httptest.Server. TransportOptions and ConfigureTransport
+// don't apply to it, and R2, GCS and Azure uploads keep their own clients.
+// A nil CheckRedirect is replaced by one that drops the token on redirects to
+// presigned or other-host URLs and follows at most 10 hops.
+//
+// The downloader bounds requests itself with contexts: 30 seconds for API
+// calls and redirect lookups, 2 minutes for listing a folder, 30 minutes per
+// file and 24 hours for a whole Download. A client Timeout applies on top and
+// includes reading the body, so keep it at 0 or above the longest file
+// transfer. The shared client uses 10 minutes, 10 second dial and TLS
+// handshake timeouts, and closes idle connections after 30 seconds.
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Downloader) {
+		if client == nil {
+			d.httpClient = nil
+			return
+		}
+		c := *client
+		if c.CheckRedirect == nil {
+			c.CheckRedirect = checkRedirect
+		}
+		d.httpClient = &c
+	}
+}
+
+// client returns the HTTP client for Hub and CDN requests, logging each one
+// when the logger is at debug level.
+func (d *Downloader) client() *http.Client {
+	client := httpClient
+	if d.httpClient != nil {
+		client = d.httpClient
+	}
+	if !d.logger.Enabled(context.Background(), slog.LevelDebug) {
+		return client
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	logged := *client
+	logged.Transport = &loggingTransport{next: next, logger: d.logger}
+	return &logged
+}
+
+// NewDownloader returns a Downloader writing to stdout unless configured otherwise.
+func NewDownloader(opts ...Option) *Downloader {
+	d := &Downloader{out: os.Stdout}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.out == nil {
+		d.out = io.Discard
+	}
+	if d.logger == nil {
+		d.logger = slog.New(NewPlainHandler(d.out, nil))
+	}
+	if d.shouldRetry == nil {
+		d.shouldRetry = DefaultShouldRetry
+	}
+	if d.chunkSize <= 0 {
+		d.chunkSize = DefaultChunkSize
+		if d.lowMemory {
+			d.chunkSize = LowMemoryChunkSize
+		}
+	}
+	d.initOpenFiles()
+	return d
+}
+
+// ValidateChunkSize checks a chunk size is within MinChunkSize and MaxChunkSize.
+func ValidateChunkSize(size int64) error {
+	if size < MinChunkSize || size > MaxChunkSize {
+		return fmt.Errorf("chunk size %s out of range, expected %s to %s", formatSize(size), formatSize(MinChunkSize), formatSize(MaxChunkSize))
+	}
+	return nil
+}
+
+// ParseSize parses a byte size such as "512KB", "1MB" or "4096". Units are
+// binary, so 1KB is 1024 bytes.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number with an optional KB/MB/GB suffix", value)
+	}
+	return n * multiplier, nil
+}
+
+func (d *Downloader) logf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	d.log(levelOf(msg), msg)
+}
+
+func (d *Downloader) logln(args ...interface{}) {
+	msg := fmt.Sprintln(args...)
+	d.log(levelOf(msg), msg)
+}
+
+// debugf is logf for per-file and per-request detail, only shown at debug level.
+func (d *Downloader) debugf(format string, args ...interface{}) {
+	d.log(slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+// copy is io.Copy with the configured chunk size. The source is wrapped so that
+// WriterTo/ReaderFrom shortcuts cannot bypass the buffer.
+func (d *Downloader) copy(dst io.Writer, src io.Reader) (int64, error) {
+	return io.CopyBuffer(dst, struct{ io.Reader }{src}, make([]byte, d.chunkSize))
+}
+
+// DownloadOptions describes a single model, dataset or Space download.
+type DownloadOptions struct {
+	Repo                string            // model or dataset name, e.g. "org/name"
+	IsDataset           bool              // Repo is a dataset rather than a model
+	RepoType            RepoType          // kind of repo, overrides IsDataset when set
+	Branch              string            // branch or revision to download
+	BranchFallback      []string          // revisions to try in order when Branch does not exist
+	Storage             string            // local base path; files land under Storage/Repo
+	HubCache            string            // when set, store the repo in this huggingface_hub cache (e.g. ~/.cache/huggingface/hub) instead of Storage
+	AppendFilterToPath  bool              // append filter names to the destination folder
+	SkipSHA             bool              // skip SHA256 verification of LFS files
+	QuickVerify         bool              // keep existing files of the right size only if a hash of their ends matches, fully verifying them after the downloads
+	QuickVerifySize     int64             // bytes QuickVerify hashes at each end, DefaultQuickVerifySize when 0
+	OnlyMissing         bool              // keep every local file whose name and size match, without hashing it or revalidating its ETag; exclusive with QuickVerify
+	Connections         int               // Deprecated: unused, see MaxWorkers and TransportOptions.MaxConnsPerHost
+	Token               string            // HuggingFace access token
+	SilentMode          bool              // suppress per-file progress output
+	R2                  *R2Config         // upload to R2 when set
+	GCS                 *GCSConfig        // upload to Google Cloud Storage when set; exclusive with R2
+	Azure               *AzureConfig      // upload to Azure Blob Storage when set; exclusive with R2 and GCS
+	SkipLocal           bool              // with R2, GCS or Azure, stream uploads without a local copy
+	Tee                 bool              // with R2, write the local copy and upload in one pass instead of uploading once the file is staged
+	HFPrefix            string            // only fetch files under this repo folder, or folders matching it when it is a glob like "data/*/train"
+	Dirs                []string          // only fetch files under these repo folders, see NormalizeDirs
+	StripPrefix         bool              // store files relative to the folder the Dirs share, e.g. subset_A/x as x; uploads keep repo paths
+	MaxWorkers          int               // worker goroutines, defaults to AutoWorkers
+	AdaptiveConcurrency bool              // start with a few workers, adding more while throughput improves and halving them when throttled; the worker count is the ceiling
+	DatasetWorkers      int               // worker goroutines for datasets, defaults to MaxWorkers
+	MetadataWorkers     int               // concurrent tree listing requests while enumerating, DefaultMetadataWorkers when 0; 1 lists one folder at a time
+	VerifyWorkers       int               // when set, files only kept locally are hashed by this many goroutines after download instead of as they stream, freeing workers for the network
+	MaxParallelLarge    int               // files of LargeFileThreshold or more transferring at once, on top of the worker limit; 0 for no extra limit
+	LargeFileThreshold  int64             // size in bytes from which MaxParallelLarge applies, DefaultLargeFileThreshold when 0
+	PreferFormat        string            // FormatSafetensors or FormatPytorch, empty for both
+	Include             []string          // glob patterns; when set only matching files are fetched
+	Exclude             []string          // glob patterns for files to leave out
+	Extensions          []string          // only fetch files with one of these extensions, e.g. "gguf", case-insensitive, on top of the other filters
+	AlwaysFetch         []string          // glob patterns for files downloaded again on every run, even when present
+	AlwaysFetchRegular  bool              // download every regular (non-LFS) file again on every run, e.g. configs and tokenizers
+	FailOnMissing       bool              // fail when an Include pattern matches nothing
+	Since               time.Time         // only fetch files last changed after this time
+	SinceStrict         bool              // with Since, also skip files without commit info
+	TouchTimestamps     bool              // set each downloaded file's modification time to its last commit date, when the Hub lists one
+	ShutdownGrace       time.Duration     // how long in-flight files may finish after cancellation, 0 for no limit
+	ContinueOnError     bool              // keep downloading after a file fails instead of stopping at the first failure
+	RedownloadCorrupted int               // times a file failing its hash check is downloaded again at once before it fails, 0 for the default
+	SHAMismatch         MismatchPolicies  // what a failed hash check does, per kind of file; see MismatchPolicies for the defaults
+	MaxFiles            int               // only fetch the first MaxFiles selected files by path, 0 for all
+	MaxTotalSize        int64             // only fetch selected files by path while their total stays within this many bytes, 0 for no limit
+	RequireFree         int64             // refuse to start unless RequireFreePath's filesystem has this many bytes free, 0 for no floor
+	RequireFreePath     string            // where RequireFree is checked, the storage folder when empty
+	Decompress          bool              // expand .gz files locally, storing them without the suffix
+	NoDownloadParam     bool              // don't add ?download=true to resolve URLs, for mirrors that reject it
+	Mirrors             []string          // base URLs file content is fetched from, failing over between them; the Hub when empty
+	MirrorAuth          bool              // send the token to every mirror, not just to huggingface.co
+	DedupeByHash        bool              // fetch each LFS blob once and hard link (or copy) it to the other paths sharing it
+	DerefSymlinks       bool              // store a copy of each repo symlink's target instead of recreating the link
+	SkipPointers        bool              // don't store files whose content turns out to be a Git LFS pointer
+	StateFile           string            // job state location, StateFileName in the download folder when empty
+	ResetState          bool              // ignore and remove any saved job state
+	Rename              map[string]string // repo path to the path it is stored under locally, see ParseRenames; uploads keep repo paths
+	WeightsOnly         bool              // skip documentation and media files, keeping weights, configs and tokenizer files
+	FromIndex           bool              // only the shards a model.safetensors.index.json (or pytorch_model.bin.index.json) references, plus it and the config and tokenizer files
+	DocPatterns         []string          // what WeightsOnly skips, DefaultDocPatterns when nil
+
+	// Transforms run on each matching file once it is downloaded and verified,
+	// before OnFileComplete; see ParseTransform. They need a local copy, so
+	// files streamed straight to a bucket are not transformed.
+	Transforms []FileTransform
+
+	// OnFileComplete, when set, is called after each file has been downloaded and
+	// verified. Calls are serialized. Returning an error marks the file failed.
+	OnFileComplete func(FileEvent) error
+
+	ManifestKey         []byte   // HMAC key checked against manifest signatures on load
+	SignManifest        bool     // sign the manifest with ManifestKey whenever it is saved
+	NoOverwriteManifest bool     // never replace an existing manifest, e.g. one maintained by someone else
+	Attestation         string   // after a successful run, write an Attestation of the downloaded files to this path
+	ExpectCommit        string   // fail before fetching anything unless the revision resolves to this commit SHA, or one starting with it
+	ChecksumFile        string   // after a successful run, write the SHA256 of every downloaded file to this path
+	ChecksumFormat      string   // ChecksumSHA256Sum (the default), ChecksumJSON or ChecksumCSV
+	ReportFiles         []string // other files the caller writes about the run, e.g. reports; mirroring and verification never count them as repo files
+	GitLayout           bool     // after a successful run, make the download folder a git repository pointing at the Hub repo and commit
+}
+
+// FileEvent describes a file that finished downloading.
+type FileEvent struct {
+	Path      string // repo path
+	LocalPath string // local copy, empty when streamed straight to a bucket
+	Key       string // object key when uploading
+	Size      int64
+}
+
+// FileError records a file that could not be downloaded.
+type FileError struct {
+	Path    string `json:"path"`
+	Message string `json:"error"`
+	Err     error  `json:"-"`
+}
+
+func (e FileError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Unwrap returns the underlying error.
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// FileTransfer records the bytes actually moved for one file: read from the Hub
+// and handed to the upload backend, counted as they pass through.
+type FileTransfer struct {
+	Path            string `json:"path"`
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	BytesUploaded   int64  `json:"bytes_uploaded"`
+}
+
+// DownloadResult reports what a download did.
+type DownloadResult struct {
+	Revision        string         `json:"revision"`               // branch, tag or commit downloaded, after any fallback
+	Commit          string         `json:"commit,omitempty"`       // commit SHA the revision resolved to, empty if the Hub didn't say
+	Files           int            `json:"files"`                  // selected files, whether transferred this run or already present
+	Failed          []FileError    `json:"failed,omitempty"`       // files that could not be downloaded
+	Transfers       []FileTransfer `json:"transfers,omitempty"`    // files that were transferred, successfully or not
+	Pointers        []string       `json:"lfs_pointers,omitempty"` // regular files whose content is a Git LFS pointer
+	BytesDownloaded int64          `json:"bytes_downloaded"`
+	BytesUploaded   int64          `json:"bytes_uploaded"`
+	Budget          *BudgetUsage   `json:"budget,omitempty"` // how much of the selection MaxTotalSize let through, when set
+
+	listed []hfmodel // the full remote listing, nil when a saved file list was reused
+}
+
+// BudgetUsage is how much of the selection fit within DownloadOptions.MaxTotalSize.
+type BudgetUsage struct {
+	Files      int   `json:"files"` // selected files within the budget, whether fetched this run or already present
+	Bytes      int64 `json:"bytes"`
+	TotalFiles int   `json:"total_files,omitempty"` // selected files before the budget, 0 when a saved file list was reused
+	TotalBytes int64 `json:"total_bytes,omitempty"`
+}
+
+// ErrInterrupted is returned by Download when its context was cancelled before
+// every file was scheduled, and by CleanupCorrupted before every object was
+// checked.
+var ErrInterrupted = errors.New("download interrupted")
+
+// ErrTimeout is returned by Download, wrapping ErrInterrupted, when its context
+// hit its deadline rather than being cancelled.
+var ErrTimeout = errors.New("download timed out")
+
+// ErrFilesFailed is returned by Download when one or more files failed; the
+// failures themselves are listed in DownloadResult.Failed.
+var ErrFilesFailed = errors.New("some files failed to download")
+
+// DownloadWithOptions downloads the repo described by opts using a default
+// Downloader that writes its output to stdout.
+func DownloadWithOptions(opts DownloadOptions) error {
+	return NewDownloader().DownloadWithOptions(opts)
+}
+
+// DownloadModel downloads a model or dataset using a default Downloader that
+// writes its output to stdout.
+//
+// Deprecated: use DownloadWithOptions, which takes named options.
+func DownloadModel(ModelDatasetName string, AppendFilterToPath bool, SkipSHA bool, IsDataset bool, DestinationBasePath string, ModelBranch string, concurrentConnections int, token string, silentMode bool, r2cfg *R2Config, skipLocal bool, hfPrefix string, maxWorkers int, preferFormat string) error {
+	return NewDownloader().DownloadModel(ModelDatasetName, AppendFilterToPath, SkipSHA, IsDataset, DestinationBasePath, ModelBranch, concurrentConnections, token, silentMode, r2cfg, skipLocal, hfPrefix, maxWorkers, preferFormat)
+}
+
+// DownloadModel is the positional form of DownloadWithOptions.
+//
+// Deprecated: use DownloadWithOptions, which takes named options.
+func (d *Downloader) DownloadModel(ModelDatasetName string, AppendFilterToPath bool, SkipSHA bool, IsDataset bool, DestinationBasePath string, ModelBranch string, concurrentConnections int, token string, silentMode bool, r2cfg *R2Config, skipLocal bool, hfPrefix string, maxWorkers int, preferFormat string) error {
+	return d.DownloadWithOptions(DownloadOptions{
+		Repo:               ModelDatasetName,
+		IsDataset:          IsDataset,
+		Branch:             ModelBranch,
+		Storage:            DestinationBasePath,
+		AppendFilterToPath: AppendFilterToPath,
+		SkipSHA:            SkipSHA,
+		Connections:        concurrentConnections,
+		Token:              token,
+		SilentMode:         silentMode,
+		R2:                 r2cfg,
+		SkipLocal:          skipLocal,
+		HFPrefix:           hfPrefix,
+		MaxWorkers:         maxWorkers,
+		PreferFormat:       preferFormat,
+	})
+}
+
+// CleanupCorruptedFiles verifies the parquet and safetensors files under prefix using a default
+// Downloader that writes its output to stdout.
+func CleanupCorruptedFiles(ctx context.Context, r2cfg *R2Config, prefix string, concurrency int) error {
+	return NewDownloader().CleanupCorruptedFiles(ctx, r2cfg, prefix, concurrency)
+}
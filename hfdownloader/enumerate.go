@@ -0,0 +1,63 @@
+package hfdownloader
+
+// FileInfo describes a repo file selected by Enumerate.
+type FileInfo struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"` // LFS files only
+	IsLFS  bool   `json:"is_lfs"`
+}
+
+// Enumerate lists the files of repo that a download with opts would fetch,
+// without transferring anything. It is a convenience wrapper around
+// Downloader.Enumerate using a default Downloader.
+func Enumerate(repo string, opts DownloadOptions) ([]FileInfo, error) {
+	opts.Repo = repo
+	return NewDownloader().Enumerate(opts)
+}
+
+// Enumerate resolves the branch, walks the repo tree and applies the same
+// filters as Download, returning the files it would fetch. To download a
+// custom subset, pass the chosen paths back as opts.Include.
+func (d *Downloader) Enumerate(opts DownloadOptions) ([]FileInfo, error) {
+	selected, err := d.selectedFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]FileInfo, 0, len(selected))
+	for _, file := range selected {
+		info := FileInfo{Path: file.Path, Size: int64(file.Size)}
+		if file.Lfs != nil {
+			info.SHA256 = file.Lfs.Oid_SHA265
+			info.IsLFS = true
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// selectedFiles returns the non-empty files that opts selects on its resolved
+// branch.
+func (d *Downloader) selectedFiles(opts DownloadOptions) ([]hfmodel, error) {
+	branch, err := d.resolveBranch(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Branch = branch
+
+	files, err := d.enumerateFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.selectFiles(files, opts); err != nil {
+		return nil, err
+	}
+
+	var selected []hfmodel
+	for _, file := range files {
+		if !file.IsDirectory && !file.FilterSkip && file.Size > 0 {
+			selected = append(selected, file)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,116 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnumerate(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":            {Content: `{"a":1}`},
+		"model.safetensors":      {Content: "weights", LFS: true},
+		"empty.txt":              {Content: ""},
+		"onnx/model.onnx":        {Content: "onnx", LFS: true},
+		"onnx/nested/extra.onnx": {Content: "extra", LFS: true},
+	})
+	d, _ := hub.downloader()
+	opts := hubOptions(t)
+	files, err := d.Enumerate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileInfo{
+		{Path: "onnx/nested/extra.onnx", Size: 5, SHA256: sha256Hex("extra"), IsLFS: true},
+		{Path: "onnx/model.onnx", Size: 4, SHA256: sha256Hex("onnx"), IsLFS: true},
+		{Path: "config.json", Size: 7},
+		{Path: "model.safetensors", Size: 7, SHA256: sha256Hex("weights"), IsLFS: true},
+	}
+	if !slices.Equal(files, want) {
+		t.Fatalf("got %+v\nwant %+v", files, want)
+	}
+	if hub.hits("/resolve/") != 0 {
+		t.Fatal("Enumerate downloaded files")
+	}
+
+	// Filters apply as they would to a download
+	opts.Include = []string{"*.onnx"}
+	opts.Exclude = []string{"onnx/nested/*"}
+	files, err = d.Enumerate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "onnx/model.onnx" {
+		t.Fatalf("filtered enumeration = %+v", files)
+	}
+
+	// A subset fed back as Include downloads just those files
+	opts = hubOptions(t)
+	opts.Include = []string{files[0].Path}
+	result, err := d.Download(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 1 || hub.hits("/resolve/main/onnx/model.onnx") != 1 {
+		t.Fatalf("downloaded %d files from the enumerated subset", result.Files)
+	}
+}
+
+func TestEnumerateIncompleteListing(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: "{}"}, "onnx/model.onnx": {Content: "onnx"}})
+	hub.fail = func(r *http.Request) int {
+		if r.URL.Path == "/api/models/o/m/tree/main/onnx" {
+			return http.StatusNotFound
+		}
+		return 0
+	}
+	d, _ := hub.downloader()
+	if _, err := d.Enumerate(hubOptions(t)); !errors.Is(err, ErrIncompleteListing) {
+		t.Fatalf("err = %v, want ErrIncompleteListing", err)
+	}
+}
+
+// BenchmarkPrefetchMetadata re-runs a download against a warm cache of 256
+// files in 32 folders, where every file is skipped and the time goes to
+// listing the tree. Each listing takes 2ms, as a stand-in for Hub latency.
+func BenchmarkPrefetchMetadata(b *testing.B) {
+	files := make(map[string]hubFile)
+	for dir := 0; dir < 32; dir++ {
+		for i := 0; i < 8; i++ {
+			files[fmt.Sprintf("shard-%02d/part-%d.bin", dir, i)] = hubFile{Content: fmt.Sprintf("data %d/%d", dir, i), LFS: true}
+		}
+	}
+	hub := newFakeHub(b, files)
+	hub.fail = func(r *http.Request) int {
+		if strings.Contains(r.URL.Path, "/tree/") {
+			time.Sleep(2 * time.Millisecond)
+		}
+		return 0
+	}
+	storage := b.TempDir()
+	d, _ := hub.downloader()
+	opts := DownloadOptions{Repo: "o/m", Branch: "main", Storage: storage, MaxWorkers: 8}
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, workers := range []int{1, DefaultMetadataWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			opts.MetadataWorkers = workers
+			for i := 0; i < b.N; i++ {
+				before := hub.hits("/resolve/")
+				if _, err := d.Download(context.Background(), opts); err != nil {
+					b.Fatal(err)
+				}
+				if hub.hits("/resolve/") != before {
+					b.Fatal("warm cache downloaded files again")
+				}
+			}
+		})
+	}
+}
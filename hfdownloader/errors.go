@@ -0,0 +1,72 @@
+package hfdownloader
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Failure classes. Errors returned by the downloader wrap one of these where the
+// cause is known, so callers can tell them apart with errors.Is.
+var (
+	ErrAuth             = errors.New("authentication failed") // 401/403 from the Hub or a storage bucket
+	ErrNotFound         = errors.New("not found")             // 404 from the Hub, or no such branch
+	ErrNetwork          = errors.New("network error")         // connection failures and timeouts
+	ErrChecksumMismatch = errors.New("checksum mismatch")     // downloaded bytes don't match the LFS SHA256 or git blob id
+	ErrDiskFull         = errors.New("not enough disk space") // writing a local file ran out of space
+)
+
+// ErrIncompleteListing is returned when a repo folder could not be listed, so
+// the files under it are unknown. Nothing is downloaded from, or deleted
+// because of, a partial listing.
+var ErrIncompleteListing = errors.New("incomplete repo listing")
+
+// Not-found errors found before any file is fetched; both also match
+// ErrNotFound. Retrying them cannot help.
+var (
+	ErrRepoNotFound     = fmt.Errorf("repo %w", ErrNotFound)     // the repo doesn't exist, or is private and no token was given
+	ErrRevisionNotFound = fmt.Errorf("revision %w", ErrNotFound) // none of the requested branches, tags or commits exist
+)
+
+// ErrCommitMismatch is returned by Download when the revision resolved to a
+// different commit than DownloadOptions.ExpectCommit. Nothing has been fetched.
+var ErrCommitMismatch = errors.New("commit mismatch")
+
+// ErrBelowFreeFloor is returned by Download, wrapping ErrDiskFull, when the
+// target filesystem has less free space than DownloadOptions.RequireFree.
+// Nothing has been fetched.
+var ErrBelowFreeFloor = fmt.Errorf("below the required free space: %w", ErrDiskFull)
+
+// Is maps Hub status codes onto the failure classes.
+func (e *hubStatusError) Is(target error) bool {
+	switch target {
+	case ErrAuth:
+		return e.StatusCode == 401 || e.StatusCode == 403
+	case ErrNotFound:
+		return e.StatusCode == 404
+	}
+	return false
+}
+
+// networkError marks a failed HTTP round trip as ErrNetwork, keeping the cause.
+func networkError(err error) error {
+	return fmt.Errorf("%w: request failed: %w", ErrNetwork, err)
+}
+
+// storageError marks a bucket request refused with 401 or 403 as ErrAuth,
+// keeping the cause.
+func storageError(err error) error {
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) && (status.HTTPStatusCode() == 401 || status.HTTPStatusCode() == 403) {
+		return fmt.Errorf("%w: %w", ErrAuth, err)
+	}
+	return err
+}
+
+// diskError marks running out of space as ErrDiskFull, keeping the cause.
+func diskError(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%w: %w", ErrDiskFull, err)
+	}
+	return err
+}
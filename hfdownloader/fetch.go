@@ -0,0 +1,195 @@
+package hfdownloader
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// fileFetch is one file for fetchFile to download, and the run's shared
+// pieces it needs.
+type fileFetch struct {
+	opts       DownloadOptions
+	file       hfmodel
+	localPath  string
+	r2Key      string
+	etag       string // sent as If-None-Match, so an unchanged file answers 304
+	decompress bool
+
+	// deferVerify leaves the file unchecked at its .part path for a verifyPool;
+	// retried counts the attempts already made, so retries stay within budget.
+	deferVerify bool
+	retried     int
+
+	largeFiles *largeFileSlots
+	mirrors    *mirrorSet
+	limiter    *adaptiveLimiter
+	gcs        *gcsClient
+	azure      *azureClient
+
+	// record gets the bytes of every transfer, failed ones included, since they
+	// were still paid for; pointer is called when the file is an LFS pointer.
+	record  func(downloaded, uploaded int64)
+	pointer func()
+}
+
+// fetchFile downloads f.file from the Hub or its mirrors into its destinations,
+// starting over while the transfer fails its checksum and f.opts allows
+// another try. It returns the headers of the response that was stored, or nil
+// when nothing was: the file is unchanged since f.etag, or is an LFS pointer
+// skipped with SkipPointers.
+func (d *Downloader) fetchFile(ctx context.Context, f fileFetch) (http.Header, error) {
+	retries := f.opts.mismatchRetries(f.file)
+	for attempt := 1 + f.retried; ; attempt++ {
+		// Large files wait for one of their own slots so they can't occupy every worker
+		releaseLarge, err := f.largeFiles.acquire(ctx, int64(f.file.Size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to download: %w", err)
+		}
+
+		// A generous timeout for large files, cancelled next to releaseLarge so
+		// retries and later files don't pile up timers
+		downloadCtx, cancelDownload := context.WithTimeout(ctx, 30*time.Minute)
+		req, resp, err := d.requestFile(downloadCtx, f)
+		if err != nil {
+			cancelDownload()
+			releaseLarge()
+			d.logf("Error downloading %s after retries: %v\n", f.file.Path, err)
+			return nil, fmt.Errorf("failed to download: %w", err)
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			cancelDownload()
+			releaseLarge()
+			if !f.opts.SilentMode {
+				d.logf("Skipping %s - not modified since last download\n", f.file.Path)
+			}
+			return nil, nil
+		}
+
+		stored, transferErr := d.storeFile(ctx, f, req, resp)
+		resp.Body.Close()
+		cancelDownload()
+		releaseLarge()
+
+		// A mismatch is almost always a corrupted transfer, and the bad copy is already gone
+		if errors.Is(transferErr, ErrChecksumMismatch) && attempt <= retries && ctx.Err() == nil {
+			d.logf("Warning: %v, downloading it again (%d/%d)\n", transferErr, attempt, retries)
+			continue
+		}
+		if transferErr != nil {
+			d.logf("Error transferring %s: %v\n", f.file.Path, transferErr)
+			return nil, fmt.Errorf("failed to transfer: %w", transferErr)
+		}
+		if !stored {
+			return nil, nil
+		}
+		return resp.Header, nil
+	}
+}
+
+// requestFile gets a response for f.file with retries, moving to the next
+// mirror when one gives up. The response is 200, or 304 for a request with
+// f.etag, and the caller closes its body.
+func (d *Downloader) requestFile(ctx context.Context, f fileFetch) (*http.Request, *http.Response, error) {
+	var req *http.Request
+	var resp *http.Response
+	var downloadErr error
+	links := f.mirrors.links(f.file.DownloadLink)
+	for n, link := range links {
+		var err error
+		req, err = http.NewRequestWithContext(ctx, "GET", link.url, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create request: %v", err)
+		}
+
+		// The token is only for the Hub, unless mirrors are trusted with it
+		if link.hub || f.opts.MirrorAuth {
+			setAuth(req, f.opts.Token)
+		}
+		req.Header.Set("User-Agent", UserAgent)
+		if f.etag != "" {
+			req.Header.Set("If-None-Match", f.etag)
+		}
+
+		var answered time.Duration
+		downloadErr = d.retryWithBackoff(func() error {
+			var err error
+			started := time.Now()
+			resp, err = d.client().Do(req)
+			answered = time.Since(started)
+			if err != nil {
+				return networkError(err)
+			}
+
+			if resp.StatusCode != http.StatusOK && !(f.etag != "" && resp.StatusCode == http.StatusNotModified) {
+				bodyBytes, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+					f.limiter.throttled()
+				}
+				return &hubStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+			}
+
+			return nil
+		}, f.mirrors.attempts(5), 1*time.Second, 30*time.Second)
+		f.mirrors.report(link.index, downloadErr, answered)
+		if downloadErr == nil {
+			return req, resp, nil
+		}
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+		resp = nil
+		if ctx.Err() != nil || n == len(links)-1 {
+			break
+		}
+		d.logf("Warning: %s failed from %s, trying %s: %v\n", f.file.Path, req.URL.Host, links[n+1].url, downloadErr)
+	}
+	return nil, nil, downloadErr
+}
+
+// storeFile streams resp's body into f's destinations: straight into a bucket,
+// or staged locally first. It reports false, and no error, for an LFS pointer
+// skipped with SkipPointers.
+func (d *Downloader) storeFile(ctx context.Context, f fileFetch, req *http.Request, resp *http.Response) (bool, error) {
+	resp.Body = d.newResumingReader(req, resp.Body, f.file.Path, int64(f.file.Size))
+	var downloaded, uploaded atomic.Int64
+	defer func() { f.record(downloaded.Load(), uploaded.Load()) }()
+	body := newCountingReader(newCountingReader(resp.Body, f.limiter.counter()), &downloaded)
+
+	// A small regular file may really be an LFS pointer committed without LFS
+	file, opts := f.file, f.opts
+	if file.Lfs == nil && file.Size <= maxLFSPointerSize {
+		peek := bufio.NewReader(body)
+		body = peek
+		if head, _ := peek.Peek(len(lfsPointerPrefix)); isLFSPointer(head) {
+			d.logf("⚠️ Warning: %s is a Git LFS pointer, not the real file. The repo was pushed without LFS and is misconfigured.\n", file.Path)
+			f.pointer()
+			if opts.SkipPointers {
+				return false, nil
+			}
+		}
+	}
+
+	skipSHA := opts.skipHashCheck(file)
+	switch {
+	case f.deferVerify:
+		_, err := d.downloadToPart(body, file, f.localPath, nil)
+		return true, err
+	case f.decompress:
+		return true, d.downloadGunzipped(body, file, f.localPath, skipSHA)
+	case f.gcs != nil:
+		return true, d.transferFileToGCS(ctx, body, file, f.localPath, f.gcs, f.r2Key, opts.SkipLocal, skipSHA, &uploaded)
+	case f.azure != nil:
+		return true, d.transferFileToAzure(ctx, body, file, f.localPath, f.azure, f.r2Key, opts.SkipLocal, skipSHA, &uploaded)
+	case opts.Tee && opts.R2 != nil && !opts.SkipLocal:
+		return true, d.teeToR2(ctx, body, file, f.localPath, opts.R2, f.r2Key, skipSHA, &uploaded)
+	}
+	return true, d.transferFile(ctx, body, file, f.localPath, opts.R2, f.r2Key, opts.SkipLocal, skipSHA, &uploaded)
+}
@@ -0,0 +1,619 @@
+package hfdownloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrUnmatchedPatterns is returned with FailOnMissing when an include pattern
+// matches no file in the repo.
+var ErrUnmatchedPatterns = errors.New("include patterns matched no files")
+
+// Weight formats understood by --prefer-format
+const (
+	FormatSafetensors = "safetensors"
+	FormatPytorch     = "pytorch"
+)
+
+// weightSuffixes maps the file suffixes of each weight format; index files are
+// listed first so they win over the plain extension match.
+var weightSuffixes = []struct {
+	suffix string
+	format string
+	tag    string
+}{
+	{".safetensors.index.json", FormatSafetensors, "#index"},
+	{".bin.index.json", FormatPytorch, "#index"},
+	{".safetensors", FormatSafetensors, ""},
+	{".bin", FormatPytorch, ""},
+}
+
+// DefaultDocPatterns are the documentation and media files WeightsOnly leaves
+// out when no other patterns are given.
+var DefaultDocPatterns = []string{
+	"*.md", "*.txt", "*.rst", "*.pdf", "*.html",
+	"*.png", "*.jpg", "*.jpeg", "*.gif", "*.webp", "*.svg",
+	"*.mp4", "*.mp3", "*.wav",
+	".gitattributes",
+}
+
+// isTokenizerFile reports whether a file is needed to load a tokenizer even
+// though it looks like documentation, e.g. BERT's vocab.txt or BPE merges.txt.
+func isTokenizerFile(filePath string) bool {
+	name := strings.ToLower(path.Base(filePath))
+	return strings.Contains(name, "tokenizer") || strings.Contains(name, "vocab") || strings.Contains(name, "merges")
+}
+
+// applyWeightsOnly marks the files matching a doc pattern FilterSkip, keeping
+// tokenizer files, and returns how many it skipped.
+func applyWeightsOnly(files []hfmodel, patterns []string) int {
+	if patterns == nil {
+		patterns = DefaultDocPatterns
+	}
+	skipped := 0
+	for i := range files {
+		if files[i].FilterSkip || isTokenizerFile(files[i].Path) {
+			continue
+		}
+		for _, pattern := range patterns {
+			if matchPattern(pattern, files[i].Path) {
+				files[i].FilterSkip = true
+				skipped++
+				break
+			}
+		}
+	}
+	return skipped
+}
+
+// ValidatePreferFormat checks a --prefer-format value, empty meaning no preference.
+func ValidatePreferFormat(format string) error {
+	switch format {
+	case "", FormatSafetensors, FormatPytorch:
+		return nil
+	}
+	return fmt.Errorf("invalid prefer format %q, expected %q or %q", format, FormatSafetensors, FormatPytorch)
+}
+
+// weightKey returns the format of a weight file and a key shared by the copies
+// of the same logical weights in other formats, e.g. pytorch_model-00001-of-00002.bin
+// and model-00001-of-00002.safetensors.
+func weightKey(filePath string) (format string, key string, ok bool) {
+	dir, name := path.Split(filePath)
+	for _, w := range weightSuffixes {
+		if !strings.HasSuffix(name, w.suffix) {
+			continue
+		}
+		stem := strings.TrimSuffix(name, w.suffix)
+		if strings.HasPrefix(stem, "pytorch_model") {
+			stem = "model" + strings.TrimPrefix(stem, "pytorch_model")
+		}
+		return w.format, dir + stem + w.tag, true
+	}
+	return "", "", false
+}
+
+// applyFormatPreference marks weight files as FilterSkip when a copy of the same
+// weights exists in the preferred format, and returns the paths it skipped.
+func applyFormatPreference(files []hfmodel, prefer string) []string {
+	if prefer == "" {
+		return nil
+	}
+
+	preferred := make(map[string]bool)
+	for _, file := range files {
+		if file.FilterSkip {
+			continue
+		}
+		if format, key, ok := weightKey(file.Path); ok && format == prefer {
+			preferred[key] = true
+		}
+	}
+
+	var skipped []string
+	for i := range files {
+		if files[i].FilterSkip {
+			continue
+		}
+		format, key, ok := weightKey(files[i].Path)
+		if ok && format != prefer && preferred[key] {
+			files[i].FilterSkip = true
+			skipped = append(skipped, files[i].Path)
+		}
+	}
+	return skipped
+}
+
+// ValidatePatterns checks that every include/exclude pattern is a valid glob.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ReadPatternFile reads include/exclude patterns from a file, one per line.
+// Blank lines and lines starting with # are skipped, and surrounding whitespace
+// is trimmed, as in rsync filter files and .gitignore.
+func ReadPatternFile(filePath string) ([]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pattern file: %v", err)
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
+
+// literalIncludes returns the include patterns as exact paths, or nil when there
+// are none or any of them is a glob.
+func literalIncludes(include []string) []string {
+	if len(include) == 0 {
+		return nil
+	}
+	for _, pattern := range include {
+		if isGlob(pattern) {
+			return nil
+		}
+	}
+	return include
+}
+
+// isGlob reports whether a pattern has wildcards.
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[\\")
+}
+
+// prefixRoot is the literal folder an HFPrefix starts from: the prefix itself,
+// or for a glob the folders before its first wildcard. Enumeration starts there
+// and object keys are relative to it.
+func prefixRoot(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if !isGlob(prefix) {
+		return prefix
+	}
+	var root []string
+	for _, segment := range strings.Split(prefix, "/") {
+		if isGlob(segment) {
+			break
+		}
+		root = append(root, segment)
+	}
+	return strings.Join(root, "/")
+}
+
+// underPrefix reports whether a repo path lies under an HFPrefix. A literal
+// prefix is a folder, a glob such as "data/*/train" is matched one folder level
+// per segment against the path's leading folders.
+func underPrefix(prefix, filePath string) bool {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	if !isGlob(prefix) {
+		return strings.HasPrefix(filePath, prefix+"/")
+	}
+	segments := strings.Split(filePath, "/")
+	n := strings.Count(prefix, "/") + 1
+	if len(segments) <= n {
+		return false
+	}
+	ok, _ := path.Match(prefix, strings.Join(segments[:n], "/"))
+	return ok
+}
+
+// mayContainPrefix reports whether a repo folder could hold files under a glob
+// HFPrefix, so enumeration only descends into folders that can match.
+func mayContainPrefix(prefix, dir string) bool {
+	patterns := strings.Split(strings.Trim(prefix, "/"), "/")
+	for i, segment := range strings.Split(dir, "/") {
+		if i >= len(patterns) {
+			return true
+		}
+		if ok, _ := path.Match(patterns[i], segment); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPattern reports whether a repo path matches a glob pattern. Patterns
+// without a slash are also tried against the base name, so "*.json" selects
+// JSON files in any folder.
+func matchPattern(pattern, filePath string) bool {
+	if ok, _ := path.Match(pattern, filePath); ok {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(filePath))
+		return ok
+	}
+	return false
+}
+
+// applyExtensions marks files FilterSkip unless their name ends in one of
+// exts, compared case-insensitively with or without a leading dot, so "gguf"
+// and ".GGUF" are the same and "tar.gz" works too. It returns how many
+// selected files it skipped.
+func applyExtensions(files []hfmodel, exts []string) int {
+	if len(exts) == 0 {
+		return 0
+	}
+	suffixes := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		if ext = strings.TrimPrefix(strings.TrimSpace(ext), "."); ext != "" {
+			suffixes = append(suffixes, "."+strings.ToLower(ext))
+		}
+	}
+	skipped := 0
+	for i := range files {
+		if files[i].FilterSkip || files[i].IsDirectory {
+			continue
+		}
+		name := strings.ToLower(path.Base(files[i].Path))
+		matched := false
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			files[i].FilterSkip = true
+			skipped++
+		}
+	}
+	return skipped
+}
+
+// alwaysFetch reports whether file is downloaded again on every run, whatever
+// is already on disk or in the bucket.
+func (opts DownloadOptions) alwaysFetch(file hfmodel) bool {
+	if opts.AlwaysFetchRegular && file.Lfs == nil {
+		return true
+	}
+	for _, pattern := range opts.AlwaysFetch {
+		if matchPattern(pattern, file.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyIncludeExclude marks files FilterSkip unless they match an include
+// pattern (when any are given) and no exclude pattern. It returns the include
+// patterns that matched nothing.
+func applyIncludeExclude(files []hfmodel, include, exclude []string) []string {
+	matched := make(map[string]bool)
+	for i := range files {
+		if len(include) > 0 {
+			included := false
+			for _, pattern := range include {
+				if matchPattern(pattern, files[i].Path) {
+					matched[pattern] = true
+					included = true
+				}
+			}
+			if !included {
+				files[i].FilterSkip = true
+			}
+		}
+		for _, pattern := range exclude {
+			if matchPattern(pattern, files[i].Path) {
+				files[i].FilterSkip = true
+				break
+			}
+		}
+	}
+
+	var unmatched []string
+	for _, pattern := range include {
+		if !matched[pattern] {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	return unmatched
+}
+
+// NormalizeDirs cleans --dir values into slash-separated repo folders without
+// leading or trailing slashes, dropping duplicates. Folders are literal: use
+// Include or HFPrefix for wildcards.
+func NormalizeDirs(dirs []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		clean := path.Clean(strings.Trim(strings.ReplaceAll(dir, "\\", "/"), "/"))
+		if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("invalid dir %q: expected a folder inside the repo", dir)
+		}
+		if isGlob(clean) {
+			return nil, fmt.Errorf("invalid dir %q: wildcards are not supported, use --include or --hf-prefix", dir)
+		}
+		if !seen[clean] {
+			seen[clean] = true
+			normalized = append(normalized, clean)
+		}
+	}
+	return normalized, nil
+}
+
+// underDirs reports whether a repo path lies under one of dirs, or dirs is empty.
+func underDirs(dirs []string, filePath string) bool {
+	if len(dirs) == 0 {
+		return true
+	}
+	for _, dir := range dirs {
+		if strings.HasPrefix(filePath, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mayContainDirs reports whether a repo folder is, lies under, or leads to one
+// of dirs, so enumeration skips the folders that cannot hold selected files.
+func mayContainDirs(dirs []string, folder string) bool {
+	if len(dirs) == 0 {
+		return true
+	}
+	for _, dir := range dirs {
+		if folder == dir || strings.HasPrefix(folder, dir+"/") || strings.HasPrefix(dir, folder+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// commonDir returns the deepest folder all dirs lie in, e.g. "data" for
+// "data/a" and "data/b/c", the dir itself when there is only one, or "" when
+// they share nothing.
+func commonDir(dirs []string) string {
+	if len(dirs) == 0 {
+		return ""
+	}
+	common := strings.Split(dirs[0], "/")
+	for _, dir := range dirs[1:] {
+		segments := strings.Split(dir, "/")
+		n := 0
+		for n < len(common) && n < len(segments) && common[n] == segments[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return strings.Join(common, "/")
+}
+
+// applyDirs marks files outside dirs FilterSkip and returns the dirs that held
+// no file.
+func applyDirs(files []hfmodel, dirs []string) []string {
+	if len(dirs) == 0 {
+		return nil
+	}
+	matched := make(map[string]bool, len(dirs))
+	for i := range files {
+		if !underDirs(dirs, files[i].Path) {
+			files[i].FilterSkip = true
+			continue
+		}
+		for _, dir := range dirs {
+			if strings.HasPrefix(files[i].Path, dir+"/") {
+				matched[dir] = true
+			}
+		}
+	}
+	var unmatched []string
+	for _, dir := range dirs {
+		if !matched[dir] {
+			unmatched = append(unmatched, dir)
+		}
+	}
+	return unmatched
+}
+
+// wantsPath reports whether the path-based selection options would pick a repo
+// path. Options that need remote metadata, like Since, are not considered.
+func wantsPath(opts DownloadOptions, filePath string) bool {
+	if !underPrefix(opts.HFPrefix, filePath) || !underDirs(opts.Dirs, filePath) {
+		return false
+	}
+	if opts.repoType() == RepoDataset && len(opts.Include) == 0 && len(opts.Dirs) == 0 && len(opts.Extensions) == 0 && !strings.HasSuffix(filePath, ".parquet") {
+		return false
+	}
+	files := []hfmodel{{Path: filePath}}
+	applyIncludeExclude(files, opts.Include, opts.Exclude)
+	applyExtensions(files, opts.Extensions)
+	if opts.WeightsOnly {
+		applyWeightsOnly(files, opts.DocPatterns)
+	}
+	return !files[0].FilterSkip
+}
+
+// selectFiles applies the selection options to the enumerated files, marking
+// everything that should not be downloaded as FilterSkip.
+func (d *Downloader) selectFiles(files []hfmodel, opts DownloadOptions) error {
+	// Without explicit includes, dirs or extensions, datasets default to their parquet shards
+	if opts.repoType() == RepoDataset && len(opts.Include) == 0 && len(opts.Dirs) == 0 && len(opts.Extensions) == 0 {
+		for i := range files {
+			if !strings.HasSuffix(files[i].Path, ".parquet") {
+				files[i].FilterSkip = true
+			}
+		}
+	}
+
+	if unmatched := applyDirs(files, opts.Dirs); len(unmatched) > 0 {
+		if opts.FailOnMissing {
+			return fmt.Errorf("%w: %s", ErrUnmatchedPatterns, strings.Join(unmatched, ", "))
+		}
+		d.logf("Warning: no files found under dir(s): %s\n", strings.Join(unmatched, ", "))
+	}
+
+	if opts.FromIndex {
+		if err := d.applyFromIndex(files, opts); err != nil {
+			return err
+		}
+	}
+
+	if unmatched := applyIncludeExclude(files, opts.Include, opts.Exclude); len(unmatched) > 0 {
+		if opts.FailOnMissing {
+			return fmt.Errorf("%w: %s", ErrUnmatchedPatterns, strings.Join(unmatched, ", "))
+		}
+		d.logf("Warning: no files matched include pattern(s): %s\n", strings.Join(unmatched, ", "))
+	}
+
+	if len(opts.Extensions) > 0 {
+		if skipped := applyExtensions(files, opts.Extensions); skipped > 0 {
+			d.logf("Skipping %d files without extension %s\n", skipped, strings.Join(opts.Extensions, ", "))
+		}
+	}
+
+	if opts.WeightsOnly {
+		if skipped := applyWeightsOnly(files, opts.DocPatterns); skipped > 0 {
+			d.logf("Skipping %d documentation and media files (--weights-only)\n", skipped)
+		}
+	}
+
+	if !opts.Since.IsZero() {
+		if skipped := applySince(files, opts.Since, opts.SinceStrict); skipped > 0 {
+			d.logf("Skipping %d files not changed since %s\n", skipped, opts.Since.Format(time.RFC3339))
+		}
+	}
+
+	for _, skipped := range applyFormatPreference(files, opts.PreferFormat) {
+		d.logf("Skipping %s - a %s copy of the same weights is available\n", skipped, opts.PreferFormat)
+	}
+
+	if opts.MaxFiles > 0 {
+		if skipped := applyMaxFiles(files, opts.MaxFiles); skipped > 0 {
+			d.logf("Limiting download to the first %d files by path, skipping %d more\n", opts.MaxFiles, skipped)
+		}
+	}
+	if opts.MaxTotalSize > 0 {
+		if kept, skipped, keptBytes, skippedBytes := applyMaxTotalSize(files, opts.MaxTotalSize); skipped > 0 {
+			d.logf("Limiting download to the first %d files by path (%s of %s) to stay within %s, skipping %d more\n",
+				kept, formatSize(keptBytes), formatSize(keptBytes+skippedBytes), formatSize(opts.MaxTotalSize), skipped)
+		}
+	}
+	return checkRenameCollisions(files, opts)
+}
+
+// applyMaxTotalSize sorts files by path and keeps the selected ones up to the
+// first that would take their total past budget, so repeated runs pick the
+// same slice. Later files are skipped even if they would fit, keeping the slice
+// a prefix. It returns how many files and bytes it kept and skipped.
+func applyMaxTotalSize(files []hfmodel, budget int64) (kept, skipped int, keptBytes, skippedBytes int64) {
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	full := false
+	for i := range files {
+		if files[i].FilterSkip || files[i].Size <= 0 {
+			continue
+		}
+		size := int64(files[i].Size)
+		if !full && keptBytes+size <= budget {
+			kept++
+			keptBytes += size
+			continue
+		}
+		full = true
+		files[i].FilterSkip = true
+		files[i].OverBudget = true
+		skipped++
+		skippedBytes += size
+	}
+	return kept, skipped, keptBytes, skippedBytes
+}
+
+// budgetUsage reports how much of the selection fit in the MaxTotalSize budget.
+// listed says whether files still carries the files over budget, which a
+// reused saved file list doesn't.
+func budgetUsage(files []hfmodel, listed bool) *BudgetUsage {
+	usage := &BudgetUsage{}
+	for _, file := range files {
+		if file.IsDirectory || file.Size <= 0 {
+			continue
+		}
+		if !file.FilterSkip {
+			usage.Files++
+			usage.Bytes += int64(file.Size)
+		}
+		if listed && (!file.FilterSkip || file.OverBudget) {
+			usage.TotalFiles++
+			usage.TotalBytes += int64(file.Size)
+		}
+	}
+	return usage
+}
+
+// applyMaxFiles sorts files by path and keeps only the first max selected ones,
+// so repeated runs pick the same sample. It returns how many it skipped.
+func applyMaxFiles(files []hfmodel, max int) int {
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	kept, skipped := 0, 0
+	for i := range files {
+		if files[i].FilterSkip || files[i].Size <= 0 {
+			continue
+		}
+		if kept < max {
+			kept++
+			continue
+		}
+		files[i].FilterSkip = true
+		skipped++
+	}
+	return skipped
+}
+
+// ParseSince parses a --since value, accepting RFC3339 or a plain YYYY-MM-DD date.
+func ParseSince(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected RFC3339 or YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
+// lastCommitTime is when file last changed, zero when the listing didn't say.
+func lastCommitTime(file hfmodel) time.Time {
+	if file.LastCommit == nil {
+		return time.Time{}
+	}
+	changed, _ := time.Parse(time.RFC3339, file.LastCommit.Date)
+	return changed
+}
+
+// applySince marks files last committed at or before since as FilterSkip. Files
+// without commit info are kept unless strict is set. It returns how many it skipped.
+func applySince(files []hfmodel, since time.Time, strict bool) int {
+	skipped := 0
+	for i := range files {
+		if files[i].FilterSkip {
+			continue
+		}
+		changed := lastCommitTime(files[i])
+		if changed.IsZero() && !strict {
+			continue
+		}
+		if !changed.After(since) {
+			files[i].FilterSkip = true
+			skipped++
+		}
+	}
+	return skipped
+}
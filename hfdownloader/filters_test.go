@@ -0,0 +1,518 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// dualFormatRepo ships its weights as both safetensors and pytorch files.
+var dualFormatRepo = map[string]hubFile{
+	"config.json":                              {Content: `{"a":1}`},
+	"model-00001-of-00002.safetensors":         {Content: "st1", LFS: true},
+	"model-00002-of-00002.safetensors":         {Content: "st2", LFS: true},
+	"model.safetensors.index.json":             {Content: `{"weight_map":{}}`},
+	"pytorch_model-00001-of-00002.bin":         {Content: "pt1", LFS: true},
+	"pytorch_model-00002-of-00002.bin":         {Content: "pt2", LFS: true},
+	"pytorch_model.bin.index.json":             {Content: `{"weight_map":{}}`},
+	"extra/adapter_model.bin":                  {Content: "adapter", LFS: true},
+	"onnx/model.onnx":                          {Content: "onnx", LFS: true},
+	"text_encoder/model.safetensors":           {Content: "te", LFS: true},
+	"text_encoder/pytorch_model.bin":           {Content: "te-pt", LFS: true},
+	"text_encoder/diffusion_pytorch_model.bin": {Content: "unpaired", LFS: true},
+}
+
+// downloaded lists the files under dir, as slash-separated relative paths.
+func downloaded(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".hfdownloader") {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+func repoFiles(repo map[string]hubFile, skip ...string) []string {
+	var files []string
+	for name := range repo {
+		if !slices.Contains(skip, name) {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestPreferFormat(t *testing.T) {
+	for _, tc := range []struct {
+		prefer  string
+		skipped []string
+	}{
+		{"", nil},
+		{FormatSafetensors, []string{
+			"pytorch_model-00001-of-00002.bin", "pytorch_model-00002-of-00002.bin", "pytorch_model.bin.index.json",
+			"text_encoder/pytorch_model.bin",
+		}},
+		{FormatPytorch, []string{
+			"model-00001-of-00002.safetensors", "model-00002-of-00002.safetensors", "model.safetensors.index.json",
+			"text_encoder/model.safetensors",
+		}},
+	} {
+		t.Run("prefer "+tc.prefer, func(t *testing.T) {
+			var files []hfmodel
+			for _, name := range repoFiles(dualFormatRepo) {
+				files = append(files, hfmodel{Path: name, Size: len(dualFormatRepo[name].Content)})
+			}
+			skipped := applyFormatPreference(files, tc.prefer)
+			if !slices.Equal(skipped, tc.skipped) {
+				t.Fatalf("skipped %v, want %v", skipped, tc.skipped)
+			}
+			for _, file := range files {
+				if file.FilterSkip != slices.Contains(tc.skipped, file.Path) {
+					t.Errorf("%s FilterSkip = %v", file.Path, file.FilterSkip)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxFiles(t *testing.T) {
+	repo := map[string]hubFile{
+		"README.md":                     {Content: "readme"},
+		"data/train-00002.parquet":      {Content: "t2", LFS: true},
+		"data/train-00000.parquet":      {Content: "t0", LFS: true},
+		"data/train-00001.parquet":      {Content: "t1", LFS: true},
+		"data/validation-00000.parquet": {Content: "v0", LFS: true},
+		"a/first.parquet":               {Content: "a", LFS: true},
+	}
+	hub := newFakeHub(t, repo)
+	opts := hubOptions(t)
+	opts.IsDataset = true
+	opts.Include = []string{"*.parquet"}
+	opts.MaxFiles = 3
+	for run := 0; run < 2; run++ {
+		d, out := hub.downloader()
+		if _, err := d.Download(context.Background(), opts); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		want := []string{"a/first.parquet", "data/train-00000.parquet", "data/train-00001.parquet"}
+		if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); !slices.Equal(got, want) {
+			t.Fatalf("run %d downloaded %v, want %v", run+1, got, want)
+		}
+		if run == 0 && !strings.Contains(out.String(), "Limiting download to the first 3 files by path, skipping 2 more") {
+			t.Errorf("limit not reported:\n%s", out)
+		}
+	}
+	if n := hub.hits("/resolve/"); n != 3 {
+		t.Errorf("%d downloads over both runs, want 3", n)
+	}
+}
+
+func TestMaxTotalSize(t *testing.T) {
+	repo := map[string]hubFile{
+		"a.bin": {Content: strings.Repeat("a", 10), LFS: true},
+		"b.bin": {Content: strings.Repeat("b", 20), LFS: true},
+		"c.bin": {Content: strings.Repeat("c", 30), LFS: true},
+		"d.bin": {Content: strings.Repeat("d", 5), LFS: true},
+	}
+	hub := newFakeHub(t, repo)
+	opts := hubOptions(t)
+	opts.MaxTotalSize = 35
+	for run := 0; run < 2; run++ {
+		d, out := hub.downloader()
+		result, err := d.Download(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		// c.bin would go over, and d.bin is left out too so the slice stays a prefix
+		want := []string{"a.bin", "b.bin"}
+		if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); !slices.Equal(got, want) {
+			t.Fatalf("run %d downloaded %v, want %v", run+1, got, want)
+		}
+		if want := (BudgetUsage{Files: 2, Bytes: 30, TotalFiles: 4, TotalBytes: 65}); result.Budget == nil || *result.Budget != want {
+			t.Errorf("run %d budget %+v, want %+v", run+1, result.Budget, want)
+		}
+		if run == 0 && !strings.Contains(out.String(), "Limiting download to the first 2 files by path (30 B of 65 B) to stay within 35 B, skipping 2 more") {
+			t.Errorf("budget not reported:\n%s", out)
+		}
+	}
+	if n := hub.hits("/resolve/"); n != 2 {
+		t.Errorf("%d downloads over both runs, want 2", n)
+	}
+
+	opts = hubOptions(t)
+	opts.MaxTotalSize = 5
+	d, out := hub.downloader()
+	result, err := d.Download(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); len(got) != 0 {
+		t.Errorf("a budget below the first file downloaded %v", got)
+	}
+	if result.Budget == nil || result.Budget.Files != 0 {
+		t.Errorf("budget %+v, want no files", result.Budget)
+	}
+}
+
+// nestedDataset splits its data by language, then by split.
+var nestedDataset = map[string]hubFile{
+	"README.md":                    {Content: "# data"},
+	"data/en/train/0.parquet":      {Content: "en-train", LFS: true},
+	"data/en/test/0.parquet":       {Content: "en-test", LFS: true},
+	"data/fr/train/0.parquet":      {Content: "fr-train", LFS: true},
+	"data/fr/train/1.parquet":      {Content: "fr-train-1", LFS: true},
+	"data/fr/validation/0.parquet": {Content: "fr-val", LFS: true},
+	"data/train/0.parquet":         {Content: "flat", LFS: true},
+	"extra/en/train/0.parquet":     {Content: "extra", LFS: true},
+}
+
+func TestHFPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		prefix string
+		want   []string
+	}{
+		{"data/en", []string{"data/en/test/0.parquet", "data/en/train/0.parquet"}},
+		{"data/en/", []string{"data/en/test/0.parquet", "data/en/train/0.parquet"}},
+		{"data/e", nil},
+		{"data/*/train", []string{"data/en/train/0.parquet", "data/fr/train/0.parquet", "data/fr/train/1.parquet"}},
+		{"data/[ef]?", []string{"data/en/test/0.parquet", "data/en/train/0.parquet", "data/fr/train/0.parquet", "data/fr/train/1.parquet", "data/fr/validation/0.parquet"}},
+		{"*/en/train", []string{"data/en/train/0.parquet", "extra/en/train/0.parquet"}},
+	} {
+		t.Run(tc.prefix, func(t *testing.T) {
+			hub := newFakeHub(t, nestedDataset)
+			opts := hubOptions(t)
+			opts.RepoType = RepoDataset
+			opts.HFPrefix = tc.prefix
+			d, _ := hub.downloader()
+			if _, err := d.Download(context.Background(), opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); !slices.Equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			if hub.hits("/api/datasets/o/m/tree/main/extra") > 0 && !strings.HasPrefix(tc.prefix, "*") {
+				t.Fatalf("listed extra/, which %s can't match", tc.prefix)
+			}
+		})
+	}
+}
+
+func TestPatternFiles(t *testing.T) {
+	dir := t.TempDir()
+	include := filepath.Join(dir, "include.txt")
+	exclude := filepath.Join(dir, "exclude.txt")
+	os.WriteFile(include, []byte("# weights\n*.safetensors\n\n  config.json  \ntext_encoder/*\n"), 0644)
+	os.WriteFile(exclude, []byte("# skip the unpaired file\ntext_encoder/diffusion_pytorch_model.bin\n"), 0644)
+
+	includes, err := ReadPatternFile(include)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"*.safetensors", "config.json", "text_encoder/*"}; !slices.Equal(includes, want) {
+		t.Fatalf("read %q, want %q", includes, want)
+	}
+	excludes, err := ReadPatternFile(exclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := newFakeHub(t, dualFormatRepo)
+	opts := hubOptions(t)
+	// Patterns from the files merge with inline ones
+	opts.Include = append([]string{"onnx/*"}, includes...)
+	opts.Exclude = excludes
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"config.json",
+		"model-00001-of-00002.safetensors",
+		"model-00002-of-00002.safetensors",
+		"onnx/model.onnx",
+		"text_encoder/model.safetensors",
+		"text_encoder/pytorch_model.bin",
+	}
+	if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if _, err := ReadPatternFile(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Fatal("missing pattern file accepted")
+	}
+}
+
+// modelCard is a model repo with the usual docs and media next to its weights.
+var modelCard = map[string]hubFile{
+	".gitattributes":          {Content: "*.bin filter=lfs"},
+	"README.md":               {Content: "# model"},
+	"LICENSE.txt":             {Content: "license"},
+	"assets/architecture.png": {Content: "png", LFS: true},
+	"assets/demo.mp4":         {Content: "mp4", LFS: true},
+	"docs/usage.md":           {Content: "usage"},
+	"config.json":             {Content: "{}"},
+	"generation_config.json":  {Content: "{}"},
+	"model.safetensors":       {Content: "weights", LFS: true},
+	"tokenizer.json":          {Content: "{}"},
+	"tokenizer_config.json":   {Content: "{}"},
+	"special_tokens_map.json": {Content: "{}"},
+	"vocab.txt":               {Content: "[PAD]"},
+	"merges.txt":              {Content: "a b"},
+}
+
+func TestWeightsOnly(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		patterns []string
+		skipped  []string
+	}{
+		{"default set", nil, []string{".gitattributes", "LICENSE.txt", "README.md", "assets/architecture.png", "assets/demo.mp4", "docs/usage.md"}},
+		{"overridden", []string{"*.md"}, []string{"README.md", "docs/usage.md"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := newFakeHub(t, modelCard)
+			opts := hubOptions(t)
+			opts.WeightsOnly = true
+			opts.DocPatterns = tc.patterns
+			d, _ := hub.downloader()
+			if _, err := d.Download(context.Background(), opts); err != nil {
+				t.Fatal(err)
+			}
+			got := downloaded(t, filepath.Join(opts.Storage, "o", "m"))
+			if want := repoFiles(modelCard, tc.skipped...); !slices.Equal(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// shardedRepo has a safetensors index referencing two shards, a stale third
+// shard, a pytorch copy and unrelated artifacts.
+var shardedRepo = map[string]hubFile{
+	"config.json":                      {Content: "{}"},
+	"generation_config.json":           {Content: "{}"},
+	"tokenizer.json":                   {Content: "{}"},
+	"tokenizer_config.json":            {Content: "{}"},
+	"README.md":                        {Content: "# model"},
+	"model.safetensors.index.json":     {Content: `{"metadata":{"total_size":6},"weight_map":{"a.weight":"model-00001-of-00002.safetensors","b.weight":"model-00002-of-00002.safetensors","c.weight":"model-00002-of-00002.safetensors"}}`},
+	"model-00001-of-00002.safetensors": {Content: "st1", LFS: true},
+	"model-00002-of-00002.safetensors": {Content: "st2", LFS: true},
+	"model-00001-of-00003.safetensors": {Content: "old", LFS: true},
+	"pytorch_model.bin.index.json":     {Content: `{"weight_map":{"a.weight":"pytorch_model-00001-of-00001.bin"}}`},
+	"pytorch_model-00001-of-00001.bin": {Content: "pt", LFS: true},
+	"training_args.bin":                {Content: "args", LFS: true},
+	"optimizer.pt":                     {Content: "opt", LFS: true},
+}
+
+func TestFromIndex(t *testing.T) {
+	for _, tc := range []struct {
+		prefer string
+		want   []string
+	}{
+		{"", []string{"config.json", "generation_config.json", "model-00001-of-00002.safetensors", "model-00002-of-00002.safetensors", "model.safetensors.index.json", "tokenizer.json", "tokenizer_config.json"}},
+		{FormatPytorch, []string{"config.json", "generation_config.json", "pytorch_model-00001-of-00001.bin", "pytorch_model.bin.index.json", "tokenizer.json", "tokenizer_config.json"}},
+	} {
+		hub := newFakeHub(t, shardedRepo)
+		opts := hubOptions(t)
+		opts.FromIndex = true
+		opts.PreferFormat = tc.prefer
+		d, _ := hub.downloader()
+		if _, err := d.Download(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); !slices.Equal(got, tc.want) {
+			t.Errorf("prefer %q: got %v, want %v", tc.prefer, got, tc.want)
+		}
+	}
+
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: "{}"}, "model.safetensors": {Content: "w", LFS: true}})
+	opts := hubOptions(t)
+	opts.FromIndex = true
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v for a repo without an index, want ErrNotFound", err)
+	}
+}
+
+func TestFromIndexChangeEnumeratesAgain(t *testing.T) {
+	hub := newFakeHub(t, shardedRepo)
+	opts := hubOptions(t)
+	opts.FromIndex = true
+	// A failed shard leaves the job's state behind for a resume
+	hub.fail = func(r *http.Request) int {
+		if strings.HasSuffix(r.URL.Path, "/model-00002-of-00002.safetensors") {
+			return http.StatusNotFound
+		}
+		return 0
+	}
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err == nil {
+		t.Fatal("download with a missing shard succeeded")
+	}
+	if _, err := os.Stat(statePath(opts)); err != nil {
+		t.Fatalf("no state left to resume from: %v", err)
+	}
+
+	// Without --from-index the saved list is stale, so the whole repo is fetched
+	hub.fail = nil
+	opts.FromIndex = false
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); len(got) != len(shardedRepo) {
+		t.Errorf("got %v, want all %d files", got, len(shardedRepo))
+	}
+}
+
+// monorepo holds several subsets side by side.
+var monorepo = map[string]hubFile{
+	"README.md":                        {Content: "# subsets"},
+	"subset_A/train/0.parquet":         {Content: "a-train", LFS: true},
+	"subset_A/test/0.parquet":          {Content: "a-test", LFS: true},
+	"subset_A_extra/0.parquet":         {Content: "not A", LFS: true},
+	"subsets/B/train/0.parquet":        {Content: "b-train", LFS: true},
+	"subsets/B/meta.json":              {Content: "{}"},
+	"subsets/C/train/0.parquet":        {Content: "c-train", LFS: true},
+	"subsets/C/train/nested/1.parquet": {Content: "c-nested", LFS: true},
+}
+
+func TestDirs(t *testing.T) {
+	for _, tc := range []struct {
+		dirs  []string
+		strip bool
+		want  []string
+	}{
+		{[]string{"subset_A"}, false, []string{"subset_A/test/0.parquet", "subset_A/train/0.parquet"}},
+		{[]string{"subset_A"}, true, []string{"test/0.parquet", "train/0.parquet"}},
+		{[]string{"/subsets/B/", "subsets\\C\\train"}, false, []string{"subsets/B/meta.json", "subsets/B/train/0.parquet", "subsets/C/train/0.parquet", "subsets/C/train/nested/1.parquet"}},
+		// Stripping drops only the folder the dirs share
+		{[]string{"subsets/B", "subsets/C/train"}, true, []string{"B/meta.json", "B/train/0.parquet", "C/train/0.parquet", "C/train/nested/1.parquet"}},
+		{[]string{"subsets/C/train"}, true, []string{"0.parquet", "nested/1.parquet"}},
+	} {
+		hub := newFakeHub(t, monorepo)
+		dirs, err := NormalizeDirs(tc.dirs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := hubOptions(t)
+		opts.Dirs, opts.StripPrefix = dirs, tc.strip
+		d, _ := hub.downloader()
+		if _, err := d.Download(context.Background(), opts); err != nil {
+			t.Fatalf("%v: %v", tc.dirs, err)
+		}
+		if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); !slices.Equal(got, tc.want) {
+			t.Errorf("dirs %v, strip %v: got %v, want %v", tc.dirs, tc.strip, got, tc.want)
+		}
+	}
+
+	for _, dir := range []string{"", "/", "..", "../x", "data/*"} {
+		if _, err := NormalizeDirs([]string{dir}); err == nil {
+			t.Errorf("dir %q accepted", dir)
+		}
+	}
+}
+
+func TestAlwaysFetch(t *testing.T) {
+	repo := map[string]hubFile{
+		"config.json":           {Content: `{"a":1}`},
+		"tokenizer_config.json": {Content: `{"t":1}`},
+		"README.md":             {Content: "# model"},
+		"model.safetensors":     {Content: "weights", LFS: true},
+		"model.gguf":            {Content: "gguf", LFS: true},
+	}
+	hub := newFakeHub(t, repo)
+	opts := hubOptions(t)
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		set     func(*DownloadOptions)
+		fetched []string
+	}{
+		{"patterns", func(o *DownloadOptions) { o.AlwaysFetch = []string{"*.json", "*.gguf"} }, []string{"config.json", "model.gguf", "tokenizer_config.json"}},
+		{"regular", func(o *DownloadOptions) { o.AlwaysFetchRegular = true }, []string{"README.md", "config.json", "tokenizer_config.json"}},
+	} {
+		opts := opts
+		opts.AlwaysFetch, opts.AlwaysFetchRegular = nil, false
+		tc.set(&opts)
+		before := len(hub.requestsTo("/resolve/"))
+		d, out := hub.downloader()
+		if _, err := d.Download(context.Background(), opts); err != nil {
+			t.Fatalf("%s: %v\n%s", tc.name, err, out)
+		}
+		var fetched []string
+		for _, r := range hub.requestsTo("/resolve/")[before:] {
+			if r.Header.Get("If-None-Match") != "" {
+				continue // a revalidation, answered 304 since nothing changed
+			}
+			fetched = append(fetched, filepath.Base(r.URL.Path))
+		}
+		sort.Strings(fetched)
+		if !slices.Equal(fetched, tc.fetched) {
+			t.Errorf("%s: fetched %q again, want %q", tc.name, fetched, tc.fetched)
+		}
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	repo := map[string]hubFile{
+		"README.md":               {Content: "# model"},
+		"config.json":             {Content: `{"a":1}`},
+		"model-q4.gguf":           {Content: "q4", LFS: true},
+		"sub/MODEL-Q8.GGUF":       {Content: "q8", LFS: true},
+		"model.safetensors":       {Content: "weights", LFS: true},
+		"data/archive.tar.gz":     {Content: "tgz", LFS: true},
+		"data/gguf":               {Content: "no extension"},
+		"notes/config.json.bak":   {Content: "old"},
+		"tokenizer/vocab.jsonl":   {Content: "{}"},
+		"tokenizer/merges.txt":    {Content: "a b"},
+		"onnx/model.onnx":         {Content: "onnx", LFS: true},
+		"onnx/model.onnx_data":    {Content: "onnx data", LFS: true},
+		"exclude/skip-me.gguf":    {Content: "excluded", LFS: true},
+		"nested/deeper/file.JSON": {Content: `{"deep":1}`},
+	}
+	hub := newFakeHub(t, repo)
+	opts := hubOptions(t)
+	opts.Extensions = []string{"gguf", ".JSON", " tar.gz "}
+	opts.Exclude = []string{"exclude/*"}
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	want := []string{"config.json", "data/archive.tar.gz", "model-q4.gguf", "nested/deeper/file.JSON", "sub/MODEL-Q8.GGUF"}
+	if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); !slices.Equal(got, want) {
+		t.Fatalf("downloaded %v, want %v", got, want)
+	}
+
+	// Datasets default to parquet only when no extension is given
+	data := newFakeHub(t, map[string]hubFile{
+		"train.parquet": {Content: "rows", LFS: true},
+		"train.jsonl":   {Content: "{}\n", LFS: true},
+	})
+	opts = hubOptions(t)
+	opts.IsDataset = true
+	opts.Extensions = []string{"jsonl"}
+	d, out = data.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if got := downloaded(t, filepath.Join(opts.Storage, "o", "m")); !slices.Equal(got, []string{"train.jsonl"}) {
+		t.Fatalf("dataset downloaded %v, want only train.jsonl", got)
+	}
+}
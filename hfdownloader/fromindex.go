@@ -0,0 +1,150 @@
+package hfdownloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Shard index names, in order of preference.
+var shardIndexNames = []string{
+	"model.safetensors.index.json",
+	"pytorch_model.bin.index.json",
+}
+
+// indexCompanionFiles are kept next to the index by FromIndex, so the result
+// loads without anything else. Tokenizer files are kept too.
+var indexCompanionFiles = map[string]bool{
+	"config.json":              true,
+	"generation_config.json":   true,
+	"special_tokens_map.json":  true,
+	"added_tokens.json":        true,
+	"preprocessor_config.json": true,
+	"chat_template.json":       true,
+}
+
+// maxIndexSize bounds the shard index read into memory.
+const maxIndexSize = 64 * 1024 * 1024
+
+// shardIndex is the part of a safetensors or pytorch shard index we use.
+type shardIndex struct {
+	WeightMap map[string]string `json:"weight_map"`
+}
+
+// findShardIndex picks the shard index to follow: a standard name first, the
+// pytorch one first when that format is preferred, then any other
+// *.safetensors.index.json or *.bin.index.json.
+func findShardIndex(files []hfmodel, preferFormat string) (hfmodel, bool) {
+	names := shardIndexNames
+	if preferFormat == FormatPytorch {
+		names = []string{shardIndexNames[1], shardIndexNames[0]}
+	}
+	for _, name := range names {
+		for _, file := range files {
+			if file.Path == name {
+				return file, true
+			}
+		}
+	}
+
+	var others []hfmodel
+	for _, file := range files {
+		if strings.HasSuffix(file.Path, ".safetensors.index.json") || strings.HasSuffix(file.Path, ".bin.index.json") {
+			others = append(others, file)
+		}
+	}
+	if len(others) == 0 {
+		return hfmodel{}, false
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Path < others[j].Path })
+	return others[0], true
+}
+
+// applyFromIndex marks FilterSkip everything but the shard index, the shards
+// it references and the config and tokenizer files next to it.
+func (d *Downloader) applyFromIndex(files []hfmodel, opts DownloadOptions) error {
+	index, ok := findShardIndex(files, opts.PreferFormat)
+	if !ok {
+		return fmt.Errorf("%w: --from-index needs a sharded model, found no model.safetensors.index.json or pytorch_model.bin.index.json", ErrNotFound)
+	}
+	weightMap, err := fetchShardIndex(d.client(), index, opts.Token)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", index.Path, err)
+	}
+
+	dir := path.Dir(index.Path)
+	keep := map[string]bool{index.Path: true}
+	for _, shard := range weightMap {
+		keep[path.Join(dir, shard)] = true
+	}
+	shards := len(keep) - 1
+
+	for i := range files {
+		p := files[i].Path
+		if keep[p] {
+			delete(keep, p)
+			continue
+		}
+		if path.Dir(p) == dir && (indexCompanionFiles[path.Base(p)] || isTokenizerFile(p)) {
+			continue
+		}
+		files[i].FilterSkip = true
+	}
+	if len(keep) > 0 {
+		missing := make([]string, 0, len(keep))
+		for p := range keep {
+			missing = append(missing, p)
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %s references shards missing from the repo: %s", ErrNotFound, index.Path, strings.Join(missing, ", "))
+	}
+	d.logf("Following %s: %d shards\n", index.Path, shards)
+	return nil
+}
+
+// fetchShardIndex downloads a shard index and returns its weight map.
+func fetchShardIndex(client *http.Client, index hfmodel, token string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", index.DownloadLink, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	setAuth(req, token)
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, networkError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &hubStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	return parseShardIndex(io.LimitReader(resp.Body, maxIndexSize))
+}
+
+// parseShardIndex reads the weight map of a shard index. Shard names must stay
+// inside the index's directory.
+func parseShardIndex(r io.Reader) (map[string]string, error) {
+	var index shardIndex
+	if err := json.NewDecoder(r).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to decode index: %v", err)
+	}
+	if len(index.WeightMap) == 0 {
+		return nil, fmt.Errorf("index has an empty weight_map")
+	}
+	for tensor, shard := range index.WeightMap {
+		if shard == "" || path.IsAbs(shard) || strings.HasPrefix(path.Clean(shard), "..") {
+			return nil, fmt.Errorf("invalid shard %q for tensor %s", shard, tensor)
+		}
+	}
+	return index.WeightMap, nil
+}
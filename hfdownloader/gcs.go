@@ -0,0 +1,223 @@
+package hfdownloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcsAPIURL    = "https://storage.googleapis.com/storage/v1/b/%s/o"
+	gcsUploadURL = "https://storage.googleapis.com/upload/storage/v1/b/%s/o"
+	gcsScope     = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// GCSConfig describes a Google Cloud Storage upload target. Credentials come from
+// Google's application default credentials, i.e. GOOGLE_APPLICATION_CREDENTIALS,
+// gcloud's user login or the metadata server.
+type GCSConfig struct {
+	Bucket string
+	Prefix string // object prefix (e.g. "hf_dataset")
+}
+
+// gcsClient talks to the GCS JSON API with an authenticated HTTP client.
+type gcsClient struct {
+	cfg  GCSConfig
+	http *http.Client
+}
+
+func newGCSClient(ctx context.Context, cfg GCSConfig) (*gcsClient, error) {
+	if tlsConfig != nil || ipVersion != "" {
+		// oauth2 builds on the client in the context, for token requests and API calls alike
+		base := &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			DialContext:     restrictDial((&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext),
+			TLSClientConfig: tlsConfig.Clone(),
+		}}
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, base)
+	}
+	client, err := google.DefaultClient(ctx, gcsScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Google credentials: %v", err)
+	}
+	return &gcsClient{cfg: cfg, http: client}, nil
+}
+
+// gcsKeyFor maps a repo path to its object name under the configured prefix.
+func gcsKeyFor(cfg *GCSConfig, filePath string, hfPrefix string) string {
+	if cfg == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", cfg.Prefix, strings.TrimPrefix(filePath, fmt.Sprintf("%s/", prefixRoot(hfPrefix))))
+}
+
+func (c *gcsClient) do(req *http.Request, v interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("bad status: %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// list returns the size of every object under prefix.
+func (c *gcsClient) list(ctx context.Context, prefix string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {prefix}, "fields": {"items(name,size),nextPageToken"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf(gcsAPIURL, url.PathEscape(c.cfg.Bucket))+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+				Size string `json:"size"` // int64 encoded as a string
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := c.do(req, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			size, _ := strconv.ParseInt(item.Size, 10, 64)
+			sizes[item.Name] = size
+		}
+		if page.NextPageToken == "" {
+			return sizes, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// upload writes an object in a single request.
+func (c *gcsClient) upload(ctx context.Context, key string, body io.Reader, size int64) error {
+	query := url.Values{"uploadType": {"media"}, "name": {key}}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf(gcsUploadURL, url.PathEscape(c.cfg.Bucket))+"?"+query.Encode(), body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if err := c.do(req, nil); err != nil {
+		return fmt.Errorf("upload failed: %v", err)
+	}
+	return nil
+}
+
+func (c *gcsClient) delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf(gcsAPIURL, url.PathEscape(c.cfg.Bucket))+"/"+url.PathEscape(key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	return c.do(req, nil)
+}
+
+// buildGCSCache lists the objects already in the bucket so finished files can be
+// skipped, the same way buildR2Cache does for R2.
+func (d *Downloader) buildGCSCache(ctx context.Context, client *gcsClient) (*R2FileCache, error) {
+	d.logf("Building cache of existing files in GCS...\n")
+	start := time.Now()
+
+	files, err := client.list(ctx, client.cfg.Prefix+"/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %v", err)
+	}
+
+	d.logf("Cached %d files in %s\n", len(files), time.Since(start))
+	return &R2FileCache{files: files}, nil
+}
+
+// transferFileToGCS is transferFile for a GCS destination.
+func (d *Downloader) transferFileToGCS(ctx context.Context, body io.Reader, file hfmodel, localPath string, client *gcsClient, key string, skipLocal bool, skipSHA bool, uploaded *atomic.Int64) error {
+	if skipLocal {
+		return d.streamToGCS(ctx, body, file, client, key, skipSHA, uploaded)
+	}
+
+	if err := d.downloadToLocal(body, file, localPath, skipSHA); err != nil {
+		return err
+	}
+	return d.uploadLocalToGCS(ctx, localPath, client, key, int64(file.Size), uploaded)
+}
+
+// streamToGCS uploads the download body directly, hashing it on the way so the
+// LFS checksum can be checked without a second read.
+func (d *Downloader) streamToGCS(ctx context.Context, body io.Reader, file hfmodel, client *gcsClient, key string, skipSHA bool, uploaded *atomic.Int64) error {
+	size := int64(file.Size)
+	hash := newContentHash(file)
+	progress := d.createProgressBar(size, filepath.Base(file.Path))
+
+	pr, pw := io.Pipe()
+	copyDone := make(chan struct{})
+	go func() {
+		defer close(copyDone)
+		_, err := d.copy(io.MultiWriter(hash, pw), newProgressReader(body, progress))
+		pw.CloseWithError(err)
+	}()
+
+	err := client.upload(ctx, key, newCountingReader(pr, uploaded), size)
+	// Unblock the copier if the upload bailed out early, then wait for the hash to settle
+	pr.Close()
+	<-copyDone
+	if err != nil {
+		return err
+	}
+
+	if !skipSHA {
+		if err := checkContentHash(file, hash); err != nil {
+			if delErr := client.delete(ctx, key); delErr != nil {
+				d.logf("Warning: Failed to delete mismatched upload %s: %v\n", key, delErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadLocalToGCS uploads a staged local file, checking parquet framing before
+// anything is sent.
+func (d *Downloader) uploadLocalToGCS(ctx context.Context, localPath string, client *gcsClient, key string, size int64, uploaded *atomic.Int64) error {
+	if strings.HasSuffix(localPath, ".parquet") {
+		if err := verifyLocalParquet(localPath); err != nil {
+			return fmt.Errorf("invalid parquet file: %v", err)
+		}
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", localPath, err)
+	}
+	defer f.Close()
+
+	progress := d.createProgressBar(size, filepath.Base(key))
+	return client.upload(ctx, key, newCountingReader(newProgressReader(f, progress), uploaded), size)
+}
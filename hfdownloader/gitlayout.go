@@ -0,0 +1,84 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	GitModelURL   = "https://huggingface.co/%s"
+	GitDatasetURL = "https://huggingface.co/datasets/%s"
+	GitSpaceURL   = "https://huggingface.co/spaces/%s"
+)
+
+// gitLayoutSection marks a .git/config as written by the downloader, so a
+// later run may rewrite it but never touches a checkout made by git itself.
+const gitLayoutSection = "[hfdownloader]"
+
+// writeGitLayout turns modelPath into an empty git repository whose origin is
+// the Hub repo, with HEAD on an unborn branch and the downloaded commit
+// recorded under hfdownloader.commit in .git/config. No objects are written,
+// since that would need the full tree; "git fetch --depth 1 origin <commit>"
+// followed by "git reset <commit>" links the files on disk to that commit.
+func writeGitLayout(modelPath string, opts DownloadOptions, revision, commit string) error {
+	gitDir := filepath.Join(modelPath, ".git")
+	configPath := filepath.Join(gitDir, "config")
+	if existing, err := os.ReadFile(configPath); err == nil {
+		if !strings.Contains(string(existing), gitLayoutSection) {
+			return fmt.Errorf("%s is already a git repository", modelPath)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", configPath, err)
+	}
+
+	for _, dir := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags", "info"} {
+		if err := os.MkdirAll(filepath.Join(gitDir, filepath.FromSlash(dir)), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	// A commit SHA or a full ref name can't name the local branch, so those
+	// check out onto main
+	branch := revision
+	if branch == commit || !validBranchName(branch) {
+		branch = "main"
+	}
+	remote := fmt.Sprintf(opts.repoType().pickURL(GitModelURL, GitDatasetURL, GitSpaceURL), opts.Repo)
+	config := fmt.Sprintf(`[core]
+	repositoryformatversion = 0
+	filemode = true
+	bare = false
+	logallrefupdates = true
+[remote "origin"]
+	url = %s
+	fetch = +refs/heads/*:refs/remotes/origin/*
+[branch %q]
+	remote = origin
+	merge = refs/heads/%s
+[lfs]
+	repositoryformatversion = 0
+%s
+	revision = %s
+	commit = %s
+`, remote, branch, branch, gitLayoutSection, revision, commit)
+
+	files := map[string]string{
+		"HEAD":         "ref: refs/heads/" + branch + "\n",
+		"config":       config,
+		"description":  "Downloaded by hfdownloader from " + remote + "\n",
+		"info/exclude": "# Downloader bookkeeping\n" + ManifestFileName + "*\n" + StateFileName + "*\n*.part\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(gitDir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write .git/%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// validBranchName reports whether revision can be used as a local branch name.
+func validBranchName(revision string) bool {
+	return revision != "" && !strings.HasPrefix(revision, "refs/") && !strings.ContainsAny(revision, " ~^:?*[\\") && !strings.Contains(revision, "..")
+}
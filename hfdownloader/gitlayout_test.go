@@ -0,0 +1,70 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitLayout(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: `{"a":1}`}})
+	opts := hubOptions(t)
+	opts.GitLayout = true
+	d, _ := hub.downloader()
+	result, err := d.Download(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitDir := filepath.Join(opts.Storage, "o", "m", ".git")
+	if head, _ := os.ReadFile(filepath.Join(gitDir, "HEAD")); string(head) != "ref: refs/heads/main\n" {
+		t.Errorf("HEAD is %q", head)
+	}
+	config, err := os.ReadFile(filepath.Join(gitDir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"url = https://huggingface.co/o/m\n", "commit = " + testCommit + "\n", "[branch \"main\"]"} {
+		if !strings.Contains(string(config), want) {
+			t.Errorf(".git/config lacks %q:\n%s", want, config)
+		}
+	}
+
+	// .git is ours, not a file the remote lacks
+	extras, err := d.MirrorExtras(opts, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extras) != 0 {
+		t.Errorf("mirror would delete %v", extras)
+	}
+
+	// A second run rewrites its own layout, but a real checkout is left alone
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("rewriting the layout: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "config"), []byte("[core]\n\tbare = false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Download(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "already a git repository") {
+		t.Fatalf("err = %v, want the existing repository refused", err)
+	}
+}
+
+func TestValidBranchName(t *testing.T) {
+	for revision, want := range map[string]bool{
+		"main":            true,
+		"release/v1":      true,
+		"refs/pr/3":       false,
+		"v1..v2":          false,
+		"feature branch":  false,
+		"":                false,
+		"main~1":          false,
+		"refs/heads/main": false,
+	} {
+		if got := validBranchName(revision); got != want {
+			t.Errorf("validBranchName(%q) = %v, want %v", revision, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// reservedHeaders are managed by the downloader or by net/http and can't be
+// set with ParseHeaders.
+var reservedHeaders = []string{"Host", "Content-Length", "Transfer-Encoding", "Connection", "Range"}
+
+// ParseHeaders parses repeatable "Name: Value" specs, e.g. from --header, into
+// headers for TransportOptions.Headers. A name given twice gets both values.
+func ParseHeaders(specs []string) (http.Header, error) {
+	headers := make(http.Header, len(specs))
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q: expected \"Name: Value\"", spec)
+		}
+		if strings.ContainsAny(name, " \t\r\n") || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid header %q: names can't contain spaces and values must be a single line", spec)
+		}
+		name = http.CanonicalHeaderKey(name)
+		for _, reserved := range reservedHeaders {
+			if name == reserved {
+				return nil, fmt.Errorf("invalid header %q: %s is set by the downloader", spec, name)
+			}
+		}
+		headers.Add(name, value)
+	}
+	return headers, nil
+}
+
+// headerTransport adds fixed headers to requests for the Hub and the hosts
+// trusted with them, and to nothing else: mirrors that aren't trusted,
+// cross-host redirect targets and presigned URLs, which authorize themselves
+// and usually go to a third-party CDN, get the request as the downloader made
+// it. The headers replace any the downloader set, the auth header included.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+	hosts   map[string]bool // lower case host[:port], the Hub's included
+}
+
+// withHeaders wraps base to add headers for the Hub and hosts, given as URLs
+// or host[:port]. No headers returns base unchanged.
+func withHeaders(base http.RoundTripper, headers http.Header, hosts []string) http.RoundTripper {
+	if len(headers) == 0 {
+		return base
+	}
+	t := &headerTransport{base: base, headers: headers.Clone(), hosts: make(map[string]bool)}
+	for _, host := range append([]string{HubURL}, hosts...) {
+		if u, err := url.Parse(host); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		t.hosts[strings.ToLower(host)] = true
+	}
+	return t
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.hosts[strings.ToLower(req.URL.Host)] || isPresignedURL(req.URL) {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+	return t.base.RoundTrip(req)
+}
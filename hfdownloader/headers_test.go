@@ -0,0 +1,144 @@
+package hfdownloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// headerDownloader is hub.downloader with headers added for the Hub and hosts,
+// as requests are addressed before the fake Hub reroutes them.
+func headerDownloader(hub *fakeHub, headers http.Header, hosts []string) (*Downloader, *syncBuffer) {
+	client := hub.client()
+	client.Transport = withHeaders(client.Transport, headers, hosts)
+	return hub.downloader(WithHTTPClient(client))
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders([]string{"x-gateway-key: secret", "X-Trace: a", "x-trace:b", "X-Empty:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := headers.Get("X-Gateway-Key"); got != "secret" {
+		t.Errorf("X-Gateway-Key = %q", got)
+	}
+	if got := headers.Values("X-Trace"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("X-Trace = %q, want both values", got)
+	}
+	if got, ok := headers["X-Empty"]; !ok || got[0] != "" {
+		t.Errorf("X-Empty = %q, %v", got, ok)
+	}
+
+	for _, spec := range []string{"no colon", ": value", "Bad Name: v", "X-Split: a\r\nInjected: b", "range: bytes=0-1", "Host: example.com"} {
+		if _, err := ParseHeaders([]string{spec}); err == nil {
+			t.Errorf("%q accepted", spec)
+		}
+	}
+}
+
+func TestHeadersOnlyForTheHub(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":       {Content: `{"a":1}`},
+		"model.safetensors": {Content: "weights", LFS: true},
+		"data.bin":          {Content: "data", LFS: true},
+	})
+	var cdnHeaders []http.Header
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnHeaders = append(cdnHeaders, r.Header.Clone())
+		w.Write([]byte(map[string]string{"/blob": "weights", "/data": "data"}[r.URL.Path]))
+	}))
+	t.Cleanup(cdn.Close)
+	hub.route("cdn.test", cdn)
+	hub.redirect = func(r *http.Request) string {
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".safetensors"):
+			return "https://cdn.test/blob?X-Amz-Signature=sig"
+		case strings.HasSuffix(r.URL.Path, ".bin"):
+			return "https://cdn.test/data"
+		}
+		return ""
+	}
+	headers, err := ParseHeaders([]string{"X-Gateway-Key: secret", "X-Trace: run-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := hubOptions(t)
+	opts.Token = "hf_token"
+	d, out := headerDownloader(hub, headers, nil)
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	requests := hub.requestsTo("/")
+	if len(requests) == 0 {
+		t.Fatal("no requests reached the hub")
+	}
+	for _, r := range requests {
+		if r.Header.Get("X-Gateway-Key") != "secret" || r.Header.Get("X-Trace") != "run-1" {
+			t.Errorf("%s %s sent without the extra headers: %v", r.Method, r.URL.Path, r.Header)
+		}
+		if r.Header.Get("Authorization") != "Bearer hf_token" {
+			t.Errorf("%s lost its token: %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+	}
+	// Redirects to other hosts, presigned or not, leave the Hub's headers behind
+	if len(cdnHeaders) != 2 {
+		t.Fatalf("%d CDN requests, want 2", len(cdnHeaders))
+	}
+	for _, h := range cdnHeaders {
+		if h.Get("X-Gateway-Key") != "" || h.Get("X-Trace") != "" || h.Get("Authorization") != "" {
+			t.Errorf("Hub headers sent to another host: %v", h)
+		}
+	}
+}
+
+func TestHeadersForTrustedMirrors(t *testing.T) {
+	headers, err := ParseHeaders([]string{"X-Gateway-Key: secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trusted := range []bool{false, true} {
+		hub := newFakeHub(t, mirrorRepo)
+		mirror := newFakeHub(t, mirrorRepo)
+		var hosts []string
+		if trusted {
+			hosts = []string{mirror.URL}
+		}
+		opts := hubOptions(t)
+		opts.Mirrors = []string{mirror.URL}
+		d, out := headerDownloader(hub, headers, hosts)
+		if _, err := d.Download(context.Background(), opts); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		requests := mirror.requestsTo("/resolve/")
+		if len(requests) == 0 {
+			t.Fatal("no requests reached the mirror")
+		}
+		for _, r := range requests {
+			if got := r.Header.Get("X-Gateway-Key") != ""; got != trusted {
+				t.Errorf("trusted %v: %s sent with the extra header %v", trusted, r.URL.Path, got)
+			}
+		}
+	}
+}
+
+func TestHeadersReplaceAuthorization(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: `{"a":1}`}})
+	headers, err := ParseHeaders([]string{"Authorization: Basic Z2F0ZXdheQ=="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := hubOptions(t)
+	opts.Token = "hf_token"
+	d, out := headerDownloader(hub, headers, nil)
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	for _, r := range hub.requestsTo("/") {
+		if got := r.Header.Values("Authorization"); !slices.Equal(got, []string{"Basic Z2F0ZXdheQ=="}) {
+			t.Errorf("%s sent Authorization %q, want only the --header value", r.URL.Path, got)
+		}
+	}
+}
@@ -2,13 +2,17 @@ package hfdownloader
 
 import (
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -41,12 +45,15 @@ const (
 	LfsDatasetResolverURL  = "https://huggingface.co/datasets/%s/resolve/%s/%s"
 	JsonModelsFileTreeURL  = "https://huggingface.co/api/models/%s/tree/%s/%s"
 	JsonDatasetFileTreeURL = "https://huggingface.co/api/datasets/%s/tree/%s/%s"
+	LfsSpaceResolverURL    = "https://huggingface.co/spaces/%s/resolve/%s/%s"
+	JsonSpaceFileTreeURL   = "https://huggingface.co/api/spaces/%s/tree/%s/%s"
 	// Optimize for high-speed downloads
 	streamBufferSize   = 256 * 1024 * 1024      // 256MB buffer
 	multipartThreshold = 1024 * 1024 * 1024     // 1GB threshold
 	chunkSize          = 256 * 1024 * 1024      // 256MB chunks
 	maxConcurrent      = 16                     // 8 concurrent files
 	maxPartsPerFile    = 32                     // 16 concurrent chunks per file
+	maxInFlightParts   = 4                      // part buffers held in memory per streamed file
 	bufferSize         = 128 * 1024 * 1024      // 128MB buffer
 	maxRetries         = 3                      // Reduced retries for faster failure recovery
 	retryDelay         = 500 * time.Millisecond // Shorter retry delay
@@ -57,9 +64,12 @@ var (
 	successColor   = color.New(color.FgHiGreen).SprintFunc()
 	warningColor   = color.New(color.FgYellow).SprintFunc()
 	errorColor     = color.New(color.FgRed).SprintFunc()
-	NumConnections = 64 // Increased from 5 to 32
+	NumConnections = 64 // size of the idle connection pool, see TransportOptions.MaxIdleConnsPerHost
 	RequiresAuth   = false
 	AuthToken      = ""
+
+	// UserAgent is sent with every Hub API, resolve and CDN request.
+	UserAgent = "hfdownloader (go/" + strings.TrimPrefix(runtime.Version(), "go") + ")"
 )
 
 type hfmodel struct {
@@ -67,6 +77,7 @@ type hfmodel struct {
 	Oid           string `json:"oid"`
 	Size          int    `json:"size"`
 	Path          string `json:"path"`
+	Mode          string `json:"mode,omitempty"` // git tree mode, when reported; see isSymlink
 	LocalSize     int64
 	NeedsDownload bool
 	IsDirectory   bool
@@ -75,8 +86,16 @@ type hfmodel struct {
 	AppendedPath    string
 	SkipDownloading bool
 	FilterSkip      bool
+	OverBudget      bool // skipped by MaxTotalSize rather than a filter
 	DownloadLink    string
-	Lfs             *hflfs `json:"lfs,omitempty"`
+	Lfs             *hflfs        `json:"lfs,omitempty"`
+	LastCommit      *hflastcommit `json:"lastCommit,omitempty"` // only present with ?expand=true
+}
+
+type hflastcommit struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Date  string `json:"date"`
 }
 
 type hflfs struct {
@@ -92,6 +111,7 @@ type R2Config struct {
 	BucketName      string
 	Region          string // Usually "auto" for R2
 	Subfolder       string // Custom subfolder (e.g., "hf_dataset")
+	Endpoint        string // S3 endpoint with path-style buckets, https://<AccountID>.r2.cloudflarestorage.com when empty
 }
 
 type uploadProgress struct {
@@ -119,36 +139,227 @@ func init() {
 	// Initialize random seed for jitter calculations
 	rand.Seed(time.Now().UnixNano())
 
-	// To solve DNS timeout issues, and resolve faster, we use  cloudflare's DNS
+	dialer = newDialer("")
+
+	// Set a longer timeout for the HTTP client (10 minutes)
+	// Individual requests will use context with their own timeouts
+	httpClient = &http.Client{
+		Transport:     withCompression(newTransport(TransportOptions{}), false),
+		Timeout:       10 * time.Minute,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// TransportOptions tunes the HTTP transport shared by every Hub and CDN request.
+// The zero value keeps the defaults.
+type TransportOptions struct {
+	// DisableHTTP2 pins connections to HTTP/1.1, for mirrors whose HTTP/2 flow
+	// control stalls large transfers. The transport's custom dialer already keeps
+	// Go from negotiating HTTP/2 on its own; this also refuses it if a later
+	// change were to opt in.
+	DisableHTTP2 bool
+	// MaxIdleConnsPerHost caps the idle connections kept per host for reuse,
+	// NumConnections when zero. Raising it helps with many small files.
+	MaxIdleConnsPerHost int
+	// CABundle is a PEM file of extra CA certificates to trust on top of the
+	// system pool, e.g. for a TLS-inspecting proxy.
+	CABundle string
+	// InsecureSkipVerify turns off certificate verification. Testing only.
+	InsecureSkipVerify bool
+	// MaxConnsPerHost caps the requests open against one host at a time, across
+	// all workers; see hostlimit.go. Zero means no cap.
+	MaxConnsPerHost int
+	// IPVersion restricts connections to IPv4 ("4") or IPv6 ("6"), for
+	// single-stack networks where trying the other family first stalls. Empty
+	// or "auto" lets Go try both.
+	IPVersion string
+	// DisableCompression stops asking the Hub for compressed transfers. By
+	// default whole-file requests send "Accept-Encoding: zstd, gzip" and the
+	// reply is decoded transparently, so checksums are computed over the
+	// decoded bytes, the same content the Hub's hashes describe. Range
+	// requests, used for resumes and peeks, always ask for the raw bytes.
+	DisableCompression bool
+	// KeepAliveInterval is the TCP keepalive interval, DefaultKeepAliveInterval
+	// when zero. A connection that receives nothing for three intervals is
+	// closed, and the transfer retried or resumed; lower it on flaky mobile or
+	// VPN links to notice dead connections sooner.
+	KeepAliveInterval time.Duration
+	// Headers are added to every request for the Hub, e.g. a gateway key or
+	// a tracing header; see ParseHeaders. They replace the downloader's own,
+	// the auth header included. Other hosts, such as redirect targets and
+	// presigned CDN URLs, never get them.
+	Headers http.Header
+	// HeaderHosts are the hosts besides the Hub's that get Headers, as URLs
+	// or host[:port], e.g. the mirrors trusted with the token.
+	HeaderHosts []string
+}
+
+// ValidateIPVersion checks an --ip-version value.
+func ValidateIPVersion(version string) error {
+	switch version {
+	case "", "auto", "4", "6":
+		return nil
+	}
+	return fmt.Errorf("invalid IP version %q: expected auto, 4 or 6", version)
+}
+
+// ipVersion is the IP family every client is restricted to, "" for either.
+var ipVersion string
+
+// restrictDial makes a dial function only use the configured IP family.
+func restrictDial(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if ipVersion != "" && (network == "tcp" || network == "udp") {
+			network += ipVersion
+		}
+		return dial(ctx, network, address)
+	}
+}
+
+// newDialer returns a dialer that resolves through Cloudflare's DNS, to solve
+// DNS timeout issues and resolve faster. On IPv6 the resolver is reached over
+// IPv6 too.
+func newDialer(version string) *net.Dialer {
+	dnsServer := "1.1.1.1:53"
+	if version == "6" {
+		dnsServer = "[2606:4700:4700::1111]:53"
+	}
 	r := &net.Resolver{
 		PreferGo: true,
 		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
 			d := &net.Dialer{Timeout: 5 * time.Second}
-			return d.DialContext(ctx, network, "1.1.1.1:53")
+			return d.DialContext(ctx, network, dnsServer)
 		},
 	}
-
-	dialer := &net.Dialer{
+	return &net.Dialer{
 		Timeout:   10 * time.Second,
 		KeepAlive: 30 * time.Second,
 		Resolver:  r,
 	}
+}
 
+// tlsConfig is used by every client the package creates: the Hub, R2, GCS and Azure.
+// nil means Go's defaults.
+var tlsConfig *tls.Config
+
+// dialer resolves through Cloudflare's DNS, see newDialer.
+var dialer *net.Dialer
+
+func newTransport(opts TransportOptions) *http.Transport {
+	idle, idlePerHost := NumConnections, NumConnections
+	if opts.MaxIdleConnsPerHost > 0 {
+		idlePerHost = opts.MaxIdleConnsPerHost
+		if idlePerHost > idle {
+			idle = idlePerHost
+		}
+	}
 	transport := &http.Transport{
-		DialContext:         dialer.DialContext,
+		DialContext:         keepAliveDial(restrictDial(dialer.DialContext), opts.KeepAliveInterval),
 		TLSHandshakeTimeout: 10 * time.Second,
-		MaxIdleConns:        NumConnections,
-		MaxIdleConnsPerHost: NumConnections,
+		MaxIdleConns:        idle,
+		MaxIdleConnsPerHost: idlePerHost,
 		IdleConnTimeout:     30 * time.Second,
 		DisableKeepAlives:   false,
+		DisableCompression:  true, // negotiated by withCompression, which also knows zstd
+		TLSClientConfig:     tlsConfig.Clone(),
 	}
+	if opts.DisableHTTP2 {
+		// A non-nil, empty TLSNextProto is what turns HTTP/2 off; nil means "default"
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
 
-	// Set a longer timeout for the HTTP client (10 minutes)
-	// Individual requests will use context with their own timeouts
-	httpClient = &http.Client{
-		Transport: transport,
-		Timeout:   10 * time.Minute,
+// ConfigureTransport replaces the shared HTTP transport and sets the TLS
+// settings of the R2, GCS and Azure clients. Call it before starting any download.
+// A client given with WithHTTPClient is left as it is.
+func ConfigureTransport(opts TransportOptions) error {
+	if err := ValidateIPVersion(opts.IPVersion); err != nil {
+		return err
+	}
+	ipVersion = ""
+	if opts.IPVersion == "4" || opts.IPVersion == "6" {
+		ipVersion = opts.IPVersion
+	}
+	dialer = newDialer(ipVersion)
+
+	tlsConfig = nil
+	if opts.CABundle != "" || opts.InsecureSkipVerify {
+		tlsConfig = &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	}
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no PEM certificates found in CA bundle %s", opts.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	httpClient.Transport = withHeaders(limitPerHost(withCompression(newTransport(opts), opts.DisableCompression), opts.MaxConnsPerHost), opts.Headers, opts.HeaderHosts)
+	return nil
+}
+
+// Query parameters that carry a signature, marking a presigned URL (S3/CloudFront
+// for classic LFS, the XET CAS bridge for xet-backed files).
+var presignParams = []string{"X-Amz-Signature", "Signature", "X-Xet-Signature", "Key-Pair-Id"}
+
+// isPresignedURL reports whether u authorizes itself through its query string.
+func isPresignedURL(u *url.URL) bool {
+	query := u.Query()
+	for _, param := range presignParams {
+		if query.Has(param) {
+			return true
+		}
 	}
+	return false
+}
+
+// checkRedirect follows resolve redirects, both the classic LFS CDN hop and the
+// XET bridge chain. Presigned targets must not see our token, as some of them
+// reject requests with two forms of auth, while the Range header has to survive
+// every hop for partial reads.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if isPresignedURL(req.URL) {
+		req.Header.Del(authHeaderName)
+	}
+	// Go only drops its own sensitive headers on cross-host hops, not a custom auth header
+	if req.URL.Hostname() != via[0].URL.Hostname() {
+		req.Header.Del(authHeaderName)
+	}
+	if rangeHeader := via[0].Header.Get("Range"); rangeHeader != "" && req.Header.Get("Range") == "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	return nil
+}
+
+// countingReader adds every byte read through it to n, so transfer totals
+// reflect what actually went over the wire rather than the sizes the API reports.
+type countingReader struct {
+	reader io.Reader
+	n      *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.reader.Read(p)
+	r.n.Add(int64(n))
+	return
+}
+
+func newCountingReader(reader io.Reader, n *atomic.Int64) io.Reader {
+	if n == nil {
+		return reader
+	}
+	return &countingReader{reader: reader, n: n}
 }
 
 func newProgressReader(reader io.Reader, progress *uploadProgress) io.Reader {
@@ -158,7 +369,7 @@ func newProgressReader(reader io.Reader, progress *uploadProgress) io.Reader {
 	}
 }
 
-func createProgressBar(total int64, filename string) *uploadProgress {
+func (d *Downloader) createProgressBar(total int64, filename string) *uploadProgress {
 	bar := progressbar.NewOptions64(
 		total,
 		progressbar.OptionSetDescription(filename),
@@ -166,8 +377,9 @@ func createProgressBar(total int64, filename string) *uploadProgress {
 		progressbar.OptionSetWidth(30),
 		progressbar.OptionThrottle(65*time.Millisecond),
 		progressbar.OptionShowCount(),
+		progressbar.OptionSetWriter(d.out),
 		progressbar.OptionOnCompletion(func() {
-			fmt.Printf("\n")
+			d.logf("\n")
 		}),
 	)
 
@@ -192,7 +404,7 @@ type R2FileCache struct {
 }
 
 // Add this function to pre-fetch existing files
-func buildR2Cache(ctx context.Context, r2cfg *R2Config, prefix string) (*R2FileCache, error) {
+func (d *Downloader) buildR2Cache(ctx context.Context, r2cfg *R2Config, prefix string) (*R2FileCache, error) {
 	client := createR2Client(ctx, *r2cfg)
 	cache := &R2FileCache{
 		files: make(map[string]int64),
@@ -203,7 +415,7 @@ func buildR2Cache(ctx context.Context, r2cfg *R2Config, prefix string) (*R2FileC
 		Prefix: aws.String(prefix),
 	}
 
-	fmt.Printf("Building cache of existing files in R2...\n")
+	d.logf("Building cache of existing files in R2...\n")
 	start := time.Now()
 
 	// Use paginator for large buckets
@@ -222,17 +434,20 @@ func buildR2Cache(ctx context.Context, r2cfg *R2Config, prefix string) (*R2FileC
 		}
 
 		if count%1000 == 0 {
-			fmt.Printf("Cached %d files...\n", count)
+			d.logf("Cached %d files...\n", count)
 		}
 	}
 
 	elapsed := time.Since(start)
-	fmt.Printf("Cached %d files in %s\n", count, elapsed)
+	d.logf("Cached %d files in %s\n", count, elapsed)
 	return cache, nil
 }
 
 // Add method to check if file exists
 func (c *R2FileCache) Exists(key string) bool {
+	if c == nil {
+		return false
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	_, exists := c.files[key]
@@ -241,6 +456,9 @@ func (c *R2FileCache) Exists(key string) bool {
 
 // Add method to check if file exists and has the expected size
 func (c *R2FileCache) ExistsWithSize(key string, expectedSize int64) bool {
+	if c == nil {
+		return false
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	size, exists := c.files[key]
@@ -249,162 +467,465 @@ func (c *R2FileCache) ExistsWithSize(key string, expectedSize int64) bool {
 
 // Get the file size
 func (c *R2FileCache) GetSize(key string) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	size, exists := c.files[key]
 	return size, exists
 }
 
-// DownloadState represents the current state of a model download
-type DownloadState struct {
-	ModelName      string          `json:"model_name"`
-	Branch         string          `json:"branch"`
-	TotalFiles     int             `json:"total_files"`
-	CompletedFiles map[string]bool `json:"completed_files"`
-	LastUpdate     time.Time       `json:"last_update"`
-	StartTime      time.Time       `json:"start_time"`
-}
-
-// saveDownloadState saves the current download state to a file
-func saveDownloadState(state *DownloadState, modelName string) error {
-	// Create state directory if it doesn't exist
-	stateDir := filepath.Join(os.TempDir(), "hfdownloader-state")
-	if err := os.MkdirAll(stateDir, 0755); err != nil {
-		return fmt.Errorf("failed to create state directory: %v", err)
+// r2KeyFor maps a repo path to its object key under the configured subfolder.
+// It returns an empty key when no R2 upload is configured.
+func r2KeyFor(r2cfg *R2Config, filePath string, hfPrefix string) string {
+	if r2cfg == nil {
+		return ""
 	}
+	return fmt.Sprintf("%s/%s", r2cfg.Subfolder, strings.TrimPrefix(filePath, fmt.Sprintf("%s/", prefixRoot(hfPrefix))))
+}
 
-	// Create filename from sanitized model name
-	safeModelName := strings.ReplaceAll(modelName, "/", "_")
-	stateFile := filepath.Join(stateDir, fmt.Sprintf("%s.json", safeModelName))
+// DownloadWithOptions downloads the repo described by opts, staging files under
+// opts.Storage and/or uploading them to R2.
+func (d *Downloader) DownloadWithOptions(opts DownloadOptions) error {
+	_, err := d.Download(context.Background(), opts)
+	return err
+}
 
-	// Update timestamp
-	state.LastUpdate = time.Now()
+// Download is DownloadWithOptions with graceful cancellation: once ctx is done no
+// new files are scheduled, files already in flight get opts.ShutdownGrace to
+// finish, and ErrInterrupted is returned. Unfinished files are left as .part
+// files, never under their final name.
+//
+// A ctx deadline is a hard limit instead: in-flight files are aborted at once
+// and the error also wraps ErrTimeout. The saved job state lets a later run
+// pick up where this one stopped.
+//
+// The first failed file stops the download unless opts.ContinueOnError is set.
+// Either way every failure is listed in the returned result and the error wraps
+// ErrFilesFailed.
+func (d *Downloader) Download(ctx context.Context, opts DownloadOptions) (*DownloadResult, error) {
+	backends := 0
+	for _, set := range []bool{opts.R2 != nil, opts.GCS != nil, opts.Azure != nil} {
+		if set {
+			backends++
+		}
+	}
+	if backends > 1 {
+		return nil, errors.New("only one upload backend can be used at a time")
+	}
+	uploading := backends == 1
+	if opts.Decompress && uploading {
+		return nil, errors.New("decompression only applies to local downloads and cannot be combined with an upload backend")
+	}
+	if opts.OnlyMissing && opts.QuickVerify {
+		return nil, errors.New("only-missing trusts local files and cannot be combined with quick verify")
+	}
+	if opts.Tee && (opts.R2 == nil || opts.SkipLocal) {
+		return nil, errors.New("tee needs an R2 upload and a local copy, so it cannot be combined with skip-local")
+	}
+	if err := checkHubCacheOptions(opts, uploading); err != nil {
+		return nil, err
+	}
+	if _, err := RepoFolder(opts.Repo); err != nil {
+		return nil, err
+	}
+	if err := checkMirrors(opts.Mirrors); err != nil {
+		return nil, err
+	}
+	if err := checkRequiredFree(opts); err != nil {
+		return nil, err
+	}
+	if err := d.checkRepo(opts); err != nil {
+		return nil, err
+	}
 
-	// Write state to file
-	file, err := os.Create(stateFile)
+	branch, err := d.resolveBranch(opts)
 	if err != nil {
-		return fmt.Errorf("failed to create state file: %v", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(state); err != nil {
-		return fmt.Errorf("failed to encode state: %v", err)
+	if branch != opts.Branch {
+		d.logf("Using branch %s instead of %s\n", branch, opts.Branch)
+		opts.Branch = branch
 	}
 
-	return nil
-}
-
-// loadDownloadState loads the download state from a file
-func loadDownloadState(modelName string) (*DownloadState, error) {
-	// Create filename from sanitized model name
-	safeModelName := strings.ReplaceAll(modelName, "/", "_")
-	stateDir := filepath.Join(os.TempDir(), "hfdownloader-state")
-	stateFile := filepath.Join(stateDir, fmt.Sprintf("%s.json", safeModelName))
-
-	// Check if state file exists
-	if _, err := os.Stat(stateFile); os.IsNotExist(err) {
-		return nil, nil // No state file exists
+	// An attestation, git layout, hub snapshot or expected commit names one
+	// commit, so download exactly that commit even if the branch moves while we
+	// run. Otherwise the commit is only recorded.
+	if opts.ExpectCommit != "" && !shortCommitSHA.MatchString(opts.ExpectCommit) {
+		return nil, fmt.Errorf("invalid expected commit %q, expected 7 to 40 hex digits", opts.ExpectCommit)
 	}
-
-	// Read state file
-	file, err := os.Open(stateFile)
+	pin := opts.Attestation != "" || opts.GitLayout || opts.HubCache != "" || opts.ExpectCommit != ""
+	revision := opts.Branch
+	commit, err := resolveCommit(d.client(), opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open state file: %v", err)
+		if pin {
+			return nil, fmt.Errorf("failed to resolve the commit of %s: %w", opts.Branch, err)
+		}
+		d.debugf("Failed to resolve the commit of %s: %v\n", opts.Branch, err)
+		commit = ""
 	}
-	defer file.Close()
-
-	// Decode state
-	state := &DownloadState{
-		CompletedFiles: make(map[string]bool),
+	if opts.ExpectCommit != "" && !strings.HasPrefix(commit, strings.ToLower(opts.ExpectCommit)) {
+		return nil, fmt.Errorf("%w: %s of %s is at %s, expected %s", ErrCommitMismatch, revision, opts.Repo, commit, opts.ExpectCommit)
 	}
-	if err := json.NewDecoder(file).Decode(state); err != nil {
-		return nil, fmt.Errorf("failed to decode state: %v", err)
+	if commit != "" && commit != revision {
+		d.logf("Resolved %s to commit %s\n", revision, commit)
 	}
-
-	// Check if state is stale (older than 7 days)
-	if time.Since(state.LastUpdate) > 7*24*time.Hour {
-		os.Remove(stateFile) // Remove stale state file
-		return nil, nil
+	if pin {
+		opts.Branch = commit
 	}
 
-	return state, nil
-}
-
-func DownloadModel(ModelDatasetName string, AppendFilterToPath bool, SkipSHA bool, IsDataset bool, DestinationBasePath string, ModelBranch string, concurrentConnections int, token string, silentMode bool, r2cfg *R2Config, skipLocal bool, hfPrefix string, maxWorkers int) error {
-	// Create a cancellable context with a 24-hour timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
+	// Transfers run on their own context so that cancelling ctx stops scheduling
+	// without cutting off the files in flight
+	transferCtx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
 	defer cancel()
 
-	// Load existing download state
-	downloadState, err := loadDownloadState(ModelDatasetName)
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-finished:
+			return
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			d.logln("⏰ Timeout reached - aborting in-flight files")
+			cancel()
+			return
+		}
+		if opts.ShutdownGrace <= 0 {
+			d.logln("🛑 Shutdown requested - waiting for in-flight files to finish")
+			return
+		}
+		d.logf("🛑 Shutdown requested - waiting up to %s for in-flight files to finish\n", opts.ShutdownGrace)
+		select {
+		case <-time.After(opts.ShutdownGrace):
+			d.logln("🛑 Shutdown grace period expired - aborting in-flight files")
+			cancel()
+		case <-finished:
+		}
+	}()
+
+	// Load the state of an earlier run with the same selection, unless asked to start over
+	stateFile := statePath(opts)
+	if opts.ResetState {
+		if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to reset download state: %v", err)
+		}
+	}
+	fingerprint := stateFingerprint(opts)
+	downloadState, err := loadDownloadState(stateFile)
 	if err != nil {
-		fmt.Printf("Warning: Failed to load download state: %v\n", err)
+		d.logf("Warning: Failed to load download state: %v\n", err)
+	}
+	if downloadState != nil && downloadState.Fingerprint != fingerprint {
+		d.logf("Download options changed since the state in %s was saved, starting over\n", stateFile)
+		downloadState = nil
 	}
 
 	// Initialize new state if needed
 	if downloadState == nil {
 		downloadState = &DownloadState{
-			ModelName:      ModelDatasetName,
-			Branch:         ModelBranch,
-			TotalFiles:     0,
-			CompletedFiles: make(map[string]bool),
-			StartTime:      time.Now(),
-			LastUpdate:     time.Now(),
-		}
-		fmt.Println("🆕 Starting new download session")
+			ModelName:   opts.Repo,
+			Branch:      opts.Branch,
+			Fingerprint: fingerprint,
+			StartTime:   time.Now(),
+			LastUpdate:  time.Now(),
+			index:       make(map[string]int),
+		}
+		d.logln("🆕 Starting new download session")
 	} else {
-		fmt.Printf("🔄 Resuming download from previous session (started %s)\n",
+		done, total := downloadState.counts()
+		d.logf("🔄 Resuming download from previous session (started %s)\n",
 			time.Since(downloadState.StartTime).Round(time.Minute))
-		fmt.Printf("💾 Previously completed: %d/%d files\n",
-			len(downloadState.CompletedFiles), downloadState.TotalFiles)
+		d.logf("💾 Previously completed: %d/%d files\n", done, total)
 	}
 
-	// Build cache of existing files
-	cache, err := buildR2Cache(ctx, r2cfg, r2cfg.Subfolder+"/")
-	if err != nil {
-		return fmt.Errorf("failed to build R2 cache: %v", err)
+	// Build cache of existing files (only when uploading)
+	var cache *R2FileCache
+	var gcs *gcsClient
+	var azure *azureClient
+	if opts.R2 != nil {
+		cache, err = d.buildR2Cache(transferCtx, opts.R2, opts.R2.Subfolder+"/")
+		if err != nil {
+			return nil, fmt.Errorf("failed to build R2 cache: %v", err)
+		}
+	} else if opts.GCS != nil {
+		if gcs, err = newGCSClient(transferCtx, *opts.GCS); err != nil {
+			return nil, err
+		}
+		cache, err = d.buildGCSCache(transferCtx, gcs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build GCS cache: %v", err)
+		}
+	} else if opts.Azure != nil {
+		if azure, err = newAzureClient(*opts.Azure); err != nil {
+			return nil, err
+		}
+		cache, err = d.buildAzureCache(transferCtx, azure)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build Azure cache: %v", err)
+		}
+	}
+	objectKey := func(filePath string) string {
+		if opts.GCS != nil {
+			return gcsKeyFor(opts.GCS, filePath, opts.HFPrefix)
+		}
+		if opts.Azure != nil {
+			return azureKeyFor(opts.Azure, filePath, opts.HFPrefix)
+		}
+		return r2KeyFor(opts.R2, filePath, opts.HFPrefix)
 	}
 
-	modelP := strings.Split(ModelDatasetName, ":")[0]
-	modelPath := filepath.Join(DestinationBasePath, modelP)
+	modelP := strings.Split(opts.Repo, ":")[0]
+	modelPath := repoDir(opts)
 
 	// Create R2 client for checking existing files
-	// r2Client := createR2Client(ctx, *r2cfg)
+	// r2Client := createR2Client(transferCtx, *opts.R2)
 
-	// Use the provided maxWorkers parameter with a safety check
-	if maxWorkers <= 0 {
-		maxWorkers = 16 // Default to 16 if an invalid value is provided
+	manifest, err := LoadManifest(modelPath)
+	if err != nil {
+		d.logf("Warning: %v, starting a fresh one\n", err)
+		manifest = &Manifest{Files: make(map[string]ManifestEntry)}
+	}
+	d.checkManifestSignature(manifest, modelPath, opts)
+	manifest.SetRevision(modelP, revision)
+	if commit != "" {
+		manifest.SetCommit(commit)
+	}
+
+	// Provenance files are kept with the download, or uploaded next to the
+	// objects when nothing is kept locally
+	keepLocal := !opts.SkipLocal || !uploading
+	openProvenance := func(localPath string) (io.WriteCloser, string, error) {
+		if keepLocal {
+			f, err := createAtomic(localPath)
+			return f, localPath, err
+		}
+		key := objectKey(filepath.Base(localPath))
+		return &objectWriter{upload: func(body io.Reader, size int64) error {
+			switch {
+			case gcs != nil:
+				return gcs.upload(transferCtx, key, body, size)
+			case azure != nil:
+				return azure.upload(transferCtx, key, body, size)
+			}
+			return putR2Object(transferCtx, *opts.R2, key, body, size)
+		}}, key, nil
 	}
-	fmt.Printf("Using %d worker goroutines for parallel downloads\n", maxWorkers)
 
-	jobs := make(chan hfmodel, maxWorkers)
-	results := make(chan error, maxWorkers)
+	manifestExisted := false
+	if keepLocal {
+		_, statErr := os.Stat(filepath.Join(modelPath, ManifestFileName))
+		manifestExisted = statErr == nil
+	} else {
+		_, manifestExisted = cache.GetSize(objectKey(ManifestFileName))
+	}
+	saveManifest := func() {
+		if opts.NoOverwriteManifest && manifestExisted {
+			return
+		}
+		if opts.SignManifest {
+			if err := manifest.Sign(opts.ManifestKey); err != nil {
+				d.logf("Warning: Failed to sign manifest: %v\n", err)
+				return
+			}
+		}
+		w, where, err := openProvenance(filepath.Join(modelPath, ManifestFileName))
+		if err != nil {
+			d.logf("Warning: Failed to save manifest: %v\n", err)
+			return
+		}
+		_, err = manifest.WriteTo(w)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			d.logf("Warning: Failed to save manifest to %s: %v\n", where, err)
+		}
+	}
+
+	workers := workerCount(opts)
+	if d.lowMemory && workers > LowMemoryWorkers {
+		workers = LowMemoryWorkers
+	}
+	d.checkOpenFileLimit(workers)
+	largeFiles := newLargeFileSlots(opts)
+	mirrors := newMirrorSet(opts.Mirrors)
+	var limiter *adaptiveLimiter
+	if opts.AdaptiveConcurrency {
+		limiter = d.newAdaptiveLimiter(workers)
+		d.logf("Using adaptive concurrency: starting at %d of up to %d workers\n", limiter.current(), workers)
+	} else if opts.MaxWorkers <= 0 && workers == AutoWorkers() {
+		d.logf("Using %d worker goroutines for parallel downloads (auto, %d CPUs)\n", workers, numCPU())
+	} else {
+		d.logf("Using %d worker goroutines for parallel downloads\n", workers)
+	}
+
+	// Scheduling stops on the first failure unless we were asked to carry on
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
+
+	result := &DownloadResult{Revision: revision, Commit: commit}
+	var resultMu sync.Mutex
+	fail := func(filePath string, err error) {
+		if filePath != "" {
+			downloadState.setStatus(filePath, StatusFailed, err)
+		}
+		resultMu.Lock()
+		result.Failed = append(result.Failed, FileError{Path: filePath, Message: err.Error(), Err: err})
+		resultMu.Unlock()
+		if !opts.ContinueOnError {
+			stopDispatch()
+		}
+	}
+	// Bytes are recorded for failed transfers too, since they were still paid for
+	record := func(filePath string, downloaded, uploaded int64) {
+		resultMu.Lock()
+		result.Transfers = append(result.Transfers, FileTransfer{Path: filePath, BytesDownloaded: downloaded, BytesUploaded: uploaded})
+		result.BytesDownloaded += downloaded
+		result.BytesUploaded += uploaded
+		resultMu.Unlock()
+	}
+
+	// Files QuickVerify kept by their quick hash, fully verified once downloads finish
+	var quickChecked []hfmodel
+
+	// Completion hooks run one at a time, whichever worker finishes a file
+	var hookMu sync.Mutex
+
+	jobs := make(chan hfmodel, workers)
 	var wg sync.WaitGroup
 	var completedFiles atomic.Int32
 
-	for i := 0; i < maxWorkers; i++ {
+	// complete records a fetched file: transforms, timestamps, the manifest
+	// entry, checks of the upload and the completion hook. It reports whether
+	// the file is done; a file that isn't was failed.
+	complete := func(f fileFetch, header http.Header) bool {
+		file, localPath, r2Key, decompress := f.file, f.localPath, f.r2Key, f.decompress
+		if len(opts.Transforms) > 0 && (!opts.SkipLocal || !uploading) {
+			event := FileEvent{Path: file.Path, LocalPath: localPath, Key: r2Key, Size: int64(file.Size)}
+			if err := runTransforms(transferCtx, opts.Transforms, event); err != nil {
+				d.logf("Error: %s: %v\n", file.Path, err)
+				os.Remove(localPath)
+				fail(file.Path, err)
+				return false
+			}
+		}
+
+		if opts.TouchTimestamps && keepLocal {
+			// Only the modification time; access times stay the file system's
+			if changed := lastCommitTime(file); changed.IsZero() {
+				d.debugf("No commit date for %s, leaving its modification time\n", file.Path)
+			} else if err := os.Chtimes(localPath, time.Time{}, changed); err != nil {
+				d.logf("Warning: failed to set the modification time of %s: %v\n", file.Path, err)
+			}
+		}
+
+		entry := ManifestEntry{Size: int64(file.Size), ETag: header.Get("ETag"), Updated: time.Now()}
+		if file.Lfs != nil {
+			entry.SHA256 = file.Lfs.Oid_SHA265
+		}
+		if target, ok := opts.Rename[file.Path]; ok && keepLocal {
+			entry.LocalPath = target
+		}
+		if opts.QuickVerify && !decompress && keepLocal {
+			var err error
+			if entry.QuickHash, err = quickHash(localPath, quickVerifySize(opts)); err != nil {
+				d.logf("Warning: %v\n", err)
+			}
+		}
+		manifest.Set(file.Path, entry)
+
+		// Verify parquet file
+		if opts.R2 != nil && strings.HasSuffix(r2Key, ".parquet") {
+			if err := verifyParquetFile(transferCtx, opts.R2, r2Key, int64(file.Size)); err != nil {
+				// Delete corrupted file
+				client := createR2Client(transferCtx, *opts.R2)
+				_, deleteErr := client.DeleteObject(transferCtx, &s3.DeleteObjectInput{
+					Bucket: aws.String(opts.R2.BucketName),
+					Key:    aws.String(r2Key),
+				})
+				if deleteErr != nil {
+					d.logf("Warning: Failed to delete corrupted file %s: %v\n", r2Key, deleteErr)
+				}
+
+				fail(file.Path, fmt.Errorf("verification failed for %s: %v", r2Key, err))
+				return false
+			}
+		}
+
+		if opts.OnFileComplete != nil {
+			event := FileEvent{Path: file.Path, Key: r2Key, Size: int64(file.Size)}
+			if !opts.SkipLocal || !uploading {
+				event.LocalPath = localPath
+			}
+			hookMu.Lock()
+			hookErr := opts.OnFileComplete(event)
+			hookMu.Unlock()
+			if hookErr != nil {
+				fail(file.Path, fmt.Errorf("file completion hook failed: %w", hookErr))
+				return false
+			}
+		}
+
+		// Mark as completed in download state
+		downloadState.setStatus(file.Path, StatusDone, nil)
+		// Save download state periodically (every ~5 files)
+		if completedFiles.Load()%5 == 0 {
+			if err := saveDownloadState(downloadState, stateFile); err != nil {
+				d.logf("Warning: Failed to save download state: %v\n", err)
+			}
+		}
+
+		completedFiles.Add(1)
+		return true
+	}
+
+	// Files fetched without their hash checked, when opts.VerifyWorkers are on
+	var verify *verifyPool
+	if opts.VerifyWorkers > 0 {
+		verify = d.newVerifyPool(transferCtx, opts.VerifyWorkers, func(f fileFetch, header http.Header) {
+			if complete(f, header) {
+				d.logf("✅ Verified %s\n", f.r2Key)
+			}
+		}, fail)
+	}
+
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func(workerID int) {
+			var current string
+
 			// Add panic recovery to prevent worker crashes from bringing down the entire process
 			defer func() {
 				if r := recover(); r != nil {
 					stack := make([]byte, 8192)
 					length := runtime.Stack(stack, false)
 					errMsg := fmt.Sprintf("❌ Worker %d panicked: %v\n%s", workerID, r, stack[:length])
-					fmt.Println(errMsg)
-					results <- fmt.Errorf("worker %d panicked: %v", workerID, r)
+					d.logln(errMsg)
+					fail(current, fmt.Errorf("worker %d panicked: %v", workerID, r))
 				}
 			}()
 			defer wg.Done()
 
-			for file := range jobs {
+			for {
+				if !limiter.wait(workerID) {
+					return
+				}
+				file, ok := <-jobs
+				if !ok {
+					return
+				}
+				current = file.Path
+				if dispatchCtx.Err() != nil && ctx.Err() == nil {
+					continue // another file failed; drain the queue without starting new work
+				}
 				if file.IsDirectory || file.FilterSkip || file.Size <= 0 || file.Path == "" {
 					completedFiles.Add(1)
 					continue
 				}
-				if skipLocal && file.LocalSize > 0 {
+				if opts.SkipLocal && file.LocalSize > 0 {
 					completedFiles.Add(1)
 					continue
 				}
@@ -413,191 +934,173 @@ func DownloadModel(ModelDatasetName string, AppendFilterToPath bool, SkipSHA boo
 					continue
 				}
 				if file.IsLFS {
-					if !silentMode {
-						fmt.Printf("Skipping LFS file %s\n", file.Path)
+					if !opts.SilentMode {
+						d.logf("Skipping LFS file %s\n", file.Path)
 					}
 					completedFiles.Add(1)
 					continue
 				}
 
-				fmt.Printf("Worker %d: Processing file %s\n", workerID, file.Path)
+				d.debugf("Worker %d: Processing file %s\n", workerID, file.Path)
+
+				localName, decompress := localPathFor(opts, file.Path)
+				localPath := filepath.Join(modelPath, localName)
+				r2Key := objectKey(file.Path)
+
+				// Small regular files with a recorded ETag are revalidated with a conditional
+				// request instead of trusting their size, since configs change in place
+				forced := opts.alwaysFetch(file)
+				var etag string
+				if !uploading && file.Lfs == nil && !opts.OnlyMissing && !forced {
+					if entry, ok := manifest.Get(file.Path); ok && entry.ETag != "" {
+						if _, err := os.Stat(localPath); err == nil {
+							etag = entry.ETag
+						}
+					}
+				}
 
-				r2Key := fmt.Sprintf("%s/%s", r2cfg.Subfolder, strings.TrimPrefix(file.Path, fmt.Sprintf("%s/", hfPrefix)))
+				// Without an upload the local copy is the only destination, so a complete one means we're done
+				if !uploading && etag == "" && !forced {
+					if decompress {
+						// The expanded file has a different size; trust the manifest entry for the .gz
+						if entry, ok := manifest.Get(file.Path); ok && entry.Size == int64(file.Size) && (file.Lfs == nil || entry.SHA256 == file.Lfs.Oid_SHA265) {
+							if _, err := os.Stat(localPath); err == nil {
+								if !opts.SilentMode {
+									d.logf("Skipping %s - already decompressed locally\n", localPath)
+								}
+								completedFiles.Add(1)
+								continue
+							}
+						}
+					} else if info, err := os.Stat(localPath); err == nil && info.Size() == int64(file.Size) && d.passesQuickCheck(localPath, file, manifest, opts) {
+						if !opts.SilentMode {
+							d.logf("Skipping %s - already exists locally with correct size\n", localPath)
+						}
+						if opts.QuickVerify {
+							resultMu.Lock()
+							quickChecked = append(quickChecked, file)
+							resultMu.Unlock()
+						}
+						completedFiles.Add(1)
+						continue
+					}
+				}
 
 				// Check if file exists with correct size using ExistsWithSize
-				if cache.ExistsWithSize(r2Key, int64(file.Size)) {
-					if !silentMode {
-						fmt.Printf("Skipping %s - already exists in R2 with correct size\n", r2Key)
+				if cache.ExistsWithSize(r2Key, int64(file.Size)) && !forced {
+					if !opts.SilentMode {
+						d.logf("Skipping %s - already uploaded with correct size\n", r2Key)
 					}
 					completedFiles.Add(1)
 					continue
-				} else if existingSize, exists := cache.GetSize(r2Key); exists {
+				} else if existingSize, exists := cache.GetSize(r2Key); exists && opts.R2 != nil {
 					// File exists but with incorrect size, delete it and reupload
-					fmt.Printf("File %s exists with incorrect size (expected: %s, actual: %s). Deleting and reuploading...\n",
+					d.logf("File %s exists with incorrect size (expected: %s, actual: %s). Deleting and reuploading...\n",
 						r2Key, formatSize(int64(file.Size)), formatSize(existingSize))
 
-					client := createR2Client(ctx, *r2cfg)
-					_, deleteErr := client.DeleteObject(ctx, &s3.DeleteObjectInput{
-						Bucket: aws.String(r2cfg.BucketName),
+					client := createR2Client(transferCtx, *opts.R2)
+					_, deleteErr := client.DeleteObject(transferCtx, &s3.DeleteObjectInput{
+						Bucket: aws.String(opts.R2.BucketName),
 						Key:    aws.String(r2Key),
 					})
 					if deleteErr != nil {
-						fmt.Printf("Warning: Failed to delete incomplete file %s: %v\n", r2Key, deleteErr)
+						d.logf("Warning: Failed to delete incomplete file %s: %v\n", r2Key, deleteErr)
 					}
 				}
 
-				downloadURL := fmt.Sprintf("https://huggingface.co/datasets/%s/resolve/%s/%s",
-					ModelDatasetName,
-					ModelBranch,
-					file.Path,
-				)
-
-				fmt.Printf("Worker %d: Starting download of %s\n", workerID, file.Path)
-
-				// Create download-specific context with longer timeout for large files (30 minutes)
-				downloadCtx, cancelDownload := context.WithTimeout(ctx, 30*time.Minute)
-				defer cancelDownload()
-
-				// Create request with context
-				req, err := http.NewRequestWithContext(downloadCtx, "GET", downloadURL, nil)
-				if err != nil {
-					fmt.Printf("Error creating request for %s: %v\n", file.Path, err)
-					results <- fmt.Errorf("failed to create request for %s: %v", file.Path, err)
-					continue
+				d.debugf("Worker %d: Starting download of %s\n", workerID, file.Path)
+				fetch := fileFetch{
+					opts:       opts,
+					file:       file,
+					localPath:  localPath,
+					r2Key:      r2Key,
+					etag:       etag,
+					decompress: decompress,
+					largeFiles: largeFiles,
+					mirrors:    mirrors,
+					limiter:    limiter,
+					gcs:        gcs,
+					azure:      azure,
+					record:     func(downloaded, uploaded int64) { record(file.Path, downloaded, uploaded) },
+					pointer: func() {
+						resultMu.Lock()
+						result.Pointers = append(result.Pointers, file.Path)
+						resultMu.Unlock()
+					},
+					// Files only kept locally can leave their hash to the verify pool
+					deferVerify: verify != nil && !uploading && !decompress && !opts.skipHashCheck(file),
 				}
-
-				if RequiresAuth {
-					req.Header.Add("Authorization", "Bearer "+AuthToken)
-				}
-				req.Header.Add("User-Agent", "Mozilla/5.0")
-
-				// Download file with retry logic
-				var resp *http.Response
-				downloadErr := retryWithBackoff(func() error {
-					var err error
-					resp, err = httpClient.Do(req)
-					if err != nil {
-						return fmt.Errorf("request failed: %v", err)
-					}
-
-					if resp.StatusCode != http.StatusOK {
-						bodyBytes, _ := io.ReadAll(resp.Body)
-						resp.Body.Close()
-						return fmt.Errorf("bad status: %d, body: %s", resp.StatusCode, string(bodyBytes))
-					}
-
-					return nil
-				}, 5, 1*time.Second, 30*time.Second)
-
-				if downloadErr != nil {
-					if resp != nil && resp.Body != nil {
-						resp.Body.Close()
-					}
-					fmt.Printf("Error downloading %s after retries: %v\n", file.Path, downloadErr)
-					results <- fmt.Errorf("failed to download %s: %v", file.Path, downloadErr)
+				header, err := d.fetchFile(transferCtx, fetch)
+				if err != nil {
+					fail(file.Path, err)
 					continue
 				}
-
-				// Create progress bar
-				progress := createProgressBar(int64(file.Size), filepath.Base(file.Path))
-
-				// Upload to R2
-				var uploadErr error
-				if int64(file.Size) > multipartThreshold {
-					uploadErr = streamMultipartToR2(ctx, *r2cfg, resp.Body, r2Key, int64(file.Size), progress)
-				} else {
-					uploadErr = streamSimpleToR2(ctx, *r2cfg, resp.Body, r2Key, int64(file.Size), progress)
-				}
-				resp.Body.Close()
-
-				if uploadErr != nil {
-					fmt.Printf("Error uploading %s: %v\n", file.Path, uploadErr)
-					results <- fmt.Errorf("failed to upload %s: %v", file.Path, uploadErr)
+				if header == nil {
+					// Unchanged since the last run, or a pointer left out
+					completedFiles.Add(1)
 					continue
 				}
 
-				// Verify parquet file
-				if err := verifyParquetFile(ctx, r2cfg, r2Key, int64(file.Size)); err != nil {
-					// Delete corrupted file
-					client := createR2Client(ctx, *r2cfg)
-					_, deleteErr := client.DeleteObject(ctx, &s3.DeleteObjectInput{
-						Bucket: aws.String(r2cfg.BucketName),
-						Key:    aws.String(r2Key),
-					})
-					if deleteErr != nil {
-						fmt.Printf("Warning: Failed to delete corrupted file %s: %v\n", r2Key, deleteErr)
-					}
-
-					results <- fmt.Errorf("file verification failed for %s: %v", r2Key, err)
+				if fetch.deferVerify {
+					verify.add(fetch, header)
 					continue
 				}
-
-				// Mark as completed in download state
-				downloadState.CompletedFiles[file.Path] = true
-				// Save download state periodically (every ~5 files)
-				if completedFiles.Load()%5 == 0 {
-					if err := saveDownloadState(downloadState, ModelDatasetName); err != nil {
-						fmt.Printf("Warning: Failed to save download state: %v\n", err)
-					}
+				if complete(fetch, header) {
+					d.logf("✅ Worker %d: Successfully uploaded and verified %s\n", workerID, r2Key)
 				}
-
-				completedFiles.Add(1)
-				fmt.Printf("✅ Worker %d: Successfully uploaded and verified %s\n", workerID, r2Key)
 			}
 		}(i)
 	}
 
 	// Process files function that checks cache before queueing
+	interrupted := false
+	var duplicates []duplicateFile
+	var symlinks []hfmodel
 	processFiles := func(files []hfmodel) {
 		var pendingFiles []hfmodel
 		totalSize := int64(0)
 		skippedSize := int64(0)
 		skippedCount := 0
 
-		// Update total file count in download state
-		// Should only count files that need downloading
-		fileCount := 0
-		for _, file := range files {
-			if !file.IsDirectory && !file.FilterSkip && file.Size > 0 {
-				fileCount++
-			}
-		}
-
-		if downloadState.TotalFiles == 0 {
-			downloadState.TotalFiles = fileCount
-		} else {
-			downloadState.TotalFiles += fileCount
-		}
-
 		// Save state
-		if err := saveDownloadState(downloadState, ModelDatasetName); err != nil {
-			fmt.Printf("Warning: Failed to save download state: %v\n", err)
+		if err := saveDownloadState(downloadState, stateFile); err != nil {
+			d.logf("Warning: Failed to save download state: %v\n", err)
 		}
 
 		// First, filter files that need to be processed
 		for _, file := range files {
 			if !file.IsDirectory && !file.FilterSkip && file.Size > 0 {
-				r2Key := fmt.Sprintf("%s/%s", r2cfg.Subfolder, strings.TrimPrefix(file.Path, fmt.Sprintf("%s/", hfPrefix)))
+				r2Key := objectKey(file.Path)
+				resultMu.Lock()
+				result.Files++
+				resultMu.Unlock()
 
 				totalSize += int64(file.Size)
 
 				// Check if file is already in completed files list
-				if downloadState.CompletedFiles[file.Path] {
-					fmt.Printf("Skipping %s - marked as completed in saved state\n", file.Path)
+				if downloadState.isDone(file.Path) {
+					d.logf("Skipping %s - marked as completed in saved state\n", file.Path)
 					skippedSize += int64(file.Size)
 					skippedCount++
 					continue
 				}
 
-				if cache.ExistsWithSize(r2Key, int64(file.Size)) {
-					// File exists in R2 with correct size - mark as completed
-					downloadState.CompletedFiles[file.Path] = true
+				if cache.ExistsWithSize(r2Key, int64(file.Size)) && !opts.alwaysFetch(file) {
+					// File already uploaded with correct size - mark as completed
+					downloadState.setStatus(file.Path, StatusDone, nil)
+					if _, ok := manifest.Get(file.Path); !ok && !keepLocal {
+						entry := ManifestEntry{Size: int64(file.Size), Updated: time.Now()}
+						if file.Lfs != nil {
+							entry.SHA256 = file.Lfs.Oid_SHA265
+						}
+						manifest.Set(file.Path, entry)
+					}
 					skippedSize += int64(file.Size)
 					skippedCount++
 					continue
 				} else if existingSize, exists := cache.GetSize(r2Key); exists {
 					// File exists but with incorrect size, will be reuploaded
-					fmt.Printf("File %s exists with incorrect size (expected: %s, actual: %s). Will be deleted and reuploaded.\n",
+					d.logf("File %s exists with incorrect size (expected: %s, actual: %s). Will be deleted and reuploaded.\n",
 						r2Key, formatSize(int64(file.Size)), formatSize(existingSize))
 				}
 
@@ -605,23 +1108,46 @@ func DownloadModel(ModelDatasetName string, AppendFilterToPath bool, SkipSHA boo
 			}
 		}
 
+		pendingFiles, symlinks = splitSymlinks(pendingFiles)
+		if len(symlinks) > 0 && uploading {
+			d.logf("Warning: not uploading %d symlink(s), object storage has no links\n", len(symlinks))
+			symlinks = nil
+		}
+
+		if opts.DedupeByHash && !uploading {
+			pendingFiles, duplicates = splitDuplicates(pendingFiles)
+			if len(duplicates) > 0 && !opts.SilentMode {
+				d.logf("%d file(s) share a blob with another file and will be linked instead of downloaded\n", len(duplicates))
+			}
+		}
+
 		// Print summary
-		if !silentMode {
-			fmt.Printf("\n=== Processing Summary ===\n")
-			fmt.Printf("Total files found: %d\n", len(files))
-			fmt.Printf("Files already in R2: %d\n", skippedCount)
-			fmt.Printf("Files to process: %d\n", len(pendingFiles))
-			fmt.Printf("Total size: %s\n", formatSize(totalSize))
-			fmt.Printf("Skipped size: %s\n", formatSize(skippedSize))
-			fmt.Printf("Remaining size: %s\n\n", formatSize(totalSize-skippedSize))
+		if !opts.SilentMode {
+			d.logf("\n=== Processing Summary ===\n")
+			d.logf("Total files found: %d\n", len(files))
+			d.logf("Files already in R2: %d\n", skippedCount)
+			d.logf("Files to process: %d\n", len(pendingFiles))
+			d.logf("Total size: %s\n", formatSize(totalSize))
+			d.logf("Skipped size: %s\n", formatSize(skippedSize))
+			d.logf("Remaining size: %s\n\n", formatSize(totalSize-skippedSize))
 		}
 
-		// Queue only files that need processing
+		// Queue only files that need processing, stopping as soon as shutdown is
+		// requested or, without ContinueOnError, a file has failed
 		for _, file := range pendingFiles {
-			if !silentMode {
-				fmt.Printf("Queueing: %s (%s)\n", file.Path, formatSize(int64(file.Size)))
+			if dispatchCtx.Err() != nil {
+				interrupted = ctx.Err() != nil
+				return
+			}
+			if !opts.SilentMode {
+				d.debugf("Queueing: %s (%s)\n", file.Path, formatSize(int64(file.Size)))
+			}
+			select {
+			case jobs <- file:
+			case <-dispatchCtx.Done():
+				interrupted = ctx.Err() != nil
+				return
 			}
-			jobs <- file
 		}
 	}
 
@@ -642,129 +1168,354 @@ func DownloadModel(ModelDatasetName string, AppendFilterToPath bool, SkipSHA boo
 				if currentCompleted == lastCompleted && lastCompleted > 0 {
 					staleCount++
 					// Longer stale detection for large files (10 minutes = 5 checks)
-					fmt.Printf("⚠️ Warning: No progress detected for %d minutes\n", staleCount*2)
+					d.logf("⚠️ Warning: No progress detected for %d minutes\n", staleCount*2)
 
 					if staleCount >= 15 { // No progress for 30 minutes
-						fmt.Println("🔄 Progress appears to be stalled for too long!")
+						d.logln("🔄 Progress appears to be stalled for too long!")
 						// We'll log this but not force cancel as it could be a very large file
 						staleCount = 0 // Reset to avoid multiple warnings
 					}
 				} else {
-					if lastCompleted > 0 {
-						fmt.Printf("📊 Progress update: %d files completed (+%d new)\n",
+					if lastCompleted > 0 && limiter != nil {
+						d.logf("📊 Progress update: %d files completed (+%d new), %d active workers\n",
+							currentCompleted, currentCompleted-lastCompleted, limiter.current())
+					} else if lastCompleted > 0 {
+						d.logf("📊 Progress update: %d files completed (+%d new)\n",
 							currentCompleted, currentCompleted-lastCompleted)
 					}
 					staleCount = 0
 					lastCompleted = currentCompleted
 				}
 			case <-stopWatchdog:
-				fmt.Println("🔍 Watchdog stopped - download completed or canceled")
+				d.logln("🔍 Watchdog stopped - download completed or canceled")
 				return
 			}
 		}
 	}()
 
-	// Start processing
-	err = processHFFolderTree(modelPath, IsDataset, SkipSHA, ModelDatasetName, ModelBranch, "", silentMode, r2cfg, skipLocal, processFiles, hfPrefix)
-	if err != nil {
-		close(stopWatchdog)
-		return fmt.Errorf("error processing file tree: %v", err)
+	if limiter != nil {
+		go limiter.run(stopWatchdog)
 	}
 
+	// Enumerate everything first so selection sees every file before anything is
+	// queued, unless an interrupted run with the same selection saved its list
+	var enumerated []hfmodel
+	reused := len(downloadState.Files) > 0
+	if reused {
+		enumerated = downloadState.models(opts)
+		d.logf("📋 Reusing the file list saved in %s (%d files), use --reset-state to enumerate again\n", stateFile, len(enumerated))
+	} else {
+		if enumerated, err = d.enumerateFiles(opts); err != nil {
+			close(stopWatchdog)
+			return nil, err
+		}
+		if err := d.selectFiles(enumerated, opts); err != nil {
+			close(stopWatchdog)
+			return nil, err
+		}
+		downloadState.setFiles(enumerated)
+		result.listed = enumerated
+	}
+	if opts.MaxTotalSize > 0 {
+		result.Budget = budgetUsage(enumerated, !reused)
+	}
+	if opts.HubCache != "" {
+		if err := d.linkCachedBlobs(enumerated, opts); err != nil {
+			close(stopWatchdog)
+			return nil, err
+		}
+	}
+
+	// Start processing
+	processFiles(enumerated)
+
 	// Stop watchdog
 	close(stopWatchdog)
 
 	// Close jobs and wait
 	close(jobs)
+	limiter.close()
 	wg.Wait()
-	close(results)
+	verify.close()
+	if !opts.SilentMode {
+		for _, line := range mirrors.summary() {
+			d.logf("Mirror %s\n", line)
+		}
+	}
+	if ctx.Err() == nil {
+		d.verifyKeptFiles(quickChecked, modelPath, manifest, opts, fail)
+	}
+	if len(duplicates) > 0 {
+		failed := make(map[string]bool)
+		for _, f := range result.Failed {
+			failed[f.Path] = true
+		}
+		d.linkDuplicates(duplicates, modelPath, opts, manifest, failed, fail)
+	}
+	if len(symlinks) > 0 && ctx.Err() == nil {
+		d.linkSymlinks(transferCtx, symlinks, modelPath, opts, fail)
+	}
+	saveManifest()
 
-	// Check for errors
-	var errors []error
-	for err := range results {
-		errors = append(errors, err)
+	// A deadline can pass after the last file was queued, aborting files in flight
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if timedOut {
+		interrupted = true
 	}
 
-	if len(errors) > 0 {
+	if interrupted {
+		if err := saveDownloadState(downloadState, stateFile); err != nil {
+			d.logf("Warning: Failed to save download state: %v\n", err)
+		}
+		if timedOut {
+			return result, fmt.Errorf("%w: %w", ErrTimeout, ErrInterrupted)
+		}
+		if len(result.Failed) > 0 {
+			return result, fmt.Errorf("%w: %w: %d file(s), first: %w", ErrInterrupted, ErrFilesFailed, len(result.Failed), result.Failed[0])
+		}
+		return result, ErrInterrupted
+	}
+
+	if len(result.Failed) > 0 {
 		// Save state before returning error
-		if err := saveDownloadState(downloadState, ModelDatasetName); err != nil {
-			fmt.Printf("Warning: Failed to save download state: %v\n", err)
+		if err := saveDownloadState(downloadState, stateFile); err != nil {
+			d.logf("Warning: Failed to save download state: %v\n", err)
 		}
-		return fmt.Errorf("encountered errors: %v", errors)
+		return result, fmt.Errorf("%w: %d file(s), first: %w", ErrFilesFailed, len(result.Failed), result.Failed[0])
 	}
 
-	// Save final state
-	fmt.Println("💾 Saving final download state")
-	if err := saveDownloadState(downloadState, ModelDatasetName); err != nil {
-		fmt.Printf("Warning: Failed to save final download state: %v\n", err)
+	// The job is done, so the next run should look at the repo afresh
+	if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+		d.logf("Warning: Failed to remove download state: %v\n", err)
 	}
 
-	return nil
+	if opts.Attestation != "" {
+		w, where, err := openProvenance(opts.Attestation)
+		if err != nil {
+			return result, fmt.Errorf("failed to create attestation: %v", err)
+		}
+		err = writeAttestation(w, enumerated, opts, revision, commit)
+		if closeErr := w.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write attestation to %s: %v", where, closeErr)
+		}
+		if err != nil {
+			return result, err
+		}
+		d.logf("📝 Wrote attestation to %s\n", where)
+	}
+	if opts.HubCache != "" {
+		if err := finishHubSnapshot(enumerated, opts, revision, commit); err != nil {
+			return result, err
+		}
+		d.logf("📦 Stored %s in the hub cache at %s\n", opts.Repo, repoDir(opts))
+	}
+	if opts.ChecksumFile != "" && !opts.SkipLocal {
+		modelPath := repoDir(opts)
+		if err := writeChecksums(enumerated, opts, modelPath); err != nil {
+			return result, err
+		}
+		d.logf("Wrote checksums to %s\n", opts.ChecksumFile)
+	}
+	if opts.GitLayout && !opts.SkipLocal {
+		modelPath := repoDir(opts)
+		if err := writeGitLayout(modelPath, opts, revision, commit); err != nil {
+			return result, fmt.Errorf("failed to write git layout: %v", err)
+		}
+		d.logf("Wrote git metadata for commit %s; run \"git fetch --depth 1 origin %s && git reset %s\" in %s to use it with git\n", commit, commit, commit, modelPath)
+	}
+
+	return result, nil
 }
 
-func processHFFolderTree(modelPath string, IsDataset bool, SkipSHA bool, ModelDatasetName string, ModelBranch string, folderName string, silentMode bool, r2cfg *R2Config, skipLocal bool, processFiles func([]hfmodel), hfPrefix string) error {
-	if !silentMode {
-		fmt.Printf("🔍 Scanning: %s\n", folderName)
+// workerCount picks the number of download workers: DatasetWorkers for datasets
+// when set, MaxWorkers otherwise, and AutoWorkers if neither is set.
+func workerCount(opts DownloadOptions) int {
+	if opts.repoType() == RepoDataset && opts.DatasetWorkers > 0 {
+		return opts.DatasetWorkers
+	}
+	if opts.MaxWorkers > 0 {
+		return opts.MaxWorkers
+	}
+	return AutoWorkers()
+}
+
+// Bounds of AutoWorkers.
+const (
+	autoWorkersPerCPU = 4
+	minAutoWorkers    = 4
+	maxAutoWorkers    = 64
+)
+
+// DefaultMetadataWorkers is how many folders are listed at once when walking
+// the repo tree, unless DownloadOptions.MetadataWorkers says otherwise.
+const DefaultMetadataWorkers = 8
+
+// metadataWorkers is the number of concurrent tree listing requests:
+// opts.MetadataWorkers, or DefaultMetadataWorkers.
+func metadataWorkers(opts DownloadOptions) int {
+	if opts.MetadataWorkers > 0 {
+		return opts.MetadataWorkers
+	}
+	return DefaultMetadataWorkers
+}
+
+// numCPU is runtime.NumCPU, swappable to check AutoWorkers on other machines.
+var numCPU = runtime.NumCPU
+
+// AutoWorkers is the default worker count for this machine. Downloads mostly
+// wait on the network, so it allows 4 per CPU, between 4 and 64.
+func AutoWorkers() int {
+	workers := numCPU() * autoWorkersPerCPU
+	if workers < minAutoWorkers {
+		return minAutoWorkers
+	}
+	if workers > maxAutoWorkers {
+		return maxAutoWorkers
+	}
+	return workers
+}
+
+// enumerateFiles lists the repo files to consider. When every include is an exact
+// path they are looked up in one paths-info call; otherwise the tree is walked.
+func (d *Downloader) enumerateFiles(opts DownloadOptions) ([]hfmodel, error) {
+	if paths := literalIncludes(opts.Include); paths != nil && opts.HFPrefix == "" {
+		files, err := d.fetchPathsInfo(opts, paths)
+		if err == nil && len(files) == len(paths) {
+			if !opts.SilentMode {
+				d.logf("📡 Resolved %d explicit paths with paths-info\n", len(files))
+			}
+			return files, nil
+		}
+		// Missing paths, folders, or an endpoint that doesn't support it: walk the tree instead
+		if err != nil {
+			d.logf("Warning: paths-info lookup failed, walking the full tree: %v\n", err)
+		}
+	}
+
+	enumerated, err := d.processHFFolderTree(opts, "", make(chan struct{}, metadataWorkers(opts)))
+	if err != nil {
+		return nil, fmt.Errorf("error processing file tree: %w", err)
+	}
+	return enumerated, nil
+}
+
+// downloadLink returns the resolve URL for a repo file. resolve serves both
+// regular and LFS files, following LFS pointers to the real blob. download=true
+// asks for the CDN URL directly and a proper Content-Disposition filename.
+func downloadLink(opts DownloadOptions, filePath string) string {
+	resolverURL := opts.repoType().pickURL(LfsModelResolverURL, LfsDatasetResolverURL, LfsSpaceResolverURL)
+	link := fmt.Sprintf(resolverURL, opts.Repo, opts.Branch, filePath)
+	if !opts.NoDownloadParam {
+		link += "?download=true"
+	}
+	return link
+}
+
+// processHFFolderTree lists folderName and everything below it. Subfolders are
+// listed concurrently, with at most cap(sem) tree requests in flight, and the
+// results are assembled in the order a serial walk would produce: each
+// subfolder's files in turn, then the folder's own.
+// If any subfolder fails to list, the whole walk fails with ErrIncompleteListing.
+func (d *Downloader) processHFFolderTree(opts DownloadOptions, folderName string, sem chan struct{}) ([]hfmodel, error) {
+	if !opts.SilentMode {
+		d.debugf("🔍 Scanning: %s\n", folderName)
 	}
 
 	// Build the correct API URL
+	treeURL := opts.repoType().pickURL(JsonModelsFileTreeURL, JsonDatasetFileTreeURL, JsonSpaceFileTreeURL)
 	var url string
-	if IsDataset {
-		if folderName == "" {
-			url = fmt.Sprintf(JsonDatasetFileTreeURL, ModelDatasetName, ModelBranch, hfPrefix)
-		} else {
-			url = fmt.Sprintf(JsonDatasetFileTreeURL, ModelDatasetName, ModelBranch, folderName)
-		}
+	if folderName == "" {
+		url = fmt.Sprintf(treeURL, opts.Repo, opts.Branch, prefixRoot(opts.HFPrefix))
+	} else {
+		url = fmt.Sprintf(treeURL, opts.Repo, opts.Branch, folderName)
+	}
+	if !opts.Since.IsZero() || opts.TouchTimestamps {
+		// expand adds each entry's last commit, which --since filters on
+		url += "?expand=true"
 	}
 
-	if !silentMode {
-		fmt.Printf("📡 API URL: %s\n", url)
+	if !opts.SilentMode {
+		d.debugf("📡 API URL: %s\n", url)
 	}
 
 	// Make request and get files
-	files, err := fetchFileList(url)
+	sem <- struct{}{}
+	files, err := d.fetchFileList(url, opts.Token)
+	<-sem
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !silentMode {
-		fmt.Printf("📂 Found %d items in %s\n", len(files), folderName)
+	if !opts.SilentMode {
+		d.debugf("📂 Found %d items in %s\n", len(files), folderName)
 	}
 
-	var parquetFiles []hfmodel
+	var repoFiles []hfmodel
+	var subfolders []string
 	for _, file := range files {
-		if strings.HasSuffix(file.Path, ".parquet") && file.Size > 0 {
-			if file.IsLFS {
-				file.DownloadLink = fmt.Sprintf(LfsDatasetResolverURL, ModelDatasetName, ModelBranch, file.Path)
-			} else {
-				file.DownloadLink = fmt.Sprintf(RawDatasetFileURL, ModelDatasetName, ModelBranch, file.Path)
+		if file.Type != "directory" {
+			if file.Size > 0 && underPrefix(opts.HFPrefix, file.Path) {
+				file.DownloadLink = downloadLink(opts, file.Path)
+				repoFiles = append(repoFiles, file)
 			}
-			parquetFiles = append(parquetFiles, file)
 		} else {
-			if !silentMode {
-				fmt.Printf("📁 Entering directory: %s\n", file.Path)
+			if isGlob(opts.HFPrefix) && !mayContainPrefix(opts.HFPrefix, file.Path) {
+				continue
 			}
-
-			err := processHFFolderTree(modelPath, IsDataset, SkipSHA, ModelDatasetName, ModelBranch, file.Path, silentMode, r2cfg, skipLocal, processFiles, hfPrefix)
-			if err != nil {
-				fmt.Printf("⚠️ Error processing subdirectory %s: %v\n", file.Path, err)
+			if !mayContainDirs(opts.Dirs, file.Path) {
 				continue
 			}
+			if !opts.SilentMode {
+				d.logf("📁 Entering directory: %s\n", file.Path)
+			}
+			subfolders = append(subfolders, file.Path)
 		}
 	}
 
-	if len(parquetFiles) > 0 {
-		if !silentMode {
-			fmt.Printf("📦 Processing %d parquet files from %s\n", len(parquetFiles), folderName)
+	listed := make([][]hfmodel, len(subfolders))
+	errs := make([]error, len(subfolders))
+	var wg sync.WaitGroup
+	for i, subfolder := range subfolders {
+		wg.Add(1)
+		go func(i int, subfolder string) {
+			defer wg.Done()
+			sub, err := d.processHFFolderTree(opts, subfolder, sem)
+			if err != nil {
+				d.logf("⚠️ Error processing subdirectory %s: %v\n", subfolder, err)
+				errs[i] = err
+				return
+			}
+			listed[i] = sub
+		}(i, subfolder)
+	}
+	wg.Wait()
+
+	// A folder that couldn't be listed hides its files, so the listing can't be
+	// trusted to say what the repo has
+	for i, err := range errs {
+		if errors.Is(err, ErrIncompleteListing) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrIncompleteListing, subfolders[i], err)
 		}
-		processFiles(parquetFiles)
 	}
 
-	return nil
+	var all []hfmodel
+	for _, sub := range listed {
+		all = append(all, sub...)
+	}
+	if len(repoFiles) > 0 {
+		if !opts.SilentMode {
+			d.debugf("📦 Processing %d files from %s\n", len(repoFiles), folderName)
+		}
+		all = append(all, repoFiles...)
+	}
+	return all, nil
 }
 
 // Helper function to fetch and parse file list
-func fetchFileList(url string) ([]hfmodel, error) {
+func (d *Downloader) fetchFileList(url string, token string) ([]hfmodel, error) {
 	// Create a context with timeout for the API request (2 minutes should be plenty)
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
@@ -774,26 +1525,24 @@ func fetchFileList(url string) ([]hfmodel, error) {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	if RequiresAuth {
-		req.Header.Add("Authorization", "Bearer "+AuthToken)
-	}
-	req.Header.Add("User-Agent", "Mozilla/5.0")
+	setAuth(req, token)
+	req.Header.Set("User-Agent", UserAgent)
 
 	var resp *http.Response
 	var files []hfmodel
 
 	// Use retry with backoff for API requests
-	fetchErr := retryWithBackoff(func() error {
+	fetchErr := d.retryWithBackoff(func() error {
 		var err error
-		resp, err = httpClient.Do(req)
+		resp, err = d.client().Do(req)
 		if err != nil {
-			return fmt.Errorf("request failed: %v", err)
+			return networkError(err)
 		}
 
 		if resp.StatusCode != http.StatusOK {
 			bodyBytes, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
-			return fmt.Errorf("bad status: %d, body: %s", resp.StatusCode, string(bodyBytes))
+			return &hubStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
 		}
 
 		// Decode response
@@ -808,7 +1557,7 @@ func fetchFileList(url string) ([]hfmodel, error) {
 	}, 5, 1*time.Second, 10*time.Second)
 
 	if fetchErr != nil {
-		return nil, fmt.Errorf("failed to fetch file list after retries: %v", fetchErr)
+		return nil, fmt.Errorf("failed to fetch file list after retries: %w", fetchErr)
 	}
 
 	return files, nil
@@ -828,6 +1577,11 @@ func formatSize(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
+// FormatSize renders a byte count the way the downloader reports sizes, e.g. "1.5 GB".
+func FormatSize(bytes int64) string {
+	return formatSize(bytes)
+}
+
 // ***********************************************   All the functions below generated by ChatGPT 3.5, and ChatGPT 4 , with some modifications ***********************************************
 func IsValidModelName(modelName string) bool {
 	pattern := `^[A-Za-z0-9_\-]+/[A-Za-z0-9\._\-]+$`
@@ -836,7 +1590,7 @@ func IsValidModelName(modelName string) bool {
 }
 
 // Add parallel chunk downloading
-func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader, key string, contentLength int64, progress *uploadProgress) error {
+func (d *Downloader) streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader, key string, contentLength int64, progress *uploadProgress) error {
 	client := createR2Client(ctx, r2cfg)
 
 	// Check for existing multipart uploads that we might resume
@@ -851,7 +1605,7 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 			if *upload.Key == key {
 				// Found an existing upload for this exact key - let's try to resume it
 				uploadID = *upload.UploadId
-				fmt.Printf("Found existing multipart upload for %s (ID: %s) - attempting to resume\n", key, uploadID)
+				d.logf("Found existing multipart upload for %s (ID: %s) - attempting to resume\n", key, uploadID)
 
 				// Get existing parts to potentially resume from
 				listPartsResp, listErr := client.ListParts(ctx, &s3.ListPartsInput{
@@ -861,7 +1615,7 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 				})
 
 				if listErr == nil && len(listPartsResp.Parts) > 0 {
-					fmt.Printf("Found %d previously uploaded parts for %s\n", len(listPartsResp.Parts), key)
+					d.logf("Found %d previously uploaded parts for %s\n", len(listPartsResp.Parts), key)
 					// TODO: In a more complex implementation, we could resume from these parts
 					// Currently, we'll just abort and start fresh to ensure consistency
 				}
@@ -879,7 +1633,7 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 					UploadId: upload.UploadId,
 				})
 				if abortErr != nil {
-					fmt.Printf("Warning: Failed to abort incomplete upload for %s: %v\n", *upload.Key, abortErr)
+					d.logf("Warning: Failed to abort incomplete upload for %s: %v\n", *upload.Key, abortErr)
 				}
 			}
 		}
@@ -895,7 +1649,7 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 			return fmt.Errorf("failed to create multipart upload: %v", err)
 		}
 		uploadID = *resp.UploadId
-		fmt.Printf("Created new multipart upload for %s (ID: %s)\n", key, uploadID)
+		d.logf("Created new multipart upload for %s (ID: %s)\n", key, uploadID)
 	}
 
 	// Calculate optimal part size (minimum 5MB, maximum 5GB)
@@ -906,6 +1660,15 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 	if partSize > 5*1024*1024*1024 {
 		partSize = 5 * 1024 * 1024 * 1024 // 5GB maximum
 	}
+	partsInFlight := maxInFlightParts
+	if d.lowMemory {
+		// Many small parts instead of a few large ones, within S3's 10,000 part limit
+		partSize = LowMemoryPartSize
+		if minPart := (contentLength + 9999) / 10000; partSize < minPart {
+			partSize = minPart
+		}
+		partsInFlight = LowMemoryPartsInFlight
+	}
 
 	// Create parts channel and results
 	type partResult struct {
@@ -913,7 +1676,8 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 		Err  error
 	}
 	parts := make([]types.CompletedPart, 0)
-	results := make(chan partResult, maxPartsPerFile)
+	results := make(chan partResult, int((contentLength+partSize-1)/partSize))
+	inFlight := make(chan struct{}, partsInFlight)
 	var wg sync.WaitGroup
 
 	// Read and upload parts
@@ -926,6 +1690,9 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 			size = remainingBytes
 		}
 
+		// Wait for a free slot so at most partsInFlight buffers are held in memory
+		inFlight <- struct{}{}
+
 		buffer := make([]byte, size)
 		n, err := io.ReadFull(reader, buffer)
 		if err != nil && err != io.ErrUnexpectedEOF {
@@ -936,7 +1703,7 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 				UploadId: aws.String(uploadID),
 			})
 			if abortErr != nil {
-				fmt.Printf("Warning: Failed to abort upload after error: %v\n", abortErr)
+				d.logf("Warning: Failed to abort upload after error: %v\n", abortErr)
 			}
 			return fmt.Errorf("failed to read part %d: %v", partNum, err)
 		}
@@ -944,6 +1711,7 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 		wg.Add(1)
 		go func(num int32, buf []byte) {
 			defer wg.Done()
+			defer func() { <-inFlight }()
 
 			// Upload part
 			partResp, err := client.UploadPart(ctx, &s3.UploadPartInput{
@@ -999,7 +1767,7 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 			UploadId: aws.String(uploadID),
 		})
 		if abortErr != nil {
-			fmt.Printf("Warning: Failed to abort upload after error: %v\n", abortErr)
+			d.logf("Warning: Failed to abort upload after error: %v\n", abortErr)
 		}
 		return uploadErr
 	}
@@ -1023,6 +1791,9 @@ func streamMultipartToR2(ctx context.Context, r2cfg R2Config, reader io.Reader,
 // Optimize S3 client configuration
 func createR2Client(ctx context.Context, r2cfg R2Config) *s3.Client {
 	r2Resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		if r2cfg.Endpoint != "" {
+			return aws.Endpoint{URL: r2cfg.Endpoint, HostnameImmutable: true}, nil
+		}
 		return aws.Endpoint{
 			URL: fmt.Sprintf("https://%s.r2.cloudflarestorage.com", r2cfg.AccountID),
 		}, nil
@@ -1046,10 +1817,11 @@ func createR2Client(ctx context.Context, r2cfg R2Config) *s3.Client {
 				MaxConnsPerHost:     256,
 				WriteBufferSize:     64 * 1024,
 				ReadBufferSize:      64 * 1024,
-				DialContext: (&net.Dialer{
+				TLSClientConfig:     tlsConfig.Clone(),
+				DialContext: restrictDial((&net.Dialer{
 					Timeout:   10 * time.Second,
 					KeepAlive: 30 * time.Second,
-				}).DialContext,
+				}).DialContext),
 			},
 			Timeout: 30 * time.Minute,
 		}),
@@ -1062,39 +1834,26 @@ func createR2Client(ctx context.Context, r2cfg R2Config) *s3.Client {
 	return s3.NewFromConfig(cfg)
 }
 
-// Helper function for simple uploads
-func streamSimpleToR2(ctx context.Context, r2cfg R2Config, reader io.Reader, key string, contentLength int64, progress *uploadProgress) error {
-	// For parquet files, verify before upload
-	if strings.HasSuffix(key, ".parquet") {
-		// Create a temp file for verification
-		tmpFile, err := os.CreateTemp("", "parquet-verify-*")
-		if err != nil {
-			return fmt.Errorf("failed to create temp file: %v", err)
-		}
-		defer os.Remove(tmpFile.Name())
-		defer tmpFile.Close()
-
-		// Copy data to temp file
-		if _, err := io.Copy(tmpFile, reader); err != nil {
-			return fmt.Errorf("failed to copy to temp file: %v", err)
-		}
-
-		// Verify parquet format
-		if err := verifyLocalParquet(tmpFile.Name()); err != nil {
-			return fmt.Errorf("invalid parquet file: %v", err)
-		}
-
-		// Reset file for upload
-		if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
-			return fmt.Errorf("failed to reset file: %v", err)
-		}
-
-		// Use temp file as reader
-		reader = tmpFile
+// putR2Object uploads a small object in one request, without a progress bar.
+func putR2Object(ctx context.Context, r2cfg R2Config, key string, body io.Reader, size int64) error {
+	_, err := createR2Client(ctx, r2cfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(r2cfg.BucketName),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: &size,
+	})
+	if err != nil {
+		return fmt.Errorf("upload failed: %v", err)
 	}
+	return nil
+}
 
+// Helper function for simple uploads
+func (d *Downloader) streamSimpleToR2(ctx context.Context, r2cfg R2Config, reader io.Reader, key string, contentLength int64, progress *uploadProgress) error {
+	// Parquet files staged locally are verified before they get here; streamed ones
+	// are checked after upload below, so nothing is written to a temp file.
 	if progress == nil {
-		progress = createProgressBar(contentLength, filepath.Base(key))
+		progress = d.createProgressBar(contentLength, filepath.Base(key))
 	}
 
 	client := createR2Client(ctx, r2cfg)
@@ -1121,7 +1880,7 @@ func streamSimpleToR2(ctx context.Context, r2cfg R2Config, reader io.Reader, key
 				Key:    aws.String(key),
 			})
 			if delErr != nil {
-				fmt.Printf("Warning: Failed to delete invalid upload: %v\n", delErr)
+				d.logf("Warning: Failed to delete invalid upload: %v\n", delErr)
 			}
 			return fmt.Errorf("post-upload verification failed: %v", err)
 		}
@@ -1130,6 +1889,221 @@ func streamSimpleToR2(ctx context.Context, r2cfg R2Config, reader io.Reader, key
 	return nil
 }
 
+// transferFile delivers a downloaded body to its destinations. With skipLocal set
+// and R2 configured the body is piped straight into the upload and never touches
+// disk; otherwise it is staged under localPath first and uploaded from there.
+// Bytes handed to the upload are added to uploaded.
+func (d *Downloader) transferFile(ctx context.Context, body io.Reader, file hfmodel, localPath string, r2cfg *R2Config, r2Key string, skipLocal bool, skipSHA bool, uploaded *atomic.Int64) error {
+	if skipLocal && r2cfg != nil {
+		return d.streamToR2(ctx, body, file, r2cfg, r2Key, skipSHA, uploaded)
+	}
+
+	if err := d.downloadToLocal(body, file, localPath, skipSHA); err != nil {
+		return err
+	}
+	if r2cfg == nil {
+		return nil
+	}
+	return d.uploadLocalToR2(ctx, localPath, r2cfg, r2Key, int64(file.Size), uploaded)
+}
+
+// streamToR2 pipes the download into an R2 upload, hashing the bytes as they pass
+// through so the LFS checksum can be checked without a second read.
+func (d *Downloader) streamToR2(ctx context.Context, body io.Reader, file hfmodel, r2cfg *R2Config, r2Key string, skipSHA bool, uploaded *atomic.Int64) error {
+	size := int64(file.Size)
+	hash := newContentHash(file)
+	pr, pw := io.Pipe()
+	upload := newCountingReader(pr, uploaded)
+
+	copyDone := make(chan struct{})
+	go func() {
+		defer close(copyDone)
+		_, err := d.copy(io.MultiWriter(hash, pw), body)
+		pw.CloseWithError(err)
+	}()
+
+	progress := d.createProgressBar(size, filepath.Base(file.Path))
+	var err error
+	if size > multipartThreshold {
+		err = d.streamMultipartToR2(ctx, *r2cfg, upload, r2Key, size, progress)
+	} else {
+		err = d.streamSimpleToR2(ctx, *r2cfg, upload, r2Key, size, progress)
+	}
+	// Unblock the copier if the upload bailed out early, then wait for the hash to settle
+	pr.Close()
+	<-copyDone
+	if err != nil {
+		return err
+	}
+
+	if !skipSHA {
+		if err := checkContentHash(file, hash); err != nil {
+			client := createR2Client(ctx, *r2cfg)
+			if _, delErr := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(r2cfg.BucketName),
+				Key:    aws.String(r2Key),
+			}); delErr != nil {
+				d.logf("Warning: Failed to delete mismatched upload %s: %v\n", r2Key, delErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// teeToR2 writes the download to localPath and uploads it to R2 in the same
+// pass, so neither waits for the other and the bytes are read and hashed once.
+// As with downloadToLocal the local copy goes through a .part file; on a
+// checksum mismatch both copies are removed.
+func (d *Downloader) teeToR2(ctx context.Context, body io.Reader, file hfmodel, localPath string, r2cfg *R2Config, r2Key string, skipSHA bool, uploaded *atomic.Int64) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", localPath, err)
+	}
+	partPath := localPath + ".part"
+	out, release, err := d.createFile(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", partPath, err)
+	}
+
+	size := int64(file.Size)
+	hash := newContentHash(file)
+	pr, pw := io.Pipe()
+	upload := newCountingReader(pr, uploaded)
+
+	var writeErr error
+	copyDone := make(chan struct{})
+	go func() {
+		defer close(copyDone)
+		_, err := d.copy(io.MultiWriter(out, hash, pw), body)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		writeErr = err
+		pw.CloseWithError(err)
+	}()
+
+	progress := d.createProgressBar(size, filepath.Base(file.Path))
+	if size > multipartThreshold {
+		err = d.streamMultipartToR2(ctx, *r2cfg, upload, r2Key, size, progress)
+	} else {
+		err = d.streamSimpleToR2(ctx, *r2cfg, upload, r2Key, size, progress)
+	}
+	pr.Close()
+	<-copyDone
+	release()
+	if err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to tee %s: %w", file.Path, diskError(err))
+	}
+
+	if !skipSHA {
+		if err := checkContentHash(file, hash); err != nil {
+			os.Remove(partPath)
+			client := createR2Client(ctx, *r2cfg)
+			if _, delErr := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(r2cfg.BucketName),
+				Key:    aws.String(r2Key),
+			}); delErr != nil {
+				d.logf("Warning: Failed to delete mismatched upload %s: %v\n", r2Key, delErr)
+			}
+			return err
+		}
+	}
+
+	if err := os.Rename(partPath, localPath); err != nil {
+		return fmt.Errorf("failed to finalize %s: %v", localPath, err)
+	}
+	return nil
+}
+
+// Git LFS pointer files are small text files starting with this line.
+const (
+	lfsPointerPrefix  = "version https://git-lfs.github.com/spec/"
+	maxLFSPointerSize = 1024
+)
+
+// isLFSPointer reports whether a file's first bytes are those of an LFS pointer.
+func isLFSPointer(head []byte) bool {
+	return bytes.HasPrefix(head, []byte(lfsPointerPrefix))
+}
+
+// downloadToLocal writes the body to localPath through a .part file, so an
+// interrupted download never leaves a truncated file under its final name. The
+// SHA256 is computed as the bytes are written, so verification needs no second
+// read of the file.
+func (d *Downloader) downloadToLocal(body io.Reader, file hfmodel, localPath string, skipSHA bool) error {
+	hash := newContentHash(file)
+	partPath, err := d.downloadToPart(body, file, localPath, hash)
+	if err != nil {
+		return err
+	}
+
+	if !skipSHA {
+		if err := checkContentHash(file, hash); err != nil {
+			os.Remove(partPath)
+			return err
+		}
+	}
+
+	if err := os.Rename(partPath, localPath); err != nil {
+		return fmt.Errorf("failed to finalize %s: %v", localPath, err)
+	}
+	return nil
+}
+
+// downloadToPart writes the body to localPath's .part file, and to hash when
+// it isn't nil, returning the part's path.
+func (d *Downloader) downloadToPart(body io.Reader, file hfmodel, localPath string, hash io.Writer) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory for %s: %v", localPath, err)
+	}
+
+	partPath := localPath + ".part"
+	out, release, err := d.createFile(partPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", partPath, err)
+	}
+
+	var w io.Writer = out
+	if hash != nil {
+		w = io.MultiWriter(out, hash)
+	}
+	progress := d.createProgressBar(int64(file.Size), filepath.Base(file.Path))
+	_, err = d.copy(w, newProgressReader(body, progress))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	release()
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", partPath, diskError(err))
+	}
+	return partPath, nil
+}
+
+// uploadLocalToR2 uploads a staged local file, checking parquet framing before
+// anything is sent.
+func (d *Downloader) uploadLocalToR2(ctx context.Context, localPath string, r2cfg *R2Config, r2Key string, size int64, uploaded *atomic.Int64) error {
+	if strings.HasSuffix(localPath, ".parquet") {
+		if err := verifyLocalParquet(localPath); err != nil {
+			return fmt.Errorf("invalid parquet file: %v", err)
+		}
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", localPath, err)
+	}
+	defer f.Close()
+
+	progress := d.createProgressBar(size, filepath.Base(r2Key))
+	if size > multipartThreshold {
+		return d.streamMultipartToR2(ctx, *r2cfg, newCountingReader(f, uploaded), r2Key, size, progress)
+	}
+	return d.streamSimpleToR2(ctx, *r2cfg, newCountingReader(f, uploaded), r2Key, size, progress)
+}
+
 func verifyParquetFile(ctx context.Context, r2cfg *R2Config, key string, expectedSize int64) error {
 	client := createR2Client(ctx, *r2cfg)
 
@@ -1214,113 +2188,35 @@ func verifyLocalParquet(filePath string) error {
 	return nil
 }
 
-func CleanupCorruptedFiles(ctx context.Context, r2cfg *R2Config, prefix string, concurrency int) error {
-	client := createR2Client(ctx, *r2cfg)
-	var wg sync.WaitGroup
-	jobs := make(chan *types.Object, concurrency*2) // buffered channel for efficiency
-	var totalFiles, corruptedFiles int32
-
-	// Worker function to process verification for each parquet file.
-	worker := func(workerID int) {
-		defer wg.Done()
-		for obj := range jobs {
-			if !strings.HasSuffix(*obj.Key, ".parquet") || *obj.Size < 8 {
-				continue
-			}
-
-			fmt.Printf("[Worker %d] Checking file: %s (size: %s)\n", workerID, *obj.Key, formatSize(*obj.Size))
-			err := verifyParquetFile(ctx, r2cfg, *obj.Key, *obj.Size)
-			// If header/footer check passed, then perform full checksum validation if metadata is available
-			if err == nil {
-				// Retrieve object's metadata to get expected checksum
-				head, headErr := client.HeadObject(ctx, &s3.HeadObjectInput{
-					Bucket: aws.String(r2cfg.BucketName),
-					Key:    obj.Key,
-				})
-				if headErr == nil {
-					if expected, ok := head.Metadata["sha256"]; ok && expected != "" {
-						fmt.Printf("[Worker %d] Verifying checksum for: %s (expected: %s)\n", workerID, *obj.Key, expected)
-						err = verifyRemoteFileChecksum(ctx, r2cfg, *obj.Key, expected)
-					} else {
-						fmt.Printf("[Worker %d] No sha256 metadata for: %s, skipping checksum\n", workerID, *obj.Key)
-					}
-				} else {
-					fmt.Printf("[Worker %d] Failed to retrieve metadata for: %s, skipping checksum (error: %v)\n", workerID, *obj.Key, headErr)
-				}
-			}
-
-			atomic.AddInt32(&totalFiles, 1)
-			if err != nil {
-				atomic.AddInt32(&corruptedFiles, 1)
-				fmt.Printf("[Worker %d] ❌ Corrupted file: %s, error: %v\n", workerID, *obj.Key, err)
-				if strings.Contains(err.Error(), "invalid parquet") {
-					_, delErr := client.DeleteObject(ctx, &s3.DeleteObjectInput{
-						Bucket: aws.String(r2cfg.BucketName),
-						Key:    obj.Key,
-					})
-					if delErr != nil {
-						fmt.Printf("[Worker %d] Warning: Failed to delete file %s: %v\n", workerID, *obj.Key, delErr)
-					} else {
-						fmt.Printf("[Worker %d] Deleted corrupted file: %s\n", workerID, *obj.Key)
-					}
-				}
-			} else {
-				fmt.Printf("[Worker %d] ✅ Valid parquet file: %s\n", workerID, *obj.Key)
-			}
-		}
-	}
-
-	// Spawn the specified number of workers.
-	for i := 0; i < concurrency; i++ {
-		wg.Add(1)
-		go worker(i)
-	}
-
-	// List objects from R2 using the provided prefix.
-	input := &s3.ListObjectsV2Input{
-		Bucket: aws.String(r2cfg.BucketName),
-		Prefix: aws.String(prefix),
-	}
-	paginator := s3.NewListObjectsV2Paginator(client, input)
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
-		if err != nil {
-			close(jobs)
-			wg.Wait()
-			return fmt.Errorf("failed to list objects: %v", err)
-		}
-		fmt.Printf("Retrieved %d objects with prefix %s\n", len(page.Contents), prefix)
-		for _, obj := range page.Contents {
-			// send pointer to a copy to avoid the type error
-			o := obj
-			jobs <- &o
-		}
-	}
-	close(jobs)
-	wg.Wait()
-
-	fmt.Printf("\n=== Summary ===\n")
-	fmt.Printf("Total parquet files checked: %d\n", totalFiles)
-	fmt.Printf("Corrupted files found: %d\n", corruptedFiles)
-	if totalFiles == 0 {
-		fmt.Printf("Warning: No parquet files found! Verify bucket and prefix.\n")
-	}
-	fmt.Printf("Verification complete!\n")
-	return nil
+// DefaultShouldRetry is the default retry policy: network timeouts, dropped
+// connections, 429 and 5xx responses are retried, anything else, such as a 404
+// or 401, is not. The attempt number is ignored.
+func DefaultShouldRetry(err error, attempt int) bool {
+	return isTransientError(err)
 }
 
-// Add this helper function to hfdownloader/hfdownloader.go
-// Helper function to determine if an error is transient and retryable
+// isTransientError reports whether err is likely to go away on its own.
 func isTransientError(err error) bool {
 	if err == nil {
 		return false
 	}
 
 	// Check for network timeouts and temporary failures
-	if netErr, ok := err.(net.Error); ok && (netErr.Timeout() || netErr.Temporary()) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()) {
 		return true
 	}
 
+	// Rate limiting and server-side failures from the Hub
+	var statusErr *hubStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+
 	// Check for HTTP retryable status codes
 	errStr := err.Error()
 	if strings.Contains(errStr, "status 429") || // Too Many Requests
@@ -1345,7 +2241,7 @@ func isTransientError(err error) bool {
 }
 
 // Retry an operation with exponential backoff
-func retryWithBackoff(operation func() error, maxRetries int, initialBackoff, maxBackoff time.Duration) error {
+func (d *Downloader) retryWithBackoff(operation func() error, maxRetries int, initialBackoff, maxBackoff time.Duration) error {
 	var err error
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
@@ -1354,8 +2250,8 @@ func retryWithBackoff(operation func() error, maxRetries int, initialBackoff, ma
 			return nil
 		}
 
-		if !isTransientError(err) {
-			return fmt.Errorf("permanent error (not retrying): %v", err)
+		if !d.shouldRetry(err, attempt+1) {
+			return fmt.Errorf("permanent error (not retrying): %w", err)
 		}
 
 		if attempt == maxRetries-1 {
@@ -1370,12 +2266,12 @@ func retryWithBackoff(operation func() error, maxRetries int, initialBackoff, ma
 		// Add jitter (±20%)
 		jitter := time.Duration(float64(backoff) * (0.8 + 0.4*rand.Float64()))
 
-		fmt.Printf("Retrying operation after %v (attempt %d/%d): %v\n",
+		d.logf("Retrying operation after %v (attempt %d/%d): %v\n",
 			jitter.Round(time.Millisecond), attempt+1, maxRetries, err)
 		time.Sleep(jitter)
 	}
 
-	return fmt.Errorf("operation failed after %d retries: %v", maxRetries, err)
+	return fmt.Errorf("operation failed after %d retries: %w", maxRetries, err)
 }
 
 func verifyRemoteFileChecksum(ctx context.Context, r2cfg *R2Config, key string, expectedChecksum string) error {
@@ -0,0 +1,723 @@
+package hfdownloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotModifiedLeavesFileUntouched(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: `{"a":1}`}})
+	opts := hubOptions(t)
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(opts.Storage, "o", "m", "config.json")
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(local, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	requests := hub.requestsTo("/resolve/")
+	if len(requests) != 2 || requests[1].Header.Get("If-None-Match") != `"`+blobOid(`{"a":1}`)+`"` {
+		t.Fatalf("second run sent no conditional request")
+	}
+	if !strings.Contains(out.String(), "Skipping config.json - not modified since last download") {
+		t.Fatalf("304 not reported:\n%s", out)
+	}
+	info, err := os.Stat(local)
+	if err != nil || !info.ModTime().Equal(old) {
+		t.Fatalf("config.json rewritten on a 304: %v, %v", info.ModTime(), err)
+	}
+}
+
+func TestChangedFileIsFetchedAgain(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: `{"a":1}`}})
+	opts := hubOptions(t)
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	hub.files["config.json"] = hubFile{Content: `{"a":2}`}
+	d, _ = hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(opts.Storage, "o", "m", "config.json")); string(got) != `{"a":2}` {
+		t.Fatalf("config.json = %q after it changed on the Hub", got)
+	}
+}
+
+func TestWorkerCount(t *testing.T) {
+	for _, tc := range []struct {
+		opts DownloadOptions
+		want int
+	}{
+		{DownloadOptions{MaxWorkers: 8}, 8},
+		{DownloadOptions{MaxWorkers: 8, DatasetWorkers: 2}, 8},
+		{DownloadOptions{MaxWorkers: 8, DatasetWorkers: 2, IsDataset: true}, 2},
+		{DownloadOptions{MaxWorkers: 8, DatasetWorkers: 2, RepoType: RepoDataset}, 2},
+		{DownloadOptions{MaxWorkers: 8, IsDataset: true}, 8},
+		{DownloadOptions{DatasetWorkers: 3}, AutoWorkers()},
+	} {
+		if got := workerCount(tc.opts); got != tc.want {
+			t.Errorf("workerCount(%+v) = %d, want %d", tc.opts, got, tc.want)
+		}
+	}
+}
+
+func TestDatasetWorkers(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"data/train-00000.parquet": {Content: "PAR1 rows PAR1", LFS: true}})
+	opts := hubOptions(t)
+	opts.IsDataset = true
+	opts.MaxWorkers = 8
+	opts.DatasetWorkers = 3
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if !strings.Contains(out.String(), "Using 3 worker goroutines") {
+		t.Fatalf("dataset download did not use --dataset-workers:\n%s", out)
+	}
+	if hub.hits("/datasets/o/m/resolve/") != 1 {
+		t.Fatal("dataset file not fetched through the dataset resolve URL")
+	}
+}
+
+func TestClassicLFSRedirect(t *testing.T) {
+	files := map[string]hubFile{"model.safetensors": {Content: "weights", LFS: true}}
+	hub, cdn := newFakeHub(t, files), newFakeHub(t, files)
+	hub.route("cdn-lfs.hf.co", cdn.Server)
+	hub.redirect = func(r *http.Request) string {
+		return "https://cdn-lfs.hf.co" + r.URL.Path + "?X-Amz-Signature=sig&Expires=1"
+	}
+	opts := hubOptions(t)
+	opts.Token = "hf_secret"
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(opts.Storage, "o", "m", "model.safetensors")); string(got) != "weights" {
+		t.Fatalf("model.safetensors = %q", got)
+	}
+	if r := hub.requestsTo("/resolve/"); len(r) == 0 || r[0].Header.Get("Authorization") != "Bearer hf_secret" {
+		t.Fatalf("resolve request sent without the token")
+	}
+	requests := cdn.requestsTo("/resolve/")
+	if len(requests) == 0 {
+		t.Fatal("CDN never reached")
+	}
+	for _, r := range requests {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Fatalf("presigned CDN request carried Authorization %q", auth)
+		}
+	}
+}
+
+func TestXetRedirectChain(t *testing.T) {
+	files := map[string]hubFile{"model.safetensors": {Content: "0123456789", LFS: true}}
+	hub, bridge, transfer := newFakeHub(t, files), newFakeHub(t, files), newFakeHub(t, files)
+	hub.route("cas-bridge.xethub.hf.co", bridge.Server)
+	hub.route("transfer.xethub.hf.co", transfer.Server)
+	hub.redirect = func(r *http.Request) string {
+		return "https://cas-bridge.xethub.hf.co" + r.URL.Path + "?X-Xet-Signature=sig"
+	}
+	bridge.redirect = func(r *http.Request) string {
+		return "https://transfer.xethub.hf.co" + r.URL.Path + "?X-Amz-Signature=sig"
+	}
+	opts := hubOptions(t)
+	opts.Token = "hf_secret"
+	d, _ := hub.downloader()
+	var got bytes.Buffer
+	if _, err := d.DownloadRange(context.Background(), opts, 2, 5, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "2345" {
+		t.Fatalf("read %q, want %q", got.String(), "2345")
+	}
+	for _, server := range []*fakeHub{bridge, transfer} {
+		requests := server.requestsTo("/resolve/")
+		if len(requests) != 1 {
+			t.Fatalf("%d requests at %s, want 1", len(requests), server.URL)
+		}
+		if auth := requests[0].Header.Get("Authorization"); auth != "" {
+			t.Fatalf("XET hop to %s carried Authorization %q", server.URL, auth)
+		}
+		if rangeHeader := requests[0].Header.Get("Range"); rangeHeader != "bytes=2-5" {
+			t.Fatalf("XET hop to %s had Range %q, want bytes=2-5", server.URL, rangeHeader)
+		}
+	}
+}
+
+func TestCheckRedirectKeepsAuthOnSameHost(t *testing.T) {
+	first, _ := http.NewRequest("GET", "https://huggingface.co/old/m/resolve/main/a.bin", nil)
+	first.Header.Set("Authorization", "Bearer hf_secret")
+	first.Header.Set("Range", "bytes=0-9")
+	next, _ := http.NewRequest("GET", "https://huggingface.co/new/m/resolve/main/a.bin", nil)
+	next.Header.Set("Authorization", "Bearer hf_secret")
+	if err := checkRedirect(next, []*http.Request{first}); err != nil {
+		t.Fatal(err)
+	}
+	if next.Header.Get("Authorization") == "" || next.Header.Get("Range") != "bytes=0-9" {
+		t.Fatalf("renamed-repo redirect lost headers: %v", next.Header)
+	}
+
+	via := make([]*http.Request, 10)
+	for i := range via {
+		via[i] = first
+	}
+	if err := checkRedirect(next, via); err == nil {
+		t.Fatal("followed an 11th redirect")
+	}
+}
+
+func TestUserAgentOnEveryRequest(t *testing.T) {
+	saved := UserAgent
+	UserAgent = "hfdownloader/test (go/test)"
+	t.Cleanup(func() { UserAgent = saved })
+
+	files := map[string]hubFile{"config.json": {Content: "{}"}, "model.safetensors": {Content: "weights", LFS: true}}
+	hub, cdn := newFakeHub(t, files), newFakeHub(t, files)
+	hub.route("cdn-lfs.hf.co", cdn.Server)
+	hub.redirect = func(r *http.Request) string {
+		if strings.HasSuffix(r.URL.Path, ".safetensors") {
+			return "https://cdn-lfs.hf.co" + r.URL.Path + "?X-Amz-Signature=sig"
+		}
+		return ""
+	}
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), hubOptions(t)); err != nil {
+		t.Fatal(err)
+	}
+	requests := append(hub.requestsTo("/"), cdn.requestsTo("/")...)
+	for _, part := range []string{"/api/models/o/m/tree/", "/resolve/main/config.json", "/resolve/main/model.safetensors"} {
+		if hub.hits(part) == 0 {
+			t.Fatalf("no request to %s", part)
+		}
+	}
+	if cdn.hits("/resolve/") == 0 {
+		t.Fatal("CDN never reached")
+	}
+	for _, r := range requests {
+		if ua := r.Header.Get("User-Agent"); ua != UserAgent {
+			t.Fatalf("%s sent User-Agent %q, want %q", r.URL.Path, ua, UserAgent)
+		}
+	}
+}
+
+func TestBranchFallback(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: "{}"}})
+	hub.fail = func(r *http.Request) int {
+		if strings.Contains(r.URL.Path, "/revision/main") || strings.Contains(r.URL.Path, "/tree/main") {
+			return http.StatusNotFound
+		}
+		return 0
+	}
+	opts := hubOptions(t)
+	opts.BranchFallback = []string{"master"}
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if hub.hits("/resolve/master/config.json") != 1 {
+		t.Fatalf("config.json not fetched from master")
+	}
+	if !strings.Contains(out.String(), "Using branch master instead of main") {
+		t.Fatalf("branch used not reported:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(opts.Storage, "o", "m", "config.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A repo whose only branch isn't main is downloaded from that branch
+	hub.fail = func(r *http.Request) int {
+		if strings.Contains(r.URL.Path, "/revision/main") || strings.Contains(r.URL.Path, "/revision/dev") {
+			return http.StatusNotFound
+		}
+		return 0
+	}
+	hub.branches = []string{"trunk"}
+	opts = hubOptions(t)
+	opts.BranchFallback = []string{"dev"}
+	d, _ = hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if hub.hits("/resolve/trunk/config.json") != 1 {
+		t.Fatalf("config.json not fetched from the only branch")
+	}
+
+	// With several branches and none matching the download fails rather than guessing
+	hub.branches = []string{"trunk", "release"}
+	d, _ = hub.downloader()
+	_, err := d.Download(context.Background(), hubOptions(t))
+	if !errors.Is(err, ErrRevisionNotFound) || !strings.Contains(err.Error(), "trunk, release") {
+		t.Fatalf("err = %v, want ErrRevisionNotFound listing the branches", err)
+	}
+}
+
+func TestFailureClasses(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: "weights", LFS: true}})
+	hub.fail = func(r *http.Request) int {
+		if strings.Contains(r.URL.Path, "/resolve/") {
+			return http.StatusUnauthorized
+		}
+		return 0
+	}
+	d, _ := hub.downloader()
+	_, err := d.Download(context.Background(), hubOptions(t))
+	if !errors.Is(err, ErrAuth) || !errors.Is(err, ErrFilesFailed) {
+		t.Fatalf("401 on resolve: %v, want ErrAuth and ErrFilesFailed", err)
+	}
+
+	hub.fail = nil
+	hub.corrupt = func(r *http.Request) bool { return true }
+	d, _ = hub.downloader()
+	if _, err := d.Download(context.Background(), hubOptions(t)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("corrupted file: %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestDownloadParam(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: "{}"}})
+	for _, noParam := range []bool{false, true} {
+		opts := hubOptions(t)
+		opts.NoDownloadParam = noParam
+		d, _ := hub.downloader()
+		if _, err := d.Download(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+		requests := hub.requestsTo("/resolve/")
+		if got := requests[len(requests)-1].URL.Query().Get("download"); (got == "true") == noParam {
+			t.Errorf("NoDownloadParam %v: resolve URL %s", noParam, requests[len(requests)-1].URL)
+		}
+	}
+}
+
+func TestOnFileCompleteRunsSerially(t *testing.T) {
+	files := map[string]hubFile{}
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("shard-%d.bin", i)] = hubFile{Content: strings.Repeat("x", i+1)}
+	}
+	hub := newFakeHub(t, files)
+	opts := hubOptions(t)
+	opts.MaxWorkers = 4
+	opts.ContinueOnError = true
+	var mu sync.Mutex
+	var running, overlapped int
+	var seen []string
+	opts.OnFileComplete = func(event FileEvent) error {
+		mu.Lock()
+		running++
+		if running > 1 {
+			overlapped++
+		}
+		seen = append(seen, event.Path)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if event.Path == "shard-3.bin" {
+			return errors.New("exit status 1")
+		}
+		if _, err := os.Stat(event.LocalPath); err != nil {
+			t.Errorf("hook ran before %s landed: %v", event.Path, err)
+		}
+		return nil
+	}
+	d, _ := hub.downloader()
+	result, err := d.Download(context.Background(), opts)
+	if err == nil {
+		t.Fatal("failing hook didn't fail the download")
+	}
+	if len(seen) != 8 || overlapped != 0 {
+		t.Fatalf("hook ran for %d files with %d overlapping, want 8 serial runs", len(seen), overlapped)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Path != "shard-3.bin" {
+		t.Fatalf("failed = %+v, want only shard-3.bin", result.Failed)
+	}
+}
+
+func TestTransferCounts(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":       {Content: `{"a":1}`},
+		"model.safetensors": {Content: "weights", LFS: true},
+	})
+	d, _ := hub.downloader()
+	result, err := d.Download(context.Background(), hubOptions(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(`{"a":1}`) + len("weights")); result.BytesDownloaded != want || result.BytesUploaded != 0 {
+		t.Fatalf("downloaded %d and uploaded %d bytes, want %d and 0", result.BytesDownloaded, result.BytesUploaded, want)
+	}
+	if len(result.Transfers) != 2 {
+		t.Fatalf("transfers %+v, want one per file", result.Transfers)
+	}
+	for _, transfer := range result.Transfers {
+		if content := hub.files[transfer.Path].Content; transfer.BytesDownloaded != int64(len(content)) {
+			t.Errorf("%s: %d bytes downloaded, want %d", transfer.Path, transfer.BytesDownloaded, len(content))
+		}
+	}
+}
+
+func TestTransportOptions(t *testing.T) {
+	defaults := newTransport(TransportOptions{})
+	if defaults.TLSNextProto != nil || defaults.MaxIdleConnsPerHost != NumConnections {
+		t.Fatalf("defaults changed: TLSNextProto %v, MaxIdleConnsPerHost %d", defaults.TLSNextProto, defaults.MaxIdleConnsPerHost)
+	}
+
+	transport := newTransport(TransportOptions{DisableHTTP2: true, MaxIdleConnsPerHost: NumConnections + 32})
+	if transport.ForceAttemptHTTP2 || transport.TLSNextProto == nil || len(transport.TLSNextProto) != 0 {
+		t.Fatalf("HTTP/2 still enabled: ForceAttemptHTTP2 %v, TLSNextProto %v", transport.ForceAttemptHTTP2, transport.TLSNextProto)
+	}
+	if transport.MaxIdleConnsPerHost != NumConnections+32 || transport.MaxIdleConns < transport.MaxIdleConnsPerHost {
+		t.Fatalf("idle pool = %d per host, %d total", transport.MaxIdleConnsPerHost, transport.MaxIdleConns)
+	}
+}
+
+func TestDisableHTTP2AgainstHTTP2Server(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	transport := newTransport(TransportOptions{DisableHTTP2: true})
+	transport.DialContext = nil
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Fatalf("negotiated %s with HTTP/2 disabled", resp.Proto)
+	}
+}
+
+func TestAuthHeader(t *testing.T) {
+	savedName, savedFormat := authHeaderName, authHeaderFormat
+	t.Cleanup(func() { authHeaderName, authHeaderFormat = savedName, savedFormat })
+	if err := SetAuthHeader("x-api-key", "Key {{.Token}}"); err != nil {
+		t.Fatal(err)
+	}
+
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: "{}"}})
+	opts := hubOptions(t)
+	opts.Token = "hf_secret"
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range hub.requestsTo("/") {
+		if got := r.Header.Get("X-Api-Key"); got != "Key hf_secret" || r.Header.Get("Authorization") != "" {
+			t.Fatalf("%s sent X-Api-Key %q and Authorization %q", r.URL.Path, got, r.Header.Get("Authorization"))
+		}
+	}
+
+	for _, bad := range [][2]string{{"X Key", ""}, {"X:Key", ""}, {"", "{{.Token"}, {"", "{{.Missing}}"}, {"", "a\n{{.Token}}"}} {
+		if err := SetAuthHeader(bad[0], bad[1]); err == nil {
+			t.Errorf("SetAuthHeader(%q, %q) accepted", bad[0], bad[1])
+		}
+	}
+}
+
+func TestLFSPointers(t *testing.T) {
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:" + sha256Hex("weights") + "\nsize 7\n"
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json": {Content: "{}"},
+		"model.bin":   {Content: pointer},
+	})
+	for _, skip := range []bool{false, true} {
+		opts := hubOptions(t)
+		opts.SkipPointers = skip
+		d, out := hub.downloader()
+		result, err := d.Download(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Pointers) != 1 || result.Pointers[0] != "model.bin" {
+			t.Fatalf("pointers %v, want [model.bin]", result.Pointers)
+		}
+		if !strings.Contains(out.String(), "model.bin is a Git LFS pointer") {
+			t.Errorf("pointer not reported:\n%s", out)
+		}
+		_, err = os.Stat(filepath.Join(opts.Storage, "o", "m", "model.bin"))
+		if skip != os.IsNotExist(err) {
+			t.Errorf("SkipPointers %v: model.bin on disk: %v", skip, err)
+		}
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	t.Cleanup(func() { ConfigureTransport(TransportOptions{}) })
+
+	// The test server's certificate is self-signed, so the system pool rejects it
+	if err := ConfigureTransport(TransportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDownloader().client().Get(server.URL); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("err = %v, want a certificate error without the bundle", err)
+	}
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, pemBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []TransportOptions{{CABundle: bundle}, {InsecureSkipVerify: true}} {
+		if err := ConfigureTransport(opts); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := NewDownloader().client().Get(server.URL)
+		if err != nil {
+			t.Fatalf("%+v: %v", opts, err)
+		}
+		resp.Body.Close()
+		// The bucket clients share the same TLS settings
+		if tlsConfig == nil {
+			t.Fatalf("%+v: bucket clients keep the default TLS settings", opts)
+		}
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0644)
+	if err := ConfigureTransport(TransportOptions{CABundle: notPEM}); err == nil {
+		t.Fatal("bundle without certificates accepted")
+	}
+}
+
+func TestTimeoutAbortsInFlightFiles(t *testing.T) {
+	content := strings.Repeat("w", 64*1024)
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: content, LFS: true}})
+	hub.stall = func(r *http.Request) int { return 1024 }
+	opts := hubOptions(t)
+	opts.ShutdownGrace = time.Minute // a deadline doesn't wait for in-flight files
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	d, _ := hub.downloader()
+	start := time.Now()
+	_, err := d.Download(ctx, opts)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("err = %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("took %s to give up after a 200ms timeout", elapsed)
+	}
+	local := filepath.Join(opts.Storage, "o", "m", "model.safetensors")
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Fatalf("unfinished file stored under its final name: %v", err)
+	}
+	if info, err := os.Stat(local + ".part"); err != nil || info.Size() != 1024 {
+		t.Fatalf(".part file not kept for a resume: %v", err)
+	}
+}
+
+func TestIPVersionRestrictsDialing(t *testing.T) {
+	t.Cleanup(func() { ConfigureTransport(TransportOptions{}) })
+	var dialed []string
+	dial := restrictDial(func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = append(dialed, network)
+		return nil, errors.New("not dialing")
+	})
+	for _, tc := range []struct {
+		version string
+		want    string
+	}{
+		{"", "tcp"},
+		{"auto", "tcp"},
+		{"4", "tcp4"},
+		{"6", "tcp6"},
+	} {
+		if err := ConfigureTransport(TransportOptions{IPVersion: tc.version}); err != nil {
+			t.Fatal(err)
+		}
+		dialed = nil
+		dial(context.Background(), "tcp", "huggingface.co:443")
+		if len(dialed) != 1 || dialed[0] != tc.want {
+			t.Errorf("--ip-version %q dialed %v, want %s", tc.version, dialed, tc.want)
+		}
+	}
+	if err := ConfigureTransport(TransportOptions{IPVersion: "5"}); err == nil {
+		t.Fatal("IP version 5 accepted")
+	}
+}
+
+func TestIPv6OnlyTransport(t *testing.T) {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("no IPv6 loopback:", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+	v4 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer v4.Close()
+	t.Cleanup(func() { ConfigureTransport(TransportOptions{}) })
+
+	if err := ConfigureTransport(TransportOptions{IPVersion: "6"}); err != nil {
+		t.Fatal(err)
+	}
+	client := NewDownloader().client()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("IPv6 server unreachable with --ip-version 6: %v", err)
+	}
+	resp.Body.Close()
+	if _, err := client.Get(v4.URL); err == nil {
+		t.Fatal("reached an IPv4 server with --ip-version 6")
+	}
+}
+
+func TestLowMemory(t *testing.T) {
+	if d := NewDownloader(); d.chunkSize != DefaultChunkSize {
+		t.Fatalf("default chunk size %d", d.chunkSize)
+	}
+	if d := NewDownloader(WithLowMemory()); d.chunkSize != LowMemoryChunkSize {
+		t.Fatalf("low-memory chunk size %d, want %d", d.chunkSize, LowMemoryChunkSize)
+	}
+	if d := NewDownloader(WithLowMemory(), WithChunkSize(MinChunkSize)); d.chunkSize != MinChunkSize {
+		t.Fatalf("an explicit chunk size was overridden: %d", d.chunkSize)
+	}
+
+	files := map[string]hubFile{}
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("shard-%02d.bin", i)] = hubFile{Content: fmt.Sprintf("shard %d", i), LFS: true}
+	}
+	hub := newFakeHub(t, files)
+	var resolves concurrency
+	hub.fail = func(r *http.Request) int {
+		if resolvePath.MatchString(r.URL.Path) {
+			resolves.enter()
+			time.Sleep(10 * time.Millisecond)
+			resolves.leave()
+		}
+		return 0
+	}
+	opts := hubOptions(t)
+	opts.MaxWorkers = 8
+	d, _ := hub.downloader(WithLowMemory())
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if peak := resolves.peak.Load(); peak > LowMemoryWorkers {
+		t.Fatalf("%d files in flight at once with WithLowMemory, want at most %d", peak, LowMemoryWorkers)
+	}
+}
+
+func TestAutoWorkersScalesWithCPUs(t *testing.T) {
+	saved := numCPU
+	t.Cleanup(func() { numCPU = saved })
+	for _, tc := range []struct{ cpus, want int }{
+		{1, minAutoWorkers},
+		{2, 8},
+		{4, 16},
+		{8, 32},
+		{16, maxAutoWorkers},
+		{128, maxAutoWorkers},
+	} {
+		numCPU = func() int { return tc.cpus }
+		if got := AutoWorkers(); got != tc.want {
+			t.Errorf("%d CPUs: %d workers, want %d", tc.cpus, got, tc.want)
+		}
+		// An explicit worker count stays authoritative
+		if got := workerCount(DownloadOptions{MaxWorkers: 3}); got != 3 {
+			t.Errorf("%d CPUs: MaxWorkers 3 gave %d workers", tc.cpus, got)
+		}
+	}
+
+	numCPU = func() int { return 2 }
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: "{}"}})
+	opts := hubOptions(t)
+	opts.MaxWorkers = 0
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Using 8 worker goroutines for parallel downloads (auto, 2 CPUs)") {
+		t.Fatalf("auto worker count not logged:\n%s", out)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	notFound := fmt.Errorf("%w: 404", ErrNotFound)
+	failTwice := func(calls *int) func() error {
+		return func() error {
+			if *calls++; *calls <= 2 {
+				return notFound
+			}
+			return nil
+		}
+	}
+
+	calls := 0
+	err := NewDownloader(WithOutput(io.Discard)).retryWithBackoff(failTwice(&calls), 5, time.Millisecond, time.Millisecond)
+	if !errors.Is(err, ErrNotFound) || calls != 1 {
+		t.Fatalf("default policy: %v after %d calls, want a 404 not retried", err, calls)
+	}
+
+	var attempts []int
+	d := NewDownloader(WithOutput(io.Discard), WithShouldRetry(func(err error, attempt int) bool {
+		attempts = append(attempts, attempt)
+		return errors.Is(err, ErrNotFound)
+	}))
+	calls = 0
+	if err := d.retryWithBackoff(failTwice(&calls), 5, time.Millisecond, time.Millisecond); err != nil {
+		t.Fatalf("404s retried by the custom policy: %v", err)
+	}
+	if calls != 3 || !slices.Equal(attempts, []int{1, 2}) {
+		t.Fatalf("%d calls, policy asked about attempts %v; want 3 and [1 2]", calls, attempts)
+	}
+
+	calls = 0
+	if err := d.retryWithBackoff(failTwice(&calls), 2, time.Millisecond, time.Millisecond); !errors.Is(err, ErrNotFound) || calls != 2 {
+		t.Fatalf("%v after %d calls, want the attempt limit kept", err, calls)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: `{"a":1}`}})
+	client := hub.client()
+	d := NewDownloader(WithHTTPClient(client), WithOutput(io.Discard))
+	if _, err := d.Download(context.Background(), hubOptions(t)); err != nil {
+		t.Fatal(err)
+	}
+	if hub.hits("/resolve/main/config.json") != 1 {
+		t.Fatal("download didn't go through the caller's client")
+	}
+	// The caller's client is copied, not changed, and still gets the redirect policy
+	if client.CheckRedirect != nil || d.client().CheckRedirect == nil {
+		t.Fatal("redirect policy not set on a copy of the client")
+	}
+	if NewDownloader(WithHTTPClient(client), WithHTTPClient(nil)).client() != httpClient {
+		t.Fatal("a nil client doesn't fall back to the shared one")
+	}
+}
@@ -0,0 +1,81 @@
+package hfdownloader
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Concurrency has two levels: DownloadOptions.MaxWorkers decides how many
+// files are in flight, and the per-host limit below caps the requests open
+// against any one host at a time, whichever files they belong to. The second
+// is what CDNs rate limit on.
+
+// hostLimitedTransport holds a slot of a per-host semaphore from the moment a
+// request is sent until its response body is read to the end or closed.
+type hostLimitedTransport struct {
+	base http.RoundTripper
+	max  int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// limitPerHost wraps base so that at most max requests per host are open at
+// once. max <= 0 returns base unchanged.
+func limitPerHost(base http.RoundTripper, max int) http.RoundTripper {
+	if max <= 0 {
+		return base
+	}
+	return &hostLimitedTransport{base: base, max: max, slots: make(map[string]chan struct{})}
+}
+
+func (t *hostLimitedTransport) hostSlots(host string) chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	slots, ok := t.slots[host]
+	if !ok {
+		slots = make(chan struct{}, t.max)
+		t.slots[host] = slots
+	}
+	return slots
+}
+
+func (t *hostLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slots := t.hostSlots(req.URL.Host)
+	select {
+	case slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	var once sync.Once
+	release := func() { once.Do(func() { <-slots }) }
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody gives the host slot back once the body is finished with.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,105 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrency tracks how many requests are in flight at once.
+type concurrency struct {
+	now, peak atomic.Int32
+}
+
+func (c *concurrency) enter() {
+	n := c.now.Add(1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			return
+		}
+	}
+}
+
+func (c *concurrency) leave() { c.now.Add(-1) }
+
+func TestLimitPerHost(t *testing.T) {
+	var total concurrency
+	servers := make([]*httptest.Server, 2)
+	counts := make([]*concurrency, 2)
+	for i := range servers {
+		c := &concurrency{}
+		counts[i] = c
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.enter()
+			total.enter()
+			time.Sleep(10 * time.Millisecond)
+			total.leave()
+			c.leave()
+			w.Write([]byte("ok"))
+		}))
+		defer servers[i].Close()
+	}
+
+	client := &http.Client{Transport: limitPerHost(http.DefaultTransport, 2)}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(server *httptest.Server) {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}(servers[i%2])
+	}
+	wg.Wait()
+	for i, c := range counts {
+		if peak := c.peak.Load(); peak > 2 {
+			t.Errorf("server %d saw %d requests at once, cap is 2", i, peak)
+		}
+	}
+	if peak := total.peak.Load(); peak < 3 {
+		t.Errorf("at most %d requests at once across both hosts; the cap is per host", peak)
+	}
+}
+
+func TestLimitPerHostDuringDownload(t *testing.T) {
+	files := map[string]hubFile{}
+	for i := 0; i < 12; i++ {
+		files[fmt.Sprintf("shard-%02d.bin", i)] = hubFile{Content: fmt.Sprintf("shard %d", i), LFS: true}
+	}
+	hub := newFakeHub(t, files)
+	var resolves concurrency
+	hub.fail = func(r *http.Request) int {
+		if resolvePath.MatchString(r.URL.Path) {
+			resolves.enter()
+			time.Sleep(10 * time.Millisecond)
+			resolves.leave()
+		}
+		return 0
+	}
+	opts := hubOptions(t)
+	opts.MaxWorkers = 8
+	client := hub.client()
+	client.Transport = limitPerHost(client.Transport, 2)
+	d := NewDownloader(WithHTTPClient(client), WithOutput(io.Discard))
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if peak := resolves.peak.Load(); peak > 2 {
+		t.Fatalf("%d requests to the Hub at once with 8 workers, cap is 2", peak)
+	}
+	if limitPerHost(http.DefaultTransport, 0) != http.DefaultTransport {
+		t.Fatal("a zero cap still wraps the transport")
+	}
+}
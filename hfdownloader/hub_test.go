@@ -0,0 +1,382 @@
+package hfdownloader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// testCommit is the commit every fakeHub revision resolves to.
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// hubFile is a file in a fakeHub repo.
+type hubFile struct {
+	Content string
+	LFS     bool   // listed with an lfs entry carrying the SHA256
+	Mode    string // git tree mode, e.g. gitSymlinkMode with the target as Content
+	Date    string // last commit date, listed with ?expand=true
+}
+
+// fakeHub serves one repo through the Hub API and resolve URLs. Any repo name
+// and revision is accepted; revisions resolve to testCommit.
+type fakeHub struct {
+	*httptest.Server
+	files    map[string]hubFile
+	branches []string // listed by refs, just main when empty
+
+	mu       sync.Mutex
+	requests []*http.Request
+
+	// fail, when set, answers a request with the status it returns instead of
+	// serving it; 0 serves it as usual.
+	fail func(r *http.Request) int
+	// corrupt, when set and true for a resolve request, serves the file with
+	// its first byte changed, keeping its size.
+	corrupt func(r *http.Request) bool
+	// cut, when set and positive for a resolve request, resets the connection
+	// after sending that many bytes of the body.
+	cut func(r *http.Request) int
+	// stall, when set and positive for a resolve request, sends that many
+	// bytes of the body and then nothing until the client gives up.
+	stall func(r *http.Request) int
+	// redirect, when set and non-empty for a resolve request, answers it with
+	// a 302 to the URL it returns, like the Hub sending LFS files to its CDN.
+	redirect func(r *http.Request) string
+	// routes sends requests for other hosts, e.g. a CDN, to other servers.
+	routes map[string]*url.URL
+	// pace, when set, sends file bodies 1KB at a time with this pause between.
+	pace time.Duration
+	// encoding, "gzip" or "zstd", serves whole files with that content
+	// encoding to clients that accept it.
+	encoding string
+	// transport, when set, carries the client's requests instead of
+	// http.DefaultTransport.
+	transport http.RoundTripper
+
+	wire atomic.Int64 // file body bytes sent, after any encoding
+}
+
+var (
+	apiPath     = regexp.MustCompile(`^/api/(models|datasets|spaces)/([^/]+/[^/]+)(?:/(tree|revision|refs|paths-info)(?:/([^/]+)(?:/(.*))?)?)?$`)
+	resolvePath = regexp.MustCompile(`^/(?:datasets/|spaces/)?[^/]+/[^/]+/resolve/[^/]+/(.+)$`)
+)
+
+func newFakeHub(t testing.TB, files map[string]hubFile) *fakeHub {
+	t.Helper()
+	h := &fakeHub{files: files}
+	h.Server = httptest.NewServer(http.HandlerFunc(h.serve))
+	t.Cleanup(h.Close)
+	return h
+}
+
+func (h *fakeHub) serve(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.requests = append(h.requests, r.Clone(r.Context()))
+	fail, corrupt, cut, stall, redirect := h.fail, h.corrupt, h.cut, h.stall, h.redirect
+	h.mu.Unlock()
+	if fail != nil {
+		if status := fail(r); status != 0 {
+			http.Error(w, "injected failure", status)
+			return
+		}
+	}
+
+	if m := resolvePath.FindStringSubmatch(r.URL.Path); m != nil {
+		w = &countingResponse{ResponseWriter: w, n: &h.wire}
+		file, ok := h.files[m[1]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if redirect != nil {
+			if target := redirect(r); target != "" {
+				http.Redirect(w, r, target, http.StatusFound)
+				return
+			}
+		}
+		content := file.Content
+		if corrupt != nil && content != "" && corrupt(r) {
+			content = string([]byte{content[0] ^ 0xff}) + content[1:]
+		}
+		w.Header().Set("ETag", `"`+blobOid(content)+`"`)
+		if cut != nil {
+			if n := cut(r); n > 0 && n < len(content) {
+				resetAfter(w, content, n)
+				return
+			}
+		}
+		if h.encoding != "" && r.Header.Get("Range") == "" && strings.Contains(r.Header.Get("Accept-Encoding"), h.encoding) {
+			w.Header().Set("Content-Encoding", h.encoding)
+			var enc io.WriteCloser = gzip.NewWriter(w)
+			if h.encoding == "zstd" {
+				enc, _ = zstd.NewWriter(w)
+			}
+			enc.Write([]byte(content))
+			enc.Close()
+			return
+		}
+		if h.pace > 0 && r.Header.Get("Range") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			for rest := content; rest != ""; {
+				n := min(1024, len(rest))
+				w.Write([]byte(rest[:n]))
+				w.(http.Flusher).Flush()
+				rest = rest[n:]
+				time.Sleep(h.pace)
+			}
+			return
+		}
+		if stall != nil {
+			if n := stall(r); n > 0 && n < len(content) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.Write([]byte(content[:n]))
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+				return
+			}
+		}
+		http.ServeContent(w, r, path.Base(m[1]), time.Time{}, strings.NewReader(content))
+		return
+	}
+
+	m := apiPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch m[3] {
+	case "":
+		writeJSON(w, map[string]string{"id": m[2]})
+	case "revision":
+		writeJSON(w, map[string]string{"sha": testCommit})
+	case "refs":
+		branches := []map[string]string{{"name": "main"}}
+		if len(h.branches) > 0 {
+			branches = nil
+			for _, name := range h.branches {
+				branches = append(branches, map[string]string{"name": name})
+			}
+		}
+		writeJSON(w, map[string]any{"branches": branches})
+	case "tree":
+		writeJSON(w, h.tree(m[5], r.URL.Query().Get("expand") == "true"))
+	case "paths-info":
+		r.ParseForm()
+		var entries []map[string]any
+		for _, p := range r.Form["paths"] {
+			if file, ok := h.files[p]; ok {
+				entries = append(entries, h.entry(p, file, r.Form.Get("expand") == "true"))
+			}
+		}
+		writeJSON(w, entries)
+	}
+}
+
+// countingResponse adds the body bytes written through it to n.
+type countingResponse struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w *countingResponse) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+func (w *countingResponse) Flush() { w.ResponseWriter.(http.Flusher).Flush() }
+
+func (w *countingResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// resetAfter promises the whole of content but sends only its first n bytes
+// before resetting the connection, like a CDN dropping a transfer.
+func resetAfter(w http.ResponseWriter, content string, n int) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(content[:n]))
+	w.(http.Flusher).Flush()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0) // close with a RST rather than a FIN
+	}
+	conn.Close()
+}
+
+// tree lists the files and folders directly inside dir.
+func (h *fakeHub) tree(dir string, expand bool) []map[string]any {
+	dir = strings.Trim(dir, "/")
+	entries := []map[string]any{}
+	folders := map[string]bool{}
+	paths := make([]string, 0, len(h.files))
+	for p := range h.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		rel := p
+		if dir != "" {
+			if !strings.HasPrefix(p, dir+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(p, dir+"/")
+		}
+		if first, _, nested := strings.Cut(rel, "/"); nested {
+			folder := path.Join(dir, first)
+			if !folders[folder] {
+				folders[folder] = true
+				entries = append(entries, map[string]any{"type": "directory", "path": folder, "oid": "", "size": 0})
+			}
+			continue
+		}
+		entries = append(entries, h.entry(p, h.files[p], expand))
+	}
+	return entries
+}
+
+func (h *fakeHub) entry(p string, file hubFile, expand bool) map[string]any {
+	entry := map[string]any{"type": "file", "path": p, "oid": blobOid(file.Content), "size": len(file.Content)}
+	if file.Mode != "" {
+		entry["mode"] = file.Mode
+	}
+	if file.LFS {
+		entry["lfs"] = map[string]any{"oid": sha256Hex(file.Content), "size": len(file.Content), "pointerSize": 134}
+	}
+	if expand && file.Date != "" {
+		entry["lastCommit"] = map[string]string{"id": testCommit, "title": "update", "date": file.Date}
+	}
+	return entry
+}
+
+// requestsTo returns the requests whose path contains part.
+func (h *fakeHub) requestsTo(part string) []*http.Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var matched []*http.Request
+	for _, r := range h.requests {
+		if strings.Contains(r.URL.Path, part) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// hits counts the requests whose path contains part.
+func (h *fakeHub) hits(part string) int {
+	return len(h.requestsTo(part))
+}
+
+// route sends requests for host to server, e.g. a CDN the Hub redirects to.
+func (h *fakeHub) route(host string, server *httptest.Server) {
+	target, _ := url.Parse(server.URL)
+	if h.routes == nil {
+		h.routes = map[string]*url.URL{}
+	}
+	h.routes[host] = target
+}
+
+// client sends huggingface.co requests to the fake Hub, routed hosts to their
+// servers and everything else, e.g. mirrors, where it was addressed.
+func (h *fakeHub) client() *http.Client {
+	hub, _ := url.Parse(h.URL)
+	routes := map[string]*url.URL{"huggingface.co": hub}
+	for host, target := range h.routes {
+		routes[host] = target
+	}
+	base := h.transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &http.Client{Transport: hubTransport{routes, base}}
+}
+
+// downloader is a Downloader talking to the fake Hub, logging into a buffer.
+func (h *fakeHub) downloader(opts ...Option) (*Downloader, *syncBuffer) {
+	out := &syncBuffer{}
+	return NewDownloader(append([]Option{WithHTTPClient(h.client()), WithOutput(out)}, opts...)...), out
+}
+
+// syncBuffer is a bytes.Buffer safe for the progress bars' concurrent writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type hubTransport struct {
+	routes map[string]*url.URL
+	base   http.RoundTripper
+}
+
+func (t hubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, ok := t.routes[req.URL.Host]
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	routed := req.Clone(req.Context())
+	routed.URL.Scheme, routed.URL.Host = target.Scheme, target.Host
+	resp, err := t.base.RoundTrip(routed)
+	if resp != nil {
+		// Like a real transport, answer for the request as it was addressed
+		resp.Request = req
+	}
+	return resp, err
+}
+
+// hubOptions downloads repo o/m from main into a fresh folder.
+func hubOptions(t *testing.T) DownloadOptions {
+	return DownloadOptions{Repo: "o/m", Branch: "main", Storage: t.TempDir(), MaxWorkers: 2}
+}
+
+func blobOid(content string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write([]byte(content))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,202 @@
+package hfdownloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Values of the --cache-layout flag.
+const (
+	CacheLayoutPlain = "plain" // <storage>/<org>/<name>, the default
+	CacheLayoutHub   = "hub"   // huggingface_hub's cache, see DownloadOptions.HubCache
+)
+
+// ValidateCacheLayout checks a --cache-layout value, empty meaning plain.
+func ValidateCacheLayout(layout string) error {
+	switch layout {
+	case "", CacheLayoutPlain, CacheLayoutHub:
+		return nil
+	}
+	return fmt.Errorf("invalid cache layout %q, expected %s or %s", layout, CacheLayoutPlain, CacheLayoutHub)
+}
+
+// DefaultHubCache returns the hub cache huggingface_hub would use: hfHome/hub
+// when hfHome is given, else $HF_HUB_CACHE, $HUGGINGFACE_HUB_CACHE, $HF_HOME/hub,
+// $XDG_CACHE_HOME/huggingface/hub or ~/.cache/huggingface/hub, in that order.
+func DefaultHubCache(hfHome string) (string, error) {
+	if hfHome != "" {
+		return filepath.Join(hfHome, "hub"), nil
+	}
+	for _, env := range []string{"HF_HUB_CACHE", "HUGGINGFACE_HUB_CACHE"} {
+		if dir := os.Getenv(env); dir != "" {
+			return dir, nil
+		}
+	}
+	if dir := os.Getenv("HF_HOME"); dir != "" {
+		return filepath.Join(dir, "hub"), nil
+	}
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "huggingface", "hub"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the hub cache: %v", err)
+	}
+	return filepath.Join(home, ".cache", "huggingface", "hub"), nil
+}
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// shortCommitSHA matches a full or abbreviated commit SHA.
+var shortCommitSHA = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// hubRepoFolder is the repo's folder in the hub cache, e.g. models--org--name.
+func hubRepoFolder(opts DownloadOptions) string {
+	prefix := opts.repoType().pickURL("models", "datasets", "spaces")
+	repo := strings.Split(opts.Repo, ":")[0]
+	return prefix + "--" + strings.ReplaceAll(repo, "/", "--")
+}
+
+// repoDir is where the local copy of opts.Repo lives: <storage>/<repo>, or its
+// snapshot folder in the hub cache. Outside a download the snapshot is found
+// through the ref the revision last resolved to.
+func repoDir(opts DownloadOptions) string {
+	if opts.HubCache == "" {
+		return filepath.Join(opts.Storage, strings.Split(opts.Repo, ":")[0])
+	}
+	repoCache := filepath.Join(opts.HubCache, hubRepoFolder(opts))
+	commit := opts.Branch
+	if !commitSHA.MatchString(commit) {
+		if ref, err := os.ReadFile(filepath.Join(repoCache, "refs", filepath.FromSlash(opts.Branch))); err == nil {
+			commit = strings.TrimSpace(string(ref))
+		}
+	}
+	return filepath.Join(repoCache, "snapshots", commit)
+}
+
+// checkHubCacheOptions rejects options that would make the snapshot differ
+// from the repo.
+func checkHubCacheOptions(opts DownloadOptions, uploading bool) error {
+	switch {
+	case opts.HubCache == "":
+		return nil
+	case uploading:
+		return errors.New("the hub cache layout only applies to local downloads and cannot be combined with an upload backend")
+	case opts.Decompress, len(opts.Rename) > 0, opts.AppendFilterToPath:
+		return errors.New("the hub cache layout keeps repo paths and cannot be combined with decompression, renames or filter folders")
+	}
+	return nil
+}
+
+// linkCachedBlobs points the snapshot at blobs already in the hub cache, so
+// files unchanged since another commit are not downloaded again.
+func (d *Downloader) linkCachedBlobs(files []hfmodel, opts DownloadOptions) error {
+	snapshot := repoDir(opts)
+	blobs := filepath.Join(filepath.Dir(filepath.Dir(snapshot)), "blobs")
+	linked := 0
+	for _, file := range files {
+		if file.IsDirectory || file.FilterSkip || file.Size <= 0 {
+			continue
+		}
+		name := hubBlobName(file)
+		if name == "" {
+			continue
+		}
+		blob := filepath.Join(blobs, name)
+		localPath := filepath.Join(snapshot, filepath.FromSlash(file.Path))
+		if _, err := os.Lstat(localPath); err == nil {
+			continue
+		}
+		if info, err := os.Stat(blob); err != nil || info.Size() != int64(file.Size) {
+			continue
+		}
+		if err := linkBlob(blob, localPath); err != nil {
+			return err
+		}
+		linked++
+	}
+	if linked > 0 {
+		d.logf("Reusing %d files already in the hub cache\n", linked)
+	}
+	return nil
+}
+
+// finishHubSnapshot moves the downloaded files of the snapshot into blobs/,
+// leaving relative symlinks behind as huggingface_hub does, and points
+// refs/<revision> at commit.
+func finishHubSnapshot(files []hfmodel, opts DownloadOptions, revision, commit string) error {
+	snapshot := repoDir(opts)
+	repoCache := filepath.Dir(filepath.Dir(snapshot))
+	blobs := filepath.Join(repoCache, "blobs")
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", blobs, err)
+	}
+
+	for _, file := range files {
+		if file.IsDirectory || file.FilterSkip || file.Size <= 0 {
+			continue
+		}
+		localPath := filepath.Join(snapshot, filepath.FromSlash(file.Path))
+		info, err := os.Lstat(localPath)
+		if err != nil || !info.Mode().IsRegular() {
+			continue // not downloaded, or already a link
+		}
+		name := hubBlobName(file)
+		if name == "" {
+			continue // no id to file it under, so keep the plain file
+		}
+		blob := filepath.Join(blobs, name)
+		if _, err := os.Stat(blob); err == nil {
+			err = os.Remove(localPath)
+		} else {
+			err = os.Rename(localPath, blob)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move %s into the hub cache: %v", file.Path, err)
+		}
+		if err := linkBlob(blob, localPath); err != nil {
+			return err
+		}
+	}
+
+	// Like huggingface_hub, refs name branches and tags only, without a newline
+	if revision != commit {
+		ref := filepath.Join(repoCache, "refs", filepath.FromSlash(revision))
+		if err := os.MkdirAll(filepath.Dir(ref), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", filepath.Dir(ref), err)
+		}
+		if err := os.WriteFile(ref, []byte(commit), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", ref, err)
+		}
+	}
+	return nil
+}
+
+// hubBlobName is the file's name under blobs/: its ETag on the Hub, which is
+// the SHA256 for LFS files and the git blob id otherwise. It is empty when the
+// listing didn't give one, and such a file must not be linked.
+func hubBlobName(file hfmodel) string {
+	if file.Lfs != nil {
+		return file.Lfs.Oid_SHA265
+	}
+	return file.Oid
+}
+
+// linkBlob makes localPath a relative symlink to blob.
+func linkBlob(blob, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(localPath), err)
+	}
+	target, err := filepath.Rel(filepath.Dir(localPath), blob)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(target, localPath); err != nil {
+		return fmt.Errorf("failed to link %s: %v", localPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// The layout must match huggingface_hub's byte for byte so transformers
+// finds the snapshot without downloading it again.
+func TestHubCacheLayout(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":         {Content: `{"a":1}`},
+		"model.safetensors":   {Content: "weights", LFS: true},
+		"tokenizer/vocab.txt": {Content: "a\nb\n"},
+	})
+	opts := hubOptions(t)
+	opts.HubCache = t.TempDir()
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	repo := filepath.Join(opts.HubCache, "models--o--m")
+	ref, err := os.ReadFile(filepath.Join(repo, "refs", "main"))
+	if err != nil || string(ref) != testCommit {
+		t.Fatalf("refs/main = %q, %v; want the commit without a newline", ref, err)
+	}
+
+	want := map[string]string{
+		"config.json":         blobOid(`{"a":1}`),
+		"model.safetensors":   sha256Hex("weights"),
+		"tokenizer/vocab.txt": blobOid("a\nb\n"),
+	}
+	snapshot := filepath.Join(repo, "snapshots", testCommit)
+	for file, blob := range want {
+		local := filepath.Join(snapshot, filepath.FromSlash(file))
+		target, err := os.Readlink(local)
+		if err != nil {
+			t.Fatalf("%s is not a symlink: %v", file, err)
+		}
+		if filepath.IsAbs(target) || filepath.Clean(filepath.Join(filepath.Dir(local), target)) != filepath.Join(repo, "blobs", blob) {
+			t.Errorf("%s -> %s, want a relative link to blobs/%s", file, target, blob)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(repo, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blobs []string
+	for _, e := range entries {
+		blobs = append(blobs, e.Name())
+	}
+	wantBlobs := []string{want["config.json"], want["model.safetensors"], want["tokenizer/vocab.txt"]}
+	sort.Strings(wantBlobs)
+	if !slices.Equal(blobs, wantBlobs) {
+		t.Fatalf("blobs %v, want %v", blobs, wantBlobs)
+	}
+
+	top, _ := os.ReadDir(repo)
+	var names []string
+	for _, e := range top {
+		names = append(names, e.Name())
+	}
+	if !slices.Equal(names, []string{"blobs", "refs", "snapshots"}) {
+		t.Fatalf("%s holds %v, want blobs, refs and snapshots only", repo, names)
+	}
+}
+
+// A second commit reuses blobs already in the cache instead of downloading them.
+func TestHubCacheReusesBlobs(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: "weights", LFS: true}})
+	opts := hubOptions(t)
+	opts.HubCache = t.TempDir()
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(filepath.Join(opts.HubCache, "models--o--m", "snapshots"))
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if n := hub.hits("/resolve/"); n != 1 {
+		t.Fatalf("%d downloads, want 1:\n%s", n, out)
+	}
+	if _, err := os.Readlink(filepath.Join(opts.HubCache, "models--o--m", "snapshots", testCommit, "model.safetensors")); err != nil {
+		t.Fatal(err)
+	}
+}
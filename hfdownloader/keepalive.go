@@ -0,0 +1,52 @@
+package hfdownloader
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// DefaultKeepAliveInterval is the TCP keepalive interval when
+// TransportOptions.KeepAliveInterval is unset.
+const DefaultKeepAliveInterval = 30 * time.Second
+
+// stallIntervals is how many keepalive intervals a connection may go without
+// receiving a byte before it is treated as dead.
+const stallIntervals = 3
+
+// keepAliveDial sets a jittered TCP keepalive period on every connection and
+// fails reads that get no data for stallIntervals intervals. Keepalive probes
+// catch peers that vanished, e.g. after a VPN or mobile network switch; the
+// read deadline catches connections the peer keeps open but stopped sending
+// on. Either way the read fails, and the request is retried or resumed
+// instead of hanging. The transport doesn't negotiate HTTP/2, so there are no
+// HTTP/2 pings to configure.
+func keepAliveDial(dial func(ctx context.Context, network, address string) (net.Conn, error), interval time.Duration) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if interval <= 0 {
+		interval = DefaultKeepAliveInterval
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			// ±20% so connections opened together don't probe in lockstep
+			tcp.SetKeepAlive(true)
+			tcp.SetKeepAlivePeriod(time.Duration(float64(interval) * (0.8 + 0.4*rand.Float64())))
+		}
+		return &idleConn{Conn: conn, timeout: stallIntervals * interval}, nil
+	}
+}
+
+// idleConn fails a read that waits longer than timeout for data.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
@@ -0,0 +1,67 @@
+package hfdownloader
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveResumesSilentConnection(t *testing.T) {
+	content := strings.Repeat("w", 64*1024)
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: content, LFS: true}})
+	// The first transfer goes silent after 1KB with the connection left open
+	var stalled atomic.Bool
+	hub.stall = func(r *http.Request) int {
+		if stalled.CompareAndSwap(false, true) {
+			return 1024
+		}
+		return 0
+	}
+	hub.transport = newTransport(TransportOptions{KeepAliveInterval: 50 * time.Millisecond})
+	opts := hubOptions(t)
+	d, out := hub.downloader()
+
+	start := time.Now()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("took %s to notice a connection silent for 150ms", elapsed)
+	}
+	if got, _ := os.ReadFile(filepath.Join(opts.Storage, "o", "m", "model.safetensors")); string(got) != content {
+		t.Fatalf("downloaded %d bytes, want %d", len(got), len(content))
+	}
+	requests := hub.requestsTo("/resolve/")
+	if len(requests) != 2 {
+		t.Fatalf("%d requests for the file, want the stalled one and a resume", len(requests))
+	}
+	if got := requests[1].Header.Get("Range"); got != "bytes=1024-" {
+		t.Errorf("resumed with Range %q, want bytes=1024-", got)
+	}
+}
+
+func TestKeepAliveDialDefaults(t *testing.T) {
+	dial := keepAliveDial(func(ctx context.Context, network, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		t.Cleanup(func() { server.Close() })
+		return client, nil
+	}, 0)
+	conn, err := dial(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	idle, ok := conn.(*idleConn)
+	if !ok {
+		t.Fatalf("dialed a %T, want reads wrapped with a deadline", conn)
+	}
+	if idle.timeout != stallIntervals*DefaultKeepAliveInterval {
+		t.Fatalf("read timeout %v, want %v", idle.timeout, stallIntervals*DefaultKeepAliveInterval)
+	}
+}
@@ -0,0 +1,41 @@
+package hfdownloader
+
+import "context"
+
+// DefaultLargeFileThreshold is the size from which MaxParallelLarge applies
+// when LargeFileThreshold is unset.
+const DefaultLargeFileThreshold = 1 << 30
+
+// largeFileSlots bounds how many files at or above a size transfer at once,
+// independent of the worker count. A nil *largeFileSlots never blocks.
+type largeFileSlots struct {
+	threshold int64
+	sem       chan struct{}
+}
+
+// newLargeFileSlots returns the slots for opts, or nil when MaxParallelLarge
+// is unset.
+func newLargeFileSlots(opts DownloadOptions) *largeFileSlots {
+	if opts.MaxParallelLarge <= 0 {
+		return nil
+	}
+	threshold := opts.LargeFileThreshold
+	if threshold <= 0 {
+		threshold = DefaultLargeFileThreshold
+	}
+	return &largeFileSlots{threshold: threshold, sem: make(chan struct{}, opts.MaxParallelLarge)}
+}
+
+// acquire waits for a slot when size is at or above the threshold and returns
+// the function that gives it back. Small files return at once.
+func (l *largeFileSlots) acquire(ctx context.Context, size int64) (func(), error) {
+	if l == nil || size < l.threshold {
+		return func() {}, nil
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return func() { <-l.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,79 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxParallelLarge(t *testing.T) {
+	files := map[string]hubFile{}
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("large-%d.bin", i)] = hubFile{Content: strings.Repeat("L", 4096+i), LFS: true}
+		files[fmt.Sprintf("small-%d.json", i)] = hubFile{Content: fmt.Sprintf(`{"i":%d}`, i)}
+	}
+	hub := newFakeHub(t, files)
+	var large, small concurrency
+	hub.fail = func(r *http.Request) int {
+		if !resolvePath.MatchString(r.URL.Path) {
+			return 0
+		}
+		c := &small
+		if strings.Contains(r.URL.Path, "/large-") {
+			c = &large
+		}
+		c.enter()
+		time.Sleep(20 * time.Millisecond)
+		c.leave()
+		return 0
+	}
+	opts := hubOptions(t)
+	opts.MaxWorkers = 8
+	opts.MaxParallelLarge = 2
+	opts.LargeFileThreshold = 4096
+	d, out := hub.downloader()
+	result, err := d.Download(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if result.Files != len(files) {
+		t.Fatalf("downloaded %d of %d files", result.Files, len(files))
+	}
+	if peak := large.peak.Load(); peak > 2 {
+		t.Errorf("%d large files at once, limit is 2", peak)
+	}
+	// Small files keep the other workers busy meanwhile
+	if peak := small.peak.Load(); peak <= 2 {
+		t.Errorf("at most %d small files at once with 8 workers", peak)
+	}
+}
+
+func TestLargeFileSlots(t *testing.T) {
+	if newLargeFileSlots(DownloadOptions{}) != nil {
+		t.Fatal("slots created without MaxParallelLarge")
+	}
+	slots := newLargeFileSlots(DownloadOptions{MaxParallelLarge: 1})
+	if slots.threshold != DefaultLargeFileThreshold {
+		t.Fatalf("threshold %d, want the default", slots.threshold)
+	}
+	release, err := slots.acquire(context.Background(), DefaultLargeFileThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Small files never wait, while a second large one waits for the slot
+	if _, err := slots.acquire(context.Background(), DefaultLargeFileThreshold-1); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := slots.acquire(ctx, DefaultLargeFileThreshold); err != context.DeadlineExceeded {
+		t.Fatalf("second large file: %v, want to wait until the deadline", err)
+	}
+	release()
+	if _, err := slots.acquire(context.Background(), DefaultLargeFileThreshold); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,150 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// SnapshotDiff compares two local download folders file by file.
+type SnapshotDiff struct {
+	OnlyInA   []string `json:"only_in_a"` // files missing from the second folder
+	OnlyInB   []string `json:"only_in_b"` // files missing from the first folder
+	Differ    []string `json:"differ"`    // present in both with different size or SHA256
+	Identical int      `json:"identical"`
+}
+
+// Clean reports whether both folders hold byte-identical files.
+func (r *SnapshotDiff) Clean() bool {
+	return len(r.OnlyInA) == 0 && len(r.OnlyInB) == 0 && len(r.Differ) == 0
+}
+
+// snapshotFile is a file found under a snapshot folder.
+type snapshotFile struct {
+	path   string // on disk
+	size   int64
+	sha256 string // from the manifest, empty until hashed
+}
+
+// DiffSnapshots compares the files under dirA and dirB by relative path, size
+// and SHA256, without touching the network. Files of equal size are hashed,
+// except that an LFS file whose size matches its manifest entry reuses the
+// SHA256 recorded there, verified against the Hub when it was downloaded;
+// rehash hashes those too. Bookkeeping files and .git are ignored.
+func DiffSnapshots(dirA, dirB string, rehash bool) (*SnapshotDiff, error) {
+	a, err := scanSnapshot(dirA, rehash)
+	if err != nil {
+		return nil, err
+	}
+	b, err := scanSnapshot(dirB, rehash)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &SnapshotDiff{}
+	for rel, fileA := range a {
+		fileB, ok := b[rel]
+		if !ok {
+			diff.OnlyInA = append(diff.OnlyInA, rel)
+			continue
+		}
+		same, err := sameSnapshotFile(fileA, fileB)
+		if err != nil {
+			return nil, err
+		}
+		if same {
+			diff.Identical++
+		} else {
+			diff.Differ = append(diff.Differ, rel)
+		}
+	}
+	for rel := range b {
+		if _, ok := a[rel]; !ok {
+			diff.OnlyInB = append(diff.OnlyInB, rel)
+		}
+	}
+	sort.Strings(diff.OnlyInA)
+	sort.Strings(diff.OnlyInB)
+	sort.Strings(diff.Differ)
+	return diff, nil
+}
+
+// scanSnapshot lists the files under dir by slash-separated relative path,
+// with the SHA256 the manifest records for them unless rehash is set.
+func scanSnapshot(dir string, rehash bool) (map[string]*snapshotFile, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder", dir)
+	}
+
+	files := make(map[string]*snapshotFile)
+	err = filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || isBookkeepingFile(entry.Name()) {
+			return nil
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil // a symlink to a folder; its files are listed under the target
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = &snapshotFile{path: p, size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %v", dir, err)
+	}
+
+	if rehash {
+		return files, nil
+	}
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	for repoPath, entry := range manifest.Files {
+		localName := repoPath
+		if entry.LocalPath != "" {
+			localName = entry.LocalPath
+		}
+		if file, ok := files[localName]; ok && entry.SHA256 != "" && entry.Size == file.size {
+			file.sha256 = entry.SHA256
+		}
+	}
+	return files, nil
+}
+
+// sameSnapshotFile compares two files by size, then by SHA256, hashing the
+// ones without a recorded SHA256.
+func sameSnapshotFile(a, b *snapshotFile) (bool, error) {
+	if a.size != b.size {
+		return false, nil
+	}
+	for _, file := range []*snapshotFile{a, b} {
+		if file.sha256 != "" {
+			continue
+		}
+		sum, _, err := sha256OfFile(file.path)
+		if err != nil {
+			return false, err
+		}
+		file.sha256 = sum
+	}
+	return a.sha256 == b.sha256, nil
+}
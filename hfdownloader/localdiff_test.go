@@ -0,0 +1,91 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":          {Content: `{"a":1}`},
+		"model.safetensors":    {Content: "weights", LFS: true},
+		"tokenizer/vocab.json": {Content: `{"hello":0}`},
+	})
+	d, _ := hub.downloader()
+	var dirs [2]string
+	for i := range dirs {
+		opts := hubOptions(t)
+		if _, err := d.Download(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+		dirs[i] = filepath.Join(opts.Storage, "o", "m")
+	}
+	a, b := dirs[0], dirs[1]
+
+	diff, err := DiffSnapshots(a, b, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Clean() || diff.Identical != 3 {
+		t.Fatalf("two downloads of the same revision differ: %+v", diff)
+	}
+
+	// Same size, different bytes: the manifest vouches for the LFS file, so
+	// only a rehash catches it, while the small file is always hashed
+	if err := os.WriteFile(filepath.Join(b, "model.safetensors"), []byte("WEIGHTS"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(b, "config.json"), []byte(`{"a":2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(b, "tokenizer", "vocab.json"))
+	if err := os.WriteFile(filepath.Join(b, "extra.txt"), []byte("extra"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err = DiffSnapshots(a, b, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SnapshotDiff{OnlyInA: []string{"tokenizer/vocab.json"}, OnlyInB: []string{"extra.txt"}, Differ: []string{"config.json"}, Identical: 1}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %+v\nwant %+v", diff, want)
+	}
+
+	diff, err = DiffSnapshots(a, b, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Differ, want.Identical = []string{"config.json", "model.safetensors"}, 0
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("rehashed diff = %+v\nwant %+v", diff, want)
+	}
+}
+
+func TestDiffSnapshotsWithoutManifests(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	for _, dir := range []string{a, b} {
+		os.MkdirAll(filepath.Join(dir, "sub", ".git"), 0755)
+		os.WriteFile(filepath.Join(dir, "same.bin"), []byte("same"), 0644)
+		os.WriteFile(filepath.Join(dir, "sub", "file.txt"), []byte("text"), 0644)
+	}
+	os.WriteFile(filepath.Join(a, "sub", ".git", "HEAD"), []byte("ref: a"), 0644)
+	os.WriteFile(filepath.Join(b, "sub", "file.txt"), []byte("TEXT"), 0644)
+	os.WriteFile(filepath.Join(b, "longer.bin"), []byte("longer"), 0644)
+
+	diff, err := DiffSnapshots(a, b, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SnapshotDiff{OnlyInB: []string{"longer.bin"}, Differ: []string{"sub/file.txt"}, Identical: 1}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff = %+v\nwant %+v", diff, want)
+	}
+
+	if _, err := DiffSnapshots(a, filepath.Join(b, "same.bin"), false); err == nil {
+		t.Error("a file was accepted as a snapshot folder")
+	}
+}
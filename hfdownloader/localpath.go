@@ -0,0 +1,24 @@
+package hfdownloader
+
+import "strings"
+
+// localPathFor returns the repo path a file is stored under locally, and
+// whether it is expanded on the way. With opts.Decompress, .gz files are
+// expanded and lose their suffix, and with opts.StripPrefix the folder shared
+// by opts.Dirs is dropped; a file in opts.Rename is stored under its target
+// instead.
+func localPathFor(opts DownloadOptions, filePath string) (string, bool) {
+	localName, decompress := filePath, false
+	if opts.Decompress && strings.HasSuffix(filePath, ".gz") && len(filePath) > len(".gz") {
+		localName, decompress = strings.TrimSuffix(filePath, ".gz"), true
+	}
+	if opts.StripPrefix {
+		if root := commonDir(opts.Dirs); root != "" {
+			localName = strings.TrimPrefix(localName, root+"/")
+		}
+	}
+	if target, ok := opts.Rename[filePath]; ok {
+		localName = target
+	}
+	return localName, decompress
+}
@@ -0,0 +1,140 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithLogger sends the downloader's diagnostic output to logger instead of
+// printing it as plain lines, e.g. to get JSON records or to change the level.
+// Per-request URLs and timings are logged at debug level, warnings at warn and
+// failures at error; everything else is info. Progress bars still go to the
+// WithOutput writer.
+func WithLogger(logger *slog.Logger) Option {
+	return func(d *Downloader) {
+		d.logger = logger
+	}
+}
+
+// NewPlainHandler returns a slog.Handler that writes each message as a bare
+// line, the way the downloader prints without WithLogger, followed by any
+// attributes as key=value. Records below opts.Level are dropped.
+func NewPlainHandler(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	var level slog.Leveler = slog.LevelInfo
+	if opts != nil && opts.Level != nil {
+		level = opts.Level
+	}
+	return &plainHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+type plainHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	prefix string // group names, joined with dots
+	attrs  string // attributes added with WithAttrs, already formatted
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		h.appendAttr(&b, a)
+		return true
+	})
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *plainHandler) appendAttr(b *strings.Builder, a slog.Attr) {
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	fmt.Fprintf(b, " %s%s=%v", h.prefix, a.Key, a.Value.Resolve())
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		h.appendAttr(&b, a)
+	}
+	c.attrs = b.String()
+	return &c
+}
+
+func (h *plainHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix += name + "."
+	return &c
+}
+
+// levelOf picks the level of a message printed with logf or logln from the
+// way it starts, so call sites don't each have to say.
+func levelOf(msg string) slog.Level {
+	msg = strings.TrimSpace(msg)
+	switch {
+	case strings.HasPrefix(msg, "Error"), strings.HasPrefix(msg, "❌ Error"), strings.Contains(msg, "panicked"):
+		return slog.LevelError
+	case strings.Contains(msg, "Warning"), strings.HasPrefix(msg, "⚠️"):
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// secretPattern matches the values of query parameters and headers that grant
+// access, wherever they show up in a message, e.g. in a *url.Error.
+var secretPattern = regexp.MustCompile(`(?i)([?&](?:x-amz-signature|x-amz-credential|x-amz-security-token|signature|x-xet-signature|key-pair-id|policy|token|access_token)=)[^&\s"']+|(bearer\s+)\S+`)
+
+// redactSecrets replaces signatures, tokens and bearer credentials in s.
+func redactSecrets(s string) string {
+	return secretPattern.ReplaceAllString(s, "${1}${2}REDACTED")
+}
+
+// log writes msg at level, without its trailing newline and with secrets
+// redacted. Blank messages are dropped.
+func (d *Downloader) log(level slog.Level, msg string) {
+	msg = strings.TrimRight(msg, "\n")
+	if strings.TrimSpace(msg) == "" {
+		return
+	}
+	d.logger.Log(context.Background(), level, redactSecrets(msg))
+}
+
+// loggingTransport logs every request at debug level with its status and
+// duration.
+type loggingTransport struct {
+	next   http.RoundTripper
+	logger *slog.Logger
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	attrs := []interface{}{"method", req.Method, "url", redactSecrets(req.URL.Redacted()), "duration", time.Since(start).Round(time.Millisecond)}
+	if err != nil {
+		t.logger.Debug("request failed", append(attrs, "error", redactSecrets(err.Error()))...)
+		return resp, err
+	}
+	t.logger.Debug("request", append(attrs, "status", resp.StatusCode)...)
+	return resp, err
+}
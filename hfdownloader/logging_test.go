@@ -0,0 +1,134 @@
+package hfdownloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// logRecords runs a download of hub logging JSON records at level, and
+// returns the records.
+func logRecords(t *testing.T, hub *fakeHub, level slog.Level) []map[string]any {
+	t.Helper()
+	var out syncBuffer
+	d := NewDownloader(WithHTTPClient(hub.client()), WithOutput(io.Discard), WithLogger(slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: level}))))
+	opts := hubOptions(t)
+	opts.Token = "hf_secret_token"
+	opts.SHAMismatch.LFS = MismatchRetry
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+	var records []map[string]any
+	if strings.Contains(out.String(), opts.Token) {
+		t.Fatal("token logged")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%q is not a JSON record: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogLevels(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":       {Content: `{"a":1}`},
+		"model.safetensors": {Content: "weights", LFS: true},
+		"extra.bin":         {Content: "extra", LFS: true},
+	})
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("weights"))
+	}))
+	t.Cleanup(cdn.Close)
+	hub.route("cdn.test", cdn)
+	hub.redirect = func(r *http.Request) string {
+		if strings.HasSuffix(r.URL.Path, ".safetensors") {
+			return "https://cdn.test/blob?X-Amz-Signature=cdn_signature&X-Amz-Expires=3600"
+		}
+		return ""
+	}
+	// The first extra.bin arrives corrupt, for a warning
+	var corrupted atomic.Bool
+	hub.corrupt = func(r *http.Request) bool {
+		return strings.HasSuffix(r.URL.Path, "extra.bin") && corrupted.CompareAndSwap(false, true)
+	}
+
+	levels := map[string]int{}
+	var requests []map[string]any
+	for _, record := range logRecords(t, hub, slog.LevelDebug) {
+		levels[record["level"].(string)]++
+		if record["msg"] == "request" {
+			requests = append(requests, record)
+		}
+	}
+	if levels["DEBUG"] == 0 || levels["INFO"] == 0 || levels["WARN"] == 0 {
+		t.Fatalf("records by level at debug: %v", levels)
+	}
+	if len(requests) == 0 {
+		t.Fatal("no request records at debug level")
+	}
+	sawCDN := false
+	for _, record := range requests {
+		url, _ := record["url"].(string)
+		sawCDN = sawCDN || strings.Contains(url, "cdn.test")
+		if strings.Contains(url, "cdn_signature") {
+			t.Errorf("signature logged: %s", url)
+		}
+		if _, ok := record["duration"]; !ok || record["status"] == nil {
+			t.Errorf("request record without status or duration: %v", record)
+		}
+	}
+	if !sawCDN {
+		t.Error("the redirect to the CDN was not logged")
+	}
+
+	corrupted.Store(false)
+	for _, record := range logRecords(t, hub, slog.LevelWarn) {
+		if level := record["level"]; level != "WARN" && level != "ERROR" {
+			t.Errorf("%s record logged at warn level: %v", level, record["msg"])
+		}
+	}
+}
+
+func TestLogRedactsSecrets(t *testing.T) {
+	var out bytes.Buffer
+	d := NewDownloader(WithLogger(slog.New(NewPlainHandler(&out, nil))))
+	d.logf("Error downloading https://cdn.test/x?X-Amz-Signature=abc&keep=1: Authorization: Bearer hf_secret\n")
+	if got := out.String(); strings.Contains(got, "abc") || strings.Contains(got, "hf_secret") || !strings.Contains(got, "keep=1") {
+		t.Fatalf("logged %q", got)
+	}
+}
+
+func TestPlainHandlerLevel(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(NewPlainHandler(&out, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn", "file", "a.bin")
+	logger.WithGroup("r2").Error("error", "key", "k")
+	if got, want := out.String(), "warn file=a.bin\nerror r2.key=k\n"; got != want {
+		t.Fatalf("logged %q, want %q", got, want)
+	}
+
+	for msg, want := range map[string]slog.Level{
+		"Error creating request":              slog.LevelError,
+		"❌ Error: failed":                     slog.LevelError,
+		"Worker 2 panicked: boom":             slog.LevelError,
+		"Warning: checksum mismatch":          slog.LevelWarn,
+		"⚠️  disk almost full":                slog.LevelWarn,
+		"Skipping config.json - not modified": slog.LevelInfo,
+	} {
+		if got := levelOf(msg); got != want {
+			t.Errorf("levelOf(%q) = %v, want %v", msg, got, want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package hfdownloader
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ManifestFileName is the manifest kept at the root of every local download,
+// recording what was fetched so later runs can make cheap skip decisions.
+const ManifestFileName = ".hfdownloader-manifest.json"
+
+// Signature check failures reported by Manifest.Verify.
+var (
+	ErrManifestUnsigned  = errors.New("manifest is not signed")
+	ErrManifestSignature = errors.New("manifest signature does not match")
+)
+
+// ManifestEntry describes one downloaded file.
+type ManifestEntry struct {
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256,omitempty"` // LFS files only
+	ETag      string    `json:"etag,omitempty"`
+	LocalPath string    `json:"local_path,omitempty"` // where the file is stored when renamed
+	QuickHash string    `json:"quick_hash,omitempty"` // hash of the size and both ends, see DownloadOptions.QuickVerify
+	Updated   time.Time `json:"updated"`
+}
+
+// Manifest maps repo paths to what is on disk for them.
+type Manifest struct {
+	Repo     string                   `json:"repo"`
+	Revision string                   `json:"revision"`
+	Commit   string                   `json:"commit,omitempty"` // commit the revision resolved to on the last run
+	Files    map[string]ManifestEntry `json:"files"`
+
+	// Signature is an HMAC-SHA256 over the rest of the manifest, see Sign. Any
+	// change clears it, so a modified manifest has to be signed again.
+	Signature string `json:"signature,omitempty"`
+
+	mu sync.Mutex
+}
+
+// LoadManifest reads the manifest in dir, returning an empty one if none exists.
+func LoadManifest(dir string) (*Manifest, error) {
+	m := &Manifest{Files: make(map[string]ManifestEntry)}
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %v", err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]ManifestEntry)
+	}
+	return m, nil
+}
+
+// Get returns the entry recorded for a repo path.
+func (m *Manifest) Get(filePath string) (ManifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.Files[filePath]
+	return entry, ok
+}
+
+// Set records the entry for a repo path.
+func (m *Manifest) Set(filePath string, entry ManifestEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Files[filePath] = entry
+	m.Signature = ""
+}
+
+// Delete forgets the entry for a repo path.
+func (m *Manifest) Delete(filePath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.Files, filePath)
+	m.Signature = ""
+}
+
+// SetRevision records which repo and revision the manifest describes.
+func (m *Manifest) SetRevision(repo, revision string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Repo != repo || m.Revision != revision {
+		m.Repo, m.Revision = repo, revision
+		m.Signature = ""
+	}
+}
+
+// SetCommit records the commit the revision resolved to.
+func (m *Manifest) SetCommit(commit string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Commit != commit {
+		m.Commit = commit
+		m.Signature = ""
+	}
+}
+
+// signature computes the HMAC of the manifest's canonical JSON: the signed
+// fields in declaration order with file paths sorted, which is how
+// encoding/json writes maps. The caller holds m.mu.
+func (m *Manifest) signature(key []byte) (string, error) {
+	canonical, err := json.Marshal(struct {
+		Repo     string                   `json:"repo"`
+		Revision string                   `json:"revision"`
+		Commit   string                   `json:"commit,omitempty"`
+		Files    map[string]ManifestEntry `json:"files"`
+	}{m.Repo, m.Revision, m.Commit, m.Files})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %v", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(canonical)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Sign sets the manifest's signature using key. It must be called again after
+// any change, before Save.
+func (m *Manifest) Sign(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sig, err := m.signature(key)
+	if err != nil {
+		return err
+	}
+	m.Signature = sig
+	return nil
+}
+
+// Verify checks the manifest's signature against key, returning
+// ErrManifestUnsigned or ErrManifestSignature when it can't be trusted.
+func (m *Manifest) Verify(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Signature == "" {
+		return ErrManifestUnsigned
+	}
+	sig, err := m.signature(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(sig), []byte(m.Signature)) {
+		return ErrManifestSignature
+	}
+	return nil
+}
+
+// WriteTo writes the manifest as indented JSON to w.
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode manifest: %v", err)
+	}
+	n, err := w.Write(data)
+	if err != nil {
+		return int64(n), fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return int64(n), nil
+}
+
+// Save writes the manifest into dir, replacing any previous one atomically.
+func (m *Manifest) Save(dir string) error {
+	f, err := createAtomic(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %v", err)
+	}
+	_, err = m.WriteTo(f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write manifest: %v", closeErr)
+	}
+	return err
+}
+
+// atomicFile is a file written under a temporary name and renamed into place
+// on Close, so readers never see half of it. A failed write discards it.
+type atomicFile struct {
+	f    *os.File
+	path string
+	err  error
+}
+
+// createAtomic starts writing path, creating its directory if needed.
+func createAtomic(path string) (*atomicFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{f: f, path: path}, nil
+}
+
+func (a *atomicFile) Write(p []byte) (int, error) {
+	n, err := a.f.Write(p)
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+	return n, err
+}
+
+// Close moves the file into place, or removes it if a write failed.
+func (a *atomicFile) Close() error {
+	err := a.f.Close()
+	if a.err != nil {
+		err = a.err
+	}
+	if err != nil {
+		os.Remove(a.f.Name())
+		return err
+	}
+	return os.Rename(a.f.Name(), a.path)
+}
+
+// objectWriter collects a small file, such as the manifest, and uploads it as
+// one object on Close, so it can stand in for a local file.
+type objectWriter struct {
+	bytes.Buffer
+	upload func(body io.Reader, size int64) error
+}
+
+// Close uploads everything written so far.
+func (o *objectWriter) Close() error {
+	return o.upload(bytes.NewReader(o.Bytes()), int64(o.Len()))
+}
+
+// checkManifestSignature warns when a manifest that should be signed with
+// opts.ManifestKey isn't, or was changed by someone without the key. The
+// manifest is still used; the warning is for the operator to act on.
+func (d *Downloader) checkManifestSignature(manifest *Manifest, modelPath string, opts DownloadOptions) {
+	if len(opts.ManifestKey) == 0 || len(manifest.Files) == 0 {
+		return
+	}
+	switch err := manifest.Verify(opts.ManifestKey); {
+	case errors.Is(err, ErrManifestSignature):
+		d.logf("\n⚠️  WARNING: the manifest in %s does not match its signature. It was modified without the manifest key and may have been tampered with; its skip decisions cannot be trusted.\n\n", modelPath)
+	case errors.Is(err, ErrManifestUnsigned):
+		d.logf("Warning: the manifest in %s is not signed\n", modelPath)
+	case err != nil:
+		d.logf("Warning: Failed to check manifest signature: %v\n", err)
+	}
+}
@@ -0,0 +1,61 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MirrorExtras lists the local files, as repo paths, that would have to be
+// deleted for opts.Storage to exactly mirror the remote revision. Only files the
+// path filters in opts select are considered, and the manifest, .part files and
+// the files the run writes itself are never listed. result is the Download that
+// just ran: its listing is used rather than asking the Hub again, unless the run
+// reused a saved file list, which only holds the selected files. The remote is
+// then listed afresh, and any folder failing to list fails MirrorExtras.
+func (d *Downloader) MirrorExtras(opts DownloadOptions, result *DownloadResult) ([]string, error) {
+	var remote []hfmodel
+	if result != nil && result.listed != nil {
+		remote = result.listed
+	} else {
+		var err error
+		if remote, err = d.enumerateFiles(opts); err != nil {
+			return nil, err
+		}
+	}
+	modelPath := repoDir(opts)
+	return localExtras(modelPath, remote, opts)
+}
+
+// RemoveLocalFiles deletes repo paths from the local copy, drops them from the
+// manifest and removes any directories left empty.
+func (d *Downloader) RemoveLocalFiles(opts DownloadOptions, paths []string) error {
+	modelPath := repoDir(opts)
+	manifest, err := LoadManifest(modelPath)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		localPath := filepath.Join(modelPath, filepath.FromSlash(p))
+		if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete %s: %v", localPath, err)
+		}
+		manifest.Delete(p)
+		d.logf("Deleted %s\n", p)
+
+		// Remove parents that are now empty, stopping at the first one that isn't
+		for dir := filepath.Dir(localPath); dir != modelPath && strings.HasPrefix(dir, modelPath); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	if opts.SignManifest {
+		if err := manifest.Sign(opts.ManifestKey); err != nil {
+			return err
+		}
+	}
+	return manifest.Save(modelPath)
+}
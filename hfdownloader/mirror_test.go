@@ -0,0 +1,100 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMirrorExtras(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":     {Content: `{"a":1}`},
+		"sub/weights.bin": {Content: "weights", LFS: true},
+	})
+	opts := hubOptions(t)
+	d, _ := hub.downloader()
+	result, err := d.Download(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modelPath := filepath.Join(opts.Storage, "o/m")
+	for _, p := range []string{"old.bin", "sub/old.txt"} {
+		if err := os.WriteFile(filepath.Join(modelPath, p), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listings := hub.hits("/tree/")
+	extras, err := d.MirrorExtras(opts, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(extras, ","); got != "old.bin,sub/old.txt" {
+		t.Fatalf("extras %q", got)
+	}
+	if hub.hits("/tree/") != listings {
+		t.Fatal("the repo was listed again instead of reusing the download's listing")
+	}
+
+	if err := d.RemoveLocalFiles(opts, extras); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"old.bin", "sub/old.txt"} {
+		if _, err := os.Stat(filepath.Join(modelPath, p)); !os.IsNotExist(err) {
+			t.Fatalf("%s still there: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(modelPath, "sub/weights.bin")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Files under a folder that fails to list must not be offered for deletion.
+func TestMirrorExtrasFailsOnUnlistedFolder(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":     {Content: `{"a":1}`},
+		"sub/weights.bin": {Content: "weights", LFS: true},
+	})
+	opts := hubOptions(t)
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	hub.fail = func(r *http.Request) int {
+		if strings.Contains(r.URL.Path, "/tree/") && strings.HasSuffix(r.URL.Path, "/sub") {
+			return http.StatusNotFound
+		}
+		return 0
+	}
+	if _, err := d.MirrorExtras(opts, nil); !errors.Is(err, ErrIncompleteListing) {
+		t.Fatalf("error %v, want ErrIncompleteListing", err)
+	}
+}
+
+// Files the run writes itself inside the download folder aren't extras.
+func TestMirrorExtrasKeepsOutputFiles(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: `{"a":1}`}})
+	opts := hubOptions(t)
+	modelPath := filepath.Join(opts.Storage, "o/m")
+	opts.Attestation = filepath.Join(modelPath, "attestation.json")
+	opts.ReportFiles = []string{filepath.Join(modelPath, "errors.json"), ""}
+	d, _ := hub.downloader()
+	result, err := d.Download(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(opts.ReportFiles[0], []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	extras, err := d.MirrorExtras(opts, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extras) != 0 {
+		t.Fatalf("extras %q, want none", extras)
+	}
+}
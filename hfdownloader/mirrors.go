@@ -0,0 +1,146 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mirrorAttempts is how often a file is requested from one mirror before the
+// next is tried, instead of the usual retry limit.
+const mirrorAttempts = 2
+
+// checkMirrors rejects mirror URLs that aren't plain http(s) base URLs.
+func checkMirrors(mirrors []string) error {
+	for _, mirror := range mirrors {
+		u, err := url.Parse(mirror)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid mirror %q, expected a base URL such as https://hf-mirror.com", mirror)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid mirror %q: no query or fragment allowed", mirror)
+		}
+	}
+	return nil
+}
+
+// mirrorSet spreads file downloads over DownloadOptions.Mirrors. Each file
+// tries the mirrors in turn, those that failed least often this run first, so
+// a mirror that keeps erroring is only used once the others have failed too.
+// Mirrors failing equally often are ordered by how fast they answered, so a
+// slow one drops back as well; one not tried yet counts as fast.
+type mirrorSet struct {
+	mu        sync.Mutex
+	bases     []string
+	hub       []bool // whether the mirror is the Hub itself and may get its token
+	requests  []int
+	failures  []int
+	succeeded []int
+	latency   []time.Duration // total over the successful requests
+}
+
+// mirrorLink is a file's resolve URL on one mirror; index is -1 for the Hub.
+type mirrorLink struct {
+	index int
+	url   string
+	hub   bool // the link is on the Hub's host
+}
+
+// newMirrorSet returns nil without mirrors, which links everything to the Hub.
+func newMirrorSet(mirrors []string) *mirrorSet {
+	if len(mirrors) == 0 {
+		return nil
+	}
+	m := &mirrorSet{
+		requests:  make([]int, len(mirrors)),
+		failures:  make([]int, len(mirrors)),
+		succeeded: make([]int, len(mirrors)),
+		latency:   make([]time.Duration, len(mirrors)),
+	}
+	for _, mirror := range mirrors {
+		m.bases = append(m.bases, strings.TrimSuffix(mirror, "/"))
+		m.hub = append(m.hub, sameHost(mirror, HubURL))
+	}
+	return m
+}
+
+// sameHost reports whether two URLs share scheme and host.
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && ua.Scheme == ub.Scheme && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// links rewrites a Hub resolve URL for each mirror, most reliable first.
+func (m *mirrorSet) links(link string) []mirrorLink {
+	if m == nil {
+		return []mirrorLink{{index: -1, url: link, hub: true}}
+	}
+	m.mu.Lock()
+	order := make([]int, len(m.bases))
+	for i := range order {
+		order[i] = i
+	}
+	// Compare failure rates and mean latencies without dividing: a/b < c/d is a*d < c*b
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		fi, fj := m.failures[i]*max(m.requests[j], 1), m.failures[j]*max(m.requests[i], 1)
+		if fi != fj {
+			return fi < fj
+		}
+		return m.latency[i]*time.Duration(max(m.succeeded[j], 1)) < m.latency[j]*time.Duration(max(m.succeeded[i], 1))
+	})
+	m.mu.Unlock()
+
+	path := strings.TrimPrefix(link, HubURL)
+	links := make([]mirrorLink, len(order))
+	for n, i := range order {
+		links[n] = mirrorLink{index: i, url: m.bases[i] + path, hub: m.hub[i]}
+	}
+	return links
+}
+
+// attempts is how often each link is requested before moving to the next.
+func (m *mirrorSet) attempts(usual int) int {
+	if m == nil || len(m.bases) == 1 {
+		return usual
+	}
+	return mirrorAttempts
+}
+
+// report records how a request to mirror index went and how long it took to
+// answer.
+func (m *mirrorSet) report(index int, err error, elapsed time.Duration) {
+	if m == nil || index < 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[index]++
+	if err != nil {
+		m.failures[index]++
+	} else {
+		m.succeeded[index]++
+		m.latency[index] += elapsed
+	}
+}
+
+// summary describes each mirror's failures, for the end of a run.
+func (m *mirrorSet) summary() []string {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lines := make([]string, len(m.bases))
+	for i, base := range m.bases {
+		lines[i] = fmt.Sprintf("%s: %d of %d requests failed", base, m.failures[i], m.requests[i])
+		if m.succeeded[i] > 0 {
+			lines[i] += fmt.Sprintf(", answered in %v on average", (m.latency[i] / time.Duration(m.succeeded[i])).Round(time.Millisecond))
+		}
+	}
+	return lines
+}
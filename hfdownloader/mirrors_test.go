@@ -0,0 +1,109 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var mirrorRepo = map[string]hubFile{
+	"a.bin":             {Content: "aaaa", LFS: true},
+	"b.bin":             {Content: "bbbb", LFS: true},
+	"model.safetensors": {Content: "weights", LFS: true},
+}
+
+func TestMirrorFailover(t *testing.T) {
+	hub := newFakeHub(t, mirrorRepo)
+	bad := newFakeHub(t, mirrorRepo)
+	bad.fail = func(r *http.Request) int { return http.StatusBadGateway }
+	good := newFakeHub(t, mirrorRepo)
+
+	opts := hubOptions(t)
+	opts.MaxWorkers = 1
+	opts.Mirrors = []string{bad.URL, good.URL}
+	opts.Token = "hf_secret"
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	for name, file := range mirrorRepo {
+		if got, err := os.ReadFile(filepath.Join(opts.Storage, "o", "m", name)); err != nil || string(got) != file.Content {
+			t.Errorf("%s = %q, %v", name, got, err)
+		}
+	}
+
+	// The first file gives up on the failing mirror after mirrorAttempts, and
+	// later files go to the working one first
+	if n := bad.hits("/resolve/"); n != mirrorAttempts {
+		t.Errorf("failing mirror got %d requests, want %d", n, mirrorAttempts)
+	}
+	if n := good.hits("/resolve/"); n != len(mirrorRepo) {
+		t.Errorf("working mirror got %d requests, want %d", n, len(mirrorRepo))
+	}
+	if n := hub.hits("/resolve/"); n != 0 {
+		t.Errorf("the Hub served %d files, want none", n)
+	}
+
+	// The token goes to the Hub's API, never to the mirrors
+	for _, r := range append(bad.requestsTo("/"), good.requestsTo("/")...) {
+		if r.Header.Get("Authorization") != "" {
+			t.Fatalf("token sent to mirror for %s", r.URL)
+		}
+	}
+	if r := hub.requestsTo("/api/"); len(r) == 0 || r[0].Header.Get("Authorization") != "Bearer hf_secret" {
+		t.Fatal("token not sent to the Hub")
+	}
+}
+
+func TestMirrorAuthOptIn(t *testing.T) {
+	hub := newFakeHub(t, mirrorRepo)
+	mirror := newFakeHub(t, mirrorRepo)
+	opts := hubOptions(t)
+	opts.Mirrors = []string{mirror.URL}
+	opts.Token = "hf_secret"
+	opts.MirrorAuth = true
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range mirror.requestsTo("/resolve/") {
+		if r.Header.Get("Authorization") != "Bearer hf_secret" {
+			t.Fatalf("token not sent to the trusted mirror for %s", r.URL)
+		}
+	}
+}
+
+func TestMirrorOrder(t *testing.T) {
+	m := newMirrorSet([]string{"https://slow.example", "https://flaky.example", "https://fast.example/", HubURL})
+	m.report(0, nil, 2*time.Second)
+	m.report(1, errors.New("502"), 0)
+	m.report(1, nil, time.Millisecond)
+	m.report(2, nil, 10*time.Millisecond)
+	m.report(2, nil, 30*time.Millisecond)
+
+	links := m.links(HubURL + "/o/m/resolve/main/a.bin")
+	var got []string
+	for _, link := range links {
+		got = append(got, link.url)
+	}
+	// Untried and fast mirrors first, then slow ones, failing ones last
+	want := []string{
+		HubURL + "/o/m/resolve/main/a.bin",
+		"https://fast.example/o/m/resolve/main/a.bin",
+		"https://slow.example/o/m/resolve/main/a.bin",
+		"https://flaky.example/o/m/resolve/main/a.bin",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("order %v, want %v", got, want)
+	}
+	for _, link := range links {
+		if link.hub != (link.index == 3) {
+			t.Errorf("%s: hub %v", link.url, link.hub)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package hfdownloader
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// MismatchPolicy is what happens when a downloaded file doesn't match the hash
+// the Hub published for it.
+type MismatchPolicy string
+
+const (
+	MismatchRetry  MismatchPolicy = "retry"  // download it again at once, then fail it
+	MismatchFail   MismatchPolicy = "fail"   // fail it without downloading it again
+	MismatchAccept MismatchPolicy = "accept" // keep what was downloaded without checking it
+)
+
+// DefaultMismatchRetries is how often MismatchRetry downloads a file again when
+// DownloadOptions.RedownloadCorrupted doesn't say.
+const DefaultMismatchRetries = 3
+
+// MismatchPolicies sets a MismatchPolicy per kind of file. LFS files are
+// checked against their SHA256 and regular files against their git blob id.
+// An empty policy keeps the default: LFS files fail, or are retried when
+// RedownloadCorrupted is set, and regular files are accepted, since small
+// files on a branch can legitimately change between listing and download.
+type MismatchPolicies struct {
+	LFS     MismatchPolicy
+	Regular MismatchPolicy
+}
+
+// ParseMismatchPolicies parses a comma-separated list of policies, e.g.
+// "retry", "lfs=retry,regular=fail" or "fail,regular=accept". A bare policy
+// applies to both kinds of file; a kind=policy entry overrides it.
+func ParseMismatchPolicies(value string) (MismatchPolicies, error) {
+	var policies MismatchPolicies
+	var lfs, regular MismatchPolicy
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kind, name, found := strings.Cut(part, "=")
+		if !found {
+			kind, name = "", kind
+		}
+		policy := MismatchPolicy(strings.ToLower(strings.TrimSpace(name)))
+		switch policy {
+		case MismatchRetry, MismatchFail, MismatchAccept:
+		default:
+			return MismatchPolicies{}, fmt.Errorf("invalid checksum mismatch policy %q, expected retry, fail or accept", name)
+		}
+		switch strings.ToLower(strings.TrimSpace(kind)) {
+		case "":
+			policies.LFS, policies.Regular = policy, policy
+		case "lfs":
+			lfs = policy
+		case "regular":
+			regular = policy
+		default:
+			return MismatchPolicies{}, fmt.Errorf("invalid checksum mismatch override %q, expected lfs= or regular=", part)
+		}
+	}
+	if lfs != "" {
+		policies.LFS = lfs
+	}
+	if regular != "" {
+		policies.Regular = regular
+	}
+	return policies, nil
+}
+
+// mismatchPolicy is the policy that applies to file under opts.
+func (opts DownloadOptions) mismatchPolicy(file hfmodel) MismatchPolicy {
+	if file.Lfs != nil {
+		switch {
+		case opts.SHAMismatch.LFS != "":
+			return opts.SHAMismatch.LFS
+		case opts.RedownloadCorrupted > 0:
+			return MismatchRetry
+		}
+		return MismatchFail
+	}
+	if opts.SHAMismatch.Regular != "" {
+		return opts.SHAMismatch.Regular
+	}
+	return MismatchAccept
+}
+
+// skipHashCheck reports whether file is taken as downloaded, unchecked.
+func (opts DownloadOptions) skipHashCheck(file hfmodel) bool {
+	return opts.SkipSHA || opts.mismatchPolicy(file) == MismatchAccept
+}
+
+// mismatchRetries is how often a file failing its hash check is downloaded again.
+func (opts DownloadOptions) mismatchRetries(file hfmodel) int {
+	if opts.mismatchPolicy(file) != MismatchRetry {
+		return 0
+	}
+	if opts.RedownloadCorrupted > 0 {
+		return opts.RedownloadCorrupted
+	}
+	return DefaultMismatchRetries
+}
+
+// newContentHash starts the hash checkContentHash compares for file: SHA256
+// for LFS files, the git blob id for regular ones.
+func newContentHash(file hfmodel) hash.Hash {
+	if file.Lfs != nil {
+		return sha256.New()
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", file.Size)
+	return h
+}
+
+// checkContentHash compares a hash from newContentHash, computed while
+// streaming, against what the Hub published for file. Files without a
+// published hash always pass.
+func checkContentHash(file hfmodel, h hash.Hash) error {
+	expected := file.Oid
+	if file.Lfs != nil {
+		expected = file.Lfs.Oid_SHA265
+	}
+	if expected == "" {
+		return nil
+	}
+	computed := hex.EncodeToString(h.Sum(nil))
+	if computed != expected {
+		return fmt.Errorf("%w for %s: computed %s, expected %s", ErrChecksumMismatch, file.Path, computed, expected)
+	}
+	return nil
+}
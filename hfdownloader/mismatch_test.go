@@ -0,0 +1,153 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRedownloadCorruptedRepairsTransfer(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: "weights", LFS: true}})
+	var served atomic.Int32
+	hub.corrupt = func(r *http.Request) bool { return served.Add(1) == 1 }
+	opts := hubOptions(t)
+	opts.RedownloadCorrupted = 2
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	got, err := os.ReadFile(filepath.Join(opts.Storage, "o", "m", "model.safetensors"))
+	if err != nil || string(got) != "weights" {
+		t.Fatalf("model.safetensors = %q, %v", got, err)
+	}
+	if n := hub.hits("/resolve/"); n != 2 {
+		t.Fatalf("%d downloads, want 2", n)
+	}
+	if !strings.Contains(out.String(), "downloading it again (1/2)") {
+		t.Fatalf("retry not logged:\n%s", out)
+	}
+}
+
+func TestRedownloadCorruptedGivesUp(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: "weights", LFS: true}})
+	hub.corrupt = func(r *http.Request) bool { return true }
+	opts := hubOptions(t)
+	opts.RedownloadCorrupted = 2
+	d, _ := hub.downloader()
+	_, err := d.Download(context.Background(), opts)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("error %v, want a checksum mismatch", err)
+	}
+	if n := hub.hits("/resolve/"); n != 3 {
+		t.Fatalf("%d downloads, want 3", n)
+	}
+	if _, err := os.Stat(filepath.Join(opts.Storage, "o", "m", "model.safetensors")); err == nil {
+		t.Fatal("corrupt copy kept")
+	}
+}
+
+// A run resumed from the saved file list must still know the git blob ids of
+// regular files to check them.
+func TestResumedRunChecksRegularFiles(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":       {Content: `{"a":1}`},
+		"model.safetensors": {Content: "weights", LFS: true},
+	})
+	hub.fail = func(r *http.Request) int {
+		if strings.HasSuffix(r.URL.Path, "/config.json") {
+			return http.StatusNotFound
+		}
+		return 0
+	}
+	opts := hubOptions(t)
+	opts.ContinueOnError = true
+	opts.SHAMismatch = MismatchPolicies{Regular: MismatchFail}
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err == nil {
+		t.Fatal("first run succeeded despite the failing file")
+	}
+
+	hub.fail = nil
+	hub.corrupt = func(r *http.Request) bool { return true }
+	d, out := hub.downloader()
+	_, err := d.Download(context.Background(), opts)
+	if !strings.Contains(out.String(), "Reusing the file list") {
+		t.Fatalf("second run did not resume from the saved state:\n%s", out)
+	}
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("error %v, want a checksum mismatch for config.json", err)
+	}
+}
+
+func TestSHAMismatchPolicies(t *testing.T) {
+	files := map[string]hubFile{
+		"model.safetensors": {Content: "weights", LFS: true},
+		"config.json":       {Content: `{"a":1}`},
+	}
+	for _, tc := range []struct {
+		policy string
+		err    bool
+		hits   map[string]int  // resolve requests per file
+		kept   map[string]bool // whether the corrupt copy is on disk
+	}{
+		{"retry", true, map[string]int{"model.safetensors": 1 + DefaultMismatchRetries, "config.json": 1 + DefaultMismatchRetries}, map[string]bool{}},
+		{"fail", true, map[string]int{"model.safetensors": 1, "config.json": 1}, map[string]bool{}},
+		{"accept", false, map[string]int{"model.safetensors": 1, "config.json": 1}, map[string]bool{"model.safetensors": true, "config.json": true}},
+		// Upstream may change a small file between listing and download, so take it as is
+		{"lfs=retry,regular=accept", true, map[string]int{"model.safetensors": 1 + DefaultMismatchRetries, "config.json": 1}, map[string]bool{"config.json": true}},
+		{"accept,lfs=fail", true, map[string]int{"model.safetensors": 1, "config.json": 1}, map[string]bool{"config.json": true}},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			hub := newFakeHub(t, files)
+			hub.corrupt = func(r *http.Request) bool { return true }
+			policies, err := ParseMismatchPolicies(tc.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := hubOptions(t)
+			opts.ContinueOnError = true
+			opts.SHAMismatch = policies
+			d, out := hub.downloader()
+			if _, err := d.Download(context.Background(), opts); (err != nil) != tc.err {
+				t.Fatalf("error %v, want one: %v\n%s", err, tc.err, out)
+			} else if err != nil && !errors.Is(err, ErrChecksumMismatch) {
+				t.Fatalf("error %v, want a checksum mismatch", err)
+			}
+			for name := range files {
+				if n := hub.hits("/resolve/main/" + name); n != tc.hits[name] {
+					t.Errorf("%s downloaded %d times, want %d", name, n, tc.hits[name])
+				}
+				_, err := os.Stat(filepath.Join(opts.Storage, "o", "m", name))
+				if kept := err == nil; kept != tc.kept[name] {
+					t.Errorf("%s kept = %v, want %v", name, kept, tc.kept[name])
+				}
+			}
+		})
+	}
+}
+
+func TestParseMismatchPolicies(t *testing.T) {
+	for value, want := range map[string]MismatchPolicies{
+		"":                         {},
+		"retry":                    {LFS: MismatchRetry, Regular: MismatchRetry},
+		"lfs=retry":                {LFS: MismatchRetry},
+		"regular=accept, lfs=FAIL": {LFS: MismatchFail, Regular: MismatchAccept},
+		"regular=fail,accept":      {LFS: MismatchAccept, Regular: MismatchFail},
+		"retry,lfs=accept,fail":    {LFS: MismatchAccept, Regular: MismatchFail},
+	} {
+		got, err := ParseMismatchPolicies(value)
+		if err != nil || got != want {
+			t.Errorf("ParseMismatchPolicies(%q) = %+v, %v; want %+v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"ignore", "lfs=", "git=retry", "lfs=retry,regular=maybe"} {
+		if _, err := ParseMismatchPolicies(value); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
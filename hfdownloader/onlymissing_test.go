@@ -0,0 +1,72 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOnlyMissing(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":       {Content: `{"a":1}`},
+		"model.safetensors": {Content: "weights", LFS: true},
+		"tokenizer.json":    {Content: `{"vocab":[]}`},
+		"README.md":         {Content: "# model"},
+	})
+	opts := hubOptions(t)
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	dir := filepath.Join(opts.Storage, "o", "m")
+
+	// Same-size edits would fail a hash or an ETag check; only-missing never looks
+	for name, content := range map[string]string{"config.json": `{"a":2}`, "model.safetensors": "WEIGHTS", "README.md": "# m"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Remove(filepath.Join(dir, "tokenizer.json"))
+
+	before := len(hub.requestsTo("/resolve/"))
+	opts.OnlyMissing = true
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	var fetched []string
+	for _, r := range hub.requestsTo("/resolve/")[before:] {
+		fetched = append(fetched, filepath.Base(r.URL.Path))
+		if r.Header.Get("If-None-Match") != "" {
+			t.Errorf("%s revalidated with only-missing", r.URL.Path)
+		}
+	}
+	// README.md is missing by size, tokenizer.json by name
+	if len(fetched) != 2 {
+		t.Fatalf("fetched %q, want just README.md and tokenizer.json", fetched)
+	}
+	for name, want := range map[string]string{"config.json": `{"a":2}`, "model.safetensors": "WEIGHTS", "README.md": "# model", "tokenizer.json": `{"vocab":[]}`} {
+		if got, _ := os.ReadFile(filepath.Join(dir, name)); string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	// Without it, the edited config is revalidated against its recorded ETag
+	opts.OnlyMissing = false
+	before = len(hub.requestsTo("/resolve/"))
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	revalidated := false
+	for _, r := range hub.requestsTo("/resolve/")[before:] {
+		revalidated = revalidated || (filepath.Base(r.URL.Path) == "config.json" && r.Header.Get("If-None-Match") != "")
+	}
+	if !revalidated {
+		t.Error("config.json was not revalidated without only-missing")
+	}
+
+	opts.OnlyMissing, opts.QuickVerify = true, true
+	if _, err := d.Download(context.Background(), opts); err == nil {
+		t.Error("only-missing combined with quick verify was accepted")
+	}
+}
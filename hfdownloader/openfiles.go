@@ -0,0 +1,69 @@
+package hfdownloader
+
+import "os"
+
+// openFileReserve is the share of the process file limit left for sockets,
+// source files and everything else once destination files are accounted for.
+const openFileReserve = 64
+
+// WithMaxOpenFiles bounds how many destination files are open at once,
+// independently of the worker count, for machines with a low `ulimit -n`.
+// Workers past the bound wait for a file to close before creating theirs. A
+// bound above what the process soft limit allows is clamped, with a warning.
+// Zero or less means no bound.
+func WithMaxOpenFiles(n int) Option {
+	return func(d *Downloader) {
+		d.maxOpenFiles = n
+	}
+}
+
+// initOpenFiles sizes the open-file semaphore, clamping maxOpenFiles to half
+// the soft limit so connections and the rest of the process keep room.
+func (d *Downloader) initOpenFiles() {
+	if d.maxOpenFiles <= 0 {
+		return
+	}
+	n := d.maxOpenFiles
+	if soft, ok := openFileLimit(); ok && uint64(n) > soft/2 {
+		n = int(soft / 2)
+		if n < 1 {
+			n = 1
+		}
+		d.openFilesClamped = true
+	}
+	d.openFiles = make(chan struct{}, n)
+}
+
+// checkOpenFileLimit warns when a download is likely to run into the process
+// file limit: either --max-open-files had to be clamped, or no bound is set
+// and every worker holding a file and a connection would exceed it.
+func (d *Downloader) checkOpenFileLimit(workers int) {
+	soft, ok := openFileLimit()
+	if !ok {
+		return
+	}
+	if d.openFilesClamped {
+		d.logf("Warning: max open files %d exceeds half the process limit of %d, using %d\n", d.maxOpenFiles, soft, cap(d.openFiles))
+		return
+	}
+	if d.openFiles == nil && uint64(workers)*2+openFileReserve > soft {
+		d.logf("Warning: %d workers may exceed the open file limit of %d; raise it with `ulimit -n` or set --max-open-files\n", workers, soft)
+	}
+}
+
+// createFile is os.Create for destination files, holding an open-file slot
+// until the returned release is called after the file is closed.
+func (d *Downloader) createFile(path string) (*os.File, func(), error) {
+	if d.openFiles == nil {
+		f, err := os.Create(path)
+		return f, func() {}, err
+	}
+	d.openFiles <- struct{}{}
+	release := func() { <-d.openFiles }
+	f, err := os.Create(path)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return f, release, nil
+}
@@ -0,0 +1,92 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// openFilesUnder counts this process's open file descriptors for files in dir.
+func openFilesUnder(dir string) (int, bool) {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	n := 0
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			n++
+		}
+	}
+	return n, true
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	storage := t.TempDir()
+	if _, ok := openFilesUnder(storage); !ok {
+		t.Skip("no /proc/self/fd to count open files")
+	}
+	files := map[string]hubFile{}
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("shard-%d.bin", i)] = hubFile{Content: strings.Repeat(fmt.Sprint(i), 8*1024), LFS: true}
+	}
+	hub := newFakeHub(t, files)
+	hub.pace = 2 * time.Millisecond
+
+	var peak atomic.Int64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(200 * time.Microsecond):
+			}
+			if n, _ := openFilesUnder(storage); int64(n) > peak.Load() {
+				peak.Store(int64(n))
+			}
+		}
+	}()
+
+	opts := hubOptions(t)
+	opts.Storage = storage
+	opts.MaxWorkers = 8
+	d, _ := hub.downloader(WithMaxOpenFiles(2))
+	_, err := d.Download(context.Background(), opts)
+	close(done)
+	<-sampled
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := peak.Load(); got > 2 || got == 0 {
+		t.Fatalf("peak of %d destination files open at once, want between 1 and 2", got)
+	}
+	if got := downloaded(t, filepath.Join(storage, "o", "m")); len(got) != 8 {
+		t.Fatalf("downloaded %v", got)
+	}
+}
+
+func TestMaxOpenFilesClampedToLimit(t *testing.T) {
+	soft, ok := openFileLimit()
+	if !ok {
+		t.Skip("no open file limit on this platform")
+	}
+	d, out := newFakeHub(t, nil).downloader(WithMaxOpenFiles(int(min(soft, 1<<30))))
+	if want := int(soft / 2); cap(d.openFiles) != max(want, 1) || !d.openFilesClamped {
+		t.Fatalf("bound %d, want it clamped to %d", cap(d.openFiles), want)
+	}
+	d.checkOpenFileLimit(4)
+	if !strings.Contains(out.String(), "exceeds half the process limit") {
+		t.Fatalf("clamp not reported:\n%s", out)
+	}
+	if d := NewDownloader(); d.openFiles != nil {
+		t.Fatal("open files bounded without WithMaxOpenFiles")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package hfdownloader
+
+import "syscall"
+
+// openFileLimit returns the soft RLIMIT_NOFILE of the process.
+func openFileLimit() (uint64, bool) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, false
+	}
+	return uint64(rlim.Cur), true
+}
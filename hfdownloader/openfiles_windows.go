@@ -0,0 +1,9 @@
+//go:build windows
+
+package hfdownloader
+
+// openFileLimit reports no limit: Windows has no per-process descriptor
+// ulimit, so there is nothing to clamp to.
+func openFileLimit() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,128 @@
+//go:build interactive
+
+package hfdownloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// CheckPicker reports whether PickFiles can run: it needs a terminal on stdin
+// and stdout.
+func CheckPicker() error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("the file picker needs a terminal on stdin and stdout")
+	}
+	return nil
+}
+
+// ErrSelectionAborted is returned when the file picker is left with q or Ctrl-C.
+var ErrSelectionAborted = errors.New("selection aborted")
+
+// PickFiles shows a checkbox list of files, e.g. from Enumerate, on the
+// terminal and returns the paths picked: arrows or j/k move, space toggles, a
+// toggles all, enter confirms and q or Ctrl-C aborts. Everything starts
+// selected, and a footer keeps the running total. Pass the result back as
+// DownloadOptions.Include to download just those files.
+func PickFiles(files []FileInfo) ([]string, error) {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the terminal: %v", err)
+	}
+	defer term.Restore(in, state)
+	fmt.Print("\x1b[?25l") // hide the cursor
+	defer fmt.Print("\x1b[?25h\x1b[2J\x1b[H")
+
+	selected := make([]bool, len(files))
+	for i := range selected {
+		selected[i] = true
+	}
+	cursor, top := 0, 0
+	key := make([]byte, 3)
+	for {
+		_, height, err := term.GetSize(out)
+		if err != nil || height < 5 {
+			height = 24
+		}
+		rows := height - 3
+		if cursor < top {
+			top = cursor
+		} else if cursor >= top+rows {
+			top = cursor - rows + 1
+		}
+		drawFilePicker(files, selected, cursor, top, rows)
+
+		n, err := os.Stdin.Read(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the keyboard: %v", err)
+		}
+		switch {
+		case n == 1 && (key[0] == 'q' || key[0] == 3): // 3 is Ctrl-C in raw mode
+			return nil, ErrSelectionAborted
+		case n == 1 && (key[0] == '\r' || key[0] == '\n'):
+			var chosen []string
+			for i, file := range files {
+				if selected[i] {
+					chosen = append(chosen, file.Path)
+				}
+			}
+			return chosen, nil
+		case n == 1 && key[0] == ' ' && len(files) > 0:
+			selected[cursor] = !selected[cursor]
+		case n == 1 && key[0] == 'a':
+			all := !allSelected(selected)
+			for i := range selected {
+				selected[i] = all
+			}
+		case (n == 1 && key[0] == 'k') || (n == 3 && key[0] == 0x1b && key[2] == 'A'):
+			if cursor > 0 {
+				cursor--
+			}
+		case (n == 1 && key[0] == 'j') || (n == 3 && key[0] == 0x1b && key[2] == 'B'):
+			if cursor < len(files)-1 {
+				cursor++
+			}
+		}
+	}
+}
+
+func allSelected(selected []bool) bool {
+	for _, s := range selected {
+		if !s {
+			return false
+		}
+	}
+	return true
+}
+
+// drawFilePicker redraws the list window starting at top, with a header and a
+// footer giving the running total of the selection.
+func drawFilePicker(files []FileInfo, selected []bool, cursor, top, rows int) {
+	var b strings.Builder
+	b.WriteString("\x1b[2J\x1b[H")
+	b.WriteString("Select files: ↑/↓ move, space toggle, a all, enter download, q quit\r\n")
+	for i := top; i < len(files) && i < top+rows; i++ {
+		pointer, box := "  ", "[ ]"
+		if i == cursor {
+			pointer = "> "
+		}
+		if selected[i] {
+			box = "[x]"
+		}
+		fmt.Fprintf(&b, "%s%s %-10s %s\r\n", pointer, box, FormatSize(files[i].Size), files[i].Path)
+	}
+	count, total := 0, int64(0)
+	for i, file := range files {
+		if selected[i] {
+			count++
+			total += file.Size
+		}
+	}
+	fmt.Fprintf(&b, "Selected %d of %d files, %s", count, len(files), FormatSize(total))
+	fmt.Print(b.String())
+}
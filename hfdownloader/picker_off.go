@@ -0,0 +1,22 @@
+//go:build !interactive
+
+package hfdownloader
+
+import "errors"
+
+// The file picker is only built with -tags interactive, keeping the terminal
+// handling out of headless builds.
+var errNoPicker = errors.New("the file picker is not available in this build, rebuild with -tags interactive")
+
+// ErrSelectionAborted is returned when the file picker is left with q or Ctrl-C.
+var ErrSelectionAborted = errors.New("selection aborted")
+
+// CheckPicker reports whether PickFiles can run.
+func CheckPicker() error {
+	return errNoPicker
+}
+
+// PickFiles lets the user pick files on the terminal; see the interactive build.
+func PickFiles(files []FileInfo) ([]string, error) {
+	return nil, errNoPicker
+}
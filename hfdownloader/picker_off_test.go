@@ -0,0 +1,17 @@
+//go:build !interactive
+
+package hfdownloader
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPickerNeedsTheInteractiveBuild(t *testing.T) {
+	if err := CheckPicker(); !errors.Is(err, errNoPicker) {
+		t.Fatalf("CheckPicker() = %v, want errNoPicker", err)
+	}
+	if chosen, err := PickFiles([]FileInfo{{Path: "config.json"}}); chosen != nil || !errors.Is(err, errNoPicker) {
+		t.Fatalf("PickFiles() = %v, %v, want errNoPicker", chosen, err)
+	}
+}
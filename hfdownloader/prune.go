@@ -0,0 +1,185 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PruneFile is a leftover file that prune can delete.
+type PruneFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Reason  string    `json:"reason"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// PruneReport lists what a prune would reclaim under a storage path.
+type PruneReport struct {
+	Files        []PruneFile         `json:"files"`
+	StaleEntries map[string][]string `json:"stale_entries"` // manifest directory to entries whose files are gone
+	Reclaimable  int64               `json:"reclaimable"`   // bytes freed by deleting Files
+}
+
+// ScanPrune looks under storage for leftovers that no download references any
+// more: partial .part files, half-written manifests, download state files in the
+// temp directory and manifest entries whose files were deleted. Files modified
+// within olderThan of now are left alone. Nothing is deleted; see Prune.
+func (d *Downloader) ScanPrune(storage string, olderThan time.Duration) (*PruneReport, error) {
+	cutoff := time.Now().Add(-olderThan)
+	report := &PruneReport{StaleEntries: make(map[string][]string)}
+
+	consider := func(p string, info fs.FileInfo, reason string) {
+		if info.ModTime().After(cutoff) {
+			return
+		}
+		report.Files = append(report.Files, PruneFile{Path: p, Size: info.Size(), Reason: reason, ModTime: info.ModTime()})
+		report.Reclaimable += info.Size()
+	}
+
+	err := filepath.WalkDir(storage, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, ".part"):
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			consider(p, info, "partial download")
+		case name == ManifestFileName+".tmp":
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			consider(p, info, "unfinished manifest write")
+		case name == StateFileName+".tmp":
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			consider(p, info, "unfinished state write")
+		case name == ManifestFileName:
+			stale, err := staleManifestEntries(filepath.Dir(p))
+			if err != nil {
+				return err
+			}
+			if len(stale) > 0 {
+				report.StaleEntries[filepath.Dir(p)] = stale
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %v", storage, err)
+	}
+
+	// Older versions kept resume state in the temp directory
+	stateDir := filepath.Join(os.TempDir(), "hfdownloader-state")
+	if entries, err := os.ReadDir(stateDir); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				consider(filepath.Join(stateDir, entry.Name()), info, "download state")
+			}
+		}
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Path < report.Files[j].Path })
+	return report, nil
+}
+
+// staleManifestEntries returns the manifest entries in dir whose files no longer
+// exist, including under their decompressed or renamed name.
+func staleManifestEntries(dir string) ([]string, error) {
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for p, entry := range manifest.Files {
+		if entry.LocalPath != "" {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(entry.LocalPath))); err == nil {
+				continue
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(p))); err == nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(strings.TrimSuffix(p, ".gz")))); err == nil {
+			continue
+		}
+		stale = append(stale, p)
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// PruneOptions controls how Prune treats the manifests it edits, matching the
+// manifest options of a download.
+type PruneOptions struct {
+	ManifestKey         []byte // key for SignManifest, and for checking a signed manifest before re-signing it
+	SignManifest        bool   // sign each edited manifest with ManifestKey
+	NoOverwriteManifest bool   // leave manifests alone, stale entries and all
+}
+
+// Prune deletes the files in report and drops its stale manifest entries. A
+// signed manifest is only edited when opts can sign it again, so pruning never
+// leaves behind a manifest that looks tampered with.
+func (d *Downloader) Prune(report *PruneReport, opts PruneOptions) error {
+	for _, file := range report.Files {
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete %s: %v", file.Path, err)
+		}
+		d.logf("Deleted %s\n", file.Path)
+	}
+
+	for dir, stale := range report.StaleEntries {
+		if opts.NoOverwriteManifest {
+			d.logf("Left %d stale manifest entries in %s, the manifest is not overwritten\n", len(stale), dir)
+			continue
+		}
+		manifest, err := LoadManifest(dir)
+		if err != nil {
+			return err
+		}
+		if manifest.Signature != "" {
+			if !opts.SignManifest {
+				d.logf("Warning: Left %d stale manifest entries in %s, the manifest is signed and --sign-manifest is not set\n", len(stale), dir)
+				continue
+			}
+			if err := manifest.Verify(opts.ManifestKey); err != nil {
+				d.logf("Warning: Left %d stale manifest entries in %s, not re-signing it: %v\n", len(stale), dir, err)
+				continue
+			}
+		}
+		for _, p := range stale {
+			manifest.Delete(p)
+		}
+		if opts.SignManifest {
+			if err := manifest.Sign(opts.ManifestKey); err != nil {
+				return err
+			}
+		}
+		if err := manifest.Save(dir); err != nil {
+			return err
+		}
+		d.logf("Removed %d stale manifest entries from %s\n", len(stale), dir)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package hfdownloader
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// staleManifest saves a manifest in a new folder with one entry whose file
+// exists and one whose file is gone, signed with key when it isn't nil.
+func staleManifest(t *testing.T, key []byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kept.bin"), []byte("kept"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{Repo: "o/m", Revision: "main", Files: map[string]ManifestEntry{
+		"kept.bin":    {Size: 4},
+		"deleted.bin": {Size: 7},
+	}}
+	if key != nil {
+		if err := manifest.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := manifest.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func pruneManifest(t *testing.T, dir string, opts PruneOptions) *Manifest {
+	t.Helper()
+	t.Setenv("TMPDIR", t.TempDir())
+	d := NewDownloader(WithOutput(io.Discard))
+	report, err := d.ScanPrune(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale := report.StaleEntries[dir]; len(stale) != 1 || stale[0] != "deleted.bin" {
+		t.Fatalf("stale entries %v, want [deleted.bin]", report.StaleEntries)
+	}
+	if err := d.Prune(report, opts); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func TestPruneUnsignedManifest(t *testing.T) {
+	manifest := pruneManifest(t, staleManifest(t, nil), PruneOptions{})
+	if _, ok := manifest.Get("deleted.bin"); ok || len(manifest.Files) != 1 {
+		t.Errorf("entries %v, want only kept.bin", manifest.Files)
+	}
+	if manifest.Signature != "" {
+		t.Errorf("unsigned manifest came back signed")
+	}
+}
+
+func TestPruneResignsManifest(t *testing.T) {
+	key := []byte("key")
+	manifest := pruneManifest(t, staleManifest(t, key), PruneOptions{ManifestKey: key, SignManifest: true})
+	if _, ok := manifest.Get("deleted.bin"); ok {
+		t.Errorf("stale entry kept")
+	}
+	if err := manifest.Verify(key); err != nil {
+		t.Errorf("pruned manifest: %v", err)
+	}
+}
+
+func TestPruneLeavesManifestsItCannotSign(t *testing.T) {
+	key := []byte("key")
+	for name, opts := range map[string]PruneOptions{
+		"no key":        {},
+		"wrong key":     {ManifestKey: []byte("other"), SignManifest: true},
+		"no overwrite":  {ManifestKey: key, SignManifest: true, NoOverwriteManifest: true},
+		"only checking": {ManifestKey: key},
+	} {
+		t.Run(name, func(t *testing.T) {
+			manifest := pruneManifest(t, staleManifest(t, key), opts)
+			if len(manifest.Files) != 2 {
+				t.Errorf("entries %v, want the manifest untouched", manifest.Files)
+			}
+			if err := manifest.Verify(key); err != nil {
+				t.Errorf("manifest no longer verifies: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrunePartFiles(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := t.TempDir()
+	old, fresh := filepath.Join(dir, "old.bin.part"), filepath.Join(dir, "fresh.bin.part")
+	for _, p := range []string{old, fresh} {
+		if err := os.WriteFile(p, []byte("partial"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	week := time.Now().Add(-7 * 24 * time.Hour)
+	if err := os.Chtimes(old, week, week); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDownloader(WithOutput(io.Discard))
+	report, err := d.ScanPrune(dir, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 1 || report.Files[0].Path != old || report.Reclaimable != int64(len("partial")) {
+		t.Fatalf("report %+v, want only %s", report, old)
+	}
+	if err := d.Prune(report, PruneOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("%s not deleted: %v", old, err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("%s, newer than the cutoff, was deleted: %v", fresh, err)
+	}
+}
@@ -0,0 +1,109 @@
+package hfdownloader
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultQuickVerifySize is how much of each end of a file QuickVerify hashes.
+const DefaultQuickVerifySize = 8 * 1024 * 1024
+
+// quickHash hashes the size of a file and its first and last sample bytes,
+// prefixed with the sample size so hashes taken with another size are
+// recognised as incomparable rather than different. Files no larger than two
+// samples are hashed whole.
+func quickHash(localPath string, sample int64) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", localPath, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %v", localPath, err)
+	}
+
+	hash := sha256.New()
+	binary.Write(hash, binary.BigEndian, info.Size())
+	if info.Size() <= 2*sample {
+		_, err = io.Copy(hash, f)
+	} else if _, err = io.CopyN(hash, f, sample); err == nil {
+		if _, err = f.Seek(-sample, io.SeekEnd); err == nil {
+			_, err = io.CopyN(hash, f, sample)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %v", localPath, err)
+	}
+	return strconv.FormatInt(sample, 10) + ":" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func quickVerifySize(opts DownloadOptions) int64 {
+	if opts.QuickVerifySize > 0 {
+		return opts.QuickVerifySize
+	}
+	return DefaultQuickVerifySize
+}
+
+// passesQuickCheck decides whether a local file of the right size can be kept
+// when resuming. Without QuickVerify, or without a quick hash recorded with the
+// same sample size, the size alone decides, as it always has.
+func (d *Downloader) passesQuickCheck(localPath string, file hfmodel, manifest *Manifest, opts DownloadOptions) bool {
+	if !opts.QuickVerify {
+		return true
+	}
+	entry, ok := manifest.Get(file.Path)
+	sample := quickVerifySize(opts)
+	if !ok || !strings.HasPrefix(entry.QuickHash, strconv.FormatInt(sample, 10)+":") {
+		return true
+	}
+	sum, err := quickHash(localPath, sample)
+	if err != nil {
+		d.logf("Warning: %v, downloading %s again\n", err, file.Path)
+		return false
+	}
+	if sum != entry.QuickHash {
+		d.logf("⚠️ %s failed the quick check, downloading it again\n", file.Path)
+		return false
+	}
+	return true
+}
+
+// verifyKeptFiles fully checks the files a QuickVerify run kept without
+// downloading. A file that fails is deleted, so the next run fetches it again,
+// and reported through fail; one that passes gets a quick hash for next time.
+func (d *Downloader) verifyKeptFiles(kept []hfmodel, modelPath string, manifest *Manifest, opts DownloadOptions, fail func(string, error)) {
+	if len(kept) == 0 {
+		return
+	}
+	d.logf("🔎 Fully verifying %d file(s) kept by the quick check\n", len(kept))
+	for _, file := range kept {
+		localName, _ := localPathFor(opts, file.Path)
+		localPath := filepath.Join(modelPath, localName)
+		same, err := sameContent(localPath, file, manifest, opts.SkipSHA)
+		if err != nil {
+			fail(file.Path, err)
+			continue
+		}
+		if !same {
+			if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+				d.logf("Warning: failed to delete %s: %v\n", localPath, err)
+			}
+			manifest.Delete(file.Path)
+			fail(file.Path, fmt.Errorf("%w for %s: it passed the quick check but not the full one and was deleted, the next run downloads it again", ErrChecksumMismatch, file.Path))
+			continue
+		}
+		if entry, ok := manifest.Get(file.Path); ok {
+			if entry.QuickHash, err = quickHash(localPath, quickVerifySize(opts)); err == nil {
+				manifest.Set(file.Path, entry)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package hfdownloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t testing.TB, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "model.safetensors")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestQuickHash(t *testing.T) {
+	content := "head" + strings.Repeat("-", 24) + "tail"
+	base, err := quickHash(writeFile(t, content), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name    string
+		content string
+		same    bool
+	}{
+		{"unchanged", content, true},
+		{"one byte longer", "head" + strings.Repeat("-", 25) + "tail", false},
+		{"truncated", "head" + strings.Repeat("-", 23) + "tail", false},
+		{"changed first bytes", "HEAD" + strings.Repeat("-", 24) + "tail", false},
+		{"changed last bytes", "head" + strings.Repeat("-", 24) + "TAIL", false},
+		// The heuristic's blind spot, left to the full check at the end
+		{"changed middle", "head" + strings.Repeat("+", 24) + "tail", true},
+	} {
+		sum, err := quickHash(writeFile(t, tc.content), 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (sum == base) != tc.same {
+			t.Errorf("%s: quick hash equal = %v, want %v", tc.name, sum == base, tc.same)
+		}
+	}
+
+	other, _ := quickHash(writeFile(t, content), 8)
+	if strings.HasPrefix(other, "4:") || other == base {
+		t.Fatalf("hash with another sample size looks comparable: %s", other)
+	}
+}
+
+func TestQuickVerify(t *testing.T) {
+	content := strings.Repeat("0123456789abcdef", 64)
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: content, LFS: true}})
+	opts := hubOptions(t)
+	opts.QuickVerify = true
+	opts.QuickVerifySize = 16
+	local := filepath.Join(opts.Storage, "o", "m", "model.safetensors")
+	download := func() error {
+		d, _ := hub.downloader()
+		_, err := d.Download(context.Background(), opts)
+		return err
+	}
+	if err := download(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A change at either end is caught before deciding to keep the file
+	os.WriteFile(local, []byte(content[:len(content)-1]+"X"), 0644)
+	if err := download(); err != nil {
+		t.Fatal(err)
+	}
+	if hub.hits("/resolve/") != 2 {
+		t.Fatalf("file with a changed tail was kept")
+	}
+	if got, _ := os.ReadFile(local); string(got) != content {
+		t.Fatal("file not restored")
+	}
+
+	// A change in the middle passes the quick check but not the final full one
+	os.WriteFile(local, []byte(content[:100]+"X"+content[101:]), 0644)
+	err := download()
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("err = %v, want the full check to fail", err)
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Fatalf("corrupt file kept: %v", err)
+	}
+}
+
+// benchmarkFile is a 64MB file for the hashing benchmarks.
+func benchmarkFile(b *testing.B) string {
+	b.Helper()
+	return writeFile(b, strings.Repeat("x", 64<<20))
+}
+
+func BenchmarkQuickHash(b *testing.B) {
+	path := benchmarkFile(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := quickHash(path, 1<<20); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFullHash(b *testing.B) {
+	path := benchmarkFile(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(sha256.New(), f)
+		f.Close()
+	}
+}
@@ -0,0 +1,161 @@
+package hfdownloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// lfsFile is an LFS file of the given content, as the tree API lists it.
+func lfsFile(path, content string) hfmodel {
+	sum := sha256.Sum256([]byte(content))
+	return hfmodel{Path: path, Size: len(content), Lfs: &hflfs{Oid_SHA265: hex.EncodeToString(sum[:]), Size: int64(len(content))}}
+}
+
+func TestSkipLocalStreamsToR2(t *testing.T) {
+	bucket := newFakeBucket(t, nil)
+	d := NewDownloader(WithOutput(io.Discard))
+	storage := t.TempDir()
+	for path, content := range map[string]string{"model.safetensors": "weights", "config.json": `{"a":1}`} {
+		file := lfsFile(path, content)
+		key := "hf_dataset/" + path
+		var uploaded atomic.Int64
+		if err := d.transferFile(context.Background(), strings.NewReader(content), file, filepath.Join(storage, path), bucket.config(), key, true, false, &uploaded); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := bucket.object(key); !ok || got != content {
+			t.Errorf("%s = %q, %v; want %q", key, got, ok, content)
+		}
+		if uploaded.Load() != int64(len(content)) {
+			t.Errorf("%s: %d bytes counted as uploaded, want %d", key, uploaded.Load(), len(content))
+		}
+	}
+	// Nothing was staged on disk, not even a .part file
+	filepath.WalkDir(storage, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			t.Errorf("local file %s left with skipLocal", path)
+		}
+		return nil
+	})
+}
+
+func TestSkipLocalRemovesMismatchedUpload(t *testing.T) {
+	bucket := newFakeBucket(t, nil)
+	d := NewDownloader(WithOutput(io.Discard))
+	file := lfsFile("model.safetensors", "weights")
+	err := d.transferFile(context.Background(), strings.NewReader("wEights"), file, filepath.Join(t.TempDir(), file.Path), bucket.config(), "hf_dataset/model.safetensors", true, false, new(atomic.Int64))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("error %v, want a checksum mismatch", err)
+	}
+	if _, ok := bucket.object("hf_dataset/model.safetensors"); ok {
+		t.Fatal("mismatched upload kept in the bucket")
+	}
+}
+
+func TestTeeWritesLocallyAndToR2(t *testing.T) {
+	files := map[string]hubFile{
+		"model.safetensors": {Content: strings.Repeat("weights", 4096), LFS: true},
+		"config.json":       {Content: `{"a":1}`},
+	}
+	hub := newFakeHub(t, files)
+	bucket := newFakeBucket(t, nil)
+	opts := hubOptions(t)
+	opts.R2 = bucket.config()
+	opts.Tee = true
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	for name, file := range files {
+		local, err := os.ReadFile(filepath.Join(opts.Storage, "o", "m", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uploaded, ok := bucket.object("hf_dataset/" + name)
+		if !ok {
+			t.Fatalf("%s was not uploaded", name)
+		}
+		if string(local) != file.Content || uploaded != file.Content {
+			t.Errorf("%s: local %d bytes and uploaded %d bytes, want the same %d bytes", name, len(local), len(uploaded), len(file.Content))
+		}
+		// One pass over the body feeds both destinations
+		if n := hub.hits("/resolve/main/" + name); n != 1 {
+			t.Errorf("%s fetched %d times, want once", name, n)
+		}
+	}
+}
+
+func TestTeeNeedsR2AndLocalCopy(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: `{"a":1}`}})
+	bucket := newFakeBucket(t, nil)
+	d, _ := hub.downloader()
+
+	opts := hubOptions(t)
+	opts.Tee = true
+	if _, err := d.Download(context.Background(), opts); err == nil {
+		t.Error("tee without R2 was accepted")
+	}
+	opts.R2 = bucket.config()
+	opts.SkipLocal = true
+	if _, err := d.Download(context.Background(), opts); err == nil {
+		t.Error("tee with skip-local was accepted")
+	}
+	if hub.hits("/resolve/") != 0 {
+		t.Error("a rejected tee download still fetched files")
+	}
+}
+
+func TestSkipLocalUploadsManifest(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"model.safetensors": {Content: "weights", LFS: true},
+		"config.json":       {Content: `{"a":1}`},
+	})
+	bucket := newFakeBucket(t, nil)
+	opts := hubOptions(t)
+	opts.R2 = bucket.config()
+	opts.SkipLocal = true
+	opts.Attestation = filepath.Join(opts.Storage, "attestation.json")
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	data, ok := bucket.object("hf_dataset/" + ManifestFileName)
+	if !ok {
+		t.Fatal("manifest not uploaded with skip-local")
+	}
+	var manifest Manifest
+	if err := json.Unmarshal([]byte(data), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Repo != "o/m" || manifest.Commit != testCommit || len(manifest.Files) != 2 {
+		t.Fatalf("uploaded manifest for %s@%s with %d files", manifest.Repo, manifest.Commit, len(manifest.Files))
+	}
+	if entry := manifest.Files["model.safetensors"]; entry.SHA256 != sha256Hex("weights") || entry.Size != 7 {
+		t.Errorf("model.safetensors entry %+v", entry)
+	}
+
+	data, ok = bucket.object("hf_dataset/attestation.json")
+	if !ok {
+		t.Fatal("attestation not uploaded with skip-local")
+	}
+	var attestation Attestation
+	if err := json.Unmarshal([]byte(data), &attestation); err != nil || attestation.Commit != testCommit || len(attestation.Files) != 2 {
+		t.Fatalf("uploaded attestation %+v, %v", attestation, err)
+	}
+	filepath.WalkDir(opts.Storage, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			t.Errorf("local file %s left with SkipLocal", path)
+		}
+		return nil
+	})
+}
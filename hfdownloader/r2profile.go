@@ -0,0 +1,96 @@
+package hfdownloader
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// R2Credentials are the R2 settings found in a shared credentials profile. Any
+// field may be empty if the profile doesn't set it.
+type R2Credentials struct {
+	AccountID       string
+	AccessKeyID     string
+	AccessKeySecret string
+}
+
+// SharedCredentialsFile returns the AWS shared credentials file, honouring
+// AWS_SHARED_CREDENTIALS_FILE like the AWS tooling does.
+func SharedCredentialsFile() (string, error) {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); path != "" {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".aws", "credentials"), nil
+}
+
+// LoadR2Profile reads a profile from an AWS-style credentials file. Besides the
+// standard aws_access_key_id and aws_secret_access_key keys, the account ID is
+// taken from account_id (or r2_account_id), or else from an
+// endpoint_url of the form https://<account>.r2.cloudflarestorage.com.
+func LoadR2Profile(path string, profile string) (*R2Credentials, error) {
+	values, err := readINISection(path, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := &R2Credentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		AccessKeySecret: values["aws_secret_access_key"],
+		AccountID:       values["account_id"],
+	}
+	if creds.AccountID == "" {
+		creds.AccountID = values["r2_account_id"]
+	}
+	if creds.AccountID == "" && values["endpoint_url"] != "" {
+		if u, err := url.Parse(values["endpoint_url"]); err == nil && strings.HasSuffix(u.Hostname(), ".r2.cloudflarestorage.com") {
+			creds.AccountID = strings.TrimSuffix(u.Hostname(), ".r2.cloudflarestorage.com")
+		}
+	}
+	return creds, nil
+}
+
+// readINISection returns the key/value pairs of one [section] of an INI file.
+func readINISection(path string, section string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open credentials file: %v", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	found, inSection := false, false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			// ~/.aws/config spells non-default sections "profile name"
+			inSection = name == section || name == "profile "+section
+			found = found || inSection
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %v", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("profile %q not found in %s", section, path)
+	}
+	return values, nil
+}
@@ -0,0 +1,70 @@
+package hfdownloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleCredentials = `# shared by the AWS CLI
+[default]
+aws_access_key_id = AKIADEFAULT
+aws_secret_access_key = default-secret
+
+[r2]
+aws_access_key_id=r2-key
+aws_secret_access_key=r2-secret
+account_id = acct123
+
+[profile legacy]
+; config-file spelling
+AWS_ACCESS_KEY_ID = legacy-key
+aws_secret_access_key = legacy-secret
+r2_account_id = acct456
+
+[endpoint]
+aws_access_key_id = endpoint-key
+aws_secret_access_key = endpoint-secret
+endpoint_url = https://acct789.r2.cloudflarestorage.com
+`
+
+func TestLoadR2Profile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte(sampleCredentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		profile string
+		want    R2Credentials
+	}{
+		{"default", R2Credentials{AccessKeyID: "AKIADEFAULT", AccessKeySecret: "default-secret"}},
+		{"r2", R2Credentials{AccountID: "acct123", AccessKeyID: "r2-key", AccessKeySecret: "r2-secret"}},
+		{"legacy", R2Credentials{AccountID: "acct456", AccessKeyID: "legacy-key", AccessKeySecret: "legacy-secret"}},
+		{"endpoint", R2Credentials{AccountID: "acct789", AccessKeyID: "endpoint-key", AccessKeySecret: "endpoint-secret"}},
+	} {
+		got, err := LoadR2Profile(path, tc.profile)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.profile, err)
+		}
+		if *got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.profile, *got, tc.want)
+		}
+	}
+
+	if _, err := LoadR2Profile(path, "missing"); err == nil || !strings.Contains(err.Error(), `profile "missing" not found`) {
+		t.Fatalf("err = %v for a missing profile", err)
+	}
+}
+
+func TestSharedCredentialsFile(t *testing.T) {
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/etc/hf/credentials")
+	if got, _ := SharedCredentialsFile(); got != "/etc/hf/credentials" {
+		t.Fatalf("got %s, want AWS_SHARED_CREDENTIALS_FILE", got)
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "")
+	t.Setenv("HOME", "/home/hf")
+	if got, _ := SharedCredentialsFile(); got != filepath.Join("/home/hf", ".aws", "credentials") {
+		t.Fatalf("got %s, want ~/.aws/credentials", got)
+	}
+}
@@ -0,0 +1,96 @@
+package hfdownloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ParseRenames builds the rename map from repo paths to the paths they are
+// stored under locally, from a JSON object file (when mapFile is set) and
+// "src=dst" specs. No-op renames are dropped. Targets must stay inside the
+// download folder and no two files may end up at one path.
+func ParseRenames(mapFile string, specs []string) (map[string]string, error) {
+	renames := make(map[string]string, len(specs))
+	if mapFile != "" {
+		data, err := os.ReadFile(mapFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rename map: %v", err)
+		}
+		if err := json.Unmarshal(data, &renames); err != nil {
+			return nil, fmt.Errorf("invalid rename map %s: %v", mapFile, err)
+		}
+	}
+	for _, spec := range specs {
+		src, dst, ok := strings.Cut(spec, "=")
+		src, dst = strings.TrimSpace(src), strings.TrimSpace(dst)
+		if !ok || src == "" || dst == "" {
+			return nil, fmt.Errorf("invalid rename %q: expected src=dst", spec)
+		}
+		if _, dup := renames[src]; dup {
+			return nil, fmt.Errorf("invalid rename %q: %s is renamed twice", spec, src)
+		}
+		renames[src] = dst
+	}
+	if err := ValidateRenames(renames); err != nil {
+		return nil, err
+	}
+	for src, dst := range renames {
+		if src == dst {
+			delete(renames, src)
+		}
+	}
+	return renames, nil
+}
+
+// ValidateRenames checks a rename map, e.g. one loaded from a config file:
+// targets must be relative paths inside the download folder and no two sources
+// may share one. Collisions with repo files that keep their own name can only
+// be found once the repo is listed, see checkRenameCollisions.
+func ValidateRenames(renames map[string]string) error {
+	claimed := make(map[string]string, len(renames))
+	for _, src := range sortedKeys(renames) {
+		dst := renames[src]
+		if dst != path.Clean(dst) || !filepath.IsLocal(filepath.FromSlash(dst)) {
+			return fmt.Errorf("invalid rename %s=%s: target must be a clean relative path inside the download folder", src, dst)
+		}
+		if other, ok := claimed[dst]; ok {
+			return fmt.Errorf("invalid rename: %s and %s are both renamed to %s", other, src, dst)
+		}
+		claimed[dst] = src
+	}
+	return nil
+}
+
+// checkRenameCollisions fails when two selected files would be stored under the
+// same local path, e.g. a rename target that is also a file in the repo.
+func checkRenameCollisions(files []hfmodel, opts DownloadOptions) error {
+	if len(opts.Rename) == 0 {
+		return nil
+	}
+	stored := make(map[string]string, len(files))
+	for _, file := range files {
+		if file.FilterSkip || file.IsDirectory {
+			continue
+		}
+		localName, _ := localPathFor(opts, file.Path)
+		if other, ok := stored[localName]; ok {
+			return fmt.Errorf("rename collision: %s and %s would both be stored as %s", other, file.Path, localName)
+		}
+		stored[localName] = file.Path
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRenames(t *testing.T) {
+	renames, err := ParseRenames("", []string{
+		"model-00001-of-00001.safetensors=model.safetensors",
+		"config.json=config.json",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renames) != 1 || renames["model-00001-of-00001.safetensors"] != "model.safetensors" {
+		t.Fatalf("renames %v, want the shard renamed and the no-op dropped", renames)
+	}
+
+	for _, specs := range [][]string{
+		{"a.bin=../a.bin"},
+		{"a.bin=/tmp/a.bin"},
+		{"a.bin=x/../a.bin"},
+		{"a.bin=c.bin", "b.bin=c.bin"},
+		{"a.bin=b.bin", "a.bin=c.bin"},
+		{"a.bin"},
+	} {
+		if _, err := ParseRenames("", specs); err == nil {
+			t.Errorf("ParseRenames(%q) succeeded", specs)
+		}
+	}
+}
+
+func TestDownloadRenames(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"model-00001-of-00001.safetensors": {Content: "weights", LFS: true},
+		"tokenizer/vocab.txt":              {Content: "a\nb\n"},
+		"config.json":                      {Content: `{"a":1}`},
+	})
+	opts := hubOptions(t)
+	opts.Rename = map[string]string{
+		"model-00001-of-00001.safetensors": "model.safetensors",
+		"tokenizer/vocab.txt":              "vocab.txt",
+	}
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	dir := filepath.Join(opts.Storage, "o", "m")
+	for name, content := range map[string]string{"model.safetensors": "weights", "vocab.txt": "a\nb\n", "config.json": `{"a":1}`} {
+		if got, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v", name, got, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "model-00001-of-00001.safetensors")); err == nil {
+		t.Error("renamed file also stored under its repo path")
+	}
+}
+
+func TestDownloadRenameCollision(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"model-00001-of-00001.safetensors": {Content: "weights", LFS: true},
+		"model.safetensors":                {Content: "other", LFS: true},
+	})
+	opts := hubOptions(t)
+	opts.Rename = map[string]string{"model-00001-of-00001.safetensors": "model.safetensors"}
+	d, _ := hub.downloader()
+	_, err := d.Download(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "rename collision") {
+		t.Fatalf("error %v, want a rename collision", err)
+	}
+	if hub.hits("/resolve/") != 0 {
+		t.Fatal("files downloaded despite the collision")
+	}
+}
@@ -0,0 +1,62 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// RepoType is the kind of Hub repo being downloaded. Only the repo-type segment
+// of the Hub URLs differs between them.
+type RepoType string
+
+const (
+	RepoModel   RepoType = "model"
+	RepoDataset RepoType = "dataset"
+	RepoSpace   RepoType = "space"
+)
+
+// repoType returns opts.RepoType, falling back to IsDataset when it is unset.
+func (opts DownloadOptions) repoType() RepoType {
+	if opts.RepoType != "" {
+		return opts.RepoType
+	}
+	if opts.IsDataset {
+		return RepoDataset
+	}
+	return RepoModel
+}
+
+// pickURL returns the URL template for a repo type.
+func (t RepoType) pickURL(model, dataset, space string) string {
+	switch t {
+	case RepoDataset:
+		return dataset
+	case RepoSpace:
+		return space
+	}
+	return model
+}
+
+// RepoFolder is the folder a repo's files go in under the storage path: its
+// "org/name" id with any ":filter" suffix dropped, so two repos never share a
+// folder and their config.json files can't collide. Ids without an org, such
+// as "gpt2", get a folder of their own as well. Ids that are empty, have more
+// than two parts or would point outside the storage path are rejected.
+func RepoFolder(repo string) (string, error) {
+	id, _, _ := strings.Cut(repo, ":")
+	parts := strings.Split(id, "/")
+	if id == "" || len(parts) > 2 || strings.Contains(id, "\\") {
+		return "", fmt.Errorf("invalid repo name %q, expected org/name", repo)
+	}
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid repo name %q, expected org/name", repo)
+		}
+	}
+	folder := filepath.FromSlash(id)
+	if !filepath.IsLocal(folder) {
+		return "", fmt.Errorf("invalid repo name %q, expected org/name", repo)
+	}
+	return folder, nil
+}
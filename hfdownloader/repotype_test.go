@@ -0,0 +1,79 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadLinkPerRepoType(t *testing.T) {
+	for _, tc := range []struct {
+		opts DownloadOptions
+		want string
+	}{
+		{DownloadOptions{Repo: "o/m", Branch: "main"}, "https://huggingface.co/o/m/resolve/main/config.json?download=true"},
+		{DownloadOptions{Repo: "o/m", Branch: "main", IsDataset: true}, "https://huggingface.co/datasets/o/m/resolve/main/config.json?download=true"},
+		{DownloadOptions{Repo: "o/m", Branch: "main", RepoType: RepoDataset}, "https://huggingface.co/datasets/o/m/resolve/main/config.json?download=true"},
+		{DownloadOptions{Repo: "o/m", Branch: "v1", RepoType: RepoSpace}, "https://huggingface.co/spaces/o/m/resolve/v1/config.json?download=true"},
+	} {
+		if got := downloadLink(tc.opts, "config.json"); got != tc.want {
+			t.Errorf("%s repo: got %s, want %s", tc.opts.repoType(), got, tc.want)
+		}
+	}
+}
+
+func TestDownloadSpace(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"app.py":           {Content: "import gradio"},
+		"requirements.txt": {Content: "gradio"},
+		"assets/logo.png":  {Content: "png", LFS: true},
+	})
+	opts := hubOptions(t)
+	opts.RepoType = RepoSpace
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if hub.hits("/api/spaces/o/m/tree/main") == 0 || hub.hits("/api/models/") > 0 {
+		t.Fatal("Space not listed through the spaces API")
+	}
+	for _, name := range []string{"app.py", "requirements.txt", "assets/logo.png"} {
+		if hub.hits("/spaces/o/m/resolve/main/"+name) != 1 {
+			t.Errorf("%s not fetched through the spaces resolve URL", name)
+		}
+		if _, err := os.Stat(filepath.Join(opts.Storage, "o", "m", filepath.FromSlash(name))); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRepoFolder(t *testing.T) {
+	for _, tc := range []struct {
+		repo, want string
+	}{
+		{"o/m", filepath.Join("o", "m")},
+		{"TheBloke/Llama-2-7B-GGUF", filepath.Join("TheBloke", "Llama-2-7B-GGUF")},
+		{"org/name.with-dots_v1.5", filepath.Join("org", "name.with-dots_v1.5")},
+		{"org/m:q4_0,q5_k", filepath.Join("org", "m")},
+		{"gpt2", "gpt2"},
+		{"user/..hidden", filepath.Join("user", "..hidden")},
+	} {
+		got, err := RepoFolder(tc.repo)
+		if err != nil || got != tc.want {
+			t.Errorf("RepoFolder(%q) = %q, %v; want %q", tc.repo, got, err, tc.want)
+		}
+	}
+	for _, repo := range []string{"", ":filter", "o/", "/m", "o//m", "a/b/c", "../m", "o/..", "o/.", `o\m`, `..\..\etc`} {
+		if got, err := RepoFolder(repo); err == nil {
+			t.Errorf("RepoFolder(%q) = %q, want an error", repo, got)
+		}
+	}
+
+	// Two repos in one storage folder never share a file
+	a, _ := RepoFolder("org-a/model")
+	b, _ := RepoFolder("org-b/model")
+	if filepath.Join(a, "config.json") == filepath.Join(b, "config.json") {
+		t.Fatal("repos with the same name under different orgs collide")
+	}
+}
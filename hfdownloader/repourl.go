@@ -0,0 +1,103 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RepoRef is what a Hub page URL points at.
+type RepoRef struct {
+	Repo     string   // org/name, or just name for the few repos without an org
+	Type     RepoType // from the datasets/ or spaces/ prefix, RepoModel otherwise
+	Revision string   // branch, tag or commit from a tree/blob/resolve URL, empty when the URL has none
+	Path     string   // repo path after the revision, empty for the repo root
+	IsFile   bool     // Path is a file (blob or resolve URL) rather than a folder (tree URL)
+}
+
+// hubHosts are the hosts ParseRepoURL accepts.
+var hubHosts = map[string]bool{"huggingface.co": true, "www.huggingface.co": true, "hf.co": true}
+
+// ParseRepoURL decomposes a URL copied from the Hub, such as
+// https://huggingface.co/org/model/tree/main or
+// https://huggingface.co/datasets/org/data/resolve/v1/train.csv?download=true.
+// ok is false when s is not a URL at all, e.g. a plain "org/model" id; a URL
+// that doesn't point at a Hub repo is an error. Query strings, fragments and
+// trailing slashes are ignored.
+func ParseRepoURL(s string) (ref RepoRef, ok bool, err error) {
+	raw := s
+	if !strings.Contains(raw, "://") {
+		host, _, _ := strings.Cut(raw, "/")
+		if !hubHosts[strings.ToLower(host)] {
+			return RepoRef{}, false, nil
+		}
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return RepoRef{}, true, fmt.Errorf("invalid repo URL %q: %v", s, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || !hubHosts[strings.ToLower(u.Hostname())] {
+		return RepoRef{}, true, fmt.Errorf("invalid repo URL %q: not a huggingface.co URL", s)
+	}
+
+	// Split the escaped path so a revision like refs%2Fpr%2F1 stays one segment
+	var parts []string
+	for _, part := range strings.Split(u.EscapedPath(), "/") {
+		if part == "" {
+			continue
+		}
+		part, err := url.PathUnescape(part)
+		if err != nil {
+			return RepoRef{}, true, fmt.Errorf("invalid repo URL %q: %v", s, err)
+		}
+		parts = append(parts, part)
+	}
+
+	ref.Type = RepoModel
+	if len(parts) > 0 {
+		switch parts[0] {
+		case "datasets":
+			ref.Type, parts = RepoDataset, parts[1:]
+		case "spaces":
+			ref.Type, parts = RepoSpace, parts[1:]
+		}
+	}
+
+	// org/name, or name alone when the next segment is a view such as tree/main
+	nameParts := 2
+	if len(parts) == 1 || (len(parts) >= 3 && isRepoView(parts[1]) && !isRepoView(parts[2])) {
+		nameParts = 1
+	}
+	if len(parts) < nameParts {
+		return RepoRef{}, true, fmt.Errorf("invalid repo URL %q: no repo name in it", s)
+	}
+	ref.Repo = strings.Join(parts[:nameParts], "/")
+	if _, err := RepoFolder(ref.Repo); err != nil {
+		return RepoRef{}, true, fmt.Errorf("invalid repo URL %q: %v", s, err)
+	}
+
+	rest := parts[nameParts:]
+	if len(rest) == 0 {
+		return ref, true, nil
+	}
+	if !isRepoView(rest[0]) {
+		return RepoRef{}, true, fmt.Errorf("invalid repo URL %q: expected tree, blob or resolve after the repo name, got %q", s, rest[0])
+	}
+	if len(rest) < 2 {
+		return RepoRef{}, true, fmt.Errorf("invalid repo URL %q: no revision after %s", s, rest[0])
+	}
+	ref.Revision = rest[1]
+	ref.Path = strings.Join(rest[2:], "/")
+	ref.IsFile = rest[0] != "tree" && ref.Path != ""
+	return ref, true, nil
+}
+
+// isRepoView reports whether a URL segment selects a view of a repo revision.
+func isRepoView(segment string) bool {
+	switch segment {
+	case "tree", "blob", "resolve":
+		return true
+	}
+	return false
+}
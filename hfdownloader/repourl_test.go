@@ -0,0 +1,51 @@
+package hfdownloader
+
+import "testing"
+
+func TestParseRepoURL(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want RepoRef
+	}{
+		{"https://huggingface.co/org/model", RepoRef{Repo: "org/model", Type: RepoModel}},
+		{"https://huggingface.co/org/model/", RepoRef{Repo: "org/model", Type: RepoModel}},
+		{"https://huggingface.co/org/model/tree/main", RepoRef{Repo: "org/model", Type: RepoModel, Revision: "main"}},
+		{"https://huggingface.co/org/model/tree/main/onnx/", RepoRef{Repo: "org/model", Type: RepoModel, Revision: "main", Path: "onnx"}},
+		{"https://huggingface.co/org/model/blob/v1.0/config.json", RepoRef{Repo: "org/model", Type: RepoModel, Revision: "v1.0", Path: "config.json", IsFile: true}},
+		{"https://huggingface.co/org/model/resolve/main/sub/model.gguf?download=true", RepoRef{Repo: "org/model", Type: RepoModel, Revision: "main", Path: "sub/model.gguf", IsFile: true}},
+		{"https://huggingface.co/org/model/tree/refs%2Fpr%2F1#files", RepoRef{Repo: "org/model", Type: RepoModel, Revision: "refs/pr/1"}},
+		{"https://huggingface.co/datasets/org/data", RepoRef{Repo: "org/data", Type: RepoDataset}},
+		{"https://huggingface.co/datasets/org/data/resolve/main/train.parquet", RepoRef{Repo: "org/data", Type: RepoDataset, Revision: "main", Path: "train.parquet", IsFile: true}},
+		{"https://huggingface.co/spaces/org/demo/tree/main", RepoRef{Repo: "org/demo", Type: RepoSpace, Revision: "main"}},
+		{"https://huggingface.co/gpt2", RepoRef{Repo: "gpt2", Type: RepoModel}},
+		{"https://huggingface.co/gpt2/blob/main/config.json", RepoRef{Repo: "gpt2", Type: RepoModel, Revision: "main", Path: "config.json", IsFile: true}},
+		{"http://www.huggingface.co/org/model?x=1", RepoRef{Repo: "org/model", Type: RepoModel}},
+		{"hf.co/org/model/tree/dev", RepoRef{Repo: "org/model", Type: RepoModel, Revision: "dev"}},
+		{"HuggingFace.co/org/model", RepoRef{Repo: "org/model", Type: RepoModel}},
+	} {
+		got, ok, err := ParseRepoURL(tc.in)
+		if err != nil || !ok || got != tc.want {
+			t.Errorf("ParseRepoURL(%q) = %+v, %v, %v; want %+v", tc.in, got, ok, err, tc.want)
+		}
+	}
+
+	// Plain ids are left alone
+	for _, id := range []string{"org/model", "gpt2", "localhost/model"} {
+		if _, ok, err := ParseRepoURL(id); ok || err != nil {
+			t.Errorf("ParseRepoURL(%q) took it for a URL: %v", id, err)
+		}
+	}
+
+	for _, in := range []string{
+		"https://example.com/org/model",
+		"ftp://huggingface.co/org/model",
+		"https://huggingface.co/",
+		"https://huggingface.co/datasets/",
+		"https://huggingface.co/org/model/commits/main",
+		"https://huggingface.co/org/model/tree",
+	} {
+		if _, ok, err := ParseRepoURL(in); !ok || err == nil {
+			t.Errorf("ParseRepoURL(%q) = %v, %v; want an error", in, ok, err)
+		}
+	}
+}
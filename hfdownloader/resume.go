@@ -0,0 +1,101 @@
+package hfdownloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxResumes caps how often one download is resumed after losing its connection.
+const maxResumes = 5
+
+// resumingReader reads a download body and, when the connection drops before
+// size bytes arrived, picks up where it stopped with a Range request instead of
+// failing the file. Readers downstream (hashing, the .part file, an upload) see
+// one continuous stream.
+type resumingReader struct {
+	d       *Downloader
+	req     *http.Request
+	body    io.ReadCloser
+	path    string
+	offset  int64
+	size    int64
+	resumes int
+}
+
+func (d *Downloader) newResumingReader(req *http.Request, body io.ReadCloser, path string, size int64) io.ReadCloser {
+	return &resumingReader{d: d, req: req, body: body, path: path, size: size}
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == nil {
+		return n, nil
+	}
+	// A clean EOF after every byte is a genuine completion; anything short is a drop
+	if err == io.EOF && r.offset >= r.size {
+		return n, err
+	}
+	if !isConnectionDrop(err) || r.resumes >= maxResumes || r.req.Context().Err() != nil {
+		return n, err
+	}
+
+	r.resumes++
+	r.d.logf("Connection lost reading %s after %s (%v), resuming (%d/%d)\n", r.path, formatSize(r.offset), err, r.resumes, maxResumes)
+	if resumeErr := r.resume(); resumeErr != nil {
+		return n, fmt.Errorf("%w (resuming at byte %d failed: %v)", err, r.offset, resumeErr)
+	}
+	return n, nil
+}
+
+// resume replaces the body with the rest of the file from r.offset.
+func (r *resumingReader) resume() error {
+	r.body.Close()
+
+	req := r.req.Clone(r.req.Context())
+	req.Header.Del("If-None-Match") // we want the bytes, not a 304
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+
+	var resp *http.Response
+	err := r.d.retryWithBackoff(func() error {
+		var err error
+		resp, err = r.d.client().Do(req)
+		if err != nil {
+			return networkError(err)
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return &hubStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+		}
+		// The server must continue exactly where we stopped
+		if want := fmt.Sprintf("bytes %d-", r.offset); !strings.HasPrefix(resp.Header.Get("Content-Range"), want) {
+			resp.Body.Close()
+			return fmt.Errorf("server answered range %q, expected %s...", resp.Header.Get("Content-Range"), want)
+		}
+		return nil
+	}, 5, 1*time.Second, 30*time.Second)
+	if err != nil {
+		r.body = io.NopCloser(strings.NewReader(""))
+		return err
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *resumingReader) Close() error {
+	return r.body.Close()
+}
+
+// isConnectionDrop reports whether a body read failed because the connection
+// went away or went silent mid-transfer, as opposed to e.g. a cancelled context.
+func isConnectionDrop(err error) bool {
+	return err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		strings.Contains(err.Error(), "connection reset by peer")
+}
@@ -0,0 +1,59 @@
+package hfdownloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResumeAfterConnectionReset(t *testing.T) {
+	content := strings.Repeat("0123456789abcdef", 4096)
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: content, LFS: true}})
+	hub.cut = func(r *http.Request) int {
+		if r.Header.Get("Range") == "" {
+			return len(content) / 2
+		}
+		return 0
+	}
+	opts := hubOptions(t)
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(opts.Storage, "o", "m", "model.safetensors")); string(got) != content {
+		t.Fatalf("model.safetensors is %d bytes, want the %d served", len(got), len(content))
+	}
+	requests := hub.requestsTo("/resolve/")
+	if len(requests) != 2 {
+		t.Fatalf("%d resolve requests, want the first and one resume", len(requests))
+	}
+	if got := requests[1].Header.Get("Range"); got != "bytes=32768-" {
+		t.Fatalf("resumed with Range %q, want the remaining bytes only", got)
+	}
+	if !strings.Contains(out.String(), "Connection lost reading model.safetensors after") {
+		t.Fatalf("drop not logged:\n%s", out)
+	}
+}
+
+func TestStreamResumesAfterConnectionReset(t *testing.T) {
+	content := strings.Repeat("x", 10000)
+	hub := newFakeHub(t, map[string]hubFile{"data.bin": {Content: content, LFS: true}})
+	hub.cut = func(r *http.Request) int {
+		if r.Header.Get("Range") == "" {
+			return 1000
+		}
+		return 0
+	}
+	d, _ := hub.downloader()
+	var got bytes.Buffer
+	if err := d.DownloadToWriter(context.Background(), hubOptions(t), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != content {
+		t.Fatalf("streamed %d bytes, want %d", got.Len(), len(content))
+	}
+}
@@ -0,0 +1,213 @@
+package hfdownloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// StateFileName is the job state kept next to a download, unless
+// DownloadOptions.StateFile puts it elsewhere.
+const StateFileName = ".hfdownloader-state.json"
+
+// File statuses recorded in the download state.
+const (
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// StateFile is one selected file in the download state.
+type StateFile struct {
+	Path   string        `json:"path"`
+	Size   int64         `json:"size"`
+	Oid    string        `json:"oid,omitempty"`  // git blob id, which names regular files in the hub cache and checks their content
+	Type   string        `json:"type,omitempty"` // tree entry type, "file" when empty
+	Mode   string        `json:"mode,omitempty"` // git tree mode, kept so resumed runs still recognise symlinks
+	LFS    *hflfs        `json:"lfs,omitempty"`
+	Commit *hflastcommit `json:"last_commit,omitempty"` // only listed with Since or TouchTimestamps
+	Status string        `json:"status"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// DownloadState is the persisted state of a download job: the files the
+// enumeration selected and how far each got, so a restarted run with the same
+// arguments can pick up where the last one stopped without walking the repo
+// again.
+type DownloadState struct {
+	ModelName   string      `json:"model_name"`
+	Branch      string      `json:"branch"`
+	Fingerprint string      `json:"fingerprint"` // hash of the selection options the file list was built with
+	TotalFiles  int         `json:"total_files"`
+	Files       []StateFile `json:"files"`
+	LastUpdate  time.Time   `json:"last_update"`
+	StartTime   time.Time   `json:"start_time"`
+
+	mu    sync.Mutex
+	index map[string]int
+}
+
+// statePath is where the state for opts lives.
+func statePath(opts DownloadOptions) string {
+	if opts.StateFile != "" {
+		return opts.StateFile
+	}
+	return filepath.Join(repoDir(opts), StateFileName)
+}
+
+// stateFormat changes whenever StateFile gains a field a resumed run relies
+// on, so lists saved without it are enumerated again. 2 added blob ids, 3 the
+// entry type and mode, 4 the last commit.
+const stateFormat = 4
+
+// stateFingerprint identifies the options that decide which files a download
+// selects. A saved file list is only reused when they haven't changed.
+func stateFingerprint(opts DownloadOptions) string {
+	data, _ := json.Marshal(struct {
+		Format          int
+		Repo            string
+		RepoType        RepoType
+		Branch          string
+		HFPrefix        string
+		Dirs            []string
+		Include         []string
+		Exclude         []string
+		Extensions      []string
+		Since           time.Time
+		SinceStrict     bool
+		PreferFormat    string
+		MaxFiles        int
+		MaxTotalSize    int64
+		TouchTimestamps bool
+		WeightsOnly     bool
+		DocPatterns     []string
+		FromIndex       bool
+	}{stateFormat, opts.Repo, opts.repoType(), opts.Branch, opts.HFPrefix, opts.Dirs, opts.Include, opts.Exclude, opts.Extensions, opts.Since, opts.SinceStrict, opts.PreferFormat, opts.MaxFiles, opts.MaxTotalSize, opts.TouchTimestamps, opts.WeightsOnly, opts.DocPatterns, opts.FromIndex})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// setFiles replaces the file list with the selected files, all pending.
+func (s *DownloadState) setFiles(files []hfmodel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Files = s.Files[:0]
+	s.index = make(map[string]int)
+	for _, file := range files {
+		if file.IsDirectory || file.FilterSkip || file.Size <= 0 {
+			continue
+		}
+		s.index[file.Path] = len(s.Files)
+		s.Files = append(s.Files, StateFile{Path: file.Path, Size: int64(file.Size), Oid: file.Oid, Type: file.Type, Mode: file.Mode, LFS: file.Lfs, Commit: file.LastCommit, Status: StatusPending})
+	}
+	s.TotalFiles = len(s.Files)
+}
+
+// models rebuilds the saved file list as enumeration results.
+func (s *DownloadState) models(opts DownloadOptions) []hfmodel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make([]hfmodel, 0, len(s.Files))
+	for _, f := range s.Files {
+		file := hfmodel{Type: f.Type, Mode: f.Mode, Path: f.Path, Size: int(f.Size), Oid: f.Oid, Lfs: f.LFS, LastCommit: f.Commit}
+		if file.Type == "" {
+			file.Type = "file"
+		}
+		file.DownloadLink = downloadLink(opts, f.Path)
+		files = append(files, file)
+	}
+	return files
+}
+
+// setStatus records how far a file got. Files missing from the list are added.
+func (s *DownloadState) setStatus(filePath, status string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[filePath]
+	if !ok {
+		i = len(s.Files)
+		s.index[filePath] = i
+		s.Files = append(s.Files, StateFile{Path: filePath})
+	}
+	s.Files[i].Status = status
+	s.Files[i].Error = ""
+	if err != nil {
+		s.Files[i].Error = err.Error()
+	}
+}
+
+// isDone reports whether a file was completed by an earlier run.
+func (s *DownloadState) isDone(filePath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[filePath]
+	return ok && s.Files[i].Status == StatusDone
+}
+
+// counts returns the number of files done and in the list.
+func (s *DownloadState) counts() (done, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.Files {
+		if f.Status == StatusDone {
+			done++
+		}
+	}
+	return done, len(s.Files)
+}
+
+// saveDownloadState writes the state to path, replacing the old one atomically.
+func saveDownloadState(state *DownloadState, path string) error {
+	state.mu.Lock()
+	state.LastUpdate = time.Now()
+	data, err := json.MarshalIndent(state, "", "  ")
+	state.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace state file: %v", err)
+	}
+	return nil
+}
+
+// loadDownloadState reads the state at path, returning nil when there is none
+// or it is more than a week old.
+func loadDownloadState(path string) (*DownloadState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+
+	state := &DownloadState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %v", err)
+	}
+
+	// Check if state is stale (older than 7 days)
+	if time.Since(state.LastUpdate) > 7*24*time.Hour {
+		os.Remove(path) // Remove stale state file
+		return nil, nil
+	}
+
+	state.index = make(map[string]int)
+	for i, f := range state.Files {
+		state.index[f.Path] = i
+	}
+	return state, nil
+}
@@ -0,0 +1,82 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStateResumesFailedFiles(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"a.bin":     {Content: "a", LFS: true},
+		"sub/b.bin": {Content: "b", LFS: true},
+	})
+	hub.fail = func(r *http.Request) int {
+		if strings.HasSuffix(r.URL.Path, "/b.bin") {
+			return http.StatusForbidden
+		}
+		return 0
+	}
+	opts := hubOptions(t)
+	opts.ContinueOnError = true
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); !errors.Is(err, ErrFilesFailed) {
+		t.Fatalf("err = %v, want ErrFilesFailed", err)
+	}
+	state, err := loadDownloadState(statePath(opts))
+	if err != nil || state == nil {
+		t.Fatalf("state %v, %v", state, err)
+	}
+	if !state.isDone("a.bin") || state.isDone("sub/b.bin") || state.TotalFiles != 2 {
+		t.Fatalf("saved state %+v", state.Files)
+	}
+
+	// The rerun takes the saved list instead of walking the repo, and only fetches what's left
+	hub.fail = nil
+	listings, fetches := hub.hits("/tree/"), hub.hits("/resolve/")
+	d, out := hub.downloader()
+	result, err := d.Download(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Reusing the file list saved") || hub.hits("/tree/") != listings {
+		t.Fatalf("saved file list not reused:\n%s", out)
+	}
+	if hub.hits("/resolve/") != fetches+1 || hub.hits("/resolve/main/sub/b.bin") != 2 {
+		t.Fatalf("rerun fetched %d files, want only sub/b.bin", hub.hits("/resolve/")-fetches)
+	}
+	if _, err := os.Stat(statePath(opts)); !os.IsNotExist(err) {
+		t.Fatalf("state kept after a successful run: %v", err)
+	}
+
+	// A saved list only holds the selection, so mirroring lists the remote afresh
+	if _, err := d.MirrorExtras(opts, result); err != nil {
+		t.Fatal(err)
+	}
+	if hub.hits("/tree/") == listings {
+		t.Fatal("MirrorExtras trusted a saved file list as the remote listing")
+	}
+}
+
+func TestStateStartsOverWhenSelectionChanges(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"a.bin": {Content: "a"}, "b.json": {Content: "{}"}})
+	opts := hubOptions(t)
+	state := &DownloadState{ModelName: opts.Repo, Branch: opts.Branch, Fingerprint: stateFingerprint(opts)}
+	state.setFiles([]hfmodel{{Path: "a.bin", Size: 1}})
+	if err := saveDownloadState(state, filepath.Join(opts.Storage, "o", "m", StateFileName)); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Include = []string{"*.json"}
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "starting over") || hub.hits("/resolve/main/b.json") != 1 || hub.hits("/resolve/main/a.bin") != 0 {
+		t.Fatalf("stale state not discarded:\n%s", out)
+	}
+}
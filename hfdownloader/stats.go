@@ -0,0 +1,274 @@
+package hfdownloader
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RevisionStats is the disk usage of one revision of a cached repo.
+type RevisionStats struct {
+	Revision   string    `json:"revision"`         // branch or tag, or the commit when no ref points at it
+	Commit     string    `json:"commit,omitempty"` // snapshot commit, or the one the manifest recorded
+	Size       int64     `json:"size"`
+	Files      int       `json:"files"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+// RepoStats is the disk usage of one repo in a local cache.
+type RepoStats struct {
+	Repo       string          `json:"repo"`
+	Type       RepoType        `json:"type,omitempty"` // hub layout only, the plain layout doesn't record it
+	Layout     string          `json:"layout"`         // CacheLayoutPlain or CacheLayoutHub
+	Path       string          `json:"path"`
+	Size       int64           `json:"size"`  // bytes on disk, counting blobs shared by revisions once
+	Files      int             `json:"files"` // distinct files on disk
+	LastAccess time.Time       `json:"last_access"`
+	Revisions  []RevisionStats `json:"revisions"`
+}
+
+// CacheStats is the disk usage of every repo found under a folder, largest
+// first.
+type CacheStats struct {
+	Repos []RepoStats `json:"repos"`
+	Size  int64       `json:"size"`
+	Files int         `json:"files"`
+}
+
+// ScanCacheStats reports how much space each repo under dir takes, reading the
+// manifests of plain downloads and the snapshots and refs of a hub cache, so
+// both layouts can be mixed. Last access times come from the file system and
+// are only as fresh as its atime setting keeps them. Nothing is changed.
+func ScanCacheStats(dir string) (*CacheStats, error) {
+	stats := &CacheStats{Repos: []RepoStats{}}
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if repoType, repo, ok := hubRepoName(entry.Name()); ok {
+			if _, err := os.Stat(filepath.Join(p, "snapshots")); err == nil {
+				repoStats, err := hubRepoStats(p, repo, repoType)
+				if err != nil {
+					return err
+				}
+				stats.Repos = append(stats.Repos, *repoStats)
+				return filepath.SkipDir
+			}
+		}
+		if _, err := os.Stat(filepath.Join(p, ManifestFileName)); err == nil {
+			repoStats, err := plainRepoStats(dir, p)
+			if err != nil {
+				return err
+			}
+			stats.Repos = append(stats.Repos, *repoStats)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range stats.Repos {
+		stats.Size += repo.Size
+		stats.Files += repo.Files
+	}
+	sort.Slice(stats.Repos, func(i, j int) bool {
+		if stats.Repos[i].Size != stats.Repos[j].Size {
+			return stats.Repos[i].Size > stats.Repos[j].Size
+		}
+		return stats.Repos[i].Repo < stats.Repos[j].Repo
+	})
+	return stats, nil
+}
+
+// hubRepoName parses a hub cache folder name such as models--org--name.
+func hubRepoName(name string) (RepoType, string, bool) {
+	prefix, rest, found := strings.Cut(name, "--")
+	if !found || rest == "" {
+		return "", "", false
+	}
+	switch prefix {
+	case "models":
+		return RepoModel, strings.ReplaceAll(rest, "--", "/"), true
+	case "datasets":
+		return RepoDataset, strings.ReplaceAll(rest, "--", "/"), true
+	case "spaces":
+		return RepoSpace, strings.ReplaceAll(rest, "--", "/"), true
+	}
+	return "", "", false
+}
+
+// plainRepoStats totals a plain download folder, whose manifest names the repo
+// and the one revision kept there.
+func plainRepoStats(storage, dir string) (*RepoStats, error) {
+	manifest, err := LoadManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dir, err)
+	}
+	repo := manifest.Repo
+	if repo == "" {
+		if repo, err = filepath.Rel(storage, dir); err != nil {
+			return nil, err
+		}
+		repo = filepath.ToSlash(repo)
+	}
+
+	stats := &RepoStats{Repo: repo, Layout: CacheLayoutPlain, Path: dir}
+	err = filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if p != dir {
+				if _, err := os.Stat(filepath.Join(p, ManifestFileName)); err == nil {
+					return filepath.SkipDir // another download nested inside this one
+				}
+			}
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ManifestFileName) || !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		stats.Size += info.Size()
+		stats.Files++
+		if atime := accessTime(info); atime.After(stats.LastAccess) {
+			stats.LastAccess = atime
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.Revisions = []RevisionStats{{Revision: manifest.Revision, Commit: manifest.Commit, Size: stats.Size, Files: stats.Files, LastAccess: stats.LastAccess}}
+	return stats, nil
+}
+
+// hubRepoStats totals a repo in the hub cache. Each snapshot is a revision,
+// named after the refs pointing at it, and counts the blobs it links to; the
+// repo counts every blob once, along with files left outside blobs/.
+func hubRepoStats(dir, repo string, repoType RepoType) (*RepoStats, error) {
+	stats := &RepoStats{Repo: repo, Type: repoType, Layout: CacheLayoutHub, Path: dir}
+
+	refs := make(map[string][]string) // commit to the refs pointing at it
+	refsDir := filepath.Join(dir, "refs")
+	err := filepath.WalkDir(refsDir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == refsDir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(refsDir, p)
+		if err != nil {
+			return err
+		}
+		commit := strings.TrimSpace(string(data))
+		refs[commit] = append(refs[commit], filepath.ToSlash(name))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counted := make(map[string]bool) // real paths already added to the repo totals
+	add := func(path string, info fs.FileInfo) {
+		if counted[path] {
+			return
+		}
+		counted[path] = true
+		stats.Size += info.Size()
+		stats.Files++
+		if atime := accessTime(info); atime.After(stats.LastAccess) {
+			stats.LastAccess = atime
+		}
+	}
+
+	snapshots, err := os.ReadDir(filepath.Join(dir, "snapshots"))
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		if !snapshot.IsDir() {
+			continue
+		}
+		commit := snapshot.Name()
+		revision := RevisionStats{Revision: commit, Commit: commit}
+		if names := refs[commit]; len(names) > 0 {
+			sort.Strings(names)
+			revision.Revision = strings.Join(names, ", ")
+		}
+		root := filepath.Join(dir, "snapshots", commit)
+		err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			real, err := filepath.EvalSymlinks(p)
+			if err != nil {
+				return nil // a dangling link takes no space
+			}
+			info, err := os.Stat(real)
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			revision.Size += info.Size()
+			revision.Files++
+			if atime := accessTime(info); atime.After(revision.LastAccess) {
+				revision.LastAccess = atime
+			}
+			add(real, info)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		stats.Revisions = append(stats.Revisions, revision)
+	}
+
+	// Blobs no snapshot links to any more still take space
+	blobs, err := os.ReadDir(filepath.Join(dir, "blobs"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, blob := range blobs {
+		path := filepath.Join(dir, "blobs", blob.Name())
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(real)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		add(real, info)
+	}
+
+	sort.Slice(stats.Revisions, func(i, j int) bool {
+		if stats.Revisions[i].Size != stats.Revisions[j].Size {
+			return stats.Revisions[i].Size > stats.Revisions[j].Size
+		}
+		return stats.Revisions[i].Revision < stats.Revisions[j].Revision
+	})
+	return stats, nil
+}
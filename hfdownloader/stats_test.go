@@ -0,0 +1,136 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// touch sets the access time of the files under dir to when, so stats don't
+// depend on the file system's atime setting.
+func touch(t *testing.T, dir string, when time.Time) {
+	t.Helper()
+	filepath.WalkDir(dir, func(p string, entry os.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			if err := os.Chtimes(p, when, when.Add(-time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return nil
+	})
+}
+
+func TestScanCacheStatsPlainLayout(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"model.safetensors": {Content: strings.Repeat("w", 100), LFS: true},
+		"config.json":       {Content: `{"a":1}`},
+	})
+	opts := hubOptions(t)
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	small := newFakeHub(t, map[string]hubFile{"README.md": {Content: "# tiny"}})
+	small.branches = []string{"main", "dev"}
+	smallOpts := opts
+	smallOpts.Repo, smallOpts.Branch = "o/tiny", "dev"
+	d, out = small.downloader()
+	if _, err := d.Download(context.Background(), smallOpts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	// Folders without a manifest are not downloads
+	os.MkdirAll(filepath.Join(opts.Storage, "scratch"), 0755)
+	os.WriteFile(filepath.Join(opts.Storage, "scratch", "notes.txt"), []byte("notes"), 0644)
+	accessed := time.Now().Add(-time.Hour).Truncate(time.Second)
+	touch(t, opts.Storage, accessed)
+
+	stats, err := ScanCacheStats(opts.Storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CacheStats{
+		Repos: []RepoStats{
+			{Repo: "o/m", Layout: CacheLayoutPlain, Path: filepath.Join(opts.Storage, "o", "m"), Size: 107, Files: 2, LastAccess: accessed,
+				Revisions: []RevisionStats{{Revision: "main", Commit: testCommit, Size: 107, Files: 2, LastAccess: accessed}}},
+			{Repo: "o/tiny", Layout: CacheLayoutPlain, Path: filepath.Join(opts.Storage, "o", "tiny"), Size: 6, Files: 1, LastAccess: accessed,
+				Revisions: []RevisionStats{{Revision: "dev", Commit: testCommit, Size: 6, Files: 1, LastAccess: accessed}}},
+		},
+		Size:  113,
+		Files: 3,
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("stats = %+v\nwant %+v", stats, want)
+	}
+
+	if stats, err := ScanCacheStats(filepath.Join(opts.Storage, "missing")); err != nil || len(stats.Repos) != 0 {
+		t.Fatalf("missing folder: %+v, %v", stats, err)
+	}
+}
+
+func TestScanCacheStatsHubLayout(t *testing.T) {
+	cache := t.TempDir()
+	const main, v1 = "1111111111111111111111111111111111111111", "2222222222222222222222222222222222222222"
+	repo := filepath.Join(cache, "models--org--name")
+	write := func(rel, content string) {
+		t.Helper()
+		p := filepath.Join(repo, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(rel, blob string) {
+		t.Helper()
+		p := filepath.Join(repo, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		target, _ := filepath.Rel(filepath.Dir(p), filepath.Join(repo, "blobs", blob))
+		if err := os.Symlink(target, p); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	write("blobs/weights", strings.Repeat("w", 100))
+	write("blobs/config-new", `{"a":2}`)
+	write("blobs/config-old", `{"a":1}`)
+	write("blobs/orphan", "orphan")
+	write("refs/main", main+"\n")
+	write("refs/release", main)
+	write("refs/v1", v1)
+	link("snapshots/"+main+"/model.safetensors", "weights")
+	link("snapshots/"+main+"/config.json", "config-new")
+	link("snapshots/"+v1+"/model.safetensors", "weights")
+	link("snapshots/"+v1+"/config.json", "config-old")
+	link("snapshots/"+v1+"/gone.bin", "deleted")
+	dataset := filepath.Join(cache, "datasets--org--data", "snapshots", main)
+	os.MkdirAll(dataset, 0755)
+	os.WriteFile(filepath.Join(dataset, "train.parquet"), []byte("rows"), 0644)
+	accessed := time.Now().Add(-time.Hour).Truncate(time.Second)
+	touch(t, cache, accessed)
+
+	stats, err := ScanCacheStats(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CacheStats{
+		Repos: []RepoStats{
+			// Shared blobs count once, the orphan blob counts too
+			{Repo: "org/name", Type: RepoModel, Layout: CacheLayoutHub, Path: repo, Size: 120, Files: 4, LastAccess: accessed,
+				Revisions: []RevisionStats{
+					{Revision: "main, release", Commit: main, Size: 107, Files: 2, LastAccess: accessed},
+					{Revision: "v1", Commit: v1, Size: 107, Files: 2, LastAccess: accessed},
+				}},
+			{Repo: "org/data", Type: RepoDataset, Layout: CacheLayoutHub, Path: filepath.Join(cache, "datasets--org--data"), Size: 4, Files: 1, LastAccess: accessed,
+				Revisions: []RevisionStats{{Revision: main, Commit: main, Size: 4, Files: 1, LastAccess: accessed}}},
+		},
+		Size:  124,
+		Files: 5,
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("stats = %+v\nwant %+v", stats, want)
+	}
+}
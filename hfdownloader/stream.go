@@ -0,0 +1,195 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DownloadToWriter streams the single file selected by opts into w, for piping
+// one file into another tool. It is an error for the filters to select anything
+// but exactly one file. The SHA256 is computed as the bytes are written, so a
+// mismatch is only reported once w has received the whole file.
+func (d *Downloader) DownloadToWriter(ctx context.Context, opts DownloadOptions, w io.Writer) error {
+	file, err := d.singleFile(opts)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", file.DownloadLink, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	setAuth(req, opts.Token)
+	req.Header.Set("User-Agent", UserAgent)
+
+	var resp *http.Response
+	err = d.retryWithBackoff(func() error {
+		var err error
+		resp, err = d.client().Do(req)
+		if err != nil {
+			return networkError(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return &hubStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+		}
+		return nil
+	}, 5, 1*time.Second, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", file.Path, err)
+	}
+	resp.Body = d.newResumingReader(req, resp.Body, file.Path, int64(file.Size))
+	defer resp.Body.Close()
+
+	hash := newContentHash(file)
+	if _, err := d.copy(io.MultiWriter(w, hash), resp.Body); err != nil {
+		return fmt.Errorf("failed to stream %s: %w", file.Path, err)
+	}
+	if !opts.skipHashCheck(file) {
+		return checkContentHash(file, hash)
+	}
+	return nil
+}
+
+// DownloadToFile saves the single file selected by opts at path instead of
+// under the storage folder, like curl -o. An existing path is an error
+// wrapping os.ErrExist unless overwrite is set. The file is written next to
+// path with a .part suffix and only renamed once its SHA256 checks out.
+func (d *Downloader) DownloadToFile(ctx context.Context, opts DownloadOptions, path string, overwrite bool) error {
+	if !overwrite {
+		if _, err := os.Lstat(path); err == nil {
+			return fmt.Errorf("%w: %s", os.ErrExist, path)
+		}
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %v", path, err)
+		}
+	}
+
+	partPath := path + ".part"
+	out, release, err := d.createFile(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", partPath, diskError(err))
+	}
+	err = d.DownloadToWriter(ctx, opts, out)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write %s: %w", partPath, diskError(closeErr))
+	}
+	release()
+	if err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("failed to finalize %s: %v", path, err)
+	}
+	return nil
+}
+
+// singleFile returns the one file opts selects, or an error if it selects any
+// other number.
+func (d *Downloader) singleFile(opts DownloadOptions) (hfmodel, error) {
+	selected, err := d.selectedFiles(opts)
+	if err != nil {
+		return hfmodel{}, err
+	}
+	if len(selected) == 0 {
+		return hfmodel{}, fmt.Errorf("%w: no file matched, streaming needs exactly one", ErrNotFound)
+	}
+	if len(selected) > 1 {
+		return hfmodel{}, fmt.Errorf("%d files matched, streaming needs exactly one (first two: %s, %s)", len(selected), selected[0].Path, selected[1].Path)
+	}
+	return selected[0], nil
+}
+
+// ParseByteRange parses an inclusive byte range such as "0-1000000", or
+// "1000-" for everything from offset 1000 on, in which case end is -1.
+func ParseByteRange(s string) (start, end int64, err error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid byte range %q, expected START-END such as 0-1000000", s)
+	}
+	if start, err = strconv.ParseInt(from, 10, 64); err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid byte range %q, expected START-END such as 0-1000000", s)
+	}
+	if to == "" {
+		return start, -1, nil
+	}
+	if end, err = strconv.ParseInt(to, 10, 64); err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid byte range %q, expected START-END such as 0-1000000", s)
+	}
+	return start, end, nil
+}
+
+// DownloadRange writes bytes start through end, inclusive, of the single file
+// selected by opts to w, e.g. to read a safetensors header without fetching
+// the tensors. An end of -1 or past the file reads to its end. Nothing is
+// checksummed since only part of the file is fetched. It returns the number
+// of bytes written.
+func (d *Downloader) DownloadRange(ctx context.Context, opts DownloadOptions, start, end int64, w io.Writer) (int64, error) {
+	file, err := d.singleFile(opts)
+	if err != nil {
+		return 0, err
+	}
+	size := int64(file.Size)
+	if start >= size {
+		return 0, fmt.Errorf("range starts at %d but %s is only %d bytes", start, file.Path, size)
+	}
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", file.DownloadLink, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %v", err)
+	}
+	setAuth(req, opts.Token)
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	var resp *http.Response
+	err = d.retryWithBackoff(func() error {
+		var err error
+		resp, err = d.client().Do(req)
+		if err != nil {
+			return networkError(err)
+		}
+		if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return &hubStatusError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+		}
+		return nil
+	}, 5, 1*time.Second, 30*time.Second)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download %s: %w", file.Path, err)
+	}
+	defer resp.Body.Close()
+
+	// A server that ignores Range sends the whole file, so skip to start
+	body := io.Reader(resp.Body)
+	if resp.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(io.Discard, body, start); err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+	}
+	length := end - start + 1
+	n, err := d.copy(w, io.LimitReader(body, length))
+	if err != nil {
+		return n, fmt.Errorf("failed to read %s: %w", file.Path, err)
+	}
+	if n != length {
+		return n, fmt.Errorf("short read of %s: got %d of %d bytes", file.Path, n, length)
+	}
+	return n, nil
+}
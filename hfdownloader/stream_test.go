@@ -0,0 +1,157 @@
+package hfdownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadToWriter(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"model.safetensors": {Content: "weights", LFS: true},
+		"config.json":       {Content: "{}"},
+	})
+	opts := hubOptions(t)
+	opts.Include = []string{"model.safetensors"}
+	d, _ := hub.downloader()
+	var got bytes.Buffer
+	if err := d.DownloadToWriter(context.Background(), opts, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "weights" {
+		t.Fatalf("wrote %q, want %q", got.String(), "weights")
+	}
+
+	hub.corrupt = func(r *http.Request) bool { return true }
+	if err := d.DownloadToWriter(context.Background(), opts, &bytes.Buffer{}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("corrupted file: %v, want ErrChecksumMismatch", err)
+	}
+
+	opts.Include = nil
+	if err := d.DownloadToWriter(context.Background(), opts, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "files matched") {
+		t.Fatalf("err = %v, want a single file required", err)
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	// A safetensors file: an 8-byte header length, the JSON header, then tensors
+	header := `{"w":{"dtype":"F32","shape":[2],"data_offsets":[0,8]}}`
+	content := "\x38\x00\x00\x00\x00\x00\x00\x00" + header + strings.Repeat("\x01", 8)
+	hub := newFakeHub(t, map[string]hubFile{
+		"model.safetensors": {Content: content, LFS: true},
+		"config.json":       {Content: "{}"},
+	})
+	opts := hubOptions(t)
+	opts.Include = []string{"model.safetensors"}
+
+	for _, tc := range []struct {
+		start, end int64
+		want       string
+	}{
+		{0, 7, content[:8]},
+		{8, 8 + int64(len(header)) - 1, header},
+		{int64(len(content)) - 3, -1, content[len(content)-3:]},
+		{60, 1 << 40, content[60:]},
+	} {
+		d, _ := hub.downloader()
+		var got bytes.Buffer
+		n, err := d.DownloadRange(context.Background(), opts, tc.start, tc.end, &got)
+		if err != nil {
+			t.Fatalf("%d-%d: %v", tc.start, tc.end, err)
+		}
+		if got.String() != tc.want || n != int64(len(tc.want)) {
+			t.Errorf("%d-%d: wrote %q (%d), want %q", tc.start, tc.end, got.String(), n, tc.want)
+		}
+	}
+	requests := hub.requestsTo("/resolve/")
+	if got := requests[0].Header.Get("Range"); got != "bytes=0-7" {
+		t.Fatalf("sent Range %q, want bytes=0-7", got)
+	}
+
+	d, _ := hub.downloader()
+	if _, err := d.DownloadRange(context.Background(), opts, int64(len(content)), -1, &bytes.Buffer{}); err == nil {
+		t.Fatal("range past the end of the file accepted")
+	}
+	opts.Include = nil
+	if _, err := d.DownloadRange(context.Background(), opts, 0, 7, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "files matched") {
+		t.Fatalf("err = %v, want a single file required", err)
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	for _, tc := range []struct {
+		in         string
+		start, end int64
+		ok         bool
+	}{
+		{"0-1000000", 0, 1000000, true},
+		{"1000-", 1000, -1, true},
+		{"5-5", 5, 5, true},
+		{"10-5", 0, 0, false},
+		{"-100", 0, 0, false},
+		{"100", 0, 0, false},
+		{"a-b", 0, 0, false},
+	} {
+		start, end, err := ParseByteRange(tc.in)
+		if (err == nil) != tc.ok || start != tc.start || end != tc.end {
+			t.Errorf("%q: got %d, %d, %v", tc.in, start, end, err)
+		}
+	}
+}
+
+func TestDownloadToFile(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"sub/model.gguf": {Content: "gguf weights", LFS: true},
+		"config.json":    {Content: "{}"},
+	})
+	opts := hubOptions(t)
+	opts.Include = []string{"*.gguf"}
+	path := filepath.Join(t.TempDir(), "out", "myname.gguf")
+	d, _ := hub.downloader()
+	if err := d.DownloadToFile(context.Background(), opts, path, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "gguf weights" {
+		t.Fatalf("%s = %q, %v", path, got, err)
+	}
+	// Only the named path is written, nothing under the storage folder
+	if entries, _ := os.ReadDir(opts.Storage); len(entries) != 0 {
+		t.Errorf("storage folder has %d entries", len(entries))
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Errorf(".part file left behind: %v", err)
+	}
+
+	if err := d.DownloadToFile(context.Background(), opts, path, false); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("err = %v, want the existing file refused", err)
+	}
+	if hits := hub.hits("/resolve/"); hits != 1 {
+		t.Fatalf("%d downloads, the refused one should fetch nothing", hits)
+	}
+	hub.files["sub/model.gguf"] = hubFile{Content: "new weights", LFS: true}
+	if err := d.DownloadToFile(context.Background(), opts, path, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new weights" {
+		t.Fatalf("overwritten file holds %q", got)
+	}
+
+	// A corrupt download leaves the existing file alone
+	hub.corrupt = func(r *http.Request) bool { return true }
+	if err := d.DownloadToFile(context.Background(), opts, path, true); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("err = %v, want a checksum mismatch", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new weights" {
+		t.Fatalf("corrupt download replaced the file with %q", got)
+	}
+
+	opts.Include = nil
+	if err := d.DownloadToFile(context.Background(), opts, filepath.Join(t.TempDir(), "x"), false); err == nil || !strings.Contains(err.Error(), "files matched") {
+		t.Fatalf("err = %v, want a single file required", err)
+	}
+}
@@ -0,0 +1,150 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitSymlinkMode is the git tree mode of a symbolic link.
+const gitSymlinkMode = "120000"
+
+// maxSymlinkTarget caps how much of a symlink blob is read as its target.
+const maxSymlinkTarget = 4096
+
+// isSymlink reports whether a tree entry is a git symlink, whose blob holds
+// the link target rather than file content. Entries are recognised when the
+// tree reports a "symlink" type or the 120000 mode.
+func (f hfmodel) isSymlink() bool {
+	return f.Type == "symlink" || f.Mode == gitSymlinkMode
+}
+
+// splitSymlinks returns the regular files and the symlinks in files separately.
+func splitSymlinks(files []hfmodel) ([]hfmodel, []hfmodel) {
+	var regular, links []hfmodel
+	for _, file := range files {
+		if file.isSymlink() {
+			links = append(links, file)
+		} else {
+			regular = append(regular, file)
+		}
+	}
+	return regular, links
+}
+
+// symlinkTarget resolves a link target against the folder of the link, both
+// repo paths, refusing absolute targets and ones that leave the repo.
+func symlinkTarget(linkPath, target string) (string, error) {
+	if target == "" || path.IsAbs(target) || strings.Contains(target, "\\") {
+		return "", fmt.Errorf("symlink %s -> %s: target must be a relative path inside the repo", linkPath, target)
+	}
+	resolved := path.Join(path.Dir(linkPath), target)
+	if resolved == "." || resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", fmt.Errorf("symlink %s -> %s: target is outside the repo", linkPath, target)
+	}
+	return resolved, nil
+}
+
+// fetchSymlinkTarget downloads a symlink's blob, which is its target path.
+func fetchSymlinkTarget(ctx context.Context, client *http.Client, file hfmodel, token string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", file.DownloadLink, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	setAuth(req, token)
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", networkError(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSymlinkTarget+1))
+	if err != nil {
+		return "", networkError(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &hubStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if len(body) > maxSymlinkTarget {
+		return "", fmt.Errorf("symlink %s: target longer than %d bytes", file.Path, maxSymlinkTarget)
+	}
+	return string(body), nil
+}
+
+// linkSymlinks recreates the repo's symlinks once all downloads have finished,
+// as relative links between the local copies so renames and StripPrefix are
+// honoured. With opts.DerefSymlinks the target's content is linked or copied
+// in instead. Links leaving the repo are refused with a warning, as are links
+// to files that were not downloaded when dereferencing.
+func (d *Downloader) linkSymlinks(ctx context.Context, links []hfmodel, modelPath string, opts DownloadOptions, fail func(string, error)) {
+	for _, link := range links {
+		target, err := fetchSymlinkTarget(ctx, d.client(), link, opts.Token)
+		if err != nil {
+			d.logf("Error reading symlink %s: %v\n", link.Path, err)
+			fail(link.Path, fmt.Errorf("failed to read symlink: %w", err))
+			continue
+		}
+		resolved, err := symlinkTarget(link.Path, target)
+		if err != nil {
+			d.logf("Warning: skipping %v\n", err)
+			continue
+		}
+
+		localName, _ := localPathFor(opts, link.Path)
+		targetName, _ := localPathFor(opts, resolved)
+		dst := filepath.Join(modelPath, filepath.FromSlash(localName))
+		src := filepath.Join(modelPath, filepath.FromSlash(targetName))
+
+		if opts.DerefSymlinks {
+			info, err := os.Stat(src)
+			if err != nil || info.IsDir() {
+				d.logf("Warning: skipping symlink %s: its target %s was not downloaded as a file\n", link.Path, resolved)
+				continue
+			}
+			if _, err := linkOrCopy(src, dst); err != nil {
+				d.logf("Error dereferencing symlink %s: %v\n", link.Path, err)
+				fail(link.Path, err)
+			} else if !opts.SilentMode {
+				d.logf("Copied %s from its symlink target %s\n", link.Path, resolved)
+			}
+			continue
+		}
+
+		if err := createSymlink(src, dst); err != nil {
+			d.logf("Error creating symlink %s: %v\n", link.Path, err)
+			fail(link.Path, err)
+			continue
+		}
+		if !opts.SilentMode {
+			d.logf("Linked %s -> %s\n", link.Path, resolved)
+		}
+	}
+}
+
+// createSymlink makes dst a relative symlink to src, replacing whatever is at
+// dst, e.g. the link's target text saved as a file by an older version.
+func createSymlink(src, dst string) error {
+	rel, err := filepath.Rel(filepath.Dir(dst), src)
+	if err != nil {
+		return fmt.Errorf("failed to link %s: %v", dst, err)
+	}
+	if current, err := os.Readlink(dst); err == nil && current == rel {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", dst, err)
+	}
+	if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to replace %s: %v", dst, err)
+	}
+	if err := os.Symlink(rel, dst); err != nil {
+		return fmt.Errorf("failed to create symlink %s (use --deref-symlinks to copy instead): %v", dst, err)
+	}
+	return nil
+}
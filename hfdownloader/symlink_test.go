@@ -0,0 +1,67 @@
+package hfdownloader
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func symlinkRepo() map[string]hubFile {
+	return map[string]hubFile{
+		"model.safetensors": {Content: "weights", LFS: true},
+		"link.bin":          {Content: "model.safetensors", Mode: gitSymlinkMode},
+	}
+}
+
+func assertLink(t *testing.T, opts DownloadOptions) {
+	t.Helper()
+	target, err := os.Readlink(filepath.Join(opts.Storage, "o", "m", "link.bin"))
+	if err != nil {
+		t.Fatalf("link.bin is not a symlink: %v", err)
+	}
+	if target != "model.safetensors" {
+		t.Fatalf("link.bin -> %q, want model.safetensors", target)
+	}
+}
+
+func TestDownloadCreatesSymlinks(t *testing.T) {
+	hub := newFakeHub(t, symlinkRepo())
+	d, _ := hub.downloader()
+	opts := hubOptions(t)
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	assertLink(t, opts)
+}
+
+func TestResumedDownloadCreatesSymlinks(t *testing.T) {
+	hub := newFakeHub(t, symlinkRepo())
+	hub.fail = func(r *http.Request) int {
+		if strings.HasSuffix(r.URL.Path, "/resolve/main/link.bin") {
+			return http.StatusNotFound
+		}
+		return 0
+	}
+	opts := hubOptions(t)
+	opts.ContinueOnError = true
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err == nil {
+		t.Fatal("first run succeeded despite the failing link")
+	}
+	if _, err := os.Lstat(filepath.Join(opts.Storage, "o", "m", "link.bin")); err == nil {
+		t.Fatal("link.bin created by the failed run")
+	}
+
+	hub.fail = nil
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Reusing the file list") {
+		t.Fatalf("second run did not resume from the saved state:\n%s", out)
+	}
+	assertLink(t, opts)
+}
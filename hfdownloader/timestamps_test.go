@@ -0,0 +1,51 @@
+package hfdownloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTouchTimestamps(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"model.safetensors": {Content: "weights", LFS: true, Date: "2024-03-01T12:30:45.000Z"},
+		"sub/config.json":   {Content: `{"a":1}`, Date: "2023-11-20T08:00:00+02:00"},
+		"README.md":         {Content: "# model"},
+	})
+	opts := hubOptions(t)
+	opts.TouchTimestamps = true
+	d, out := hub.downloader()
+	start := time.Now()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+
+	dir := filepath.Join(opts.Storage, "o", "m")
+	for name, want := range map[string]time.Time{
+		"model.safetensors": time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC),
+		"sub/config.json":   time.Date(2023, 11, 20, 6, 0, 0, 0, time.UTC),
+	} {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(want) {
+			t.Errorf("%s modified %s, want the commit date %s", name, info.ModTime().UTC(), want)
+		}
+	}
+	// Without a commit date the file keeps its download time
+	info, err := os.Stat(filepath.Join(dir, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Before(start.Add(-time.Second)) {
+		t.Errorf("README.md modified %s, want its download time", info.ModTime())
+	}
+	for _, r := range hub.requestsTo("/tree/") {
+		if r.URL.Query().Get("expand") != "true" {
+			t.Errorf("%s listed without commit dates", r.URL)
+		}
+	}
+}
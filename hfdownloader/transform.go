@@ -0,0 +1,129 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TransformFunc runs on a file once it has been downloaded and verified.
+// Returning an error fails the file, and its local copy is removed so the next
+// run fetches it again.
+type TransformFunc func(ctx context.Context, event FileEvent) error
+
+// FileTransform applies Run to the files matching Pattern, a glob as in
+// DownloadOptions.Include.
+type FileTransform struct {
+	Pattern string
+	Name    string
+	Run     TransformFunc
+}
+
+type registeredTransform struct {
+	pattern string
+	run     TransformFunc
+}
+
+var (
+	transformsMu sync.Mutex
+	transforms   = map[string]registeredTransform{
+		"validate-safetensors": {"*.safetensors", ValidateSafetensorsFile},
+	}
+)
+
+// RegisterTransform makes a transform available to ParseTransform under name,
+// applied to defaultPattern unless the spec names another.
+func RegisterTransform(name, defaultPattern string, run TransformFunc) {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	transforms[name] = registeredTransform{defaultPattern, run}
+}
+
+// TransformNames lists the registered transforms.
+func TransformNames() []string {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseTransform parses a --transform spec, "name" or "pattern=name", into the
+// registered transform of that name.
+func ParseTransform(spec string) (FileTransform, error) {
+	pattern, name, ok := strings.Cut(spec, "=")
+	if !ok {
+		pattern, name = "", spec
+	}
+	pattern, name = strings.TrimSpace(pattern), strings.TrimSpace(name)
+
+	transformsMu.Lock()
+	registered, found := transforms[name]
+	transformsMu.Unlock()
+	if !found {
+		return FileTransform{}, fmt.Errorf("unknown transform %q, expected one of %s", name, strings.Join(TransformNames(), ", "))
+	}
+	if pattern == "" {
+		pattern = registered.pattern
+	}
+	if err := ValidatePatterns([]string{pattern}); err != nil {
+		return FileTransform{}, err
+	}
+	return FileTransform{Pattern: pattern, Name: name, Run: registered.run}, nil
+}
+
+// runTransforms runs the transforms matching a downloaded file in order,
+// stopping at the first failure.
+func runTransforms(ctx context.Context, transforms []FileTransform, event FileEvent) error {
+	for _, t := range transforms {
+		if !matchPattern(t.Pattern, event.Path) {
+			continue
+		}
+		if err := t.Run(ctx, event); err != nil {
+			return fmt.Errorf("transform %s failed: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateSafetensorsFile is the validate-safetensors transform: it checks a
+// local safetensors file's header length and JSON header like CheckSafetensors
+// does for bucket objects, catching files that pass their checksum but are
+// structurally broken, e.g. from a bad cache.
+func ValidateSafetensorsFile(ctx context.Context, event FileEvent) error {
+	f, err := os.Open(event.LocalPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", event.LocalPath, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", event.LocalPath, err)
+	}
+
+	reason, err := CheckSafetensors(ctx, RemoteObject{
+		Key:  event.Path,
+		Size: info.Size(),
+		ReadRange: func(ctx context.Context, offset, length int64) ([]byte, error) {
+			buf := make([]byte, length)
+			if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return buf, nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return fmt.Errorf("invalid safetensors file: %s", reason)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestValidateSafetensorsTransform(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"good.safetensors": {Content: safetensors(`{"w":{"dtype":"F32","shape":[1],"data_offsets":[0,4]}}`, "data"), LFS: true},
+		// Passes its checksum, but the header length points past the end
+		"bad.safetensors": {Content: safetensors(`{"w":{}}`, "")[:12], LFS: true},
+		"config.json":     {Content: `{"a":1}`},
+	})
+	transform, err := ParseTransform("validate-safetensors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := hubOptions(t)
+	opts.ContinueOnError = true
+	opts.Transforms = []FileTransform{transform}
+	var completed []string
+	opts.OnFileComplete = func(event FileEvent) error {
+		completed = append(completed, event.Path)
+		return nil
+	}
+	d, out := hub.downloader()
+	result, err := d.Download(context.Background(), opts)
+	if !errors.Is(err, ErrFilesFailed) {
+		t.Fatalf("error %v, want a failed file\n%s", err, out)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Path != "bad.safetensors" {
+		t.Fatalf("failed = %+v, want just bad.safetensors", result.Failed)
+	}
+
+	dir := filepath.Join(opts.Storage, "o", "m")
+	for name, kept := range map[string]bool{"good.safetensors": true, "config.json": true, "bad.safetensors": false} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept {
+			t.Errorf("%s kept = %v, want %v", name, err == nil, kept)
+		}
+	}
+	slices.Sort(completed)
+	if !slices.Equal(completed, []string{"config.json", "good.safetensors"}) {
+		t.Errorf("OnFileComplete saw %q, want only the files that passed", completed)
+	}
+}
+
+func TestParseTransform(t *testing.T) {
+	transform, err := ParseTransform("weights/*.bin = validate-safetensors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transform.Pattern != "weights/*.bin" || transform.Name != "validate-safetensors" {
+		t.Errorf("parsed %+v", transform)
+	}
+	if _, err := ParseTransform("no-such-transform"); err == nil {
+		t.Error("unknown transform accepted")
+	}
+	if _, err := ParseTransform("[=validate-safetensors"); err == nil {
+		t.Error("malformed pattern accepted")
+	}
+
+	var ran []string
+	RegisterTransform("record", "*.json", func(ctx context.Context, event FileEvent) error {
+		ran = append(ran, event.Path)
+		return nil
+	})
+	t.Cleanup(func() {
+		transformsMu.Lock()
+		delete(transforms, "record")
+		transformsMu.Unlock()
+	})
+	if !slices.Contains(TransformNames(), "record") {
+		t.Fatalf("registered transform missing from %q", TransformNames())
+	}
+	record, err := ParseTransform("record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"config.json", "model.safetensors"} {
+		if err := runTransforms(context.Background(), []FileTransform{record}, FileEvent{Path: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(ran, []string{"config.json"}) {
+		t.Errorf("transform ran on %q, want only the default pattern's matches", ran)
+	}
+}
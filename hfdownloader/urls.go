@@ -0,0 +1,111 @@
+package hfdownloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ResolvedURL is where a selected file can be fetched from directly.
+type ResolvedURL struct {
+	Path      string    `json:"path"`                // repo path
+	LocalPath string    `json:"local_path"`          // where a download would store it
+	URL       string    `json:"url"`                 // final URL after the Hub's redirects
+	Expires   time.Time `json:"expires,omitempty"`   // when a presigned URL stops working, if known
+	Presigned bool      `json:"presigned,omitempty"` // URL carries its own authorization
+}
+
+// ResolveURLs resolves every file opts selects to its final, possibly
+// presigned, CDN URL without downloading anything, for handing to an external
+// downloader. Presigned URLs expire, so use them soon.
+func (d *Downloader) ResolveURLs(opts DownloadOptions) ([]ResolvedURL, error) {
+	selected, err := d.selectedFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	modelPath := repoDir(opts)
+
+	resolved := make([]ResolvedURL, len(selected))
+	errs := make([]error, len(selected))
+	sem := make(chan struct{}, workerCount(opts))
+	var wg sync.WaitGroup
+	for i, file := range selected {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, file hfmodel) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			final, err := resolveURL(d.client(), file.DownloadLink, opts.Token)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to resolve %s: %w", file.Path, err)
+				return
+			}
+			localName, _ := localPathFor(opts, file.Path)
+			resolved[i] = ResolvedURL{Path: file.Path, LocalPath: filepath.Join(modelPath, localName), URL: final.String(), Presigned: isPresignedURL(final)}
+			resolved[i].Expires, _ = urlExpiry(final)
+		}(i, file)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// resolveURL follows the Hub's redirects for link with HEAD requests, stopping
+// at the first presigned URL so the CDN itself is never contacted.
+func resolveURL(client *http.Client, link string, token string) (*url.URL, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	setAuth(req, token)
+	req.Header.Set("User-Agent", UserAgent)
+
+	noFollow := *client
+	noFollow.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if isPresignedURL(req.URL) {
+			return http.ErrUseLastResponse
+		}
+		return checkRedirect(req, via)
+	}
+	resp, err := noFollow.Do(req)
+	if err != nil {
+		return nil, networkError(err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		return resp.Request.URL.Parse(resp.Header.Get("Location"))
+	case resp.StatusCode == http.StatusOK:
+		return resp.Request.URL, nil
+	}
+	return nil, &hubStatusError{StatusCode: resp.StatusCode}
+}
+
+// urlExpiry reads the expiry of a presigned URL from its query: S3's
+// X-Amz-Date plus X-Amz-Expires, or CloudFront's Expires timestamp.
+func urlExpiry(u *url.URL) (time.Time, bool) {
+	query := u.Query()
+	if date, expires := query.Get("X-Amz-Date"), query.Get("X-Amz-Expires"); date != "" && expires != "" {
+		signed, err := time.Parse("20060102T150405Z", date)
+		seconds, err2 := strconv.Atoi(expires)
+		if err == nil && err2 == nil {
+			return signed.Add(time.Duration(seconds) * time.Second), true
+		}
+	}
+	if expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64); err == nil {
+		return time.Unix(expires, 0).UTC(), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,77 @@
+package hfdownloader
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestResolveURLs(t *testing.T) {
+	files := map[string]hubFile{
+		"config.json":         {Content: "{}"},
+		"model.safetensors":   {Content: "weights", LFS: true},
+		"onnx/model.onnx":     {Content: "onnx", LFS: true},
+		"README.md":           {Content: "# model"},
+		"onnx/tokenizer.json": {Content: "{}"},
+	}
+	hub, cdn := newFakeHub(t, files), newFakeHub(t, files)
+	hub.route("cdn-lfs.hf.co", cdn.Server)
+	hub.redirect = func(r *http.Request) string {
+		if hub.files[resolvePath.FindStringSubmatch(r.URL.Path)[1]].LFS {
+			return "https://cdn-lfs.hf.co/repos/ab/cd" + r.URL.Path + "?X-Amz-Date=20260101T000000Z&X-Amz-Expires=3600&X-Amz-Signature=sig"
+		}
+		return ""
+	}
+	opts := hubOptions(t)
+	opts.Branch = "v1.0"
+	opts.Exclude = []string{"*.md"}
+	d, _ := hub.downloader()
+	resolved, err := d.ResolveURLs(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Path < resolved[j].Path })
+
+	dir := filepath.Join(opts.Storage, "o", "m")
+	expires := time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC)
+	want := []ResolvedURL{
+		{Path: "config.json", LocalPath: filepath.Join(dir, "config.json"), URL: "https://huggingface.co/o/m/resolve/v1.0/config.json?download=true"},
+		{Path: "model.safetensors", LocalPath: filepath.Join(dir, "model.safetensors"), URL: "https://cdn-lfs.hf.co/repos/ab/cd/o/m/resolve/v1.0/model.safetensors?X-Amz-Date=20260101T000000Z&X-Amz-Expires=3600&X-Amz-Signature=sig", Expires: expires, Presigned: true},
+		{Path: "onnx/model.onnx", LocalPath: filepath.Join(dir, "onnx", "model.onnx"), URL: "https://cdn-lfs.hf.co/repos/ab/cd/o/m/resolve/v1.0/onnx/model.onnx?X-Amz-Date=20260101T000000Z&X-Amz-Expires=3600&X-Amz-Signature=sig", Expires: expires, Presigned: true},
+		{Path: "onnx/tokenizer.json", LocalPath: filepath.Join(dir, "onnx", "tokenizer.json"), URL: "https://huggingface.co/o/m/resolve/v1.0/onnx/tokenizer.json?download=true"},
+	}
+	if len(resolved) != len(want) {
+		t.Fatalf("resolved %+v, want %+v", resolved, want)
+	}
+	for i := range want {
+		if resolved[i] != want[i] {
+			t.Errorf("got %+v\nwant %+v", resolved[i], want[i])
+		}
+	}
+	for _, r := range hub.requestsTo("/resolve/") {
+		if r.Method != http.MethodHead {
+			t.Errorf("%s %s fetched a file", r.Method, r.URL.Path)
+		}
+	}
+	if n := cdn.hits("/"); n != 0 {
+		t.Fatalf("contacted the CDN %d times", n)
+	}
+}
+
+func TestURLExpiry(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  time.Time
+	}{
+		{"X-Amz-Date=20260101T000000Z&X-Amz-Expires=600", time.Date(2026, 1, 1, 0, 10, 0, 0, time.UTC)},
+		{"Expires=1767225600&Signature=sig&Key-Pair-Id=k", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"X-Xet-Signature=sig", time.Time{}},
+	} {
+		u, _ := http.NewRequest("GET", "https://cdn-lfs.hf.co/blob?"+tc.query, nil)
+		if got, _ := urlExpiry(u.URL); !got.Equal(tc.want) {
+			t.Errorf("%s: expiry %s, want %s", tc.query, got, tc.want)
+		}
+	}
+}
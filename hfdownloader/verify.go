@@ -0,0 +1,208 @@
+package hfdownloader
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RemoteDiff is the difference between a local snapshot and the current remote
+// revision, from the point of view of the local copy.
+type RemoteDiff struct {
+	Added     []string `json:"added"`    // on the remote but missing locally
+	Deleted   []string `json:"deleted"`  // local files no longer on the remote
+	Modified  []string `json:"modified"` // present on both sides with different content
+	Unchanged int      `json:"unchanged"`
+}
+
+// Clean reports whether the local snapshot matches the remote.
+func (r *RemoteDiff) Clean() bool {
+	return len(r.Added) == 0 && len(r.Deleted) == 0 && len(r.Modified) == 0
+}
+
+// VerifyRemote compares the files under opts.Storage against the current remote
+// tree without downloading anything. Sizes are always compared; contents are
+// hashed unless opts.SkipSHA is set, in which case the manifest is trusted.
+func (d *Downloader) VerifyRemote(opts DownloadOptions) (*RemoteDiff, error) {
+	branch, err := d.resolveBranch(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Branch = branch
+
+	modelPath := repoDir(opts)
+
+	remote, err := d.enumerateFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.selectFiles(remote, opts); err != nil {
+		return nil, err
+	}
+
+	manifest, err := LoadManifest(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	d.checkManifestSignature(manifest, modelPath, opts)
+
+	diff := &RemoteDiff{}
+	for _, file := range remote {
+		if file.FilterSkip || file.Size <= 0 {
+			continue
+		}
+
+		localName, decompressed := localPathFor(opts, file.Path)
+		localPath := filepath.Join(modelPath, localName)
+		info, err := os.Stat(localPath)
+		if err != nil {
+			diff.Added = append(diff.Added, file.Path)
+			continue
+		}
+		if file.isSymlink() {
+			// The recorded size is the length of the link target, not of the file
+			diff.Unchanged++
+			continue
+		}
+		if decompressed {
+			// The local file no longer matches the remote bytes, so rely on the manifest
+			entry, ok := manifest.Get(file.Path)
+			if ok && entry.Size == int64(file.Size) && (file.Lfs == nil || entry.SHA256 == file.Lfs.Oid_SHA265) {
+				diff.Unchanged++
+			} else {
+				diff.Modified = append(diff.Modified, file.Path)
+			}
+			continue
+		}
+		if info.Size() != int64(file.Size) {
+			diff.Modified = append(diff.Modified, file.Path)
+			continue
+		}
+
+		same, err := sameContent(localPath, file, manifest, opts.SkipSHA)
+		if err != nil {
+			return nil, err
+		}
+		if same {
+			diff.Unchanged++
+		} else {
+			diff.Modified = append(diff.Modified, file.Path)
+		}
+	}
+
+	// Anything local that the remote no longer has
+	if diff.Deleted, err = localExtras(modelPath, remote, opts); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Modified)
+	return diff, nil
+}
+
+// localExtras lists the local files under modelPath, as repo paths, that the
+// path filters in opts select but that are not in the remote listing.
+// Bookkeeping files and the files the run writes itself are never reported.
+func localExtras(modelPath string, remote []hfmodel, opts DownloadOptions) ([]string, error) {
+	remotePaths := make(map[string]bool, len(remote))
+	for _, file := range remote {
+		remotePaths[file.Path] = true
+		if localName, _ := localPathFor(opts, file.Path); localName != file.Path {
+			remotePaths[localName] = true
+		}
+	}
+
+	outputs := opts.outputFiles()
+	var extras []string
+	err := filepath.WalkDir(modelPath, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || isBookkeepingFile(entry.Name()) {
+			return nil
+		}
+		if abs, err := filepath.Abs(p); err == nil && outputs[abs] {
+			return nil
+		}
+		rel, err := filepath.Rel(modelPath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !remotePaths[rel] && wantsPath(opts, rel) {
+			extras = append(extras, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %v", modelPath, err)
+	}
+	sort.Strings(extras)
+	return extras, nil
+}
+
+// isBookkeepingFile reports whether a local file belongs to the downloader
+// itself rather than the repo.
+func isBookkeepingFile(name string) bool {
+	return strings.HasPrefix(name, ManifestFileName) || strings.HasPrefix(name, StateFileName) || strings.HasSuffix(name, ".part")
+}
+
+// outputFiles is the set of absolute paths the run writes besides the repo's
+// own files: the state file, attestation, checksum list and opts.ReportFiles.
+func (opts DownloadOptions) outputFiles() map[string]bool {
+	outputs := make(map[string]bool)
+	for _, p := range append([]string{opts.StateFile, opts.Attestation, opts.ChecksumFile}, opts.ReportFiles...) {
+		if p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			outputs[abs] = true
+		}
+	}
+	return outputs
+}
+
+// sameContent checks a local file against the remote entry. LFS files are
+// compared by SHA256, regular files by their git blob id.
+func sameContent(localPath string, file hfmodel, manifest *Manifest, skipSHA bool) (bool, error) {
+	if skipSHA {
+		if entry, ok := manifest.Get(file.Path); ok && file.Lfs != nil && entry.SHA256 != "" {
+			return entry.SHA256 == file.Lfs.Oid_SHA265, nil
+		}
+		return true, nil
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %v", localPath, err)
+	}
+	defer f.Close()
+
+	if file.Lfs != nil {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return false, fmt.Errorf("failed to hash %s: %v", localPath, err)
+		}
+		return hex.EncodeToString(hash.Sum(nil)) == file.Lfs.Oid_SHA265, nil
+	}
+
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %d\x00", file.Size)
+	if _, err := io.Copy(hash, f); err != nil {
+		return false, fmt.Errorf("failed to hash %s: %v", localPath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == file.Oid, nil
+}
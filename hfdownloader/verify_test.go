@@ -0,0 +1,54 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRemote(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":     {Content: `{"a":1}`},
+		"sub/weights.bin": {Content: "weights", LFS: true},
+	})
+	opts := hubOptions(t)
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	hub.files["config.json"] = hubFile{Content: `{"a":2}`}
+	hub.files["new.txt"] = hubFile{Content: "new"}
+	delete(hub.files, "sub/weights.bin")
+
+	diff, err := d.VerifyRemote(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(diff.Added, ",") != "new.txt" || strings.Join(diff.Modified, ",") != "config.json" || strings.Join(diff.Deleted, ",") != "sub/weights.bin" {
+		t.Fatalf("diff %+v", diff)
+	}
+}
+
+// A folder that fails to list must not show up as deleted files.
+func TestVerifyRemoteFailsOnUnlistedFolder(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{
+		"config.json":     {Content: `{"a":1}`},
+		"sub/weights.bin": {Content: "weights", LFS: true},
+	})
+	opts := hubOptions(t)
+	d, _ := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	hub.fail = func(r *http.Request) int {
+		if strings.Contains(r.URL.Path, "/tree/") && strings.HasSuffix(r.URL.Path, "/sub") {
+			return http.StatusNotFound
+		}
+		return 0
+	}
+	if _, err := d.VerifyRemote(opts); !errors.Is(err, ErrIncompleteListing) {
+		t.Fatalf("error %v, want ErrIncompleteListing", err)
+	}
+}
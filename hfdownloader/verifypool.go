@@ -0,0 +1,102 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// verifyJob is a file fetched into its .part path with its hash unchecked.
+type verifyJob struct {
+	fetch  fileFetch
+	header http.Header
+}
+
+// verifyPool hashes downloaded files apart from the download workers, so a
+// worker can start its next transfer while the last one is checked. Files only
+// reach their final name once they pass.
+type verifyPool struct {
+	jobs chan verifyJob
+	wg   sync.WaitGroup
+}
+
+// newVerifyPool starts workers verifiers. done is called with every file that
+// passes, or that passed after downloading it again; fail with every file that
+// didn't.
+func (d *Downloader) newVerifyPool(ctx context.Context, workers int, done func(fileFetch, http.Header), fail func(string, error)) *verifyPool {
+	p := &verifyPool{jobs: make(chan verifyJob, workers)}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				header, err := d.verifyPart(ctx, job)
+				if err != nil {
+					fail(job.fetch.file.Path, err)
+					continue
+				}
+				if header != nil {
+					done(job.fetch, header)
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// add queues a fetched file, waiting while every verifier is busy.
+func (p *verifyPool) add(f fileFetch, header http.Header) {
+	p.jobs <- verifyJob{fetch: f, header: header}
+}
+
+// close waits for the queued files to be verified. A nil pool is a no-op.
+func (p *verifyPool) close() {
+	if p == nil {
+		return
+	}
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+// verifyPart checks a job's .part file and moves it to its final name. A
+// mismatch that its options allow to retry is downloaded again, verified
+// inline this time, and that response's headers are returned.
+func (d *Downloader) verifyPart(ctx context.Context, job verifyJob) (http.Header, error) {
+	f := job.fetch
+	partPath := f.localPath + ".part"
+	err := d.checkPart(partPath, f.file)
+	if err == nil {
+		if err := os.Rename(partPath, f.localPath); err != nil {
+			return nil, fmt.Errorf("failed to finalize %s: %v", f.localPath, err)
+		}
+		return job.header, nil
+	}
+	os.Remove(partPath)
+
+	retries := f.opts.mismatchRetries(f.file)
+	if !errors.Is(err, ErrChecksumMismatch) || retries == 0 || ctx.Err() != nil {
+		d.logf("Error transferring %s: %v\n", f.file.Path, err)
+		return nil, fmt.Errorf("failed to transfer: %w", err)
+	}
+	d.logf("Warning: %v, downloading it again (1/%d)\n", err, retries)
+	f.deferVerify, f.retried = false, 1
+	return d.fetchFile(ctx, f)
+}
+
+// checkPart hashes a downloaded file the way downloadToLocal does as it writes.
+func (d *Downloader) checkPart(partPath string, file hfmodel) error {
+	in, err := os.Open(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", partPath, err)
+	}
+	defer in.Close()
+
+	hash := newContentHash(file)
+	if _, err := d.copy(hash, in); err != nil {
+		return fmt.Errorf("failed to read %s: %v", partPath, err)
+	}
+	return checkContentHash(file, hash)
+}
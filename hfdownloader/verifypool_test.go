@@ -0,0 +1,108 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestVerifyWorkers(t *testing.T) {
+	files := map[string]hubFile{"config.json": {Content: `{"a":1}`}}
+	for i := 0; i < 6; i++ {
+		files[fmt.Sprintf("model-%d.safetensors", i)] = hubFile{Content: fmt.Sprintf("weights %d", i), LFS: true}
+	}
+	hub := newFakeHub(t, files)
+	opts := hubOptions(t)
+	opts.VerifyWorkers = 2
+	opts.SHAMismatch = MismatchPolicies{Regular: MismatchFail}
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	dir := filepath.Join(opts.Storage, "o", "m")
+	for name, file := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != file.Content {
+			t.Fatalf("%s = %q, %v", name, got, err)
+		}
+	}
+	if n := strings.Count(out.String(), "✅ Verified"); n != len(files) {
+		t.Fatalf("%d files verified by the pool, want %d:\n%s", n, len(files), out)
+	}
+	parts, _ := filepath.Glob(filepath.Join(dir, "*.part"))
+	if len(parts) != 0 {
+		t.Fatalf("parts left behind: %v", parts)
+	}
+}
+
+func TestVerifyWorkersRetryMismatch(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: "weights", LFS: true}})
+	var served atomic.Int32
+	hub.corrupt = func(r *http.Request) bool { return served.Add(1) == 1 }
+	opts := hubOptions(t)
+	opts.VerifyWorkers = 1
+	opts.RedownloadCorrupted = 2
+	d, out := hub.downloader()
+	if _, err := d.Download(context.Background(), opts); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	got, err := os.ReadFile(filepath.Join(opts.Storage, "o", "m", "model.safetensors"))
+	if err != nil || string(got) != "weights" {
+		t.Fatalf("model.safetensors = %q, %v", got, err)
+	}
+	if n := hub.hits("/resolve/"); n != 2 {
+		t.Fatalf("%d downloads, want 2", n)
+	}
+	if !strings.Contains(out.String(), "downloading it again (1/2)") {
+		t.Fatalf("retry not logged:\n%s", out)
+	}
+}
+
+func TestVerifyWorkersFailMismatch(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"model.safetensors": {Content: "weights", LFS: true}})
+	hub.corrupt = func(r *http.Request) bool { return true }
+	opts := hubOptions(t)
+	opts.VerifyWorkers = 1
+	d, _ := hub.downloader()
+	_, err := d.Download(context.Background(), opts)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("error %v, want a checksum mismatch", err)
+	}
+	dir := filepath.Join(opts.Storage, "o", "m")
+	for _, name := range []string{"model.safetensors", "model.safetensors.part"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Fatalf("corrupt copy kept as %s", name)
+		}
+	}
+}
+
+// BenchmarkVerifyWorkers compares hashing while streaming with hashing in a
+// separate pool. The pool only pays off with cores to spare for it.
+func BenchmarkVerifyWorkers(b *testing.B) {
+	files := make(map[string]hubFile)
+	var size int64
+	for i := 0; i < 8; i++ {
+		content := strings.Repeat(fmt.Sprintf("shard %d ", i), 1<<17)
+		files[fmt.Sprintf("model-%d.safetensors", i)] = hubFile{Content: content, LFS: true}
+		size += int64(len(content))
+	}
+	hub := newFakeHub(b, files)
+	for _, workers := range []int{0, 4} {
+		b.Run(fmt.Sprintf("verify-workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				opts := DownloadOptions{Repo: "o/m", Branch: "main", Storage: b.TempDir(), MaxWorkers: 4, VerifyWorkers: workers}
+				d, _ := hub.downloader()
+				if _, err := d.Download(context.Background(), opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package hfdownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// watchFirstBackoff is the wait after a failed watch cycle. It doubles with
+// every further failure, up to the watch interval.
+const watchFirstBackoff = time.Minute
+
+// Watch keeps the download of opts in sync with the remote until ctx is
+// cancelled. Every interval it looks up the commit the revision points to and
+// runs sync only when that commit differs from the last one synced, logging a
+// line either way. The first cycle always syncs, which for an existing copy
+// only fetches what changed. Failed cycles are retried with a backoff capped
+// at interval instead of hammering the API. sync nil uses Download.
+//
+// Cancelling ctx while waiting returns nil; cancelling it mid-sync returns
+// the sync's error, normally wrapping ErrInterrupted.
+func (d *Downloader) Watch(ctx context.Context, opts DownloadOptions, interval time.Duration, sync func(ctx context.Context) error) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid watch interval %s", interval)
+	}
+	if sync == nil {
+		sync = func(ctx context.Context) error {
+			_, err := d.Download(ctx, opts)
+			return err
+		}
+	}
+
+	synced := ""
+	failures := 0
+	for {
+		commit, err := d.watchCycle(ctx, opts, synced, sync)
+		if errors.Is(err, ErrInterrupted) || ctx.Err() != nil {
+			return err
+		}
+
+		wait := interval
+		if err != nil {
+			failures++
+			wait = watchBackoff(interval, failures)
+			d.logf("Warning: watch cycle failed (%d in a row), retrying in %s: %v\n", failures, wait, err)
+		} else {
+			failures = 0
+			synced = commit
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			d.logf("Watch stopped\n")
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// watchCycle runs one check, syncing if the remote moved past synced, and
+// returns the commit the local copy is now at.
+func (d *Downloader) watchCycle(ctx context.Context, opts DownloadOptions, synced string, sync func(ctx context.Context) error) (string, error) {
+	commit, err := resolveCommit(d.client(), opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to check %s@%s: %w", opts.Repo, opts.Branch, err)
+	}
+	now := time.Now().Format(time.RFC3339)
+	if commit == synced {
+		d.logf("[%s] No changes, %s@%s is still at %s\n", now, opts.Repo, opts.Branch, commit)
+		return commit, nil
+	}
+	if synced == "" {
+		d.logf("[%s] Syncing %s@%s at %s\n", now, opts.Repo, opts.Branch, commit)
+	} else {
+		d.logf("[%s] %s@%s moved from %s to %s, syncing\n", now, opts.Repo, opts.Branch, synced, commit)
+	}
+	if err := sync(ctx); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// watchBackoff is the wait after the given number of consecutive failures.
+func watchBackoff(interval time.Duration, failures int) time.Duration {
+	wait := watchFirstBackoff
+	for i := 1; i < failures && wait < interval; i++ {
+		wait *= 2
+	}
+	if wait > interval {
+		wait = interval
+	}
+	return wait
+}
@@ -0,0 +1,57 @@
+package hfdownloader
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchSyncsOnlyWhenTheCommitMoves(t *testing.T) {
+	hub := newFakeHub(t, map[string]hubFile{"config.json": {Content: `{"a":1}`}})
+	d, out := hub.downloader()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	syncs := 0
+	sync := func(ctx context.Context) error {
+		syncs++
+		return nil
+	}
+	go func() {
+		for hub.hits("/revision/") < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if err := d.Watch(ctx, hubOptions(t), 5*time.Millisecond, sync); err != nil {
+		t.Fatalf("cancelled while waiting: %v", err)
+	}
+	if syncs != 1 {
+		t.Fatalf("synced %d times, want once for an unchanged commit", syncs)
+	}
+	if !strings.Contains(out.String(), "No changes, o/m@main is still at "+testCommit) {
+		t.Errorf("unchanged cycles not logged:\n%s", out.String())
+	}
+
+	if err := d.Watch(context.Background(), hubOptions(t), 0, sync); err == nil {
+		t.Fatal("zero interval accepted")
+	}
+}
+
+func TestWatchBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		interval time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{time.Hour, 1, time.Minute},
+		{time.Hour, 3, 4 * time.Minute},
+		{time.Hour, 10, time.Hour},
+		{30 * time.Second, 1, 30 * time.Second},
+	} {
+		if got := watchBackoff(tc.interval, tc.failures); got != tc.want {
+			t.Errorf("watchBackoff(%s, %d) = %s, want %s", tc.interval, tc.failures, got, tc.want)
+		}
+	}
+}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
 	"time"
 
 	hfd "github.com/bodaay/HuggingFaceModelDownloader/hfdownloader"
@@ -22,30 +31,119 @@ import (
 const VERSION = "1.4.2"
 
 type Config struct {
-	NumConnections     int    `json:"num_connections"`
-	RequiresAuth       bool   `json:"requires_auth"`
-	AuthToken          string `json:"auth_token"`
-	ModelName          string `json:"model_name"`
-	DatasetName        string `json:"dataset_name"`
-	Branch             string `json:"branch"`
-	Storage            string `json:"storage"`
-	OneFolderPerFilter bool   `json:"one_folder_per_filter"`
-	SkipSHA            bool   `json:"skip_sha"`
+	NumConnections     int      `json:"num_connections"` // Only used as the concurrency of --cleanup-corrupted; see max_workers and max_conns_per_host
+	RequiresAuth       bool     `json:"requires_auth"`
+	AuthToken          string   `json:"auth_token"`
+	ModelName          string   `json:"model_name"`
+	DatasetName        string   `json:"dataset_name"`
+	SpaceName          string   `json:"space_name"`
+	Branch             string   `json:"branch"`
+	BranchFallback     []string `json:"branch_fallback"`
+	Storage            string   `json:"storage"`
+	CacheLayout        string   `json:"cache_layout"` // plain or hub
+	HFHome             string   `json:"hf_home"`      // Store in this HF_HOME's hub cache
+	OneFolderPerFilter bool     `json:"one_folder_per_filter"`
+	SkipSHA            bool     `json:"skip_sha"`
+	QuickVerify        bool     `json:"quick_verify"`
+	QuickVerifyMB      int      `json:"quick_verify_mb"` // MB hashed at each end of a file by --quick-verify
+	OnlyMissing        bool     `json:"only_missing"`    // Trust local files matching by name and size, hashing nothing
 	// Install            bool   `json:"install"`
 	// InstallPath        string `json:"install_path"`
-	MaxRetries    int    `json:"max_retries"`
-	RetryInterval int    `json:"retry_interval"`
-	JustDownload  bool   `json:"just_download"`
-	SilentMode    bool   `json:"silent_mode"`
-	UseR2         bool   `json:"use_r2"`
-	R2BucketName  string `json:"r2_bucket_name"`
-	R2AccountID   string `json:"r2_account_id"`
-	R2AccessKey   string `json:"r2_access_key"`
-	R2SecretKey   string `json:"r2_secret_key"`
-	SkipLocal     bool   `json:"skip_local"`
-	R2Subfolder   string `json:"r2_subfolder"`
-	HFPrefix      string `json:"hf_prefix"`
-	MaxWorkers    int    `json:"max_workers"`   // Maximum number of worker goroutines
+	MaxRetries          int      `json:"max_retries"`
+	RetryInterval       int      `json:"retry_interval"`
+	JustDownload        bool     `json:"just_download"`
+	SilentMode          bool     `json:"silent_mode"`
+	UseR2               bool     `json:"use_r2"`
+	R2BucketName        string   `json:"r2_bucket_name"`
+	R2AccountID         string   `json:"r2_account_id"`
+	R2AccessKey         string   `json:"r2_access_key"`
+	R2SecretKey         string   `json:"r2_secret_key"`
+	R2Profile           string   `json:"r2_profile"` // Profile in ~/.aws/credentials holding the R2 keys
+	SkipLocal           bool     `json:"skip_local"`
+	Tee                 bool     `json:"tee"` // Keep a local copy while uploading to R2, in one pass
+	R2Subfolder         string   `json:"r2_subfolder"`
+	UseGCS              bool     `json:"use_gcs"`
+	GCSBucket           string   `json:"gcs_bucket"`
+	GCSPrefix           string   `json:"gcs_prefix"`
+	UseAzure            bool     `json:"use_azure"`
+	AzureContainer      string   `json:"azure_container"`
+	AzurePrefix         string   `json:"azure_prefix"`
+	HFPrefix            string   `json:"hf_prefix"`
+	Dirs                []string `json:"dirs"`                 // Only fetch files under these repo folders
+	StripPrefix         bool     `json:"strip_prefix"`         // Store files relative to the folder the dirs share
+	MaxWorkers          int      `json:"max_workers"`          // Maximum number of worker goroutines
+	AdaptiveConcurrency bool     `json:"adaptive_concurrency"` // Ramp workers up to MaxWorkers while throughput improves, halve them when throttled
+	PreferFormat        string   `json:"prefer_format"`
+	Include             []string `json:"include"`
+	Exclude             []string `json:"exclude"`
+	Extensions          []string `json:"ext"`             // Only download files with these extensions, e.g. gguf,json
+	AlwaysFetch         []string `json:"always_fetch"`    // Patterns of files downloaded again on every run
+	NoCacheConfig       bool     `json:"no_cache_config"` // Download every regular (non-LFS) file again on every run
+	IncludeFrom         string   `json:"include_from"`    // File of include patterns, one per line
+	ExcludeFrom         string   `json:"exclude_from"`    // File of exclude patterns, one per line
+	Rename              []string `json:"rename"`          // src=dst pairs
+	RenameMap           string   `json:"rename_map"`      // JSON file mapping repo paths to local paths
+	WeightsOnly         bool     `json:"weights_only"`
+	FromIndex           bool     `json:"from_index"`   // Only the shards the model's index references, plus config and tokenizer
+	DocPatterns         []string `json:"doc_patterns"` // Replaces the files --weights-only skips
+	FailOnMissing       bool     `json:"fail_on_missing"`
+	Since               string   `json:"since"`
+	SinceStrict         bool     `json:"since_strict"`
+	TouchTimestamps     bool     `json:"touch_timestamps"`
+	DatasetWorkers      int      `json:"dataset_workers"`   // Worker goroutines for datasets, 0 to use MaxWorkers
+	PrefetchMetadata    int      `json:"prefetch_metadata"` // Concurrent repo tree listing requests, 0 for the default
+	VerifyWorkers       int      `json:"verify_workers"`    // Goroutines hashing finished local files, 0 to hash while downloading
+	ShutdownGrace       int      `json:"shutdown_grace"`    // Seconds in-flight files may take to finish after SIGTERM/SIGINT
+	Timeout             string   `json:"timeout"`           // Wall-clock limit for the whole download, e.g. 30m
+	WatchInterval       string   `json:"watch_interval"`    // How often --watch checks the remote, e.g. 1h
+	ContinueOnError     bool     `json:"continue_on_error"`
+	RedownloadCorrupted bool     `json:"redownload_corrupted"`       // Fetch a file failing its checksum again, up to MaxRetries times, before failing it
+	SHAMismatch         string   `json:"sha_mismatch"`               // What a failed checksum does: retry, fail or accept, with lfs= and regular= overrides
+	ChunkSize           string   `json:"chunk_size"`                 // Download copy buffer, e.g. "1MB"
+	LowMemory           bool     `json:"low_memory"`                 // Cap workers and buffers for devices with little RAM
+	MaxOpenFiles        int      `json:"max_open_files"`             // Bound on simultaneously open destination files, 0 for none
+	LimitParallelLarge  int      `json:"limit_parallel_large_files"` // Files over LargeFileThreshold downloading at once, 0 for no extra limit
+	LargeFileThreshold  string   `json:"large_file_threshold"`       // Size from which LimitParallelLarge applies, e.g. "1GB"
+	MaxFiles            int      `json:"max_files"`                  // Only download the first N selected files by path, 0 for all
+	MaxTotalSize        string   `json:"max_total_size"`             // Only download selected files by path while their total fits in this size, e.g. "50GB"
+	RequireFree         string   `json:"require_free"`               // Refuse to start unless RequireFreePath has this much free space, e.g. "200GB"
+	RequireFreePath     string   `json:"require_free_path"`          // Mount checked by RequireFree, the storage folder when empty
+	Decompress          bool     `json:"decompress"`
+	NoDownloadParam     bool     `json:"no_download_param"`
+	Endpoints           []string `json:"endpoints"`     // Mirrors to fetch file content from, failing over between them
+	EndpointAuth        bool     `json:"endpoint_auth"` // Send the token to the mirrors too, not only to huggingface.co
+	DedupeByHash        bool     `json:"dedupe_by_hash"`
+	DerefSymlinks       bool     `json:"deref_symlinks"` // Copy symlink targets instead of recreating the links
+	SkipPointers        bool     `json:"skip_pointers"`
+	StateFile           string   `json:"state_file"`       // Job state location, .hfdownloader-state.json in the download folder by default
+	OnFileComplete      string   `json:"on_file_complete"` // Command run after each file, e.g. "process {{.LocalPath}}"
+	Transforms          []string `json:"transforms"`       // "[pattern=]name" transforms run on each downloaded file, see --transform
+	OnComplete          string   `json:"on_complete"`      // Command run after the whole download
+	HookFatal           bool     `json:"hook_fatal"`       // Fail the download when a hook exits non-zero
+	UserAgent           string   `json:"user_agent"`       // Overrides the default hfdownloader/<version> User-Agent
+	DisableHTTP2        bool     `json:"disable_http2"`
+	NoCompression       bool     `json:"no_compression"`          // Don't ask the Hub for zstd or gzip transfer encoding
+	MaxIdleConnsPerHost int      `json:"max_idle_conns_per_host"` // 0 keeps the default
+	MaxConnsPerHost     int      `json:"max_conns_per_host"`      // 0 for no cap
+	CABundle            string   `json:"ca_bundle"`               // Extra PEM CA certificates to trust, e.g. for a TLS-inspecting proxy
+	InsecureSkipVerify  bool     `json:"insecure_skip_verify"`
+	IPVersion           string   `json:"ip_version"`         // auto, 4 or 6
+	KeepAliveInterval   string   `json:"keepalive_interval"` // TCP keepalive interval, e.g. 10s; connections silent for three intervals are dropped
+	LogLevel            string   `json:"log_level"`          // debug, info, warn or error
+	LogFormat           string   `json:"log_format"`         // plain, text or json
+	ManifestKey         string   `json:"manifest_key"`       // HMAC key for manifest signatures, better set via HFDOWNLOADER_MANIFEST_KEY
+	SignManifest        bool     `json:"sign_manifest"`
+	NoOverwriteManifest bool     `json:"no_overwrite_manifest"`
+	Attestation         string   `json:"attestation"`           // Path of the provenance record written after a successful run
+	ExpectCommit        string   `json:"expect_commit"`         // Abort before downloading unless the revision resolves to this commit SHA
+	ChecksumFile        string   `json:"checksum_manifest_out"` // SHA256SUMS-style file written after a successful run
+	ChecksumFormat      string   `json:"checksum_format"`       // sha256sum, json or csv
+	GitLayout           bool     `json:"git_layout"`            // Make the download folder a git repository pointing at the Hub commit
+	ErrorReport         string   `json:"error_report"`          // Path of the JSON report written when a run fails
+	SummaryJSON         string   `json:"summary_json"`          // Path of the JSON summary written after every run
+	AuthHeaderName      string   `json:"auth_header_name"`      // e.g. X-API-Key for a gateway, default Authorization
+	AuthHeaderFormat    string   `json:"auth_header_format"`    // template for the header value, default "Bearer {{.Token}}"
+	Headers             []string `json:"headers"`               // Extra "Name: Value" headers sent to huggingface.co and trusted mirrors
 }
 
 // DefaultConfig returns a config instance populated with default values.
@@ -57,27 +155,86 @@ func DefaultConfig() Config {
 		MaxRetries:     3,
 		RetryInterval:  5,
 		R2Subfolder:    "hf_dataset",
-		MaxWorkers:     16, // Default to 16 worker goroutines
+		GCSPrefix:      "hf_dataset",
+		AzurePrefix:    "hf_dataset",
+		QuickVerifyMB:  8,
+		ShutdownGrace:  300,
+		WatchInterval:  "1h",
 	}
 }
 
-func LoadConfig() (*Config, error) {
-	config := DefaultConfig() // Use defaults as a base
+// defaultConfigPath returns ~/.config/hfdownloader.json.
+func defaultConfigPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	configPath := filepath.Join(homeDir, ".config", "hfdownloader.json")
+	return filepath.Join(homeDir, ".config", "hfdownloader.json"), nil
+}
 
-	file, err := os.ReadFile(configPath)
-	if os.IsNotExist(err) {
-		return &config, nil // Return defaults if file does not exist
-	} else if err == nil {
-		if err := json.Unmarshal(file, &config); err != nil {
+// configPathFromArgs finds the value of --config in the command line. It has to
+// be known before the flags are parsed, since the config supplies their defaults.
+func configPathFromArgs(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--config="); ok {
+			return value
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// strictConfigFromArgs reports whether --strict-config is in the command line,
+// which like --config has to be known before the flags are parsed.
+func strictConfigFromArgs(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--strict-config" || arg == "--strict-config=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadConfig loads the config file at configPath, or the default one when
+// configPath is empty. Only the default file may be missing. With strict,
+// fields the config doesn't know are an error instead of being ignored.
+func LoadConfig(configPath string, strict bool) (*Config, error) {
+	config := DefaultConfig() // Use defaults as a base
+	explicit := configPath != ""
+	if !explicit {
+		var err error
+		if configPath, err = defaultConfigPath(); err != nil {
 			return nil, err
 		}
 	}
 
+	// Defaults are kept if the default file does not exist
+	file, err := os.ReadFile(configPath)
+	if err == nil {
+		if err := decodeConfig(file, &config, strict); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %v", configPath, err)
+		}
+	} else if explicit {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	// Environment overrides sit between the config file and explicit flags
+	if err := applyEnvOverrides(&config); err != nil {
+		return nil, err
+	}
+
+	if err := validateConfig(&config); err != nil {
+		return nil, err
+	}
+
 	// Check if an environment variable to always enable the 'just download' feature is enabled
 	envVar := os.Getenv("HFDOWNLOADER_JUST_DOWNLOAD")
 	if envVar == "1" || envVar == "true" {
@@ -87,12 +244,202 @@ func LoadConfig() (*Config, error) {
 	return &config, nil
 }
 
-func generateConfigFile() error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return err
+// decodeConfig decodes a config file, turning the decoder's errors into ones
+// that name the offending field and where it is.
+func decodeConfig(data []byte, config *Config, strict bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	err := decoder.Decode(config)
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &syntaxErr):
+		line, col := lineAndColumn(data, syntaxErr.Offset)
+		return fmt.Errorf("line %d, column %d: %v", line, col, syntaxErr)
+	case errors.As(err, &typeErr):
+		line, col := lineAndColumn(data, typeErr.Offset)
+		return fmt.Errorf("line %d, column %d: %q must be %s, got %s", line, col, typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value)
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		if suggestion := closestConfigField(field); suggestion != "" {
+			return fmt.Errorf("unknown field %q, did you mean %q?", field, suggestion)
+		}
+		return fmt.Errorf("unknown field %q", field)
+	}
+	return err
+}
+
+// lineAndColumn converts the byte offset the JSON decoder reports, which is
+// just past the offending character, into that character's 1-based line and
+// column.
+func lineAndColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset > 0 {
+		offset--
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// jsonTypeName describes a Go type the way it is written in JSON.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Slice:
+		return "a list of " + strings.TrimPrefix(jsonTypeName(t.Elem()), "a ") + "s"
+	case reflect.Map:
+		return "an object"
+	}
+	return t.String()
+}
+
+// closestConfigField returns the config field name nearest to a misspelled
+// one, or "" when nothing is close enough to be a likely typo.
+func closestConfigField(name string) string {
+	best, bestDistance := "", 4
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		field := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if distance := editDistance(strings.ToLower(name), field); distance < bestDistance {
+			best, bestDistance = field, distance
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// validateConfig checks the ranges of loaded values, naming the config key and
+// its environment variable so the setting is easy to find.
+func validateConfig(config *Config) error {
+	checks := []struct {
+		key  string
+		ok   bool
+		want string
+	}{
+		{"num_connections", config.NumConnections > 0, "at least 1"},
+		{"max_workers", config.MaxWorkers >= 0, "0 (auto) or more"},
+		{"max_open_files", config.MaxOpenFiles >= 0, "0 (no bound) or more"},
+		{"limit_parallel_large_files", config.LimitParallelLarge >= 0, "0 (no extra limit) or more"},
+		{"max_retries", config.MaxRetries > 0, "at least 1"},
+		{"retry_interval", config.RetryInterval >= 0, "0 or more seconds"},
+		{"dataset_workers", config.DatasetWorkers >= 0, "0 (use max_workers) or more"},
+		{"prefetch_metadata", config.PrefetchMetadata >= 0, "0 (the default) or more"},
+		{"verify_workers", config.VerifyWorkers >= 0, "0 (hash while downloading) or more"},
+		{"shutdown_grace", config.ShutdownGrace >= 0, "0 (no limit) or more seconds"},
+		{"max_files", config.MaxFiles >= 0, "0 (all files) or more"},
+		{"max_idle_conns_per_host", config.MaxIdleConnsPerHost >= 0, "0 (the default) or more"},
+		{"max_conns_per_host", config.MaxConnsPerHost >= 0, "0 (no cap) or more"},
+		{"quick_verify_mb", config.QuickVerifyMB > 0, "at least 1"},
+	}
+	for _, check := range checks {
+		if !check.ok {
+			return fmt.Errorf("invalid config: %s must be %s (set in the config file or HFDOWNLOADER_%s)", check.key, check.want, strings.ToUpper(check.key))
+		}
+	}
+	return nil
+}
+
+// applyEnvOverrides sets config fields from HFDOWNLOADER_<FIELD> environment
+// variables, where FIELD is the upper-cased JSON name of the field, e.g.
+// HFDOWNLOADER_NUM_CONNECTIONS. List fields take comma-separated values.
+// HFDOWNLOADER_JUST_DOWNLOAD keeps its own meaning and is handled by LoadConfig.
+func applyEnvOverrides(config *Config) error {
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || name == "just_download" {
+			continue
+		}
+		key := "HFDOWNLOADER_" + strings.ToUpper(name)
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s=%q: expected an integer", key, value)
+			}
+			field.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s=%q: expected true or false", key, value)
+			}
+			field.SetBool(b)
+		case reflect.Slice:
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		}
+	}
+	return nil
+}
+
+// generateConfigFile writes the default config to configPath, or to the default
+// location when configPath is empty.
+func generateConfigFile(configPath string) error {
+	if configPath == "" {
+		var err error
+		if configPath, err = defaultConfigPath(); err != nil {
+			return err
+		}
 	}
-	configPath := filepath.Join(homeDir, ".config", "hfdownloader.json")
 
 	config := DefaultConfig()
 
@@ -112,16 +459,77 @@ func generateConfigFile() error {
 	return nil
 }
 
+// logger carries diagnostics from the CLI and the library; see setupLogger.
+var logger = slog.New(hfd.NewPlainHandler(stdoutWriter{}, nil))
+
+// stdoutWriter writes to whatever os.Stdout is at the time, so log lines follow
+// the redirect to stderr that --stdout, --peek and --print-urls set up.
+type stdoutWriter struct{}
+
+func (stdoutWriter) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+
+// setupLogger builds the logger for --log-level and --log-format.
+func setupLogger(config *Config) error {
+	var level slog.Level
+	if config.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(config.LogLevel)); err != nil {
+			return fmt.Errorf("invalid --log-level %q: expected debug, info, warn or error", config.LogLevel)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch config.LogFormat {
+	case "", "plain":
+		logger = slog.New(hfd.NewPlainHandler(stdoutWriter{}, opts))
+	case "text":
+		logger = slog.New(slog.NewTextHandler(stdoutWriter{}, opts))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(stdoutWriter{}, opts))
+	default:
+		return fmt.Errorf("invalid --log-format %q: expected plain, text or json", config.LogFormat)
+	}
+	return nil
+}
+
+// maskToken shows enough of a token to tell which one is set, and no more.
+func maskToken(token string) string {
+	if token == "" {
+		return "not set"
+	}
+	if len(token) <= 12 {
+		return "set (REDACTED)"
+	}
+	return token[:3] + "..." + token[len(token)-4:]
+}
+
 func main() {
-	config, err := LoadConfig()
+	configPath := configPathFromArgs(os.Args[1:])
+	config, err := LoadConfig(configPath, strictConfigFromArgs(os.Args[1:]))
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		log.Println("Error: failed to load configuration:", err)
+		os.Exit(exitCode(err))
 	}
 	var justDownload bool
 	var (
 		install          bool
 		installPath      string
 		cleanupCorrupted bool
+		cleanupDryRun    bool
+		cleanupRate      float64
+		cleanupAfter     string
+		verifyRemote     bool
+		jsonOutput       bool
+		mirror           bool
+		assumeYes        bool
+		streamStdout     bool
+		outputFile       string
+		overwrite        bool
+		printURLs        bool
+		concurrencyAuto  bool
+		peekFile         string
+		peekBytes        string
+		watch            bool
+		resetState       bool
+		interactive      bool
 	)
 	ShortString := fmt.Sprintf("a Simple HuggingFace Models Downloader Utility\nVersion: %s", VERSION)
 	currentPath, err := os.Executable()
@@ -136,6 +544,9 @@ func main() {
 		Short:         ShortString,
 		SilenceErrors: true,
 		SilenceUsage:  true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return setupLogger(config)
+		},
 		Args: func(cmd *cobra.Command, args []string) error {
 			if justDownload && len(args) < 1 {
 				return errors.New("requires a model name argument when using -j")
@@ -143,6 +554,13 @@ func main() {
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// With --stdout, --peek or --print-urls the result owns stdout; everything else we print goes to stderr
+			pipeOut := os.Stdout
+			if streamStdout || printURLs || peekFile != "" {
+				os.Stdout = os.Stderr
+				defer func() { os.Stdout = pipeOut }()
+				config.SilentMode = true
+			}
 			if justDownload {
 				config.ModelName = args[0] // Use the first argument as the model name
 				config.Storage = "./"
@@ -158,127 +576,544 @@ func main() {
 				if config.AuthToken == "" {
 					config.AuthToken = os.Getenv("HUGGING_FACE_HUB_TOKEN")
 					if config.AuthToken != "" {
-						fmt.Println("DeprecationWarning: The environment variable 'HUGGING_FACE_HUB_TOKEN' is deprecated and will be removed in a future version. Please use 'HF_TOKEN' instead.")
+						logger.Warn("DeprecationWarning: The environment variable 'HUGGING_FACE_HUB_TOKEN' is deprecated and will be removed in a future version. Please use 'HF_TOKEN' instead.")
 					}
 				}
 			}
 			if install {
-				if err := installBinary(installPath); err != nil {
-					log.Fatal(err)
-				}
-				os.Exit(0)
+				return installBinary(installPath)
 			}
-			var IsDataset bool
+			repoType := hfd.RepoModel
 			ModelOrDataSet := config.ModelName
-			if config.ModelName != "" {
-				fmt.Println("Model:", config.ModelName)
-				IsDataset = false
-			} else if config.DatasetName != "" {
-				fmt.Println("Dataset:", config.DatasetName)
-				IsDataset = true
+			switch {
+			case config.ModelName != "":
+			case config.DatasetName != "":
+				repoType = hfd.RepoDataset
 				ModelOrDataSet = config.DatasetName
-			} else {
+			case config.SpaceName != "":
+				repoType = hfd.RepoSpace
+				ModelOrDataSet = config.SpaceName
+			default:
 				cmd.Help()
-				return fmt.Errorf("Error: You must set either modelName or datasetName.")
+				return fmt.Errorf("Error: You must set either modelName, datasetName or spaceName.")
+			}
+			// A URL copied from the Hub also names the repo type, and maybe a revision and a file or folder
+			ref, isURL, err := hfd.ParseRepoURL(ModelOrDataSet)
+			if err != nil {
+				return err
+			}
+			if isURL {
+				if ref.Revision != "" && cmd.Flags().Changed("branch") && config.Branch != ref.Revision {
+					return fmt.Errorf("--branch %s conflicts with revision %s in the URL", config.Branch, ref.Revision)
+				}
+				repoType, ModelOrDataSet = ref.Type, ref.Repo
+				if ref.Revision != "" {
+					config.Branch = ref.Revision
+				}
+				if ref.IsFile {
+					config.Include = append(config.Include, ref.Path)
+				} else if ref.Path != "" {
+					config.Dirs = append(config.Dirs, ref.Path)
+				}
+			}
+			switch repoType {
+			case hfd.RepoDataset:
+				logger.Info("Dataset: " + ModelOrDataSet)
+			case hfd.RepoSpace:
+				logger.Info("Space: " + ModelOrDataSet)
+			default:
+				logger.Info("Model: " + ModelOrDataSet)
+			}
+
+			if err := hfd.ValidatePreferFormat(config.PreferFormat); err != nil {
+				return err
+			}
+			if config.IncludeFrom != "" {
+				patterns, err := hfd.ReadPatternFile(config.IncludeFrom)
+				if err != nil {
+					return err
+				}
+				config.Include = append(config.Include, patterns...)
+			}
+			if config.ExcludeFrom != "" {
+				patterns, err := hfd.ReadPatternFile(config.ExcludeFrom)
+				if err != nil {
+					return err
+				}
+				config.Exclude = append(config.Exclude, patterns...)
+			}
+			if err := hfd.ValidateChecksumFormat(config.ChecksumFormat); err != nil {
+				return err
+			}
+			if err := hfd.ValidateCacheLayout(config.CacheLayout); err != nil {
+				return err
+			}
+			var hubCache string
+			if config.CacheLayout == hfd.CacheLayoutHub || config.HFHome != "" {
+				if hubCache, err = hfd.DefaultHubCache(config.HFHome); err != nil {
+					return err
+				}
+			}
+			if err := hfd.ValidatePatterns(append(append(append(config.Include, config.Exclude...), config.DocPatterns...), config.HFPrefix)); err != nil {
+				return err
+			}
+			dirs, err := hfd.NormalizeDirs(config.Dirs)
+			if err != nil {
+				return err
+			}
+			if config.StripPrefix && len(dirs) == 0 {
+				return errors.New("--strip-prefix needs at least one --dir")
+			}
+			var chunkSize int64 // zero picks the default, which depends on --low-memory
+			if config.ChunkSize != "" {
+				if chunkSize, err = hfd.ParseSize(config.ChunkSize); err != nil {
+					return err
+				}
+				if err := hfd.ValidateChunkSize(chunkSize); err != nil {
+					return err
+				}
+			}
+			var redownloadCorrupted int
+			if config.RedownloadCorrupted {
+				redownloadCorrupted = config.MaxRetries
+			}
+			shaMismatch, err := hfd.ParseMismatchPolicies(config.SHAMismatch)
+			if err != nil {
+				return fmt.Errorf("invalid --sha-mismatch: %v", err)
+			}
+			var largeFileThreshold int64 // zero picks hfd.DefaultLargeFileThreshold
+			if config.LargeFileThreshold != "" {
+				if largeFileThreshold, err = hfd.ParseSize(config.LargeFileThreshold); err != nil {
+					return err
+				}
+			}
+			var maxTotalSize int64 // zero means no budget
+			if config.MaxTotalSize != "" {
+				if maxTotalSize, err = hfd.ParseSize(config.MaxTotalSize); err != nil {
+					return fmt.Errorf("invalid --max-total-size: %v", err)
+				}
+			}
+			var requireFree int64 // zero means no floor
+			if config.RequireFree != "" {
+				if requireFree, err = hfd.ParseSize(config.RequireFree); err != nil {
+					return fmt.Errorf("invalid --require-free: %v", err)
+				}
+			} else if config.RequireFreePath != "" {
+				return errors.New("--require-free-path needs --require-free")
+			}
+			if config.OnlyMissing && config.QuickVerify {
+				return errors.New("--only-missing trusts local files and cannot be combined with --quick-verify")
+			}
+			if config.SignManifest && config.ManifestKey == "" {
+				return errors.New("--sign-manifest needs a key, set --manifest-key or HFDOWNLOADER_MANIFEST_KEY")
+			}
+			renames, err := hfd.ParseRenames(config.RenameMap, config.Rename)
+			if err != nil {
+				return err
+			}
+			transforms, err := parseTransforms(config.Transforms)
+			if err != nil {
+				return err
+			}
+			if interactive {
+				if err := hfd.CheckPicker(); err != nil {
+					return err
+				}
+				if watch || streamStdout || printURLs || peekFile != "" || verifyRemote {
+					return errors.New("--interactive cannot be combined with --watch, --stdout, --print-urls, --peek or --verify-remote")
+				}
+			}
+			if outputFile != "" && (watch || streamStdout || printURLs || peekFile != "" || verifyRemote || interactive || mirror) {
+				return errors.New("--output cannot be combined with --watch, --stdout, --print-urls, --peek, --verify-remote, --interactive or --mirror")
+			}
+			if overwrite && outputFile == "" {
+				return errors.New("--overwrite only applies to --output")
+			}
+			var watchInterval time.Duration
+			if watch {
+				if watchInterval, err = time.ParseDuration(config.WatchInterval); err != nil || watchInterval <= 0 {
+					return fmt.Errorf("invalid --interval %q: expected a positive duration such as 1h", config.WatchInterval)
+				}
+				if config.Timeout != "" {
+					return errors.New("--timeout cannot be combined with --watch")
+				}
+				if mirror && !assumeYes {
+					return errors.New("--mirror with --watch needs --yes, there is nobody to confirm deletions")
+				}
+			}
+			var timeout time.Duration
+			if config.Timeout != "" {
+				if timeout, err = time.ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+					return fmt.Errorf("invalid --timeout %q: expected a positive duration such as 30m", config.Timeout)
+				}
+			}
+			var since time.Time
+			if config.Since != "" {
+				if since, err = hfd.ParseSince(config.Since); err != nil {
+					return err
+				}
 			}
 
 			_ = godotenv.Load() // Load .env file if exists
 
-			if config.AuthToken == "" {
-				config.AuthToken = os.Getenv("HF_TOKEN")
-				if config.AuthToken == "" {
-					config.AuthToken = os.Getenv("HUGGING_FACE_HUB_TOKEN")
-					if config.AuthToken != "" {
-						fmt.Println("DeprecationWarning: The environment variable 'HUGGING_FACE_HUB_TOKEN' is deprecated and will be removed in a future version. Please use 'HF_TOKEN' instead.")
+			if err := configureHTTP(config); err != nil {
+				return err
+			}
+			resolveAuthToken(config)
+
+			// --concurrency-auto overrides a config file's max_workers, but not an explicit --concurrent
+			if concurrencyAuto && !cmd.Flags().Changed("concurrent") {
+				config.MaxWorkers = 0
+			}
+			workers := strconv.Itoa(config.MaxWorkers)
+			if config.MaxWorkers == 0 {
+				workers = fmt.Sprintf("auto (%d)", hfd.AutoWorkers())
+			}
+			logger.Info(fmt.Sprintf("Branch: %s\nStorage: %s\nWorkers: %s\nAppend Filter Names to Folder: %t\nSkip SHA256 Check: %t\nToken: %s",
+				config.Branch, config.Storage, workers, config.OneFolderPerFilter, config.SkipSHA, maskToken(config.AuthToken)))
+			if filters := describeFilters(config); filters != "" && !config.SilentMode {
+				logger.Info("Filters: " + filters)
+			}
+
+			if (config.UseR2 && config.UseGCS) || (config.UseR2 && config.UseAzure) || (config.UseGCS && config.UseAzure) {
+				return errors.New("--r2, --gcs and --azure cannot be combined, pick one upload backend")
+			}
+
+			var gcscfg *hfd.GCSConfig
+			if config.UseGCS {
+				if config.GCSBucket == "" {
+					return errors.New("--gcs requires --gcs-bucket")
+				}
+				prefix := config.GCSPrefix
+				if prefix == "" {
+					prefix = "hf_dataset"
+				}
+				gcscfg = &hfd.GCSConfig{
+					Bucket: config.GCSBucket,
+					Prefix: prefix,
+				}
+			}
+
+			azurecfg, err := azureConfigFrom(config)
+			if err != nil {
+				return err
+			}
+
+			r2cfg, err := r2ConfigFrom(config)
+			if err != nil {
+				return err
+			}
+
+			downloaderOpts := []hfd.Option{hfd.WithOutput(os.Stdout), hfd.WithLogger(logger), hfd.WithChunkSize(int(chunkSize))}
+			if config.LowMemory {
+				downloaderOpts = append(downloaderOpts, hfd.WithLowMemory())
+			}
+			if config.MaxOpenFiles > 0 {
+				downloaderOpts = append(downloaderOpts, hfd.WithMaxOpenFiles(config.MaxOpenFiles))
+			}
+			downloader := hfd.NewDownloader(downloaderOpts...)
+
+			if cleanupCorrupted {
+				// Stopped by a signal, cleanup still reports where to resume
+				ctx, stop := interruptContext("checks")
+				defer stop()
+				prefix := r2cfg.Subfolder + "/" // ensure trailing slash so keys match
+				cleanupOpts := hfd.CleanupOptions{Prefix: prefix, Concurrency: config.NumConnections, DryRun: cleanupDryRun, RateLimit: cleanupRate, StartAfter: cleanupAfter}
+				if report, err := downloader.CleanupCorrupted(ctx, r2cfg, cleanupOpts); err != nil {
+					if report != nil && report.ResumeAfter != "" {
+						return fmt.Errorf("failed to cleanup corrupted files: %w (rerun with --cleanup-start-after %q to resume)", err, report.ResumeAfter)
 					}
+					return fmt.Errorf("failed to cleanup corrupted files: %w", err)
 				}
+				logger.Info("Cleanup completed")
+				return nil
+			}
+
+			opts := hfd.DownloadOptions{
+				Repo:                ModelOrDataSet,
+				IsDataset:           repoType == hfd.RepoDataset,
+				RepoType:            repoType,
+				Branch:              config.Branch,
+				BranchFallback:      config.BranchFallback,
+				Storage:             config.Storage,
+				HubCache:            hubCache,
+				AppendFilterToPath:  config.OneFolderPerFilter,
+				SkipSHA:             config.SkipSHA,
+				QuickVerify:         config.QuickVerify,
+				QuickVerifySize:     int64(config.QuickVerifyMB) * 1024 * 1024,
+				OnlyMissing:         config.OnlyMissing,
+				Connections:         config.NumConnections,
+				Token:               config.AuthToken,
+				SilentMode:          config.SilentMode,
+				R2:                  r2cfg,
+				GCS:                 gcscfg,
+				Azure:               azurecfg,
+				SkipLocal:           config.SkipLocal,
+				Tee:                 config.Tee,
+				HFPrefix:            config.HFPrefix,
+				Dirs:                dirs,
+				StripPrefix:         config.StripPrefix,
+				MaxWorkers:          config.MaxWorkers,
+				AdaptiveConcurrency: config.AdaptiveConcurrency,
+				DatasetWorkers:      config.DatasetWorkers,
+				MetadataWorkers:     config.PrefetchMetadata,
+				VerifyWorkers:       config.VerifyWorkers,
+				MaxParallelLarge:    config.LimitParallelLarge,
+				LargeFileThreshold:  largeFileThreshold,
+				PreferFormat:        config.PreferFormat,
+				Include:             config.Include,
+				Exclude:             config.Exclude,
+				Extensions:          config.Extensions,
+				AlwaysFetch:         config.AlwaysFetch,
+				AlwaysFetchRegular:  config.NoCacheConfig,
+				Rename:              renames,
+				Transforms:          transforms,
+				WeightsOnly:         config.WeightsOnly,
+				FromIndex:           config.FromIndex,
+				DocPatterns:         config.DocPatterns,
+				FailOnMissing:       config.FailOnMissing,
+				Since:               since,
+				SinceStrict:         config.SinceStrict,
+				TouchTimestamps:     config.TouchTimestamps,
+				ShutdownGrace:       time.Duration(config.ShutdownGrace) * time.Second,
+				ContinueOnError:     config.ContinueOnError,
+				RedownloadCorrupted: redownloadCorrupted,
+				SHAMismatch:         shaMismatch,
+				MaxFiles:            config.MaxFiles,
+				MaxTotalSize:        maxTotalSize,
+				RequireFree:         requireFree,
+				RequireFreePath:     config.RequireFreePath,
+				Decompress:          config.Decompress,
+				NoDownloadParam:     config.NoDownloadParam,
+				Mirrors:             config.Endpoints,
+				MirrorAuth:          config.EndpointAuth,
+				DedupeByHash:        config.DedupeByHash,
+				DerefSymlinks:       config.DerefSymlinks,
+				SkipPointers:        config.SkipPointers,
+				StateFile:           config.StateFile,
+				ResetState:          resetState,
+				SignManifest:        config.SignManifest,
+				NoOverwriteManifest: config.NoOverwriteManifest,
+				Attestation:         config.Attestation,
+				ExpectCommit:        config.ExpectCommit,
+				ChecksumFile:        config.ChecksumFile,
+				ReportFiles:         []string{config.ErrorReport, config.SummaryJSON},
+				ChecksumFormat:      config.ChecksumFormat,
+				GitLayout:           config.GitLayout,
+			}
+			if config.ManifestKey != "" {
+				opts.ManifestKey = []byte(config.ManifestKey)
 			}
 
-			fmt.Printf("Branch: %s\nStorage: %s\nNumberOfConcurrentConnections: %d\nAppend Filter Names to Folder: %t\nSkip SHA256 Check: %t\nToken: %s\n",
-				config.Branch, config.Storage, config.NumConnections, config.OneFolderPerFilter, config.SkipSHA, config.AuthToken)
+			if config.Tee && (config.SkipLocal || r2cfg == nil) {
+				return errors.New("--tee needs an R2 upload and cannot be combined with --skip-local")
+			}
+			if mirror && config.SkipLocal && (r2cfg != nil || gcscfg != nil || azurecfg != nil) {
+				return errors.New("--mirror needs a local copy and cannot be combined with --skip-local")
+			}
 
-			var r2cfg *hfd.R2Config
-			if config.UseR2 {
-				// Load credentials from env
-				accountID := os.Getenv("R2_ACCOUNT_ID")
-				accessKey := os.Getenv("R2_WRITE_ACCESS_KEY_ID")
-				secretKey := os.Getenv("R2_WRITE_SECRET_ACCESS_KEY")
-				if accountID == "" || accessKey == "" || secretKey == "" {
-					log.Fatal("R2 credentials not found in environment variables")
+			if streamStdout {
+				if r2cfg != nil || gcscfg != nil || azurecfg != nil {
+					return errors.New("--stdout cannot be combined with an upload backend")
 				}
+				return downloader.DownloadToWriter(context.Background(), opts, pipeOut)
+			}
 
-				// Use config.R2BucketName if provided; otherwise, try the env variable R2_BUCKET_NAME;
-				// if still empty, fallback to accountID.
-				bucketName := config.R2BucketName
-				if bucketName == "" {
-					bucketName = os.Getenv("R2_BUCKET_NAME")
-					if bucketName == "" {
-						bucketName = accountID
-					}
+			if outputFile != "" {
+				if r2cfg != nil || gcscfg != nil || azurecfg != nil {
+					return errors.New("--output cannot be combined with an upload backend")
 				}
+				err := downloader.DownloadToFile(context.Background(), opts, outputFile, overwrite)
+				if errors.Is(err, os.ErrExist) {
+					return fmt.Errorf("%s already exists, pass --overwrite to replace it", outputFile)
+				}
+				if err != nil {
+					return err
+				}
+				logger.Info("Saved " + outputFile)
+				return nil
+			}
 
-				// Use the provided subfolder or default if empty
-				subfolder := config.R2Subfolder
-				if subfolder == "" {
-					subfolder = "hf_dataset"
+			if peekFile != "" {
+				if r2cfg != nil || gcscfg != nil || azurecfg != nil {
+					return errors.New("--peek cannot be combined with an upload backend")
 				}
+				start, end, err := hfd.ParseByteRange(peekBytes)
+				if err != nil {
+					return err
+				}
+				opts.Include, opts.Exclude = []string{peekFile}, nil
+				_, err = downloader.DownloadRange(context.Background(), opts, start, end, pipeOut)
+				return err
+			}
 
-				r2cfg = &hfd.R2Config{
-					AccountID:       accountID,
-					AccessKeyID:     accessKey,
-					AccessKeySecret: secretKey,
-					BucketName:      bucketName,
-					Region:          "auto",
-					Subfolder:       subfolder,
+			if printURLs {
+				if r2cfg != nil || gcscfg != nil || azurecfg != nil {
+					return errors.New("--print-urls cannot be combined with an upload backend")
+				}
+				resolved, err := downloader.ResolveURLs(opts)
+				if err != nil {
+					return err
 				}
+				return printResolvedURLs(resolved, pipeOut, jsonOutput)
 			}
 
-			if cleanupCorrupted {
-				ctx := context.Background()
-				prefix := r2cfg.Subfolder + "/" // ensure trailing slash so keys match
-				if err := hfd.CleanupCorruptedFiles(ctx, r2cfg, prefix, config.NumConnections); err != nil {
-					log.Fatalf("Failed to cleanup corrupted files: %v", err)
+			if verifyRemote {
+				diff, err := downloader.VerifyRemote(opts)
+				if err != nil {
+					return err
 				}
-				fmt.Println("Cleanup completed")
-				return nil
+				return printRemoteDiff(diff, jsonOutput)
 			}
 
-			for i := 0; i < config.MaxRetries; i++ {
-				if err := hfd.DownloadModel(
-					ModelOrDataSet,            // model name
-					config.OneFolderPerFilter, // append filter to path
-					config.SkipSHA,            // skip SHA check
-					IsDataset,                 // is dataset
-					config.Storage,            // local temp path
-					config.Branch,             // branch
-					config.NumConnections,     // concurrent connections
-					config.AuthToken,          // HF token
-					config.SilentMode,         // silent mode
-					r2cfg,                     // R2 config
-					config.SkipLocal,          // skipLocal - use SkipLocal flag
-					config.HFPrefix,           // HF prefix
-					config.MaxWorkers,         // max workers for parallel downloads
-				); err != nil {
-					fmt.Printf("Warning: attempt %d / %d failed, error: %s\n", i+1, config.MaxRetries, err)
-					time.Sleep(time.Duration(config.RetryInterval) * time.Second)
-					continue
+			if interactive {
+				files, err := downloader.Enumerate(opts)
+				if err != nil {
+					return err
+				}
+				chosen, err := hfd.PickFiles(files)
+				if err != nil {
+					return err
+				}
+				if len(chosen) == 0 {
+					fmt.Println("No files selected")
+					return nil
+				}
+				// The picked paths already passed every selection option
+				opts.Include, opts.FromIndex, opts.MaxFiles, opts.MaxTotalSize = chosen, false, 0, 0
+			}
+
+			// First SIGTERM/SIGINT stops scheduling new files, a second one exits immediately
+			ctx, stop := interruptContext("files")
+			defer stop()
+			if timeout > 0 {
+				var cancelTimeout context.CancelFunc
+				ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+				defer cancelTimeout()
+			}
+
+			var fileHook, completeHook *template.Template
+			if config.OnFileComplete != "" {
+				if fileHook, err = template.New("on-file-complete").Parse(config.OnFileComplete); err != nil {
+					return fmt.Errorf("invalid --on-file-complete: %v", err)
+				}
+				opts.OnFileComplete = func(event hfd.FileEvent) error {
+					err := runHook(fileHook, event)
+					if config.HookFatal {
+						return err
+					}
+					return nil
+				}
+			}
+			if config.OnComplete != "" {
+				if completeHook, err = template.New("on-complete").Parse(config.OnComplete); err != nil {
+					return fmt.Errorf("invalid --on-complete: %v", err)
 				}
-				fmt.Printf("\nDownload of %s completed successfully\n", ModelOrDataSet)
-				return nil
 			}
-			return fmt.Errorf("failed to download %s after %d attempts", ModelOrDataSet, config.MaxRetries)
+
+			syncOnce := func(ctx context.Context) error {
+				startedAt := time.Now()
+				var result *hfd.DownloadResult
+				downloadErr := func() error {
+					var err error
+					for i := 0; i < config.MaxRetries; i++ {
+						result, err = downloader.Download(ctx, opts)
+						if result != nil {
+							printTransferSummary(result)
+							printBudgetUsage(result)
+							printPointerFiles(result.Pointers, config.SkipPointers)
+						}
+						if err == nil {
+							logger.Info(fmt.Sprintf("Download of %s completed successfully", ModelOrDataSet))
+							if mirror {
+								return mirrorLocal(downloader, opts, result, assumeYes)
+							}
+							return nil
+						}
+						if errors.Is(err, hfd.ErrUnmatchedPatterns) || errors.Is(err, hfd.ErrRepoNotFound) || errors.Is(err, hfd.ErrRevisionNotFound) || errors.Is(err, hfd.ErrAuth) {
+							return err // retrying won't make a missing file, repo or permission appear
+						}
+						if errors.Is(err, hfd.ErrBelowFreeFloor) || errors.Is(err, hfd.ErrCommitMismatch) {
+							return err // nor free up space or move a branch back
+						}
+						if errors.Is(err, hfd.ErrInterrupted) {
+							break
+						}
+						if config.SHAMismatch != "" && onlyChecksumMismatches(result) {
+							printFailedFiles(result.Failed)
+							return err // --sha-mismatch already decided what a mismatch does
+						}
+						logger.Warn(fmt.Sprintf("Warning: attempt %d / %d failed, error: %s", i+1, config.MaxRetries, err))
+						time.Sleep(time.Duration(config.RetryInterval) * time.Second)
+					}
+					if result != nil && len(result.Failed) > 0 {
+						printFailedFiles(result.Failed)
+					}
+					if errors.Is(err, hfd.ErrInterrupted) {
+						return err
+					}
+					return fmt.Errorf("failed to download %s after %d attempts: %w", ModelOrDataSet, config.MaxRetries, err)
+				}()
+
+				if completeHook != nil {
+					folder, _ := hfd.RepoFolder(ModelOrDataSet)
+					data := completeEvent{Repo: ModelOrDataSet, Path: filepath.Join(config.Storage, folder), OK: downloadErr == nil}
+					if downloadErr != nil {
+						data.Error = downloadErr.Error()
+					}
+					if err := runHook(completeHook, data); err != nil && config.HookFatal && downloadErr == nil {
+						return err
+					}
+				}
+				if downloadErr != nil && config.ErrorReport != "" {
+					report := newErrorReport(downloadErr, result, opts, *config, startedAt)
+					if err := report.write(config.ErrorReport, secretsOf(*config, r2cfg, azurecfg)); err != nil {
+						logger.Warn(fmt.Sprintf("Warning: %v", err))
+					} else {
+						logger.Info("Wrote error report to " + config.ErrorReport)
+					}
+				}
+				if config.SummaryJSON != "" {
+					summary := newRunSummary(downloadErr, result, opts, *config, startedAt)
+					if err := writeRedactedJSON(config.SummaryJSON, summary, secretsOf(*config, r2cfg, azurecfg)); err != nil {
+						logger.Warn(fmt.Sprintf("Warning: failed to write run summary: %v", err))
+					} else {
+						logger.Info("Wrote run summary to " + config.SummaryJSON)
+					}
+				}
+				return downloadErr
+			}
+
+			if watch {
+				return downloader.Watch(ctx, opts, watchInterval, syncOnce)
+			}
+			return syncOnce(ctx)
 		},
 	}
 
 	// Setup flags and bind them to config properties
-	rootCmd.PersistentFlags().StringVarP(&config.ModelName, "model", "m", config.ModelName, "Model name to download")
-	rootCmd.PersistentFlags().StringVarP(&config.DatasetName, "dataset", "d", config.DatasetName, "Dataset name to download")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", configPath, "Config file to load instead of ~/.config/hfdownloader.json")
+	rootCmd.PersistentFlags().Bool("strict-config", false, "Reject config files with unknown fields instead of ignoring them")
+	rootCmd.PersistentFlags().StringVarP(&config.ModelName, "model", "m", config.ModelName, "Model name to download, or its huggingface.co URL")
+	rootCmd.PersistentFlags().StringVarP(&config.DatasetName, "dataset", "d", config.DatasetName, "Dataset name to download, or its huggingface.co URL")
+	rootCmd.PersistentFlags().StringVar(&config.SpaceName, "space", config.SpaceName, "Space name to download, or its huggingface.co URL")
 	rootCmd.PersistentFlags().StringVarP(&config.Branch, "branch", "b", config.Branch, "Branch of the model or dataset")
+	rootCmd.PersistentFlags().StringSliceVar(&config.BranchFallback, "branch-fallback", config.BranchFallback, "Branches to try in order when --branch does not exist, e.g. master (repeatable, comma-separated)")
 	rootCmd.PersistentFlags().StringVarP(&config.Storage, "storage", "s", config.Storage, "Storage path for downloads")
-	rootCmd.PersistentFlags().IntVarP(&config.MaxWorkers, "concurrent", "c", config.MaxWorkers, "Number of concurrent download workers")
+	rootCmd.PersistentFlags().StringVar(&config.CacheLayout, "cache-layout", config.CacheLayout, "plain (storage/org/name) or hub to store in the huggingface_hub cache, where transformers finds it ($HF_HUB_CACHE, $HF_HOME/hub or ~/.cache/huggingface/hub)")
+	rootCmd.PersistentFlags().StringVar(&config.HFHome, "hf-home", config.HFHome, "Store in the hub cache under this HF_HOME, implies --cache-layout hub")
+	rootCmd.PersistentFlags().IntVarP(&config.MaxWorkers, "concurrent", "c", config.MaxWorkers, "Number of concurrent download workers (default: 4 per CPU, between 4 and 64)")
+	rootCmd.PersistentFlags().BoolVar(&concurrencyAuto, "concurrency-auto", false, "Pick the worker count from the CPU count even if the config file sets max_workers (--concurrent still wins)")
+	rootCmd.PersistentFlags().BoolVar(&config.AdaptiveConcurrency, "adaptive-concurrency", config.AdaptiveConcurrency, "Start with a few workers, add more while throughput improves and halve them when the server throttles (--concurrent is the ceiling)")
+	rootCmd.PersistentFlags().IntVar(&config.DatasetWorkers, "dataset-workers", config.DatasetWorkers, "Number of concurrent download workers for datasets (overrides --concurrent for datasets only)")
+	rootCmd.PersistentFlags().IntVar(&config.PrefetchMetadata, "prefetch-metadata", config.PrefetchMetadata, "Repo folders listed at once while gathering file sizes and hashes, before any transfer starts (default 8, 1 for one at a time)")
+	rootCmd.PersistentFlags().IntVar(&config.VerifyWorkers, "verify-workers", config.VerifyWorkers, "Hash files kept only locally in this many goroutines after they download, instead of while they stream (default 0)")
 	rootCmd.PersistentFlags().StringVarP(&config.AuthToken, "token", "t", config.AuthToken, "HuggingFace Auth Token")
 	rootCmd.PersistentFlags().BoolVarP(&config.OneFolderPerFilter, "appendFilterFolder", "f", config.OneFolderPerFilter, "Append filter name to folder")
 	rootCmd.PersistentFlags().BoolVarP(&config.SkipSHA, "skipSHA", "k", config.SkipSHA, "Skip SHA256 hash check")
+	rootCmd.PersistentFlags().BoolVar(&config.QuickVerify, "quick-verify", config.QuickVerify, "When resuming, keep existing files whose first and last MB still hash the same, then fully verify them after the downloads")
+	rootCmd.PersistentFlags().IntVar(&config.QuickVerifyMB, "quick-verify-mb", config.QuickVerifyMB, "MB hashed at each end of a file by --quick-verify")
+	rootCmd.PersistentFlags().BoolVar(&config.OnlyMissing, "only-missing", config.OnlyMissing, "Only fetch files missing locally or of the wrong size; existing files are trusted without hashing or revalidating")
 	rootCmd.PersistentFlags().IntVar(&config.MaxRetries, "maxRetries", config.MaxRetries, "Maximum number of retries for downloads")
 	rootCmd.PersistentFlags().IntVar(&config.RetryInterval, "retryInterval", config.RetryInterval, "Interval between retries in seconds")
 	rootCmd.PersistentFlags().BoolVarP(&justDownload, "justDownload", "j", config.JustDownload, "Just download the model to the current directory and assume the first argument is the model name")
@@ -292,26 +1127,864 @@ func main() {
 		Use:   "generate-config",
 		Short: "Generates an example configuration file with default values",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return generateConfigFile()
+			return generateConfigFile(configPath)
 		},
 	}
 
 	rootCmd.AddCommand(generateCmd)
 
+	// Add the prune command
+	var olderThan time.Duration
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Finds and deletes leftover partial downloads, state files and stale manifest entries (dry run unless --yes)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if config.SignManifest && config.ManifestKey == "" {
+				return errors.New("--sign-manifest needs a key, set --manifest-key or HFDOWNLOADER_MANIFEST_KEY")
+			}
+			downloader := hfd.NewDownloader(hfd.WithOutput(os.Stdout), hfd.WithLogger(logger))
+			report, err := downloader.ScanPrune(config.Storage, olderThan)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				printPruneReport(report)
+			}
+			if len(report.Files) == 0 && len(report.StaleEntries) == 0 {
+				return nil
+			}
+			if !assumeYes {
+				// Keep stdout parseable when it holds the JSON report
+				fmt.Fprintln(os.Stderr, "Dry run, nothing deleted. Rerun with --yes to delete.")
+				return nil
+			}
+			pruneOpts := hfd.PruneOptions{SignManifest: config.SignManifest, NoOverwriteManifest: config.NoOverwriteManifest}
+			if config.ManifestKey != "" {
+				pruneOpts.ManifestKey = []byte(config.ManifestKey)
+			}
+			return downloader.Prune(report, pruneOpts)
+		},
+	}
+	pruneCmd.Flags().DurationVar(&olderThan, "older-than", 0, "Only prune files not modified for this long, e.g. 72h")
+	rootCmd.AddCommand(pruneCmd)
+
+	// Add the stats command
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Reports the disk usage of each repo in the storage folder or hub cache, largest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := hfd.ValidateCacheLayout(config.CacheLayout); err != nil {
+				return err
+			}
+			dir := config.Storage
+			if config.CacheLayout == hfd.CacheLayoutHub || config.HFHome != "" {
+				var err error
+				if dir, err = hfd.DefaultHubCache(config.HFHome); err != nil {
+					return err
+				}
+			}
+			stats, err := hfd.ScanCacheStats(dir)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(stats)
+			}
+			printCacheStats(stats, dir)
+			return nil
+		},
+	}
+	rootCmd.AddCommand(statsCmd)
+
+	// Add the diff command
+	var rehash bool
+	diffCmd := &cobra.Command{
+		Use:   "diff <dirA> <dirB>",
+		Short: "Compares two local downloads by file list and SHA256, offline",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			diff, err := hfd.DiffSnapshots(args[0], args[1], rehash)
+			if err != nil {
+				return err
+			}
+			printSnapshotDiff(diff, args[0], args[1], jsonOutput)
+			if !diff.Clean() {
+				return fmt.Errorf("%s and %s differ", args[0], args[1])
+			}
+			return nil
+		},
+	}
+	diffCmd.Flags().BoolVar(&rehash, "rehash", false, "Hash every file instead of trusting the SHA256 recorded in the manifests")
+	rootCmd.AddCommand(diffCmd)
+
+	// Add the doctor command
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Checks connectivity to HuggingFace, the token, the storage folder and R2 credentials",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_ = godotenv.Load()
+			if err := configureHTTP(config); err != nil {
+				return err
+			}
+			resolveAuthToken(config)
+
+			opts := hfd.DoctorOptions{Token: config.AuthToken, Storage: config.Storage}
+			checks := []hfd.Check{}
+			r2cfg, err := r2ConfigFrom(config)
+			if err != nil {
+				checks = append(checks, hfd.Check{Name: "R2", Detail: err.Error()})
+			}
+			opts.R2 = r2cfg
+
+			downloader := hfd.NewDownloader(hfd.WithOutput(os.Stdout), hfd.WithLogger(logger))
+			checks = append(downloader.Doctor(context.Background(), opts), checks...)
+			if jsonOutput {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(checks); err != nil {
+					return err
+				}
+			}
+
+			failed := 0
+			for _, check := range checks {
+				if !check.OK {
+					failed++
+				}
+				if jsonOutput {
+					continue
+				}
+				mark := "✅"
+				if !check.OK {
+					mark = "❌"
+				}
+				fmt.Printf("%s %-8s %s\n", mark, check.Name, check.Detail)
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+			}
+			return nil
+		},
+	}
+	rootCmd.AddCommand(doctorCmd)
+
+	// Add the completion command
+	completionCmd := &cobra.Command{
+		Use:                   "completion [bash|zsh|fish|powershell]",
+		Short:                 "Generates a shell completion script",
+		DisableFlagsInUseLine: true,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch args[0] {
+			case "bash":
+				return rootCmd.GenBashCompletionV2(os.Stdout, true)
+			case "zsh":
+				return rootCmd.GenZshCompletion(os.Stdout)
+			case "fish":
+				return rootCmd.GenFishCompletion(os.Stdout, true)
+			default:
+				return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+			}
+		},
+	}
+
+	rootCmd.AddCommand(completionCmd)
+
 	// Add new flags
 	rootCmd.PersistentFlags().BoolVar(&config.UseR2, "r2", false, "Upload to Cloudflare R2")
 	rootCmd.PersistentFlags().StringVar(&config.R2BucketName, "r2-bucket", "", "R2 bucket name")
-	rootCmd.PersistentFlags().StringVar(&config.R2AccountID, "r2-account", "", "R2 account ID")
-	rootCmd.PersistentFlags().StringVar(&config.R2AccessKey, "r2-access-key", "", "R2 access key")
-	rootCmd.PersistentFlags().StringVar(&config.R2SecretKey, "r2-secret-key", "", "R2 secret key")
-	rootCmd.PersistentFlags().BoolVar(&config.SkipLocal, "skip-local", false, "Skip local storage when using R2")
-	rootCmd.PersistentFlags().BoolVar(&cleanupCorrupted, "cleanup-corrupted", false, "Clean up corrupted parquet files")
+	rootCmd.PersistentFlags().StringVar(&config.R2AccountID, "r2-account", config.R2AccountID, "R2 account ID")
+	rootCmd.PersistentFlags().StringVar(&config.R2AccessKey, "r2-access-key", config.R2AccessKey, "R2 access key")
+	rootCmd.PersistentFlags().StringVar(&config.R2SecretKey, "r2-secret-key", config.R2SecretKey, "R2 secret key")
+	rootCmd.PersistentFlags().StringVar(&config.R2Profile, "r2-profile", config.R2Profile, "Read R2 credentials from this profile in ~/.aws/credentials (or AWS_SHARED_CREDENTIALS_FILE)")
+	rootCmd.PersistentFlags().BoolVar(&config.SkipLocal, "skip-local", false, "Skip local storage when using R2, GCS or Azure")
+	rootCmd.PersistentFlags().BoolVar(&config.Tee, "tee", config.Tee, "With R2, write the local copy and upload in the same pass instead of uploading once each file is staged")
+	rootCmd.PersistentFlags().BoolVar(&cleanupCorrupted, "cleanup-corrupted", false, "Clean up corrupted parquet and safetensors files")
+	rootCmd.PersistentFlags().BoolVar(&cleanupDryRun, "cleanup-dry-run", false, "With --cleanup-corrupted, list the corrupt objects and why without deleting them")
+	rootCmd.PersistentFlags().Float64Var(&cleanupRate, "cleanup-rate", 0, "With --cleanup-corrupted, check at most this many objects per second to avoid R2 throttling (0 for no cap)")
+	rootCmd.PersistentFlags().StringVar(&cleanupAfter, "cleanup-start-after", "", "With --cleanup-corrupted, skip every key up to and including this one, to resume an interrupted cleanup")
+	rootCmd.PersistentFlags().BoolVar(&interactive, "interactive", false, "Pick the files to download from a checkbox list after the repo is listed (builds with -tags interactive)")
 	rootCmd.PersistentFlags().StringVar(&config.R2Subfolder, "r2-subfolder", config.R2Subfolder, "Subfolder on your R2 bucket (e.g. hf_dataset)")
-	rootCmd.PersistentFlags().StringVar(&config.HFPrefix, "hf-prefix", "", "Optional prefix to only fetch files from a specific folder in the HF datasets repo")
+	rootCmd.PersistentFlags().BoolVar(&config.UseGCS, "gcs", false, "Upload to Google Cloud Storage (credentials from GOOGLE_APPLICATION_CREDENTIALS)")
+	rootCmd.PersistentFlags().StringVar(&config.GCSBucket, "gcs-bucket", "", "GCS bucket name")
+	rootCmd.PersistentFlags().StringVar(&config.GCSPrefix, "gcs-prefix", config.GCSPrefix, "Object prefix in your GCS bucket (e.g. hf_dataset)")
+	rootCmd.PersistentFlags().BoolVar(&config.UseAzure, "azure", false, "Upload to Azure Blob Storage (credentials from AZURE_STORAGE_CONNECTION_STRING or AZURE_STORAGE_ACCOUNT/AZURE_STORAGE_KEY)")
+	rootCmd.PersistentFlags().StringVar(&config.AzureContainer, "azure-container", "", "Azure Blob Storage container name")
+	rootCmd.PersistentFlags().StringVar(&config.AzurePrefix, "azure-prefix", config.AzurePrefix, "Blob name prefix in your Azure container (e.g. hf_dataset)")
+	rootCmd.PersistentFlags().StringVar(&config.HFPrefix, "hf-prefix", "", "Optional prefix to only fetch files from a specific folder in the HF datasets repo, or a glob like data/*/train matching several folders")
+	rootCmd.PersistentFlags().StringSliceVar(&config.Dirs, "dir", config.Dirs, "Only fetch files under this repo folder, e.g. subset_A (repeatable)")
+	rootCmd.PersistentFlags().BoolVar(&config.StripPrefix, "strip-prefix", config.StripPrefix, "With --dir, store files relative to the folder the dirs share, e.g. subset_A/train.parquet as train.parquet")
+	rootCmd.PersistentFlags().StringSliceVar(&config.Include, "include", config.Include, "Only download files matching these glob patterns or paths (repeatable, comma-separated)")
+	rootCmd.PersistentFlags().StringSliceVar(&config.Exclude, "exclude", config.Exclude, "Skip files matching these glob patterns (repeatable, comma-separated)")
+	rootCmd.PersistentFlags().StringSliceVar(&config.Extensions, "ext", config.Extensions, "Only download files with these extensions, case-insensitive, with or without the dot, e.g. gguf,json (combined with the other filters)")
+	rootCmd.PersistentFlags().StringSliceVar(&config.AlwaysFetch, "always-fetch", config.AlwaysFetch, "Download files matching these glob patterns again on every run, even when already present (repeatable, comma-separated)")
+	rootCmd.PersistentFlags().BoolVar(&config.NoCacheConfig, "no-cache-config", config.NoCacheConfig, "Download every regular (non-LFS) file, such as configs and tokenizers, again on every run while weights keep being skipped")
+	rootCmd.PersistentFlags().StringSliceVar(&config.Rename, "rename", config.Rename, "Store a repo file under another local path, as src=dst (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&config.RenameMap, "rename-map", config.RenameMap, "JSON file mapping repo paths to the local paths to store them under")
+	rootCmd.PersistentFlags().BoolVar(&config.WeightsOnly, "weights-only", config.WeightsOnly, "Skip READMEs, docs and images, keeping weights, configs and tokenizer files")
+	rootCmd.PersistentFlags().BoolVar(&config.FromIndex, "from-index", config.FromIndex, "Download exactly the shards listed in the model's safetensors (or pytorch) index, plus the index, config and tokenizer files")
+	rootCmd.PersistentFlags().StringSliceVar(&config.DocPatterns, "doc-patterns", config.DocPatterns, "Patterns --weights-only skips, replacing the built-in list (repeatable, comma-separated)")
+	rootCmd.PersistentFlags().StringVar(&config.IncludeFrom, "include-from", config.IncludeFrom, "Read more --include patterns from this file, one per line, # for comments")
+	rootCmd.PersistentFlags().StringVar(&config.ExcludeFrom, "exclude-from", config.ExcludeFrom, "Read more --exclude patterns from this file, one per line, # for comments")
+	rootCmd.PersistentFlags().BoolVar(&config.FailOnMissing, "fail-on-missing", config.FailOnMissing, "Fail if an --include pattern matches no file in the repo")
+	rootCmd.PersistentFlags().StringVar(&config.Since, "since", config.Since, "Only download files changed after this date (RFC3339 or YYYY-MM-DD)")
+	rootCmd.PersistentFlags().BoolVar(&config.SinceStrict, "since-strict", config.SinceStrict, "With --since, also skip files that have no commit date")
+	rootCmd.PersistentFlags().BoolVar(&config.TouchTimestamps, "touch-timestamps", config.TouchTimestamps, "Set each downloaded file's modification time to its last commit date instead of the download time")
+	rootCmd.PersistentFlags().BoolVar(&verifyRemote, "verify-remote", false, "Compare the local copy against the current remote files and report differences without downloading")
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "Print reports as JSON")
+	rootCmd.PersistentFlags().BoolVar(&mirror, "mirror", false, "After downloading, delete local files that are no longer in the remote revision (asks first unless --yes)")
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "Answer yes to confirmation prompts")
+	rootCmd.PersistentFlags().BoolVar(&streamStdout, "stdout", false, "Write the single matching file to stdout instead of storage; all other output goes to stderr")
+	rootCmd.PersistentFlags().StringVarP(&outputFile, "output", "o", "", "Save the single matching file at this path instead of under --storage, like curl -o")
+	rootCmd.PersistentFlags().BoolVar(&overwrite, "overwrite", false, "With --output, replace an existing file")
+	rootCmd.PersistentFlags().StringVar(&config.Timeout, "timeout", config.Timeout, "Abort the whole download if it hasn't finished within this duration, e.g. 30m (exit code 124)")
+	rootCmd.PersistentFlags().BoolVar(&watch, "watch", false, "Keep running and sync again whenever the remote revision moves, checking every --interval")
+	rootCmd.PersistentFlags().StringVar(&config.WatchInterval, "interval", config.WatchInterval, "How often --watch checks the remote for a new commit, e.g. 1h")
+	rootCmd.PersistentFlags().IntVar(&config.ShutdownGrace, "shutdown-grace", config.ShutdownGrace, "Seconds to let in-flight files finish after SIGTERM/SIGINT before aborting them (0 waits indefinitely)")
+	rootCmd.PersistentFlags().StringVar(&config.ChunkSize, "chunk-size", config.ChunkSize, "Buffer size used to copy downloads and report progress, e.g. 1MB (4KB to 64MB, default 32KB)")
+	rootCmd.PersistentFlags().BoolVar(&config.LowMemory, "low-memory", config.LowMemory, "Cap workers and buffers for devices with little RAM, e.g. a Raspberry Pi (2 workers, 16KB copy buffer, one 8MB R2 part buffer per file)")
+	rootCmd.PersistentFlags().IntVar(&config.MaxOpenFiles, "max-open-files", config.MaxOpenFiles, "Maximum destination files open at once, independent of --concurrent; clamped to half the ulimit -n soft limit (0 for no bound)")
+	rootCmd.PersistentFlags().IntVar(&config.LimitParallelLarge, "limit-parallel-large-files", config.LimitParallelLarge, "Maximum files of --large-file-threshold or more downloading at once, while smaller files keep using every worker (0 for no extra limit)")
+	rootCmd.PersistentFlags().StringVar(&config.LargeFileThreshold, "large-file-threshold", config.LargeFileThreshold, "Size from which --limit-parallel-large-files applies, e.g. 500MB (default 1GB)")
+	rootCmd.PersistentFlags().StringVar(&config.OnFileComplete, "on-file-complete", config.OnFileComplete, "Command to run after each file lands; {{.Path}}, {{.LocalPath}}, {{.Key}} and {{.Size}} are expanded")
+	rootCmd.PersistentFlags().StringArrayVar(&config.Transforms, "transform", config.Transforms, "Run a check on each matching file after download, failing it on error: \"[pattern=]validate-safetensors\" or \"[pattern=]exec:command\" with {{.LocalPath}} expanded (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&config.OnComplete, "on-complete", config.OnComplete, "Command to run after the whole download; {{.Repo}}, {{.Path}}, {{.OK}} and {{.Error}} are expanded")
+	rootCmd.PersistentFlags().BoolVar(&config.HookFatal, "hook-fatal", config.HookFatal, "Fail the download when a hook command exits non-zero")
+	rootCmd.PersistentFlags().StringVar(&config.StateFile, "state-file", config.StateFile, "Where to keep the job state used to resume (default .hfdownloader-state.json in the download folder)")
+	rootCmd.PersistentFlags().BoolVar(&printURLs, "print-urls", false, "Resolve every matching file to its final download URL and print \"url<TAB>path\" lines instead of downloading")
+	rootCmd.PersistentFlags().StringVar(&peekFile, "peek", "", "Write only part of this repo file to stdout, selected with --bytes, e.g. to read a safetensors header")
+	rootCmd.PersistentFlags().StringVar(&peekBytes, "bytes", "0-1048575", "Inclusive byte range for --peek, e.g. 0-1000000, or 1000- to read to the end")
+	rootCmd.PersistentFlags().BoolVar(&resetState, "reset-state", false, "Discard any saved job state and enumerate the repo again")
+	rootCmd.PersistentFlags().BoolVar(&config.SkipPointers, "skip-pointers", config.SkipPointers, "Don't store files whose content is a Git LFS pointer instead of the real file")
+	rootCmd.PersistentFlags().BoolVar(&config.DedupeByHash, "dedupe-by-hash", config.DedupeByHash, "Download files sharing an LFS blob once and hard link (or copy) the rest")
+	rootCmd.PersistentFlags().BoolVar(&config.DerefSymlinks, "deref-symlinks", config.DerefSymlinks, "Store a copy of each repo symlink's target instead of recreating the symlink")
+	rootCmd.PersistentFlags().BoolVar(&config.NoDownloadParam, "no-download-param", config.NoDownloadParam, "Don't add ?download=true to resolve URLs (for mirrors that reject it)")
+	rootCmd.PersistentFlags().StringSliceVar(&config.Endpoints, "endpoint", config.Endpoints, "Mirror to download file content from, e.g. https://hf-mirror.com; with several, each file fails over to the next and flaky or slow mirrors are tried last (repeatable, comma-separated)")
+	rootCmd.PersistentFlags().BoolVar(&config.EndpointAuth, "endpoint-auth", config.EndpointAuth, "Send the token to the --endpoint mirrors too; by default only huggingface.co gets it")
+	rootCmd.PersistentFlags().StringVar(&config.AuthHeaderName, "auth-header-name", config.AuthHeaderName, "Header carrying the token, for gateways that expect e.g. X-API-Key (default Authorization)")
+	rootCmd.PersistentFlags().StringVar(&config.AuthHeaderFormat, "auth-header-format", config.AuthHeaderFormat, "Template for the auth header value, e.g. \"{{.Token}}\" (default \"Bearer {{.Token}}\")")
+	rootCmd.PersistentFlags().StringArrayVar(&config.Headers, "header", config.Headers, "Extra header sent with every request to huggingface.co, as \"Name: Value\" (repeatable); other hosts only get it as --endpoint mirrors with --endpoint-auth")
+	rootCmd.PersistentFlags().StringVar(&config.ManifestKey, "manifest-key", config.ManifestKey, "Key used to check manifest signatures and, with --sign-manifest, to sign them (prefer HFDOWNLOADER_MANIFEST_KEY)")
+	rootCmd.PersistentFlags().BoolVar(&config.SignManifest, "sign-manifest", config.SignManifest, "Sign the manifest with an HMAC-SHA256 of its contents using --manifest-key")
+	rootCmd.PersistentFlags().BoolVar(&config.NoOverwriteManifest, "no-overwrite-manifest", config.NoOverwriteManifest, "Never replace an existing manifest")
+	rootCmd.PersistentFlags().StringVar(&config.Attestation, "attestation", config.Attestation, "After a successful run, write a provenance record of every downloaded file (path, size, SHA256, commit) to this file")
+	rootCmd.PersistentFlags().StringVar(&config.ExpectCommit, "expect-commit", config.ExpectCommit, "Abort before downloading anything unless the branch or tag resolves to this commit SHA (full or at least 7 characters), and download exactly that commit")
+	rootCmd.PersistentFlags().StringVar(&config.ChecksumFile, "checksum-manifest-out", config.ChecksumFile, "After a successful run, write the SHA256 of every downloaded file to this file, e.g. SHA256SUMS")
+	rootCmd.PersistentFlags().StringVar(&config.ChecksumFormat, "checksum-format", config.ChecksumFormat, "Format of --checksum-manifest-out: sha256sum (default), json or csv")
+	rootCmd.PersistentFlags().BoolVar(&config.GitLayout, "git-layout", config.GitLayout, "After a successful run, write .git metadata so the download folder can be used with git (remote, branch and commit, no history)")
+	rootCmd.PersistentFlags().StringVar(&config.ErrorReport, "error-report", config.ErrorReport, "When the run fails, write the error, failed files, revision and config (secrets redacted) to this JSON file")
+	rootCmd.PersistentFlags().StringVar(&config.SummaryJSON, "summary-json", config.SummaryJSON, "After every run, successful or not, write the repo, commit, file counts, bytes, duration and backend to this JSON file")
+	rootCmd.PersistentFlags().BoolVar(&config.DisableHTTP2, "disable-http2", config.DisableHTTP2, "Force HTTP/1.1, for mirrors where HTTP/2 stalls large transfers")
+	rootCmd.PersistentFlags().BoolVar(&config.NoCompression, "no-compression", config.NoCompression, "Don't ask the Hub for zstd or gzip compressed transfers of whole files")
+	rootCmd.PersistentFlags().StringVar(&config.CABundle, "ca-bundle", config.CABundle, "PEM file of extra CA certificates to trust, e.g. for a TLS-inspecting proxy")
+	rootCmd.PersistentFlags().BoolVar(&config.InsecureSkipVerify, "insecure-skip-verify", config.InsecureSkipVerify, "Don't verify TLS certificates (testing only)")
+	rootCmd.PersistentFlags().StringVar(&config.IPVersion, "ip-version", config.IPVersion, "Connect over IPv4 or IPv6 only (auto, 4 or 6), for single-stack networks")
+	rootCmd.PersistentFlags().StringVar(&config.KeepAliveInterval, "keepalive-interval", config.KeepAliveInterval, "TCP keepalive interval, e.g. 10s on flaky mobile or VPN links; a connection silent for three intervals is dropped and the transfer resumed (default 30s)")
+	rootCmd.PersistentFlags().StringVar(&config.LogLevel, "log-level", config.LogLevel, "Least severe messages shown: debug (adds per-request URLs and timings), info, warn or error (default info)")
+	rootCmd.PersistentFlags().StringVar(&config.LogFormat, "log-format", config.LogFormat, "Log output: plain lines, or text or json records for log collectors (default plain)")
+	rootCmd.PersistentFlags().IntVar(&config.MaxIdleConnsPerHost, "max-idle-conns-per-host", config.MaxIdleConnsPerHost, "Idle connections kept per host for reuse (0 for the default)")
+	rootCmd.PersistentFlags().IntVar(&config.MaxConnsPerHost, "max-conns-per-host", config.MaxConnsPerHost, "Most requests open against one host at a time, across all workers (0 for no cap)")
+	rootCmd.PersistentFlags().StringVar(&config.UserAgent, "user-agent", config.UserAgent, "User-Agent sent to HuggingFace (default hfdownloader/<version> (go/<version>))")
+	rootCmd.PersistentFlags().BoolVar(&config.Decompress, "decompress", config.Decompress, "Expand .gz files while downloading and store them without the .gz suffix")
+	rootCmd.PersistentFlags().IntVar(&config.MaxFiles, "max-files", config.MaxFiles, "Only download the first N matching files, sorted by path (0 for all)")
+	rootCmd.PersistentFlags().StringVar(&config.MaxTotalSize, "max-total-size", config.MaxTotalSize, "Only download matching files, sorted by path, while their total stays within this size, e.g. 50GB")
+	rootCmd.PersistentFlags().StringVar(&config.RequireFree, "require-free", config.RequireFree, "Refuse to start unless the storage folder's filesystem (or --require-free-path) has this much free space, e.g. 200GB")
+	rootCmd.PersistentFlags().StringVar(&config.RequireFreePath, "require-free-path", config.RequireFreePath, "Directory whose filesystem --require-free checks, e.g. a model serving mount")
+	rootCmd.PersistentFlags().BoolVar(&config.ContinueOnError, "continue-on-error", config.ContinueOnError, "Keep downloading the remaining files when one fails and report all failures at the end")
+	rootCmd.PersistentFlags().BoolVar(&config.RedownloadCorrupted, "redownload-corrupted", config.RedownloadCorrupted, "Download a file failing its SHA256 check again right away, up to --maxRetries times, instead of failing it")
+	rootCmd.PersistentFlags().StringVar(&config.SHAMismatch, "sha-mismatch", config.SHAMismatch, "What a file failing its checksum does: retry, fail or accept, optionally per kind, e.g. lfs=retry,regular=fail")
+	rootCmd.PersistentFlags().StringVar(&config.PreferFormat, "prefer-format", config.PreferFormat, "When weights ship in both formats, only download this one (safetensors or pytorch)")
+
+	// Complete --branch with the real branches of the repo given by -m/-d
+	rootCmd.RegisterFlagCompletionFunc("branch", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		repo, repoType := config.ModelName, hfd.RepoModel
+		if repo == "" && config.DatasetName != "" {
+			repo, repoType = config.DatasetName, hfd.RepoDataset
+		}
+		if repo == "" && config.SpaceName != "" {
+			repo, repoType = config.SpaceName, hfd.RepoSpace
+		}
+		if repo == "" && len(args) > 0 {
+			repo = args[0]
+		}
+		if repo == "" {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		token := config.AuthToken
+		if token == "" {
+			token = os.Getenv("HF_TOKEN")
+		}
+		branches, err := hfd.ListRepoBranches(repo, repoType, token)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return branches, cobra.ShellCompDirectiveNoFileComp
+	})
 
 	if err := rootCmd.Execute(); err != nil {
-		log.Fatalln("Error:", err)
+		log.Println("Error:", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// Exit codes, so scripts can tell failure modes apart.
+const (
+	exitFailure     = 1   // anything not covered below
+	exitAuth        = 2   // missing or rejected token, gated repo
+	exitNotFound    = 3   // repo, branch, file or --include pattern not found
+	exitNetwork     = 4   // connection failures and timeouts
+	exitChecksum    = 5   // downloaded data failed SHA256 verification
+	exitDiskFull    = 6   // ran out of local disk space
+	exitFilesFailed = 7   // some files failed for other reasons
+	exitTimeout     = 124 // --timeout expired
+	exitInterrupted = 130 // stopped by SIGINT/SIGTERM
+)
+
+// interruptContext is cancelled by the first SIGINT or SIGTERM, letting the
+// in-flight work (named by what) finish; a second signal exits immediately.
+// stop releases the signal handler.
+func interruptContext(what string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case _, ok := <-signals:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+		logger.Warn(fmt.Sprintf("Received shutdown signal, finishing in-flight %s (send again to exit immediately)", what))
+		cancel()
+		if _, ok := <-signals; ok {
+			logger.Warn("Received second shutdown signal, exiting now")
+			os.Exit(1)
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+		close(signals)
+	}
+}
+
+// exitCode maps an error to the exit code of its failure class.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, hfd.ErrTimeout):
+		return exitTimeout
+	case errors.Is(err, hfd.ErrInterrupted):
+		return exitInterrupted
+	case errors.Is(err, hfd.ErrAuth):
+		return exitAuth
+	case errors.Is(err, hfd.ErrNotFound), errors.Is(err, hfd.ErrUnmatchedPatterns):
+		return exitNotFound
+	case errors.Is(err, hfd.ErrChecksumMismatch):
+		return exitChecksum
+	case errors.Is(err, hfd.ErrDiskFull):
+		return exitDiskFull
+	case errors.Is(err, hfd.ErrNetwork):
+		return exitNetwork
+	case errors.Is(err, hfd.ErrFilesFailed):
+		return exitFilesFailed
+	}
+	return exitFailure
+}
+
+// printRemoteDiff prints a --verify-remote report, git status style.
+func printRemoteDiff(diff *hfd.RemoteDiff, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+
+	for _, p := range diff.Added {
+		fmt.Printf("added:    %s\n", p)
+	}
+	for _, p := range diff.Modified {
+		fmt.Printf("modified: %s\n", p)
+	}
+	for _, p := range diff.Deleted {
+		fmt.Printf("deleted:  %s\n", p)
+	}
+	if diff.Clean() {
+		fmt.Printf("Local copy is up to date (%d files)\n", diff.Unchanged)
+	} else {
+		fmt.Printf("%d added, %d modified, %d deleted, %d unchanged\n", len(diff.Added), len(diff.Modified), len(diff.Deleted), diff.Unchanged)
 	}
+	return nil
+}
+
+// printSnapshotDiff prints a diff report, or encodes it as JSON.
+func printSnapshotDiff(diff *hfd.SnapshotDiff, dirA, dirB string, asJSON bool) {
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(diff)
+		return
+	}
+
+	for _, p := range diff.Differ {
+		fmt.Printf("differs: %s\n", p)
+	}
+	for _, p := range diff.OnlyInA {
+		fmt.Printf("only in %s: %s\n", dirA, p)
+	}
+	for _, p := range diff.OnlyInB {
+		fmt.Printf("only in %s: %s\n", dirB, p)
+	}
+	if diff.Clean() {
+		fmt.Printf("Identical (%d files)\n", diff.Identical)
+	} else {
+		fmt.Printf("%d differ, %d only in %s, %d only in %s, %d identical\n", len(diff.Differ), len(diff.OnlyInA), dirA, len(diff.OnlyInB), dirB, diff.Identical)
+	}
+}
+
+// printResolvedURLs writes one "url<TAB>path" line per file to out, with a
+// warning on stderr when the URLs are presigned and will expire.
+func printResolvedURLs(resolved []hfd.ResolvedURL, out io.Writer, asJSON bool) error {
+	var expires time.Time
+	presigned := false
+	for _, r := range resolved {
+		presigned = presigned || r.Presigned
+		if !r.Expires.IsZero() && (expires.IsZero() || r.Expires.Before(expires)) {
+			expires = r.Expires
+		}
+	}
+	if presigned {
+		if expires.IsZero() {
+			logger.Warn("Warning: these are presigned URLs and expire after a while, use them soon")
+		} else {
+			logger.Warn(fmt.Sprintf("Warning: these are presigned URLs, the first expires at %s", expires.Local().Format(time.RFC3339)))
+		}
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(resolved)
+	}
+	for _, r := range resolved {
+		if _, err := fmt.Fprintf(out, "%s\t%s\n", r.URL, r.LocalPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirrorLocal deletes local files that are no longer in the remote revision,
+// after listing them and asking for confirmation unless assumeYes is set.
+func mirrorLocal(downloader *hfd.Downloader, opts hfd.DownloadOptions, result *hfd.DownloadResult, assumeYes bool) error {
+	extras, err := downloader.MirrorExtras(opts, result)
+	if err != nil {
+		return err
+	}
+	if len(extras) == 0 {
+		fmt.Println("Mirror: no extra local files")
+		return nil
+	}
+
+	fmt.Printf("Mirror: %d local file(s) are not in the remote revision:\n", len(extras))
+	for _, p := range extras {
+		fmt.Printf("  %s\n", p)
+	}
+	if !assumeYes {
+		fmt.Print("Delete them? [y/N] ")
+		var answer string
+		fmt.Scanln(&answer)
+		if answer != "y" && answer != "Y" && answer != "yes" {
+			fmt.Println("Nothing deleted")
+			return nil
+		}
+	}
+	return downloader.RemoveLocalFiles(opts, extras)
+}
+
+// describeFilters summarizes the file selection options in effect, empty when
+// every file is selected.
+func describeFilters(config *Config) string {
+	var parts []string
+	add := func(name string, values []string) {
+		if len(values) > 0 {
+			parts = append(parts, name+" "+strings.Join(values, ","))
+		}
+	}
+	if config.HFPrefix != "" {
+		add("prefix", []string{config.HFPrefix})
+	}
+	add("dirs", config.Dirs)
+	add("include", config.Include)
+	add("exclude", config.Exclude)
+	add("ext", config.Extensions)
+	if config.WeightsOnly {
+		parts = append(parts, "weights only")
+	}
+	if config.PreferFormat != "" {
+		add("prefer", []string{config.PreferFormat})
+	}
+	if config.MaxFiles > 0 {
+		add("max files", []string{strconv.Itoa(config.MaxFiles)})
+	}
+	if config.MaxTotalSize != "" {
+		add("max total size", []string{config.MaxTotalSize})
+	}
+	return strings.Join(parts, "; ")
+}
+
+// printCacheStats lists each repo with its revisions, largest first.
+func printCacheStats(stats *hfd.CacheStats, dir string) {
+	if len(stats.Repos) == 0 {
+		fmt.Printf("No downloads found in %s\n", dir)
+		return
+	}
+	for _, repo := range stats.Repos {
+		fmt.Printf("%-10s %6d files  %s  %s (%s)\n", hfd.FormatSize(repo.Size), repo.Files, formatAccess(repo.LastAccess), repo.Repo, repo.Layout)
+		for _, rev := range repo.Revisions {
+			fmt.Printf("  %-10s %6d files  %s  %s\n", hfd.FormatSize(rev.Size), rev.Files, formatAccess(rev.LastAccess), rev.Revision)
+		}
+	}
+	fmt.Printf("Total: %s in %d file(s) across %d repo(s)\n", hfd.FormatSize(stats.Size), stats.Files, len(stats.Repos))
+}
+
+// formatAccess is a last access time for printCacheStats, "never" for a repo without files.
+func formatAccess(t time.Time) string {
+	if t.IsZero() {
+		return fmt.Sprintf("%-16s", "never")
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// printPruneReport lists what prune found and how much space it would free.
+func printPruneReport(report *hfd.PruneReport) {
+	for _, file := range report.Files {
+		fmt.Printf("%-10s %s (%s, last modified %s)\n", hfd.FormatSize(file.Size), file.Path, file.Reason, file.ModTime.Format(time.RFC3339))
+	}
+	for dir, stale := range report.StaleEntries {
+		fmt.Printf("%d stale manifest entries in %s\n", len(stale), dir)
+	}
+	if len(report.Files) == 0 && len(report.StaleEntries) == 0 {
+		fmt.Println("Nothing to prune")
+		return
+	}
+	fmt.Printf("Reclaimable: %s in %d file(s)\n", hfd.FormatSize(report.Reclaimable), len(report.Files))
+}
+
+// configureHTTP applies the User-Agent, auth header and transport settings to
+// the library's shared HTTP client.
+func configureHTTP(config *Config) error {
+	hfd.UserAgent = fmt.Sprintf("hfdownloader/%s (go/%s)", VERSION, strings.TrimPrefix(runtime.Version(), "go"))
+	if config.UserAgent != "" {
+		hfd.UserAgent = config.UserAgent
+	}
+	if err := hfd.SetAuthHeader(config.AuthHeaderName, config.AuthHeaderFormat); err != nil {
+		return err
+	}
+	if config.InsecureSkipVerify {
+		logger.Warn("⚠️  WARNING: --insecure-skip-verify is set, TLS certificates are NOT verified. Anyone on the network path can read and alter the traffic, including your token. Use it for testing only.")
+	}
+	headers, err := hfd.ParseHeaders(config.Headers)
+	if err != nil {
+		return err
+	}
+	var keepAlive time.Duration
+	if config.KeepAliveInterval != "" {
+		if keepAlive, err = time.ParseDuration(config.KeepAliveInterval); err != nil || keepAlive < time.Second {
+			return fmt.Errorf("invalid --keepalive-interval %q: expected a duration of at least 1s, such as 10s", config.KeepAliveInterval)
+		}
+	}
+	authHeader := "Authorization"
+	if config.AuthHeaderName != "" {
+		authHeader = config.AuthHeaderName
+	}
+	if headers.Get(authHeader) != "" {
+		logger.Warn(fmt.Sprintf("⚠️  WARNING: --header sets %s, replacing the token's auth header on every request", authHeader))
+	}
+	// Like the token, the headers only go to the mirrors trusted with it
+	var headerHosts []string
+	if config.EndpointAuth {
+		headerHosts = config.Endpoints
+	}
+	if len(headers) > 0 || keepAlive > 0 || config.DisableHTTP2 || config.NoCompression || config.MaxIdleConnsPerHost > 0 || config.MaxConnsPerHost > 0 || config.CABundle != "" || config.InsecureSkipVerify || (config.IPVersion != "" && config.IPVersion != "auto") {
+		return hfd.ConfigureTransport(hfd.TransportOptions{
+			DisableHTTP2:        config.DisableHTTP2,
+			DisableCompression:  config.NoCompression,
+			MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+			MaxConnsPerHost:     config.MaxConnsPerHost,
+			CABundle:            config.CABundle,
+			InsecureSkipVerify:  config.InsecureSkipVerify,
+			IPVersion:           config.IPVersion,
+			Headers:             headers,
+			HeaderHosts:         headerHosts,
+			KeepAliveInterval:   keepAlive,
+		})
+	}
+	return nil
+}
+
+// resolveAuthToken falls back to the token environment variables when none was configured.
+func resolveAuthToken(config *Config) {
+	if config.AuthToken == "" {
+		config.AuthToken = os.Getenv("HF_TOKEN")
+		if config.AuthToken == "" {
+			config.AuthToken = os.Getenv("HUGGING_FACE_HUB_TOKEN")
+			if config.AuthToken != "" {
+				logger.Warn("DeprecationWarning: The environment variable 'HUGGING_FACE_HUB_TOKEN' is deprecated and will be removed in a future version. Please use 'HF_TOKEN' instead.")
+			}
+		}
+	}
+}
+
+// azureConfigFrom builds the Azure upload target when --azure is set. The
+// connection string wins over the separate account and key variables.
+func azureConfigFrom(config *Config) (*hfd.AzureConfig, error) {
+	if !config.UseAzure {
+		return nil, nil
+	}
+	if config.AzureContainer == "" {
+		return nil, errors.New("--azure requires --azure-container")
+	}
+	var cfg hfd.AzureConfig
+	if connStr := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); connStr != "" {
+		var err error
+		if cfg, err = hfd.ParseAzureConnectionString(connStr); err != nil {
+			return nil, err
+		}
+	} else {
+		cfg.Account, cfg.Key = os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_KEY")
+		if cfg.Account == "" || cfg.Key == "" {
+			return nil, errors.New("--azure needs AZURE_STORAGE_CONNECTION_STRING, or AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY")
+		}
+	}
+	cfg.Container = config.AzureContainer
+	cfg.Prefix = firstNonEmpty(config.AzurePrefix, "hf_dataset")
+	return &cfg, nil
+}
+
+// r2ConfigFrom builds the R2 target from the config, or returns nil without --r2.
+func r2ConfigFrom(config *Config) (*hfd.R2Config, error) {
+	if !config.UseR2 {
+		return nil, nil
+	}
+	// Credentials come from the flags first, then the --r2-profile profile, then env
+	accountID, accessKey, secretKey := config.R2AccountID, config.R2AccessKey, config.R2SecretKey
+	if config.R2Profile != "" {
+		credsPath, err := hfd.SharedCredentialsFile()
+		if err != nil {
+			return nil, err
+		}
+		creds, err := hfd.LoadR2Profile(credsPath, config.R2Profile)
+		if err != nil {
+			return nil, err
+		}
+		accountID = firstNonEmpty(accountID, creds.AccountID)
+		accessKey = firstNonEmpty(accessKey, creds.AccessKeyID)
+		secretKey = firstNonEmpty(secretKey, creds.AccessKeySecret)
+	}
+	accountID = firstNonEmpty(accountID, os.Getenv("R2_ACCOUNT_ID"))
+	accessKey = firstNonEmpty(accessKey, os.Getenv("R2_WRITE_ACCESS_KEY_ID"))
+	secretKey = firstNonEmpty(secretKey, os.Getenv("R2_WRITE_SECRET_ACCESS_KEY"))
+	if accountID == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("R2 credentials not found in flags, --r2-profile or environment variables")
+	}
+
+	// Use config.R2BucketName if provided; otherwise, try the env variable R2_BUCKET_NAME;
+	// if still empty, fallback to accountID.
+	bucketName := config.R2BucketName
+	if bucketName == "" {
+		bucketName = os.Getenv("R2_BUCKET_NAME")
+		if bucketName == "" {
+			bucketName = accountID
+		}
+	}
+
+	// Use the provided subfolder or default if empty
+	subfolder := config.R2Subfolder
+	if subfolder == "" {
+		subfolder = "hf_dataset"
+	}
+
+	return &hfd.R2Config{
+		AccountID:       accountID,
+		AccessKeyID:     accessKey,
+		AccessKeySecret: secretKey,
+		BucketName:      bucketName,
+		Region:          "auto",
+		Subfolder:       subfolder,
+	}, nil
+}
+
+// firstNonEmpty returns the first of values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// completeEvent is the data available to --on-complete.
+type completeEvent struct {
+	Repo  string
+	Path  string // local download folder
+	OK    bool
+	Error string
+}
+
+// runHook expands a hook command with data and runs it through the shell,
+// logging its exit status.
+func runHook(tmpl *template.Template, data interface{}) error {
+	var command strings.Builder
+	if err := tmpl.Execute(&command, data); err != nil {
+		return fmt.Errorf("failed to expand %s hook: %v", tmpl.Name(), err)
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command.String())
+	} else {
+		cmd = exec.Command("sh", "-c", command.String())
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		logger.Error(fmt.Sprintf("Hook %s (%s) failed: %v", tmpl.Name(), command.String(), err))
+		return fmt.Errorf("%s hook failed: %v", tmpl.Name(), err)
+	}
+	logger.Info(fmt.Sprintf("Hook %s (%s) exited with status 0", tmpl.Name(), command.String()))
+	return nil
+}
+
+// parseTransforms turns --transform specs into transforms: "[pattern=]name"
+// for a built-in one, or "[pattern=]exec:command" to run a shell command
+// expanded like --on-file-complete, which fails the file on a non-zero exit.
+func parseTransforms(specs []string) ([]hfd.FileTransform, error) {
+	var transforms []hfd.FileTransform
+	for _, spec := range specs {
+		pattern, command := "", ""
+		if strings.HasPrefix(spec, "exec:") {
+			command = strings.TrimPrefix(spec, "exec:")
+		} else if p, name, ok := strings.Cut(spec, "="); ok && strings.HasPrefix(strings.TrimSpace(name), "exec:") {
+			pattern, command = strings.TrimSpace(p), strings.TrimPrefix(strings.TrimSpace(name), "exec:")
+		}
+		if command == "" {
+			transform, err := hfd.ParseTransform(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --transform %q: %v", spec, err)
+			}
+			transforms = append(transforms, transform)
+			continue
+		}
+
+		if pattern == "" {
+			pattern = "*"
+		}
+		if err := hfd.ValidatePatterns([]string{pattern}); err != nil {
+			return nil, fmt.Errorf("invalid --transform %q: %v", spec, err)
+		}
+		tmpl, err := template.New("transform").Parse(command)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --transform %q: %v", spec, err)
+		}
+		transforms = append(transforms, hfd.FileTransform{
+			Pattern: pattern,
+			Name:    "exec",
+			Run: func(ctx context.Context, event hfd.FileEvent) error {
+				return runHook(tmpl, event)
+			},
+		})
+	}
+	return transforms, nil
+}
+
+// onlyChecksumMismatches reports whether every failed file failed its checksum.
+func onlyChecksumMismatches(result *hfd.DownloadResult) bool {
+	if result == nil || len(result.Failed) == 0 {
+		return false
+	}
+	for _, failed := range result.Failed {
+		if !errors.Is(failed, hfd.ErrChecksumMismatch) {
+			return false
+		}
+	}
+	return true
+}
+
+// printFailedFiles lists the files that could not be downloaded.
+func printFailedFiles(failed []hfd.FileError) {
+	fmt.Printf("\n%d file(s) failed to download:\n", len(failed))
+	for _, f := range failed {
+		fmt.Printf("  %s: %s\n", f.Path, f.Message)
+	}
+}
+
+// printPointerFiles warns about files that turned out to be Git LFS pointers.
+func printPointerFiles(pointers []string, skipped bool) {
+	if len(pointers) == 0 {
+		return
+	}
+	action := "were saved as-is, rerun with --skip-pointers to leave them out"
+	if skipped {
+		action = "were skipped"
+	}
+	fmt.Printf("\nWarning: %d file(s) are Git LFS pointers instead of real content, the repo was pushed without LFS. They %s:\n", len(pointers), action)
+	for _, p := range pointers {
+		fmt.Printf("  %s\n", p)
+	}
+}
+
+// printTransferSummary lists the bytes moved per file, largest first, with the
+// totals for Hub egress and upload ingress.
+func printTransferSummary(result *hfd.DownloadResult) {
+	if len(result.Transfers) == 0 {
+		return
+	}
+	transfers := append([]hfd.FileTransfer(nil), result.Transfers...)
+	sort.Slice(transfers, func(i, j int) bool {
+		a, b := transfers[i], transfers[j]
+		if a.BytesDownloaded+a.BytesUploaded != b.BytesDownloaded+b.BytesUploaded {
+			return a.BytesDownloaded+a.BytesUploaded > b.BytesDownloaded+b.BytesUploaded
+		}
+		return a.Path < b.Path
+	})
+
+	fmt.Printf("\nBytes transferred:\n")
+	fmt.Printf("  %12s %12s  %s\n", "downloaded", "uploaded", "file")
+	for _, t := range transfers {
+		fmt.Printf("  %12d %12d  %s\n", t.BytesDownloaded, t.BytesUploaded, t.Path)
+	}
+	fmt.Printf("  %12d %12d  total (%s downloaded, %s uploaded)\n", result.BytesDownloaded, result.BytesUploaded,
+		hfd.FormatSize(result.BytesDownloaded), hfd.FormatSize(result.BytesUploaded))
+}
+
+// printBudgetUsage reports how much of the selection --max-total-size let
+// through and how much of it this run fetched.
+func printBudgetUsage(result *hfd.DownloadResult) {
+	b := result.Budget
+	if b == nil {
+		return
+	}
+	if b.TotalFiles > 0 {
+		fmt.Printf("\nSize budget: %d of %d files (%s of %s) fit, %s downloaded this run\n",
+			b.Files, b.TotalFiles, hfd.FormatSize(b.Bytes), hfd.FormatSize(b.TotalBytes), hfd.FormatSize(result.BytesDownloaded))
+		return
+	}
+	fmt.Printf("\nSize budget: %d files (%s) fit, %s downloaded this run\n",
+		b.Files, hfd.FormatSize(b.Bytes), hfd.FormatSize(result.BytesDownloaded))
 }
 
 func installBinary(installPath string) error {
@@ -387,3 +2060,158 @@ func copyFile(dst string, src *os.File) error {
 	}
 	return nil
 }
+
+// redacted replaces secrets in an error report.
+const redacted = "[REDACTED]"
+
+// errorReport is what --error-report writes when a run fails, for CI
+// artifacts and dashboards.
+type errorReport struct {
+	Error      string          `json:"error"`
+	ExitCode   int             `json:"exit_code"`
+	Repo       string          `json:"repo"`
+	Revision   string          `json:"revision"`
+	Commit     string          `json:"commit,omitempty"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+	Failed     []hfd.FileError `json:"failed,omitempty"`
+	Config     Config          `json:"config"`
+}
+
+func newErrorReport(err error, result *hfd.DownloadResult, opts hfd.DownloadOptions, config Config, startedAt time.Time) *errorReport {
+	report := &errorReport{
+		Error:      err.Error(),
+		ExitCode:   exitCode(err),
+		Repo:       opts.Repo,
+		Revision:   opts.Branch,
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: time.Now().UTC(),
+		Config:     config,
+	}
+	if result != nil {
+		report.Revision, report.Commit, report.Failed = result.Revision, result.Commit, result.Failed
+	}
+	for _, secret := range []*string{&report.Config.AuthToken, &report.Config.R2AccessKey, &report.Config.R2SecretKey, &report.Config.ManifestKey} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	// Header values are often gateway keys; keep the names to show what was sent
+	report.Config.Headers = nil
+	for _, header := range config.Headers {
+		name, _, _ := strings.Cut(header, ":")
+		report.Config.Headers = append(report.Config.Headers, name+": "+redacted)
+	}
+	return report
+}
+
+// write saves the report to path. Every value in secrets is scrubbed from the
+// output as well, in case one turned up in an error message.
+func (r *errorReport) write(path string, secrets []string) error {
+	if err := writeRedactedJSON(path, r, secrets); err != nil {
+		return fmt.Errorf("failed to write error report: %v", err)
+	}
+	return nil
+}
+
+// writeRedactedJSON saves v to path as indented JSON with every value in
+// secrets replaced by redacted.
+func writeRedactedJSON(path string, v any, secrets []string) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		if len(secret) >= 4 {
+			data = bytes.ReplaceAll(data, []byte(secret), []byte(redacted))
+		}
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// runSummary is what --summary-json writes after every run, for orchestration
+// that records what each run did. The download result supplies the revision,
+// commit, selected file count, failures, transfers and bytes.
+type runSummary struct {
+	Repo       string    `json:"repo"`
+	Backend    string    `json:"backend"` // local, r2, gcs or azure, joined with + when both are written
+	OK         bool      `json:"ok"`
+	Error      string    `json:"error,omitempty"`
+	ExitCode   int       `json:"exit_code"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Duration   float64   `json:"duration_seconds"`
+	Downloaded int       `json:"files_downloaded"` // files transferred successfully this run
+	Skipped    int       `json:"files_skipped"`    // selected files already present, linked or not reached
+	FailedN    int       `json:"files_failed"`
+	*hfd.DownloadResult
+}
+
+func newRunSummary(err error, result *hfd.DownloadResult, opts hfd.DownloadOptions, config Config, startedAt time.Time) *runSummary {
+	finishedAt := time.Now()
+	if result == nil {
+		result = &hfd.DownloadResult{Revision: opts.Branch}
+	}
+	summary := &runSummary{
+		Repo:           opts.Repo,
+		Backend:        backendOf(config),
+		OK:             err == nil,
+		StartedAt:      startedAt.UTC(),
+		FinishedAt:     finishedAt.UTC(),
+		Duration:       finishedAt.Sub(startedAt).Seconds(),
+		FailedN:        len(result.Failed),
+		DownloadResult: result,
+	}
+	if err != nil {
+		summary.Error, summary.ExitCode = err.Error(), exitCode(err)
+	}
+	failed := make(map[string]bool)
+	for _, f := range result.Failed {
+		failed[f.Path] = true
+	}
+	downloaded := make(map[string]bool)
+	for _, t := range result.Transfers {
+		if !failed[t.Path] && !downloaded[t.Path] {
+			downloaded[t.Path] = true
+			summary.Downloaded++
+		}
+	}
+	if skipped := result.Files - summary.Downloaded - summary.FailedN; skipped > 0 {
+		summary.Skipped = skipped
+	}
+	return summary
+}
+
+// backendOf names where a run writes its files.
+func backendOf(config Config) string {
+	var backends []string
+	if !config.SkipLocal || !(config.UseR2 || config.UseGCS || config.UseAzure) {
+		backends = append(backends, "local")
+	}
+	switch {
+	case config.UseR2:
+		backends = append(backends, "r2")
+	case config.UseGCS:
+		backends = append(backends, "gcs")
+	case config.UseAzure:
+		backends = append(backends, "azure")
+	}
+	return strings.Join(backends, "+")
+}
+
+// secretsOf lists the credentials in use, wherever they came from.
+func secretsOf(config Config, r2cfg *hfd.R2Config, azurecfg *hfd.AzureConfig) []string {
+	secrets := []string{config.AuthToken, config.R2AccessKey, config.R2SecretKey, config.ManifestKey, os.Getenv("HF_TOKEN")}
+	if r2cfg != nil {
+		secrets = append(secrets, r2cfg.AccessKeyID, r2cfg.AccessKeySecret)
+	}
+	if azurecfg != nil {
+		secrets = append(secrets, azurecfg.Key)
+	}
+	for _, header := range config.Headers {
+		if _, value, ok := strings.Cut(header, ":"); ok {
+			secrets = append(secrets, strings.TrimSpace(value))
+		}
+	}
+	return secrets
+}
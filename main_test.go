@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"text/template"
+	"time"
+
+	hfd "github.com/bodaay/HuggingFaceModelDownloader/hfdownloader"
+)
+
+// writeConfig writes a config file fixture and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hfdownloader.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnvOverrides(t *testing.T) {
+	path := writeConfig(t, `{"num_connections": 4, "skip_sha": false, "branch": "dev"}`)
+	t.Setenv("HFDOWNLOADER_NUM_CONNECTIONS", "16")
+	t.Setenv("HFDOWNLOADER_SKIP_SHA", "true")
+	t.Setenv("HFDOWNLOADER_INCLUDE", "*.json, *.safetensors,")
+	config, err := LoadConfig(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.NumConnections != 16 || !config.SkipSHA {
+		t.Errorf("num_connections %d and skip_sha %v, want the environment's 16 and true", config.NumConnections, config.SkipSHA)
+	}
+	if config.Branch != "dev" {
+		t.Errorf("branch %q, want the config file's dev", config.Branch)
+	}
+	if len(config.Include) != 2 || config.Include[0] != "*.json" || config.Include[1] != "*.safetensors" {
+		t.Errorf("include %q", config.Include)
+	}
+
+	t.Setenv("HFDOWNLOADER_SKIP_SHA", "0")
+	if config, err := LoadConfig(path, false); err != nil || config.SkipSHA {
+		t.Errorf("HFDOWNLOADER_SKIP_SHA=0: skip_sha %v, %v", config.SkipSHA, err)
+	}
+}
+
+func TestEnvOverridesRejectMalformedValues(t *testing.T) {
+	path := writeConfig(t, `{}`)
+	for key, value := range map[string]string{
+		"HFDOWNLOADER_NUM_CONNECTIONS": "many",
+		"HFDOWNLOADER_MAX_WORKERS":     "1.5",
+		"HFDOWNLOADER_SKIP_SHA":        "yes please",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			_, err := LoadConfig(path, false)
+			if err == nil || !strings.Contains(err.Error(), key) {
+				t.Fatalf("error %v, want one naming %s", err, key)
+			}
+		})
+	}
+
+	t.Setenv("HFDOWNLOADER_NUM_CONNECTIONS", "0")
+	if _, err := LoadConfig(path, false); err == nil || !strings.Contains(err.Error(), "num_connections must be at least 1") {
+		t.Fatalf("error %v, want a range error", err)
+	}
+}
+
+func TestConfigPathFromArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-m", "o/m"}, ""},
+		{[]string{"--config", "a.json", "-m", "o/m"}, "a.json"},
+		{[]string{"-m", "o/m", "--config=b.json"}, "b.json"},
+		{[]string{"--config"}, ""},
+		{[]string{"--", "--config", "c.json"}, ""},
+	} {
+		if got := configPathFromArgs(tc.args); got != tc.want {
+			t.Errorf("configPathFromArgs(%q) = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestLoadConfigFromPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	config, err := LoadConfig(writeConfig(t, `{"branch": "dev", "num_connections": 3}`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Branch != "dev" || config.NumConnections != 3 {
+		t.Errorf("branch %q and num_connections %d, want the fixture's dev and 3", config.Branch, config.NumConnections)
+	}
+	if config.MaxRetries != DefaultConfig().MaxRetries {
+		t.Errorf("max_retries %d, want the default for fields the file leaves out", config.MaxRetries)
+	}
+
+	// A missing default file means defaults; a missing explicit one is an error
+	if config, err := LoadConfig("", false); err != nil || config.Branch != DefaultConfig().Branch {
+		t.Errorf("without a config file: %+v, %v", config, err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	if _, err := LoadConfig(missing, false); err == nil || !strings.Contains(err.Error(), "missing.json") {
+		t.Errorf("error %v, want one naming the missing file", err)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{errors.New("boom"), exitFailure},
+		{fmt.Errorf("%w: %w: 1 file(s)", hfd.ErrFilesFailed, hfd.ErrAuth), exitAuth},
+		{fmt.Errorf("failed to download: %w", hfd.ErrNotFound), exitNotFound},
+		{fmt.Errorf("%w: 2 file(s), first: %w", hfd.ErrFilesFailed, hfd.ErrChecksumMismatch), exitChecksum},
+		{fmt.Errorf("failed to write: %w", hfd.ErrDiskFull), exitDiskFull},
+		{fmt.Errorf("failed to fetch file list: %w", hfd.ErrNetwork), exitNetwork},
+		{fmt.Errorf("%w: 1 file(s)", hfd.ErrFilesFailed), exitFilesFailed},
+		{fmt.Errorf("%w: %w", hfd.ErrInterrupted, hfd.ErrFilesFailed), exitInterrupted},
+	} {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are sh commands here")
+	}
+	out := filepath.Join(t.TempDir(), "hook.log")
+	tmpl := template.Must(template.New("on-file-complete").Parse("echo {{.Path}} {{.Size}} >> " + out))
+	for _, event := range []hfd.FileEvent{{Path: "config.json", Size: 2}, {Path: "model.safetensors", Size: 7}} {
+		if err := runHook(tmpl, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := os.ReadFile(out); string(got) != "config.json 2\nmodel.safetensors 7\n" {
+		t.Fatalf("hook wrote %q", got)
+	}
+
+	failing := template.Must(template.New("on-complete").Parse("exit 3"))
+	if err := runHook(failing, completeEvent{Repo: "o/m"}); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("err = %v, want the hook's exit status", err)
+	}
+}
+
+func TestR2CredentialPrecedence(t *testing.T) {
+	creds := filepath.Join(t.TempDir(), "credentials")
+	profile := "[r2]\naws_access_key_id = profile-key\naws_secret_access_key = profile-secret\naccount_id = profile-account\n"
+	if err := os.WriteFile(creds, []byte(profile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", creds)
+	t.Setenv("R2_ACCOUNT_ID", "env-account")
+	t.Setenv("R2_WRITE_ACCESS_KEY_ID", "env-key")
+	t.Setenv("R2_WRITE_SECRET_ACCESS_KEY", "env-secret")
+	t.Setenv("R2_BUCKET_NAME", "")
+
+	// The flag wins over the profile, which wins over the environment
+	r2cfg, err := r2ConfigFrom(&Config{UseR2: true, R2Profile: "r2", R2AccessKey: "flag-key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2cfg.AccessKeyID != "flag-key" || r2cfg.AccessKeySecret != "profile-secret" || r2cfg.AccountID != "profile-account" {
+		t.Fatalf("got %+v", r2cfg)
+	}
+
+	r2cfg, err = r2ConfigFrom(&Config{UseR2: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2cfg.AccessKeyID != "env-key" || r2cfg.AccountID != "env-account" || r2cfg.BucketName != "env-account" {
+		t.Fatalf("got %+v without a profile", r2cfg)
+	}
+
+	if _, err := r2ConfigFrom(&Config{UseR2: true, R2Profile: "missing"}); err == nil {
+		t.Fatal("missing profile accepted")
+	}
+}
+
+func TestTimeoutExitCode(t *testing.T) {
+	err := fmt.Errorf("download stopped: %w", errors.Join(hfd.ErrInterrupted, hfd.ErrTimeout))
+	if got := exitCode(err); got != exitTimeout {
+		t.Fatalf("exit code %d for an expired --timeout, want %d", got, exitTimeout)
+	}
+}
+
+func TestStrictConfig(t *testing.T) {
+	path := writeConfig(t, `{"branch": "dev", "num_conections": 3}`)
+	if _, err := LoadConfig(path, false); err != nil {
+		t.Fatalf("unknown field rejected without --strict-config: %v", err)
+	}
+	_, err := LoadConfig(path, true)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "num_conections", did you mean "num_connections"?`) {
+		t.Fatalf("error %v, want the unknown field and a suggestion", err)
+	}
+	if _, err := LoadConfig(writeConfig(t, `{"zzzzzzzz": 1}`), true); err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Fatalf("error %v, want an unknown field without a suggestion", err)
+	}
+	if !strictConfigFromArgs([]string{"-m", "o/m", "--strict-config"}) || strictConfigFromArgs([]string{"--", "--strict-config"}) {
+		t.Error("--strict-config not found in the command line")
+	}
+}
+
+func TestConfigTypeErrors(t *testing.T) {
+	for content, want := range map[string]string{
+		"{\n  \"branch\": \"main\",\n  \"num_connections\": \"8\"\n}": `line 3, column 24: "num_connections" must be an integer, got string`,
+		`{"skip_sha": 1}`:               `"skip_sha" must be true or false, got number`,
+		`{"include": "*.json"}`:         `"include" must be a list of strings, got string`,
+		"{\n  \"branch\": \"main\",\n}": "line 3, column 1",
+	} {
+		_, err := LoadConfig(writeConfig(t, content), false)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestPrintResolvedURLs(t *testing.T) {
+	resolved := []hfd.ResolvedURL{
+		{Path: "config.json", LocalPath: "/models/o/m/config.json", URL: "https://huggingface.co/o/m/resolve/main/config.json?download=true"},
+		{Path: "model.safetensors", LocalPath: "/models/o/m/model.safetensors", URL: "https://cdn-lfs.hf.co/blob?X-Amz-Signature=sig", Presigned: true},
+	}
+	var out bytes.Buffer
+	if err := printResolvedURLs(resolved, &out, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "https://huggingface.co/o/m/resolve/main/config.json?download=true\t/models/o/m/config.json\n" +
+		"https://cdn-lfs.hf.co/blob?X-Amz-Signature=sig\t/models/o/m/model.safetensors\n"
+	if out.String() != want {
+		t.Fatalf("printed\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestErrorReportRedactsSecrets(t *testing.T) {
+	const token, accessKey, secretKey, azureKey, gatewayKey = "hf_abcdefghijklmnop", "r2-access-key-id", "r2-secret-access-key", "YXp1cmUta2V5", "gw-0123456789"
+	config := Config{AuthToken: token, R2AccessKey: accessKey, R2SecretKey: secretKey, Headers: []string{"X-Gateway-Key: " + gatewayKey}, Storage: "Storage", Branch: "main"}
+	result := &hfd.DownloadResult{
+		Revision: "main",
+		Commit:   "0123456789abcdef0123456789abcdef01234567",
+		Failed: []hfd.FileError{
+			{Path: "model.safetensors", Message: "upload failed: bad key " + secretKey},
+			{Path: "config.json", Message: "GET https://huggingface.co/o/m?token=" + token + ": 500"},
+		},
+	}
+	err := fmt.Errorf("failed to download o/m after 3 attempts: %w", errors.Join(hfd.ErrFilesFailed, errors.New("auth "+azureKey), errors.New("gateway refused "+gatewayKey)))
+	started := time.Now().Add(-time.Minute)
+	report := newErrorReport(err, result, hfd.DownloadOptions{Repo: "o/m", Branch: "main"}, config, started)
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := report.write(path, secretsOf(config, &hfd.R2Config{AccessKeyID: accessKey, AccessKeySecret: secretKey}, &hfd.AzureConfig{Key: azureKey})); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{token, accessKey, secretKey, azureKey, gatewayKey} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("report leaks %q:\n%s", secret, data)
+		}
+	}
+	var got struct {
+		Error     string    `json:"error"`
+		ExitCode  int       `json:"exit_code"`
+		Repo      string    `json:"repo"`
+		Revision  string    `json:"revision"`
+		Commit    string    `json:"commit"`
+		StartedAt time.Time `json:"started_at"`
+		Failed    []struct {
+			Path  string `json:"path"`
+			Error string `json:"error"`
+		} `json:"failed"`
+		Config struct {
+			AuthToken string   `json:"auth_token"`
+			Branch    string   `json:"branch"`
+			Headers   []string `json:"headers"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Repo != "o/m" || got.Revision != "main" || got.Commit != result.Commit || got.ExitCode != exitFilesFailed || !got.StartedAt.Equal(started.UTC()) {
+		t.Fatalf("report fields wrong: %+v", got)
+	}
+	if len(got.Failed) != 2 || got.Failed[0].Path != "model.safetensors" || !strings.Contains(got.Failed[0].Error, redacted) {
+		t.Fatalf("per-file failures wrong: %+v", got.Failed)
+	}
+	if got.Config.AuthToken != redacted || got.Config.Branch != "main" || !slices.Equal(got.Config.Headers, []string{"X-Gateway-Key: " + redacted}) {
+		t.Fatalf("config wrong: %+v", got.Config)
+	}
+	if config.Headers[0] != "X-Gateway-Key: "+gatewayKey {
+		t.Fatalf("redacting the report changed the config's headers to %q", config.Headers)
+	}
+}
+
+func TestMissingRepoExitCodes(t *testing.T) {
+	if got := exitCode(fmt.Errorf("%w: o/typo (revision main)", hfd.ErrRepoNotFound)); got != exitNotFound {
+		t.Fatalf("exit code %d for a missing repo, want %d", got, exitNotFound)
+	}
+	if got := exitCode(fmt.Errorf("%w: the token was rejected for o/m", hfd.ErrAuth)); got != exitAuth {
+		t.Fatalf("exit code %d for a rejected token, want %d", got, exitAuth)
+	}
+}
+
+func TestHeaderOverridingAuthWarns(t *testing.T) {
+	var out bytes.Buffer
+	saved, userAgent := logger, hfd.UserAgent
+	logger = slog.New(hfd.NewPlainHandler(&out, nil))
+	t.Cleanup(func() {
+		logger, hfd.UserAgent = saved, userAgent
+		hfd.ConfigureTransport(hfd.TransportOptions{})
+	})
+
+	if err := configureHTTP(&Config{Headers: []string{"X-Trace: run-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("warned about a plain header: %s", out.String())
+	}
+	if err := configureHTTP(&Config{Headers: []string{"authorization: Basic Z2F0ZXdheQ=="}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "--header sets Authorization") {
+		t.Fatalf("no warning for overriding Authorization, got %q", out.String())
+	}
+	if err := configureHTTP(&Config{Headers: []string{"missing the colon"}}); err == nil {
+		t.Fatal("malformed --header accepted")
+	}
+}
+
+func TestSetupLogger(t *testing.T) {
+	saved, stdout := logger, os.Stdout
+	t.Cleanup(func() { logger, os.Stdout = saved, stdout })
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = out
+
+	if err := setupLogger(&Config{LogLevel: "warn", LogFormat: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error")
+	got, _ := os.ReadFile(out.Name())
+	var levels []string
+	for _, line := range strings.Split(strings.TrimSpace(string(got)), "\n") {
+		var record struct{ Level, Msg string }
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		levels = append(levels, record.Level+" "+record.Msg)
+	}
+	if strings.Join(levels, ",") != "WARN warn,ERROR error" {
+		t.Fatalf("logged %q at warn level", levels)
+	}
+
+	for _, config := range []Config{{LogLevel: "loud"}, {LogFormat: "xml"}} {
+		if err := setupLogger(&config); err == nil {
+			t.Errorf("%+v accepted", config)
+		}
+	}
+}
+
+func TestDescribeFilters(t *testing.T) {
+	if got := describeFilters(&Config{}); got != "" {
+		t.Errorf("no filters described as %q", got)
+	}
+	config := &Config{Include: []string{"*.gguf"}, Exclude: []string{"old/*"}, Extensions: []string{"gguf", "json"}, MaxFiles: 3}
+	if got, want := describeFilters(config), "include *.gguf; exclude old/*; ext gguf,json; max files 3"; got != want {
+		t.Errorf("describeFilters = %q, want %q", got, want)
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	const token, secretKey = "hf_abcdefghijklmnop", "r2-secret-access-key"
+	config := Config{AuthToken: token, R2SecretKey: secretKey, UseR2: true, Branch: "main"}
+	result := &hfd.DownloadResult{
+		Revision: "main",
+		Commit:   "0123456789abcdef0123456789abcdef01234567",
+		Files:    4,
+		// A resumed transfer is listed twice but is one file
+		Transfers: []hfd.FileTransfer{
+			{Path: "model.safetensors", BytesDownloaded: 600, BytesUploaded: 600},
+			{Path: "model.safetensors", BytesDownloaded: 400, BytesUploaded: 400},
+			{Path: "config.json", BytesDownloaded: 24, BytesUploaded: 24},
+		},
+		BytesDownloaded: 1024,
+		BytesUploaded:   1024,
+	}
+	started := time.Now().Add(-90 * time.Second)
+	summary := newRunSummary(nil, result, hfd.DownloadOptions{Repo: "o/m", Branch: "main"}, config, started)
+	path := filepath.Join(t.TempDir(), "summary.json")
+	if err := writeRedactedJSON(path, summary, secretsOf(config, nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{token, secretKey} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("summary leaks %q:\n%s", secret, data)
+		}
+	}
+	var got struct {
+		Repo            string    `json:"repo"`
+		Revision        string    `json:"revision"`
+		Commit          string    `json:"commit"`
+		Backend         string    `json:"backend"`
+		OK              bool      `json:"ok"`
+		Error           *string   `json:"error"`
+		ExitCode        int       `json:"exit_code"`
+		StartedAt       time.Time `json:"started_at"`
+		FinishedAt      time.Time `json:"finished_at"`
+		Duration        float64   `json:"duration_seconds"`
+		Files           int       `json:"files"`
+		Downloaded      int       `json:"files_downloaded"`
+		Skipped         int       `json:"files_skipped"`
+		Failed          int       `json:"files_failed"`
+		BytesDownloaded int64     `json:"bytes_downloaded"`
+		BytesUploaded   int64     `json:"bytes_uploaded"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Repo != "o/m" || got.Revision != "main" || got.Commit != result.Commit || got.Backend != "local+r2" {
+		t.Errorf("identity fields wrong: %+v", got)
+	}
+	if !got.OK || got.Error != nil || got.ExitCode != 0 {
+		t.Errorf("successful run reported as ok %v, error %v, exit code %d", got.OK, got.Error, got.ExitCode)
+	}
+	if got.Files != 4 || got.Downloaded != 2 || got.Skipped != 2 || got.Failed != 0 {
+		t.Errorf("counts: %d files, %d downloaded, %d skipped, %d failed; want 4, 2, 2, 0", got.Files, got.Downloaded, got.Skipped, got.Failed)
+	}
+	if got.BytesDownloaded != 1024 || got.BytesUploaded != 1024 {
+		t.Errorf("bytes: %d down, %d up", got.BytesDownloaded, got.BytesUploaded)
+	}
+	if !got.StartedAt.Equal(started.UTC()) || got.Duration < 90 || got.FinishedAt.Before(got.StartedAt) {
+		t.Errorf("timing: started %s, finished %s, %.1fs", got.StartedAt, got.FinishedAt, got.Duration)
+	}
+
+	config.SkipLocal = true
+	if got := backendOf(config); got != "r2" {
+		t.Errorf("backend with skip-local = %q, want r2", got)
+	}
+	if got := backendOf(Config{}); got != "local" {
+		t.Errorf("backend without uploads = %q, want local", got)
+	}
+}
+
+func TestInterruptContextCancelsOnSignal(t *testing.T) {
+	var out bytes.Buffer
+	previous := logger
+	logger = slog.New(hfd.NewPlainHandler(&out, nil))
+	defer func() { logger = previous }()
+
+	ctx, stop := interruptContext("checks")
+	defer stop()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGINT did not cancel the context")
+	}
+	if !strings.Contains(out.String(), "finishing in-flight checks") {
+		t.Fatalf("shutdown not logged: %q", out.String())
+	}
+}